@@ -277,6 +277,49 @@ func BenchmarkClosureComplexDataTypes(b *testing.B) {
 	}
 }
 
+// BenchmarkClosureComplexDataTypesCallbacks benchmarks closures building
+// complex data types through the callbacks of builtin functions, each run in
+// its own VM like the calls of BenchmarkClosureComplexDataTypes.
+func BenchmarkClosureComplexDataTypesCallbacks(b *testing.B) {
+	script := tengo.NewScript([]byte(`
+		global_map := {a: 1, b: 2, c: 3}
+
+		make_processor := func(local_data) {
+			return func(param) {
+				return map_values(global_map, func(v) {
+					return {value: v, local_data: local_data, param: param}
+				})
+			}
+		}
+
+		processor := make_processor({x: 10, y: 20})
+	`))
+
+	compiled, err := script.Compile()
+	if err != nil {
+		b.Fatalf("compile error: %v", err)
+	}
+
+	err = compiled.Run()
+	if err != nil {
+		b.Fatalf("run error: %v", err)
+	}
+
+	processorFn := compiled.Get("processor").Value().(*tengo.CompiledFunction)
+	ctx := tengo.NewExecutionContext(compiled)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		for i := 0; i < 1000; i++ {
+			_, err := ctx.Call(processorFn, &tengo.String{Value: "test"})
+			if err != nil {
+				b.Fatalf("call error: %v", err)
+			}
+		}
+	}
+}
+
 // BenchmarkBasicFunctionCall benchmarks basic function calls (baseline).
 func BenchmarkBasicFunctionCall(b *testing.B) {
 	script := tengo.NewScript([]byte(`
@@ -303,3 +346,93 @@ func BenchmarkBasicFunctionCall(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkExecutionContextGlobals benchmarks reading a single global through
+// a copy of all globals.
+func BenchmarkExecutionContextGlobals(b *testing.B) {
+	ctx := benchmarkGlobalsContext(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if ctx.Globals()[0] == nil {
+			b.Fatal("unexpected nil global")
+		}
+	}
+}
+
+// BenchmarkExecutionContextGlobalAt benchmarks reading a single global
+// without copying the globals.
+func BenchmarkExecutionContextGlobalAt(b *testing.B) {
+	ctx := benchmarkGlobalsContext(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		g, err := ctx.GlobalAt(0)
+		if err != nil || g == nil {
+			b.Fatalf("unexpected global: %v, %v", g, err)
+		}
+	}
+}
+
+func benchmarkGlobalsContext(b *testing.B) *tengo.ExecutionContext {
+	script := tengo.NewScript([]byte(`
+		counter := 0
+		name := "bench"
+		items := [1, 2, 3]
+	`))
+
+	compiled, err := script.Compile()
+	if err != nil {
+		b.Fatalf("compile error: %v", err)
+	}
+	if err := compiled.Run(); err != nil {
+		b.Fatalf("run error: %v", err)
+	}
+	return tengo.NewExecutionContext(compiled)
+}
+
+// BenchmarkClosureGlobalLoop benchmarks a closure that reads and writes
+// globals in a hot loop, called through an ExecutionContext whose globals
+// were replaced with WithGlobals.
+func BenchmarkClosureGlobalLoop(b *testing.B) {
+	script := tengo.NewScript([]byte(`
+		step := 1
+		scale := 2
+		total := 0
+
+		accumulate := func(n) {
+			for i := 0; i < n; i++ {
+				total += step * scale
+			}
+			return total
+		}
+	`))
+
+	compiled, err := script.Compile()
+	if err != nil {
+		b.Fatalf("compile error: %v", err)
+	}
+
+	err = compiled.Run()
+	if err != nil {
+		b.Fatalf("run error: %v", err)
+	}
+
+	accumulateFn := compiled.Get("accumulate").Value().(*tengo.CompiledFunction)
+	ctx := tengo.NewExecutionContext(compiled)
+	ctx = ctx.WithGlobals(ctx.Globals())
+	n := &tengo.Int{Value: 1000}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := ctx.Call(accumulateFn, n)
+		if err != nil {
+			b.Fatalf("call error: %v", err)
+		}
+	}
+}
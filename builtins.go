@@ -1,5 +1,112 @@
 package tengo
 
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tiagoj/tengo/v2/token"
+)
+
+// builtinApplyFunc is recognized by the VM, which turns apply(fn, args) into
+// a regular call of fn. It gets its values in init, as builtinApply calls back
+// into the VM, which refers to it.
+var builtinApplyFunc = &BuiltinFunction{
+	Name: "apply",
+}
+
+func init() {
+	builtinApplyFunc.Value = func(args ...Object) (Object, error) {
+		return builtinApply(nil, args...)
+	}
+	builtinApplyFunc.vmValue = builtinApply
+}
+
+// The functions below get their values in init, as they call back into the
+// VM, which refers to builtinFuncs.
+var (
+	builtinMemoizeFunc = &BuiltinFunction{
+		Name: "memoize",
+	}
+	builtinGroupByFunc = &BuiltinFunction{
+		Name: "group_by",
+	}
+	builtinTryFunc = &BuiltinFunction{
+		Name: "try",
+	}
+	builtinPartialFunc = &BuiltinFunction{
+		Name: "partial",
+	}
+	builtinPipeFunc = &BuiltinFunction{
+		Name: "pipe",
+	}
+	builtinComposeFunc = &BuiltinFunction{
+		Name: "compose",
+	}
+	builtinRetryFunc = &BuiltinFunction{
+		Name: "retry",
+	}
+	builtinMapValuesFunc = &BuiltinFunction{
+		Name: "map_values",
+	}
+	builtinMapKeysFunc = &BuiltinFunction{
+		Name: "map_keys",
+	}
+	builtinUniqueByFunc = &BuiltinFunction{
+		Name: "unique_by",
+	}
+	builtinCurryFunc = &BuiltinFunction{
+		Name: "curry",
+	}
+	builtinTimeitFunc = &BuiltinFunction{
+		Name: "timeit",
+	}
+)
+
+func init() {
+	builtinMemoizeFunc.Value = builtinMemoize
+	builtinGroupByFunc.Value = func(args ...Object) (Object, error) {
+		return builtinGroupBy(nil, args...)
+	}
+	builtinGroupByFunc.vmValue = builtinGroupBy
+	builtinTryFunc.Value = func(args ...Object) (Object, error) {
+		return builtinTry(nil, args...)
+	}
+	builtinTryFunc.vmValue = builtinTry
+	builtinPartialFunc.Value = builtinPartial
+	builtinPipeFunc.Value = builtinPipe
+	builtinComposeFunc.Value = builtinCompose
+	builtinRetryFunc.Value = func(args ...Object) (Object, error) {
+		return builtinRetry(nil, args...)
+	}
+	builtinRetryFunc.vmValue = builtinRetry
+	builtinMapValuesFunc.Value = func(args ...Object) (Object, error) {
+		return builtinMapValues(nil, args...)
+	}
+	builtinMapValuesFunc.vmValue = builtinMapValues
+	builtinMapKeysFunc.Value = func(args ...Object) (Object, error) {
+		return builtinMapKeys(nil, args...)
+	}
+	builtinMapKeysFunc.vmValue = builtinMapKeys
+	builtinUniqueByFunc.Value = func(args ...Object) (Object, error) {
+		return builtinUniqueBy(nil, args...)
+	}
+	builtinUniqueByFunc.vmValue = builtinUniqueBy
+	builtinCurryFunc.Value = builtinCurry
+	builtinTimeitFunc.Value = func(args ...Object) (Object, error) {
+		return builtinTimeit(nil, args...)
+	}
+	builtinTimeitFunc.vmValue = builtinTimeit
+}
+
 var builtinFuncs = []*BuiltinFunction{
 	{
 		Name:  "len",
@@ -125,6 +232,181 @@ var builtinFuncs = []*BuiltinFunction{
 		Name:  "range",
 		Value: builtinRange,
 	},
+	{
+		Name:    "log",
+		Value:   func(args ...Object) (Object, error) { return builtinLog(nil, args...) },
+		vmValue: builtinLog,
+	},
+	builtinApplyFunc,
+	{
+		Name:    "assert",
+		Value:   func(args ...Object) (Object, error) { return builtinAssert(nil, args...) },
+		vmValue: builtinAssert,
+	},
+	{
+		Name:  "zip",
+		Value: builtinZip,
+	},
+	{
+		Name:  "enumerate",
+		Value: builtinEnumerate,
+	},
+	{
+		Name:    "coroutine",
+		Value:   func(args ...Object) (Object, error) { return builtinCoroutine(nil, args...) },
+		vmValue: builtinCoroutine,
+	},
+	builtinMemoizeFunc,
+	{
+		Name:    "range_array",
+		Value:   func(args ...Object) (Object, error) { return builtinRangeArray(nil, args...) },
+		vmValue: builtinRangeArray,
+	},
+	{
+		Name:  "keys_sorted",
+		Value: builtinKeysSorted,
+	},
+	{
+		Name:  "values_sorted",
+		Value: builtinValuesSorted,
+	},
+	builtinGroupByFunc,
+	builtinTryFunc,
+	{
+		Name:    "ctx_value",
+		Value:   func(args ...Object) (Object, error) { return builtinCtxValue(nil, args...) },
+		vmValue: builtinCtxValue,
+	},
+	builtinPartialFunc,
+	{
+		Name:  "sum",
+		Value: builtinSum,
+	},
+	{
+		Name:  "min",
+		Value: builtinMin,
+	},
+	{
+		Name:  "max",
+		Value: builtinMax,
+	},
+	{
+		Name:  "avg",
+		Value: builtinAvg,
+	},
+	{
+		Name:  "format_map",
+		Value: builtinFormatMap,
+	},
+	{
+		Name:  "deep_equal",
+		Value: builtinDeepEqual,
+	},
+	builtinPipeFunc,
+	builtinComposeFunc,
+	builtinRetryFunc,
+	builtinMapValuesFunc,
+	builtinMapKeysFunc,
+	{
+		Name:  "panic",
+		Value: builtinPanic,
+	},
+	{
+		Name:    "recover",
+		Value:   func(args ...Object) (Object, error) { return builtinRecover(nil, args...) },
+		vmValue: builtinRecover,
+	},
+	{
+		Name:  "to_json",
+		Value: builtinToJSON,
+	},
+	{
+		Name:  "from_json",
+		Value: builtinFromJSON,
+	},
+	{
+		Name:  "unique",
+		Value: builtinUnique,
+	},
+	builtinUniqueByFunc,
+	{
+		Name:  "clamp",
+		Value: builtinClamp,
+	},
+	{
+		Name:  "sign",
+		Value: builtinSign,
+	},
+	{
+		Name:  "abs",
+		Value: builtinAbs,
+	},
+	{
+		Name:  "round",
+		Value: builtinRound,
+	},
+	{
+		Name:  "frequencies",
+		Value: builtinFrequencies,
+	},
+	{
+		Name:  "to_bytes",
+		Value: builtinToBytes,
+	},
+	{
+		Name:  "from_bytes",
+		Value: builtinFromBytes,
+	},
+	{
+		Name:  "float_to_bytes",
+		Value: builtinFloatToBytes,
+	},
+	{
+		Name:  "bytes_to_float",
+		Value: builtinBytesToFloat,
+	},
+	{
+		Name:  "merge",
+		Value: builtinMerge,
+	},
+	{
+		Name:  "sprintf",
+		Value: builtinSprintf,
+	},
+	{
+		Name:  "sort_by_key",
+		Value: builtinSortByKey,
+	},
+	{
+		Name:  "format_table",
+		Value: builtinFormatTable,
+	},
+	{
+		Name:  "split_lines",
+		Value: builtinSplitLines,
+	},
+	{
+		Name:  "join_lines",
+		Value: builtinJoinLines,
+	},
+	{
+		Name:  "parse_query",
+		Value: builtinParseQuery,
+	},
+	{
+		Name:  "build_query",
+		Value: builtinBuildQuery,
+	},
+	builtinCurryFunc,
+	builtinTimeitFunc,
+	{
+		Name:  "default",
+		Value: builtinDefault,
+	},
+	{
+		Name:  "coalesce",
+		Value: builtinCoalesce,
+	},
 }
 
 // GetAllBuiltinFunctions returns all builtin function objects.
@@ -203,7 +485,8 @@ func builtinIsArray(args ...Object) (Object, error) {
 	if len(args) != 1 {
 		return nil, ErrWrongNumArguments
 	}
-	if _, ok := args[0].(*Array); ok {
+	switch args[0].(type) {
+	case *Array, *GoSlice:
 		return TrueValue, nil
 	}
 	return FalseValue, nil
@@ -223,7 +506,8 @@ func builtinIsMap(args ...Object) (Object, error) {
 	if len(args) != 1 {
 		return nil, ErrWrongNumArguments
 	}
-	if _, ok := args[0].(*Map); ok {
+	switch args[0].(type) {
+	case *Map, *GoMap:
 		return TrueValue, nil
 	}
 	return FalseValue, nil
@@ -269,6 +553,30 @@ func builtinIsUndefined(args ...Object) (Object, error) {
 	return FalseValue, nil
 }
 
+// default(x, fallback)
+func builtinDefault(args ...Object) (Object, error) {
+	if len(args) != 2 {
+		return nil, ErrWrongNumArguments
+	}
+	if args[0] == UndefinedValue {
+		return args[1], nil
+	}
+	return args[0], nil
+}
+
+// coalesce(a, b, ...)
+func builtinCoalesce(args ...Object) (Object, error) {
+	if len(args) < 1 {
+		return nil, ErrWrongNumArguments
+	}
+	for _, arg := range args {
+		if arg != UndefinedValue {
+			return arg, nil
+		}
+	}
+	return UndefinedValue, nil
+}
+
 func builtinIsFunction(args ...Object) (Object, error) {
 	if len(args) != 1 {
 		return nil, ErrWrongNumArguments
@@ -307,17 +615,21 @@ func builtinLen(args ...Object) (Object, error) {
 	}
 	switch arg := args[0].(type) {
 	case *Array:
-		return &Int{Value: int64(len(arg.Value))}, nil
+		return internInt(int64(len(arg.Value))), nil
 	case *ImmutableArray:
-		return &Int{Value: int64(len(arg.Value))}, nil
+		return internInt(int64(len(arg.Value))), nil
 	case *String:
-		return &Int{Value: int64(len(arg.Value))}, nil
+		return internInt(int64(len(arg.Value))), nil
 	case *Bytes:
-		return &Int{Value: int64(len(arg.Value))}, nil
+		return internInt(int64(len(arg.Value))), nil
 	case *Map:
-		return &Int{Value: int64(len(arg.Value))}, nil
+		return internInt(int64(len(arg.Value))), nil
 	case *ImmutableMap:
-		return &Int{Value: int64(len(arg.Value))}, nil
+		return internInt(int64(len(arg.Value))), nil
+	case *GoMap:
+		return internInt(int64(len(arg.Value))), nil
+	case *GoSlice:
+		return internInt(int64(len(arg.Value))), nil
 	default:
 		return nil, ErrInvalidArgumentType{
 			Name:     "first",
@@ -329,14 +641,44 @@ func builtinLen(args ...Object) (Object, error) {
 
 // range(start, stop[, step])
 func builtinRange(args ...Object) (Object, error) {
+	start, stop, step, err := rangeArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	return buildRange(start, stop, step), nil
+}
+
+// builtinRangeArray is like builtinRange, but it checks the number of
+// elements against the object allocation limit of the VM before building the
+// array.
+func builtinRangeArray(v *VM, args ...Object) (Object, error) {
+	start, stop, step, err := rangeArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	if v != nil && v.maxAllocs >= 0 {
+		n := rangeLen(start, stop, step)
+		if n >= uint64(v.allocs) {
+			return nil, ErrObjectAllocLimit
+		}
+		v.allocs -= int64(n)
+	}
+	return buildRange(start, stop, step), nil
+}
+
+// rangeArgs validates the arguments of range: start, stop and an optional
+// non-zero step, which defaults to 1. The values count towards stop: a
+// positive step is the distance between them, and a negative step is only
+// valid if start is not less than stop. It returns the distance between the
+// values.
+func rangeArgs(args []Object) (start, stop int64, step uint64, err error) {
 	numArgs := len(args)
 	if numArgs < 2 || numArgs > 3 {
-		return nil, ErrWrongNumArguments
+		return 0, 0, 0, ErrWrongNumArguments
 	}
-	var start, stop, step *Int
-
+	step = 1
 	for i, arg := range args {
-		v, ok := args[i].(*Int)
+		v, ok := arg.(*Int)
 		if !ok {
 			var name string
 			switch i {
@@ -348,46 +690,59 @@ func builtinRange(args ...Object) (Object, error) {
 				name = "step"
 			}
 
-			return nil, ErrInvalidArgumentType{
+			return 0, 0, 0, ErrInvalidArgumentType{
 				Name:     name,
 				Expected: "int",
 				Found:    arg.TypeName(),
 			}
 		}
-		if i == 2 && v.Value <= 0 {
-			return nil, ErrInvalidRangeStep
-		}
 		switch i {
 		case 0:
-			start = v
+			start = v.Value
 		case 1:
-			stop = v
+			stop = v.Value
 		case 2:
-			step = v
+			switch {
+			case v.Value == 0:
+				return 0, 0, 0, ErrInvalidRangeStep
+			case v.Value < 0 && start < stop:
+				return 0, 0, 0, ErrRangeStepDirection
+			case v.Value < 0:
+				step = uint64(-v.Value)
+			default:
+				step = uint64(v.Value)
+			}
 		}
 	}
+	return start, stop, step, nil
+}
 
-	if step == nil {
-		step = &Int{Value: int64(1)}
+// rangeLen returns the number of values of a range.
+func rangeLen(start, stop int64, step uint64) uint64 {
+	var dist uint64
+	if start <= stop {
+		dist = uint64(stop - start)
+	} else {
+		dist = uint64(start - stop)
 	}
-
-	return buildRange(start.Value, stop.Value, step.Value), nil
+	n := dist / step
+	if dist%step != 0 {
+		n++
+	}
+	return n
 }
 
-func buildRange(start, stop, step int64) *Array {
+func buildRange(start, stop int64, step uint64) *Array {
 	array := &Array{}
-	if start <= stop {
-		for i := start; i < stop; i += step {
-			array.Value = append(array.Value, &Int{
-				Value: i,
-			})
-		}
-	} else {
-		for i := start; i > stop; i -= step {
-			array.Value = append(array.Value, &Int{
-				Value: i,
-			})
+	n := rangeLen(start, stop, step)
+	for i := uint64(0); i < n; i++ {
+		value := start + int64(i*step)
+		if start > stop {
+			value = start - int64(i*step)
 		}
+		array.Value = append(array.Value, &Int{
+			Value: value,
+		})
 	}
 	return array
 }
@@ -416,6 +771,29 @@ func builtinFormat(args ...Object) (Object, error) {
 	return &String{Value: s}, nil
 }
 
+// sprintf(format, args...)
+func builtinSprintf(args ...Object) (Object, error) {
+	if len(args) == 0 {
+		return nil, ErrWrongNumArguments
+	}
+	format, ok := args[0].(*String)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "format",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	s, err := formatStrict(format.Value, args[1:])
+	if err == ErrStringLimit {
+		return nil, err
+	}
+	if err != nil {
+		return &Error{Value: &String{Value: err.Error()}}, nil
+	}
+	return &String{Value: s}, nil
+}
+
 func builtinCopy(args ...Object) (Object, error) {
 	if len(args) != 1 {
 		return nil, ErrWrongNumArguments
@@ -678,3 +1056,2102 @@ func builtinSplice(args ...Object) (Object, error) {
 	// return deleted items
 	return &Array{Value: deleted}, nil
 }
+
+// builtinAssert returns ErrAssertionFailed if the condition is falsy.
+func builtinAssert(v *VM, args ...Object) (Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, ErrWrongNumArguments
+	}
+	if !args[0].IsFalsy() {
+		return UndefinedValue, nil
+	}
+	var err ErrAssertionFailed
+	if len(args) == 2 {
+		msg, ok := ToString(args[1])
+		if !ok {
+			return nil, ErrInvalidArgumentType{
+				Name:     "second",
+				Expected: "string(compatible)",
+				Found:    args[1].TypeName(),
+			}
+		}
+		err.Message = msg
+	}
+	if v != nil {
+		err.Pos = v.sourcePosition(v.curFrame.fn.SourcePos(v.ip))
+	}
+	return nil, err
+}
+
+// builtinLog routes a log event to the logger of the ExecutionContext the VM
+// is running on behalf of. It is a no-op when no logger is available.
+func builtinLog(v *VM, args ...Object) (Object, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, ErrWrongNumArguments
+	}
+	level, ok := args[0].(*String)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	msg, ok := args[1].(*String)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "string",
+			Found:    args[1].TypeName(),
+		}
+	}
+	var fields map[string]Object
+	if len(args) == 3 {
+		switch arg := args[2].(type) {
+		case *Map:
+			fields = arg.Value
+		case *ImmutableMap:
+			fields = arg.Value
+		case *Undefined:
+		default:
+			return nil, ErrInvalidArgumentType{
+				Name:     "third",
+				Expected: "map",
+				Found:    args[2].TypeName(),
+			}
+		}
+	}
+	if v == nil || v.ctx == nil || v.ctx.logger == nil {
+		return UndefinedValue, nil
+	}
+
+	// hand out copies so the host cannot observe later script mutations
+	copied := make(map[string]Object, len(fields))
+	for key, value := range fields {
+		copied[key] = value.Copy()
+	}
+	v.ctx.logger(level.Value, msg.Value, copied)
+	return UndefinedValue, nil
+}
+
+// builtinApply calls fn with the elements of an array as its arguments. Calls
+// made by the VM are rewritten in place; this function serves the other ones,
+// e.g. when apply is passed as a callback, running compiled functions through
+// v.Call.
+func builtinApply(v *VM, args ...Object) (Object, error) {
+	fn, items, err := applyArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	return v.Call(fn, items...)
+}
+
+func applyArgs(args []Object) (fn Object, items []Object, err error) {
+	if len(args) != 2 {
+		return nil, nil, ErrWrongNumArguments
+	}
+	if !args[0].CanCall() {
+		return nil, nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "callable",
+			Found:    args[0].TypeName(),
+		}
+	}
+	items, ok := arrayElements(args[1])
+	if !ok {
+		return nil, nil, ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "array",
+			Found:    args[1].TypeName(),
+		}
+	}
+	return args[0], items, nil
+}
+
+// builtinZip returns an array of pairs of the elements of two arrays, up to
+// the length of the shorter one.
+func builtinZip(args ...Object) (Object, error) {
+	if len(args) != 2 {
+		return nil, ErrWrongNumArguments
+	}
+	a, ok := arrayElements(args[0])
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "array",
+			Found:    args[0].TypeName(),
+		}
+	}
+	b, ok := arrayElements(args[1])
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "array",
+			Found:    args[1].TypeName(),
+		}
+	}
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	pairs := make([]Object, n)
+	for i := 0; i < n; i++ {
+		pairs[i] = &Array{Value: []Object{a[i], b[i]}}
+	}
+	return &Array{Value: pairs}, nil
+}
+
+// builtinEnumerate returns an array of [index, element] pairs.
+func builtinEnumerate(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	elems, ok := arrayElements(args[0])
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "array",
+			Found:    args[0].TypeName(),
+		}
+	}
+	pairs := make([]Object, len(elems))
+	for i, elem := range elems {
+		pairs[i] = &Array{Value: []Object{&Int{Value: int64(i)}, elem}}
+	}
+	return &Array{Value: pairs}, nil
+}
+
+func arrayElements(o Object) ([]Object, bool) {
+	switch o := o.(type) {
+	case *Array:
+		return o.Value, true
+	case *ImmutableArray:
+		return o.Value, true
+	case *GoSlice:
+		return o.elements(), true
+	}
+	return nil, false
+}
+
+// builtinCoroutine creates a Coroutine running the given compiled function
+// with the remaining arguments.
+func builtinCoroutine(v *VM, args ...Object) (Object, error) {
+	if len(args) < 1 {
+		return nil, ErrWrongNumArguments
+	}
+	fn, ok := args[0].(*CompiledFunction)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "compiled-function",
+			Found:    args[0].TypeName(),
+		}
+	}
+	if v == nil {
+		return nil, ErrNotImplemented
+	}
+	return newCoroutine(v, fn, args[1:])
+}
+
+// builtinMemoize returns a function that calls the given function and caches
+// its results by the arguments. Calls with arguments that cannot be used as a
+// cache key are passed through without caching.
+func builtinMemoize(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	fn := args[0]
+	if !fn.CanCall() {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "callable",
+			Found:    fn.TypeName(),
+		}
+	}
+	// the memoized function may be called by concurrent calls of an
+	// ExecutionContext; the lock isn't held while fn runs, so that fn can
+	// call it recursively
+	var lock sync.Mutex
+	cache := make(map[string]Object)
+	return &UserFunction{
+		Name: "memoized",
+		VMValue: func(v *VM, args ...Object) (Object, error) {
+			key, ok := memoizeKey(args)
+			if !ok {
+				return v.Call(fn, args...)
+			}
+			lock.Lock()
+			ret, ok := cache[key]
+			lock.Unlock()
+			if ok {
+				return ret, nil
+			}
+			ret, err := v.Call(fn, args...)
+			if err != nil {
+				return nil, err
+			}
+			lock.Lock()
+			cache[key] = ret
+			lock.Unlock()
+			return ret, nil
+		},
+	}, nil
+}
+
+// memoizeKey encodes the arguments into a cache key. It returns false if any
+// of the arguments is not an immutable scalar value.
+func memoizeKey(args []Object) (string, bool) {
+	var sb strings.Builder
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case *Int:
+			sb.WriteByte('i')
+			sb.WriteString(strconv.FormatInt(arg.Value, 10))
+		case *Float:
+			sb.WriteByte('f')
+			sb.WriteString(strconv.FormatUint(math.Float64bits(arg.Value), 16))
+		case *String:
+			sb.WriteByte('s')
+			sb.WriteString(strconv.Itoa(len(arg.Value)))
+			sb.WriteByte(':')
+			sb.WriteString(arg.Value)
+		case *Char:
+			sb.WriteByte('c')
+			sb.WriteString(strconv.FormatInt(int64(arg.Value), 10))
+		case *Bool:
+			if arg.IsFalsy() {
+				sb.WriteByte('F')
+			} else {
+				sb.WriteByte('T')
+			}
+		case *Undefined:
+			sb.WriteByte('u')
+		default:
+			return "", false
+		}
+		sb.WriteByte(',')
+	}
+	return sb.String(), true
+}
+
+// builtinKeysSorted returns the keys of a map in ascending order.
+func builtinKeysSorted(args ...Object) (Object, error) {
+	keys, _, err := sortedMapKeys(args)
+	if err != nil {
+		return nil, err
+	}
+	elements := make([]Object, len(keys))
+	for i, key := range keys {
+		elements[i] = &String{Value: key}
+	}
+	return &Array{Value: elements}, nil
+}
+
+// builtinValuesSorted returns the values of a map in the ascending order of
+// their keys.
+func builtinValuesSorted(args ...Object) (Object, error) {
+	keys, m, err := sortedMapKeys(args)
+	if err != nil {
+		return nil, err
+	}
+	elements := make([]Object, len(keys))
+	for i, key := range keys {
+		elements[i] = m[key]
+	}
+	return &Array{Value: elements}, nil
+}
+
+// sortedMapKeys returns the sorted keys and the entries of the map passed as
+// the only argument.
+func sortedMapKeys(args []Object) ([]string, map[string]Object, error) {
+	if len(args) != 1 {
+		return nil, nil, ErrWrongNumArguments
+	}
+	var m map[string]Object
+	switch arg := args[0].(type) {
+	case *Map:
+		m = arg.Value
+	case *ImmutableMap:
+		m = arg.Value
+	default:
+		return nil, nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "map",
+			Found:    args[0].TypeName(),
+		}
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, m, nil
+}
+
+// builtinGroupBy returns a map of the keys returned by the given function for
+// the elements of an array to arrays of the elements with that key. Keys must
+// be strings or ints, otherwise an error object is returned.
+func builtinGroupBy(v *VM, args ...Object) (Object, error) {
+	if len(args) != 2 {
+		return nil, ErrWrongNumArguments
+	}
+	elems, ok := arrayElements(args[0])
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "array",
+			Found:    args[0].TypeName(),
+		}
+	}
+	fn := args[1]
+	if !fn.CanCall() {
+		return nil, ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "callable",
+			Found:    fn.TypeName(),
+		}
+	}
+	groups := make(map[string]Object)
+	for _, elem := range elems {
+		ret, err := v.Call(fn, elem)
+		if err != nil {
+			return nil, err
+		}
+		var key string
+		switch ret := ret.(type) {
+		case *String:
+			key = ret.Value
+		case *Int:
+			key = strconv.FormatInt(ret.Value, 10)
+		default:
+			return &Error{Value: &String{
+				Value: "invalid group key: " + ret.TypeName(),
+			}}, nil
+		}
+		group, ok := groups[key].(*Array)
+		if !ok {
+			group = &Array{}
+			groups[key] = group
+		}
+		group.Value = append(group.Value, elem)
+	}
+	return &Map{Value: groups}, nil
+}
+
+// trappedError returns the error value standing for the runtime error of a
+// call trapped by try or retry.
+func trappedError(err error) *Error {
+	// drop the source positions appended to runtime errors
+	msg := err.Error()
+	if idx := strings.Index(msg, "\n\tat "); idx >= 0 {
+		msg = msg[:idx]
+	}
+	return &Error{Value: &String{Value: msg}}
+}
+
+// builtinTry calls the given function with the remaining arguments and
+// returns [result, undefined], or [undefined, error] if the call fails with a
+// runtime error or returns an error value. Exceeding the object allocation
+// limit is not trapped, so that scripts cannot ignore it.
+func builtinTry(v *VM, args ...Object) (Object, error) {
+	if len(args) < 1 {
+		return nil, ErrWrongNumArguments
+	}
+	fn := args[0]
+	if !fn.CanCall() {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "callable",
+			Found:    fn.TypeName(),
+		}
+	}
+	ret, err := v.Call(fn, args[1:]...)
+	if err != nil {
+		if errors.Is(err, ErrObjectAllocLimit) {
+			return nil, err
+		}
+		ret = trappedError(err)
+	}
+	if _, ok := ret.(*Error); ok {
+		return &Array{Value: []Object{UndefinedValue, ret}}, nil
+	}
+	return &Array{Value: []Object{ret, UndefinedValue}}, nil
+}
+
+// builtinTimeit calls the given function with the remaining arguments and
+// returns [result, duration], the duration being the wall-clock time of the
+// call in nanoseconds, measured with the monotonic clock. Errors of the call
+// are not trapped.
+func builtinTimeit(v *VM, args ...Object) (Object, error) {
+	if len(args) < 1 {
+		return nil, ErrWrongNumArguments
+	}
+	fn := args[0]
+	if !fn.CanCall() {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "callable",
+			Found:    fn.TypeName(),
+		}
+	}
+	start := time.Now()
+	ret, err := v.Call(fn, args[1:]...)
+	elapsed := time.Since(start)
+	if err != nil {
+		return nil, err
+	}
+	return &Array{Value: []Object{ret, &Int{Value: int64(elapsed)}}}, nil
+}
+
+// builtinCtxValue returns a copy of the value of the given key set with
+// ExecutionContext.WithValues, or undefined if there is none.
+func builtinCtxValue(v *VM, args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	key, ok := args[0].(*String)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	if v == nil || v.ctx == nil {
+		return UndefinedValue, nil
+	}
+	value, ok := v.ctx.values[key.Value]
+	if !ok || value == nil {
+		return UndefinedValue, nil
+	}
+	return value.Copy(), nil
+}
+
+// builtinPartial returns a function that calls the given function with the
+// given leading arguments followed by the arguments it's called with.
+func builtinPartial(args ...Object) (Object, error) {
+	if len(args) < 1 {
+		return nil, ErrWrongNumArguments
+	}
+	fn := args[0]
+	if !fn.CanCall() {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "callable",
+			Found:    fn.TypeName(),
+		}
+	}
+	bound := append([]Object{}, args[1:]...)
+	compiled, _ := fn.(*CompiledFunction)
+	if compiled != nil && !compiled.VarArgs &&
+		len(bound) > compiled.NumParameters {
+		return nil, ErrWrongNumArguments
+	}
+	return &UserFunction{
+		Name: "partial",
+		VMValue: func(v *VM, args ...Object) (Object, error) {
+			if compiled != nil {
+				// report the arity of the partial function
+				want := compiled.NumParameters - len(bound)
+				if compiled.VarArgs {
+					if want--; want > 0 && len(args) < want {
+						return nil, fmt.Errorf(
+							"wrong number of arguments: want>=%d, got=%d",
+							want, len(args))
+					}
+				} else if len(args) != want {
+					return nil, fmt.Errorf(
+						"wrong number of arguments: want=%d, got=%d",
+						want, len(args))
+				}
+			}
+			callArgs := make([]Object, 0, len(bound)+len(args))
+			callArgs = append(callArgs, bound...)
+			return v.Call(fn, append(callArgs, args...)...)
+		},
+	}, nil
+}
+
+// builtinCurry returns a function taking the first parameter of the given
+// compiled function, which returns a function taking the second one, and so
+// on until all the parameters are collected and the function is called.
+func builtinCurry(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	fn, ok := args[0].(*CompiledFunction)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "compiled-function",
+			Found:    args[0].TypeName(),
+		}
+	}
+	if fn.VarArgs {
+		return &Error{Value: &String{
+			Value: "cannot curry a function with a variadic parameter",
+		}}, nil
+	}
+	if fn.NumParameters == 0 {
+		return fn, nil
+	}
+	return curried(fn, nil), nil
+}
+
+// curried returns the function of curry taking the parameter of fn that
+// follows the collected arguments.
+func curried(fn *CompiledFunction, collected []Object) Object {
+	return &UserFunction{
+		Name: "curried",
+		VMValue: func(v *VM, args ...Object) (Object, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf(
+					"wrong number of arguments: want=1, got=%d", len(args))
+			}
+			callArgs := make([]Object, 0, len(collected)+1)
+			callArgs = append(append(callArgs, collected...), args[0])
+			if len(callArgs) < fn.NumParameters {
+				return curried(fn, callArgs), nil
+			}
+			return v.Call(fn, callArgs...)
+		},
+	}
+}
+
+// numericElements returns the elements of the array argument of the numeric
+// reducers and whether any of them is a float. If an element is not an int or
+// a float, it returns an error object to be returned to the script.
+func numericElements(args []Object) ([]Object, bool, Object, error) {
+	if len(args) != 1 {
+		return nil, false, nil, ErrWrongNumArguments
+	}
+	elems, ok := arrayElements(args[0])
+	if !ok {
+		return nil, false, nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "array",
+			Found:    args[0].TypeName(),
+		}
+	}
+	hasFloat := false
+	for _, elem := range elems {
+		switch elem.(type) {
+		case *Int:
+		case *Float:
+			hasFloat = true
+		default:
+			return nil, false, &Error{Value: &String{
+				Value: "non-numeric element: " + elem.TypeName(),
+			}}, nil
+		}
+	}
+	return elems, hasFloat, nil, nil
+}
+
+// toFloat64 converts an element returned by numericElements to float64.
+func toFloat64(o Object) float64 {
+	if i, ok := o.(*Int); ok {
+		return float64(i.Value)
+	}
+	return o.(*Float).Value
+}
+
+// sum(arr)
+func builtinSum(args ...Object) (Object, error) {
+	elems, hasFloat, errObj, err := numericElements(args)
+	if errObj != nil || err != nil {
+		return errObj, err
+	}
+	if hasFloat {
+		var sum float64
+		for _, elem := range elems {
+			sum += toFloat64(elem)
+		}
+		return &Float{Value: sum}, nil
+	}
+	var sum int64
+	for _, elem := range elems {
+		n := elem.(*Int).Value
+		if intOverflows(token.Add, sum, n) {
+			return nil, fmt.Errorf("%w: %d + %d", ErrIntOverflow, sum, n)
+		}
+		sum += n
+	}
+	return &Int{Value: sum}, nil
+}
+
+// min(arr)
+func builtinMin(args ...Object) (Object, error) {
+	return numericExtreme(args, -1)
+}
+
+// max(arr)
+func builtinMax(args ...Object) (Object, error) {
+	return numericExtreme(args, 1)
+}
+
+// numericExtreme returns the first smallest (want == -1) or greatest
+// (want == 1) element of the array argument, as a float if the array contains
+// any float.
+func numericExtreme(args []Object, want int) (Object, error) {
+	elems, hasFloat, errObj, err := numericElements(args)
+	if errObj != nil || err != nil {
+		return errObj, err
+	}
+	if len(elems) == 0 {
+		return &Error{Value: &String{Value: "empty array"}}, nil
+	}
+	res := elems[0]
+	for _, elem := range elems[1:] {
+		if compareNumbers(elem, res) == want {
+			res = elem
+		}
+	}
+	if hasFloat {
+		return &Float{Value: toFloat64(res)}, nil
+	}
+	return res, nil
+}
+
+// compareNumbers returns -1, 0 or 1 depending on whether the int or float a
+// is less than, equal to or greater than b. Ints are compared as ints to keep
+// their precision.
+func compareNumbers(a, b Object) int {
+	if a, ok := a.(*Int); ok {
+		if b, ok := b.(*Int); ok {
+			switch {
+			case a.Value < b.Value:
+				return -1
+			case a.Value > b.Value:
+				return 1
+			}
+			return 0
+		}
+	}
+	switch x, y := toFloat64(a), toFloat64(b); {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// avg(arr)
+func builtinAvg(args ...Object) (Object, error) {
+	elems, _, errObj, err := numericElements(args)
+	if errObj != nil || err != nil {
+		return errObj, err
+	}
+	if len(elems) == 0 {
+		return &Error{Value: &String{Value: "empty array"}}, nil
+	}
+	var sum float64
+	for _, elem := range elems {
+		sum += toFloat64(elem)
+	}
+	return &Float{Value: sum / float64(len(elems))}, nil
+}
+
+// numberArg returns the i-th argument if it's an int or a float.
+func numberArg(args []Object, i int, name string) (Object, error) {
+	switch args[i].(type) {
+	case *Int, *Float:
+		return args[i], nil
+	}
+	return nil, ErrInvalidArgumentType{
+		Name:     name,
+		Expected: "int/float",
+		Found:    args[i].TypeName(),
+	}
+}
+
+// clamp(n, lo, hi)
+func builtinClamp(args ...Object) (Object, error) {
+	if len(args) != 3 {
+		return nil, ErrWrongNumArguments
+	}
+	return Clamp(args[0], args[1], args[2])
+}
+
+// Clamp returns the number n limited to the range [lo, hi], as the builtin
+// function clamp does: the result is a float if any of the numbers is a
+// float, and an error object if lo is greater than hi. It returns
+// ErrInvalidArgumentType if any of them is not an int or a float.
+func Clamp(n, lo, hi Object) (Object, error) {
+	args := []Object{n, lo, hi}
+	allInts := true
+	for i, name := range []string{"first", "second", "third"} {
+		if _, err := numberArg(args, i, name); err != nil {
+			return nil, err
+		}
+		if _, ok := args[i].(*Int); !ok {
+			allInts = false
+		}
+	}
+	if compareNumbers(lo, hi) > 0 {
+		return &Error{Value: &String{
+			Value: "invalid range: " + lo.String() + " > " + hi.String(),
+		}}, nil
+	}
+	if compareNumbers(n, lo) < 0 {
+		n = lo
+	} else if compareNumbers(n, hi) > 0 {
+		n = hi
+	}
+	if !allInts {
+		return &Float{Value: toFloat64(n)}, nil
+	}
+	return n, nil
+}
+
+// sign(n)
+func builtinSign(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	n, err := numberArg(args, 0, "first")
+	if err != nil {
+		return nil, err
+	}
+	return &Int{Value: int64(compareNumbers(n, &Int{}))}, nil
+}
+
+// abs(n)
+func builtinAbs(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	n, err := numberArg(args, 0, "first")
+	if err != nil {
+		return nil, err
+	}
+	switch n := n.(type) {
+	case *Int:
+		if n.Value == math.MinInt64 {
+			return nil, fmt.Errorf("%w: abs(%d)", ErrIntOverflow, n.Value)
+		}
+		if n.Value < 0 {
+			return &Int{Value: -n.Value}, nil
+		}
+		return n, nil
+	default:
+		return &Float{Value: math.Abs(n.(*Float).Value)}, nil
+	}
+}
+
+// round(n[, places])
+func builtinRound(args ...Object) (Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, ErrWrongNumArguments
+	}
+	n, err := numberArg(args, 0, "first")
+	if err != nil {
+		return nil, err
+	}
+	var places int64
+	if len(args) == 2 {
+		p, ok := args[1].(*Int)
+		if !ok {
+			return nil, ErrInvalidArgumentType{
+				Name:     "second",
+				Expected: "int",
+				Found:    args[1].TypeName(),
+			}
+		}
+		places = p.Value
+	}
+	if i, ok := n.(*Int); ok {
+		if places >= 0 {
+			return i, nil
+		}
+		return roundInt(i.Value, -places)
+	}
+	return &Float{Value: roundFloat(n.(*Float).Value, places)}, nil
+}
+
+// roundFloat rounds f to the given number of decimal places, or to a power of
+// ten if places is negative, rounding halfway values to even.
+func roundFloat(f float64, places int64) float64 {
+	switch {
+	case math.IsInf(f, 0) || math.IsNaN(f):
+		return f
+	case places > 350:
+		// beyond the precision of the smallest float
+		return f
+	case places >= 0:
+		// formatting rounds the exact binary value to even
+		r, _ := strconv.ParseFloat(
+			strconv.FormatFloat(f, 'f', int(places), 64), 64)
+		return r
+	case places < -308:
+		return math.Copysign(0, f)
+	}
+	p := math.Pow10(int(-places))
+	return math.RoundToEven(f/p) * p
+}
+
+// roundInt rounds n to a multiple of 10^k, rounding halfway values to even.
+func roundInt(n int64, k int64) (Object, error) {
+	if k > 19 {
+		return &Int{}, nil
+	}
+	m := uint64(n)
+	if n < 0 {
+		m = -m
+	}
+	p := uint64(1)
+	for i := int64(0); i < k; i++ {
+		p *= 10
+	}
+	q, r := m/p, m%p
+	if r > p-r || (r == p-r && q%2 == 1) {
+		q++
+	}
+	if q > math.MaxUint64/p {
+		return nil, ErrIntOverflow
+	}
+	m = q * p
+	if n < 0 {
+		if m > 1<<63 {
+			return nil, ErrIntOverflow
+		}
+		return &Int{Value: -int64(m)}, nil
+	}
+	if m > math.MaxInt64 {
+		return nil, ErrIntOverflow
+	}
+	return &Int{Value: int64(m)}, nil
+}
+
+// to_bytes(n, size, big_endian)
+func builtinToBytes(args ...Object) (Object, error) {
+	if len(args) != 3 {
+		return nil, ErrWrongNumArguments
+	}
+	n, ok := args[0].(*Int)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "int",
+			Found:    args[0].TypeName(),
+		}
+	}
+	size, err := byteSizeArg(args)
+	if err != nil {
+		return nil, err
+	}
+	order, err := byteOrderArg(args, 2, "third")
+	if err != nil {
+		return nil, err
+	}
+	if size.Value != 1 && size.Value != 2 && size.Value != 4 &&
+		size.Value != 8 {
+		return unsupportedSizeError(size.Value), nil
+	}
+	if bits := size.Value * 8; bits < 64 &&
+		(n.Value < -1<<(bits-1) || n.Value > 1<<bits-1) {
+		return &Error{Value: &String{
+			Value: fmt.Sprintf("%d does not fit in %d bytes",
+				n.Value, size.Value),
+		}}, nil
+	}
+	b := make([]byte, size.Value)
+	putUint(order, b, uint64(n.Value))
+	return &Bytes{Value: b}, nil
+}
+
+// from_bytes(bytes, signed, big_endian)
+func builtinFromBytes(args ...Object) (Object, error) {
+	if len(args) != 3 {
+		return nil, ErrWrongNumArguments
+	}
+	b, ok := args[0].(*Bytes)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "bytes",
+			Found:    args[0].TypeName(),
+		}
+	}
+	signed, ok := args[1].(*Bool)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "bool",
+			Found:    args[1].TypeName(),
+		}
+	}
+	order, err := byteOrderArg(args, 2, "third")
+	if err != nil {
+		return nil, err
+	}
+	size := len(b.Value)
+	if size != 1 && size != 2 && size != 4 && size != 8 {
+		return unsupportedSizeError(int64(size)), nil
+	}
+	u := getUint(order, b.Value)
+	if !signed.IsFalsy() {
+		// sign-extend the value to 64 bits
+		shift := 64 - 8*size
+		return &Int{Value: int64(u<<shift) >> shift}, nil
+	}
+	if u > math.MaxInt64 {
+		return &Error{Value: &String{
+			Value: fmt.Sprintf("%d overflows int", u),
+		}}, nil
+	}
+	return &Int{Value: int64(u)}, nil
+}
+
+// float_to_bytes(f, size, big_endian)
+func builtinFloatToBytes(args ...Object) (Object, error) {
+	if len(args) != 3 {
+		return nil, ErrWrongNumArguments
+	}
+	f, err := numberArg(args, 0, "first")
+	if err != nil {
+		return nil, err
+	}
+	size, err := byteSizeArg(args)
+	if err != nil {
+		return nil, err
+	}
+	order, err := byteOrderArg(args, 2, "third")
+	if err != nil {
+		return nil, err
+	}
+	var bits uint64
+	switch size.Value {
+	case 4:
+		bits = uint64(math.Float32bits(float32(toFloat64(f))))
+	case 8:
+		bits = math.Float64bits(toFloat64(f))
+	default:
+		return unsupportedFloatSizeError(size.Value), nil
+	}
+	b := make([]byte, size.Value)
+	putUint(order, b, bits)
+	return &Bytes{Value: b}, nil
+}
+
+// bytes_to_float(bytes, big_endian)
+func builtinBytesToFloat(args ...Object) (Object, error) {
+	if len(args) != 2 {
+		return nil, ErrWrongNumArguments
+	}
+	b, ok := args[0].(*Bytes)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "bytes",
+			Found:    args[0].TypeName(),
+		}
+	}
+	order, err := byteOrderArg(args, 1, "second")
+	if err != nil {
+		return nil, err
+	}
+	switch len(b.Value) {
+	case 4:
+		return &Float{
+			Value: float64(math.Float32frombits(uint32(getUint(order, b.Value)))),
+		}, nil
+	case 8:
+		return &Float{Value: math.Float64frombits(getUint(order, b.Value))}, nil
+	}
+	return unsupportedFloatSizeError(int64(len(b.Value))), nil
+}
+
+// byteSizeArg returns the second argument, giving a number of bytes.
+func byteSizeArg(args []Object) (*Int, error) {
+	size, ok := args[1].(*Int)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "int",
+			Found:    args[1].TypeName(),
+		}
+	}
+	return size, nil
+}
+
+// byteOrderArg returns the byte order selected by the big_endian argument at
+// index i.
+func byteOrderArg(args []Object, i int, name string) (binary.ByteOrder, error) {
+	bigEndian, ok := args[i].(*Bool)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     name,
+			Expected: "bool",
+			Found:    args[i].TypeName(),
+		}
+	}
+	if bigEndian.IsFalsy() {
+		return binary.LittleEndian, nil
+	}
+	return binary.BigEndian, nil
+}
+
+func unsupportedSizeError(size int64) Object {
+	return &Error{Value: &String{
+		Value: fmt.Sprintf("unsupported size: %d (want 1, 2, 4 or 8)", size),
+	}}
+}
+
+func unsupportedFloatSizeError(size int64) Object {
+	return &Error{Value: &String{
+		Value: fmt.Sprintf("unsupported float size: %d (want 4 or 8)", size),
+	}}
+}
+
+// putUint stores the low len(b) bytes of v in b, which holds 1, 2, 4 or 8
+// bytes.
+func putUint(order binary.ByteOrder, b []byte, v uint64) {
+	switch len(b) {
+	case 1:
+		b[0] = byte(v)
+	case 2:
+		order.PutUint16(b, uint16(v))
+	case 4:
+		order.PutUint32(b, uint32(v))
+	case 8:
+		order.PutUint64(b, v)
+	}
+}
+
+// getUint returns the unsigned value of b, which holds 1, 2, 4 or 8 bytes.
+func getUint(order binary.ByteOrder, b []byte) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(order.Uint16(b))
+	case 4:
+		return uint64(order.Uint32(b))
+	}
+	return order.Uint64(b)
+}
+
+// format_map(template, data[, strict])
+func builtinFormatMap(args ...Object) (Object, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, ErrWrongNumArguments
+	}
+	tmpl, ok := args[0].(*String)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	var data map[string]Object
+	switch arg := args[1].(type) {
+	case *Map:
+		data = arg.Value
+	case *ImmutableMap:
+		data = arg.Value
+	default:
+		return nil, ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "map",
+			Found:    arg.TypeName(),
+		}
+	}
+	strict := len(args) == 3 && !args[2].IsFalsy()
+
+	var sb strings.Builder
+	s := tmpl.Value
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case (c == '{' || c == '}') && i+1 < len(s) && s[i+1] == c:
+			// escaped brace
+			sb.WriteByte(c)
+			i++
+		case c == '{':
+			end := strings.IndexByte(s[i+1:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed '{' at offset %d in template", i)
+			}
+			key := s[i+1 : i+1+end]
+			value, ok := data[key]
+			if !ok && strict {
+				return &Error{Value: &String{Value: "missing key: " + key}}, nil
+			}
+			if ok {
+				str, _ := ToString(value)
+				sb.WriteString(str)
+			}
+			i += end + 1
+		case c == '}':
+			return nil, fmt.Errorf("unmatched '}' at offset %d in template", i)
+		default:
+			sb.WriteByte(c)
+		}
+		if sb.Len() > MaxStringLen {
+			return nil, ErrStringLimit
+		}
+	}
+	return &String{Value: sb.String()}, nil
+}
+
+// deep_equal(a, b)
+func builtinDeepEqual(args ...Object) (Object, error) {
+	if len(args) != 2 {
+		return nil, ErrWrongNumArguments
+	}
+	if deepEqual(args[0], args[1], make(map[[2]Object]bool)) {
+		return TrueValue, nil
+	}
+	return FalseValue, nil
+}
+
+// deepEqual compares a and b like Object.Equals, recursing into arrays and
+// maps. A pair of containers already being compared is considered equal,
+// which stops the recursion on cyclic values.
+func deepEqual(a, b Object, visited map[[2]Object]bool) bool {
+	aArr, aIsArr := arrayElements(a)
+	aMap, aIsMap := mapElements(a)
+	if !aIsArr && !aIsMap {
+		return a.Equals(b)
+	}
+	bArr, bIsArr := arrayElements(b)
+	bMap, bIsMap := mapElements(b)
+	if aIsArr != bIsArr || aIsMap != bIsMap {
+		return false
+	}
+
+	pair := [2]Object{a, b}
+	if visited[pair] {
+		return true
+	}
+	visited[pair] = true
+	if aIsMap {
+		if len(aMap) != len(bMap) {
+			return false
+		}
+		for k, v := range aMap {
+			w, ok := bMap[k]
+			if !ok || !deepEqual(v, w, visited) {
+				return false
+			}
+		}
+		return true
+	}
+	if len(aArr) != len(bArr) {
+		return false
+	}
+	for i, v := range aArr {
+		if !deepEqual(v, bArr[i], visited) {
+			return false
+		}
+	}
+	return true
+}
+
+// mapElements returns the entries of a map or an immutable map.
+func mapElements(o Object) (map[string]Object, bool) {
+	switch o := o.(type) {
+	case *Map:
+		return o.Value, true
+	case *ImmutableMap:
+		return o.Value, true
+	case *GoMap:
+		return o.entries(), true
+	}
+	return nil, false
+}
+
+// merge(base, override[, arrays])
+func builtinMerge(args ...Object) (Object, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, ErrWrongNumArguments
+	}
+	base, ok := mapElements(args[0])
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "map",
+			Found:    args[0].TypeName(),
+		}
+	}
+	override, ok := mapElements(args[1])
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "map",
+			Found:    args[1].TypeName(),
+		}
+	}
+	m := &mapMerger{merged: make(map[[2]Object]*Map)}
+	if len(args) == 3 {
+		mode, ok := args[2].(*String)
+		if !ok {
+			return nil, ErrInvalidArgumentType{
+				Name:     "third",
+				Expected: "string",
+				Found:    args[2].TypeName(),
+			}
+		}
+		switch mode.Value {
+		case "replace":
+		case "concat":
+			m.concat = true
+		default:
+			return &Error{Value: &String{
+				Value: fmt.Sprintf(
+					"invalid array mode: %q (want \"replace\" or \"concat\")",
+					mode.Value),
+			}}, nil
+		}
+	}
+	return m.merge(args[0], base, args[1], override), nil
+}
+
+// mapMerger deep-merges maps for builtinMerge. The merged maps are recorded
+// by the pair of maps they were merged from, so that merging a pair again, as
+// cyclic maps do, returns the map being built for it and the result keeps the
+// cycles.
+type mapMerger struct {
+	concat bool
+	merged map[[2]Object]*Map
+}
+
+// merge returns a new map holding the entries of a and b, merging the values
+// of the keys they share.
+func (m *mapMerger) merge(
+	a Object,
+	aMap map[string]Object,
+	b Object,
+	bMap map[string]Object,
+) *Map {
+	pair := [2]Object{a, b}
+	if res, ok := m.merged[pair]; ok {
+		return res
+	}
+	res := &Map{Value: make(map[string]Object, len(aMap)+len(bMap))}
+	m.merged[pair] = res
+	for k, v := range aMap {
+		res.Value[k] = v
+	}
+	for k, w := range bMap {
+		if v, ok := aMap[k]; ok {
+			w = m.mergeValues(v, w)
+		}
+		res.Value[k] = w
+	}
+	return res
+}
+
+// mergeValues returns the merge of the values of a key of both maps: maps are
+// merged, arrays are concatenated in concat mode, and w wins otherwise.
+func (m *mapMerger) mergeValues(v, w Object) Object {
+	if vMap, ok := mapElements(v); ok {
+		if wMap, ok := mapElements(w); ok {
+			return m.merge(v, vMap, w, wMap)
+		}
+	}
+	if m.concat {
+		vArr, vIsArr := arrayElements(v)
+		wArr, wIsArr := arrayElements(w)
+		if vIsArr && wIsArr {
+			elems := make([]Object, 0, len(vArr)+len(wArr))
+			elems = append(elems, vArr...)
+			return &Array{Value: append(elems, wArr...)}
+		}
+	}
+	return w
+}
+
+// sort_by_key(arr, key[, descending])
+func builtinSortByKey(args ...Object) (Object, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, ErrWrongNumArguments
+	}
+	elems, ok := arrayElements(args[0])
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "array",
+			Found:    args[0].TypeName(),
+		}
+	}
+	key, ok := args[1].(*String)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "string",
+			Found:    args[1].TypeName(),
+		}
+	}
+	var descending bool
+	if len(args) == 3 {
+		d, ok := args[2].(*Bool)
+		if !ok {
+			return nil, ErrInvalidArgumentType{
+				Name:     "third",
+				Expected: "bool",
+				Found:    args[2].TypeName(),
+			}
+		}
+		descending = !d.IsFalsy()
+	}
+
+	// look up the keys first, so that the records can't be sorted halfway
+	// before an error is found
+	keys := make([]Object, len(elems))
+	var numbers, strs bool
+	for i, elem := range elems {
+		record, ok := mapElements(elem)
+		if !ok {
+			return &Error{Value: &String{
+				Value: fmt.Sprintf("element %d is not a map: %s",
+					i, elem.TypeName()),
+			}}, nil
+		}
+		v, ok := record[key.Value]
+		if !ok || v == UndefinedValue {
+			continue
+		}
+		switch v.(type) {
+		case *Int, *Float:
+			numbers = true
+		case *String:
+			strs = true
+		default:
+			return &Error{Value: &String{
+				Value: fmt.Sprintf("unsupported key type in element %d: %s",
+					i, v.TypeName()),
+			}}, nil
+		}
+		keys[i] = v
+	}
+	if numbers && strs {
+		return &Error{Value: &String{
+			Value: "cannot compare numbers and strings",
+		}}, nil
+	}
+
+	order := make([]int, len(elems))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := keys[order[i]], keys[order[j]]
+		if descending {
+			a, b = b, a
+		}
+		return compareKeys(a, b) < 0
+	})
+	res := make([]Object, len(elems))
+	for i, idx := range order {
+		res[i] = elems[idx]
+	}
+	return &Array{Value: res}, nil
+}
+
+// compareKeys compares the keys of two records for builtinSortByKey. Missing
+// keys, which are nil, are less than any other key.
+func compareKeys(a, b Object) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	if a, ok := a.(*String); ok {
+		return strings.Compare(a.Value, b.(*String).Value)
+	}
+	return compareNumbers(a, b)
+}
+
+// format_table(rows[, header])
+func builtinFormatTable(args ...Object) (Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, ErrWrongNumArguments
+	}
+	rows, ok := arrayElements(args[0])
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "array",
+			Found:    args[0].TypeName(),
+		}
+	}
+	var cells [][]string
+	var widths []int
+	addRow := func(row []Object) {
+		line := make([]string, len(row))
+		for i, cell := range row {
+			line[i], _ = ToString(cell)
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(line[i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+		cells = append(cells, line)
+	}
+	if len(args) == 2 {
+		header, ok := arrayElements(args[1])
+		if !ok {
+			return nil, ErrInvalidArgumentType{
+				Name:     "second",
+				Expected: "array",
+				Found:    args[1].TypeName(),
+			}
+		}
+		addRow(header)
+	}
+	for i, row := range rows {
+		elems, ok := arrayElements(row)
+		if !ok {
+			return &Error{Value: &String{
+				Value: fmt.Sprintf("row %d is not an array: %s",
+					i, row.TypeName()),
+			}}, nil
+		}
+		addRow(elems)
+	}
+
+	var sep []string
+	if len(args) == 2 {
+		sep = make([]string, len(widths))
+		for j, w := range widths {
+			sep[j] = strings.Repeat("-", w)
+		}
+	}
+
+	// a few long cells make every line long, so the size is checked before
+	// the table is built
+	size := len(cells) - 1
+	for _, line := range cells {
+		size += tableLineLen(line, widths)
+	}
+	if sep != nil {
+		size += 1 + tableLineLen(sep, widths)
+	}
+	if size > MaxStringLen {
+		return nil, ErrStringLimit
+	}
+
+	lines := make([]string, 0, len(cells)+1)
+	for i, line := range cells {
+		lines = append(lines, tableLine(line, widths))
+		if i == 0 && sep != nil {
+			lines = append(lines, tableLine(sep, widths))
+		}
+	}
+	return &String{Value: strings.Join(lines, "\n")}, nil
+}
+
+// tableLine returns the cells of a row of format_table padded to the widths
+// of their columns, without trailing spaces. Missing cells are empty.
+func tableLine(cells []string, widths []int) string {
+	var sb strings.Builder
+	sb.Grow(tableLineLen(cells, widths))
+	for i, w := range widths {
+		var cell string
+		if i < len(cells) {
+			cell = cells[i]
+		}
+		if i > 0 {
+			sb.WriteString("  ")
+		}
+		sb.WriteString(cell)
+		sb.WriteString(strings.Repeat(" ", w-utf8.RuneCountInString(cell)))
+	}
+	return strings.TrimRight(sb.String(), " ")
+}
+
+// tableLineLen returns the length in bytes of the line tableLine returns.
+func tableLineLen(cells []string, widths []int) int {
+	var n, end int
+	for i, w := range widths {
+		var cell string
+		if i < len(cells) {
+			cell = cells[i]
+		}
+		if i > 0 {
+			n += 2
+		}
+		if trimmed := strings.TrimRight(cell, " "); trimmed != "" {
+			end = n + len(trimmed)
+		}
+		n += len(cell) + w - utf8.RuneCountInString(cell)
+	}
+	return end
+}
+
+// split_lines(s)
+func builtinSplitLines(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	s, ok := args[0].(*String)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	rest := s.Value
+	lines := make([]Object, 0, strings.Count(rest, "\n")+1)
+	for rest != "" {
+		line := rest
+		if i := strings.IndexByte(rest, '\n'); i >= 0 {
+			line = strings.TrimSuffix(rest[:i], "\r")
+			rest = rest[i+1:]
+		} else {
+			rest = ""
+		}
+		lines = append(lines, &String{Value: line})
+	}
+	return &Array{Value: lines}, nil
+}
+
+// join_lines(arr[, sep])
+func builtinJoinLines(args ...Object) (Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, ErrWrongNumArguments
+	}
+	elems, ok := arrayElements(args[0])
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "array",
+			Found:    args[0].TypeName(),
+		}
+	}
+	sep := "\n"
+	if len(args) == 2 {
+		s, ok := args[1].(*String)
+		if !ok {
+			return nil, ErrInvalidArgumentType{
+				Name:     "second",
+				Expected: "string",
+				Found:    args[1].TypeName(),
+			}
+		}
+		sep = s.Value
+	}
+	lines := make([]string, len(elems))
+	size := len(sep) * (len(elems) - 1)
+	for i, elem := range elems {
+		line, ok := ToString(elem)
+		if !ok {
+			return nil, ErrInvalidArgumentType{
+				Name:     fmt.Sprintf("first[%d]", i),
+				Expected: "string(compatible)",
+				Found:    elem.TypeName(),
+			}
+		}
+		lines[i] = line
+		size += len(line)
+	}
+	if size > MaxStringLen {
+		return nil, ErrStringLimit
+	}
+	return &String{Value: strings.Join(lines, sep)}, nil
+}
+
+// parse_query(s)
+func builtinParseQuery(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	s, ok := args[0].(*String)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	values, err := url.ParseQuery(strings.TrimPrefix(s.Value, "?"))
+	if err != nil {
+		return &Error{Value: &String{Value: err.Error()}}, nil
+	}
+	res := make(map[string]Object, len(values))
+	for key, vals := range values {
+		elems := make([]Object, len(vals))
+		for i, v := range vals {
+			elems[i] = &String{Value: v}
+		}
+		res[key] = &Array{Value: elems}
+	}
+	return &Map{Value: res}, nil
+}
+
+// build_query(m)
+func builtinBuildQuery(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	m, ok := mapElements(args[0])
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "map",
+			Found:    args[0].TypeName(),
+		}
+	}
+	values := make(url.Values, len(m))
+	for key, val := range m {
+		elems, ok := arrayElements(val)
+		if !ok {
+			elems = []Object{val}
+		}
+		for _, elem := range elems {
+			s, ok := ToString(elem)
+			if !ok {
+				return nil, ErrInvalidArgumentType{
+					Name:     fmt.Sprintf("first[%q]", key),
+					Expected: "string(compatible) or array",
+					Found:    elem.TypeName(),
+				}
+			}
+			values.Add(key, s)
+		}
+	}
+	res := values.Encode()
+	if len(res) > MaxStringLen {
+		return nil, ErrStringLimit
+	}
+	return &String{Value: res}, nil
+}
+
+// builtinPipe returns a function that passes its argument to the first given
+// function, the result to the second one, and so on, and returns the result
+// of the last one.
+func builtinPipe(args ...Object) (Object, error) {
+	return pipeFunctions("pipe", args, false)
+}
+
+// builtinCompose is like builtinPipe but calls the functions from the last
+// one to the first one: compose(f, g)(x) is f(g(x)).
+func builtinCompose(args ...Object) (Object, error) {
+	return pipeFunctions("compose", args, true)
+}
+
+// pipeFunctions returns a function threading a single value through args, in
+// order or in reverse order. With no functions, it returns its argument.
+func pipeFunctions(name string, args []Object, reverse bool) (Object, error) {
+	fns := make([]Object, len(args))
+	for i, fn := range args {
+		if !fn.CanCall() {
+			return nil, ErrInvalidArgumentType{
+				Name:     argumentName(i),
+				Expected: "callable",
+				Found:    fn.TypeName(),
+			}
+		}
+		if reverse {
+			fns[len(args)-1-i] = fn
+		} else {
+			fns[i] = fn
+		}
+	}
+	return &UserFunction{
+		Name: name,
+		VMValue: func(v *VM, args ...Object) (Object, error) {
+			if len(args) != 1 {
+				return nil, ErrWrongNumArguments
+			}
+			val := args[0]
+			for _, fn := range fns {
+				var err error
+				if val, err = v.Call(fn, val); err != nil {
+					return nil, err
+				}
+			}
+			return val, nil
+		},
+	}, nil
+}
+
+// argumentOrdinals are the names of the first arguments of a call.
+var argumentOrdinals = []string{
+	"first", "second", "third", "fourth", "fifth",
+	"sixth", "seventh", "eighth", "ninth", "tenth",
+}
+
+// argumentName returns the name of the argument at index i of a call, as
+// reported by ErrInvalidArgumentType: "first", "second", ..., then "11th",
+// "12th" and so on.
+func argumentName(i int) string {
+	if i < len(argumentOrdinals) {
+		return argumentOrdinals[i]
+	}
+	n := i + 1
+	suffix := "th"
+	if n%100 < 11 || n%100 > 13 {
+		switch n % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// builtinRetry calls the given function with the arguments following the
+// number of attempts until it neither fails with a runtime error nor returns
+// an error value, at most that number of times. It returns the first
+// successful result, or the error of the last attempt as an error value. Like
+// try, it doesn't trap the object allocation limit, and it stops retrying when
+// the script is aborted.
+func builtinRetry(v *VM, args ...Object) (Object, error) {
+	if len(args) < 2 {
+		return nil, ErrWrongNumArguments
+	}
+	fn := args[0]
+	if !fn.CanCall() {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "callable",
+			Found:    fn.TypeName(),
+		}
+	}
+	attempts, ok := args[1].(*Int)
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "int",
+			Found:    args[1].TypeName(),
+		}
+	}
+	if attempts.Value <= 0 {
+		return &Error{Value: &String{
+			Value: "invalid number of attempts: " +
+				strconv.FormatInt(attempts.Value, 10),
+		}}, nil
+	}
+	var ret Object
+	for i := int64(0); i < attempts.Value; i++ {
+		var err error
+		ret, err = v.Call(fn, args[2:]...)
+		if err != nil {
+			if errors.Is(err, ErrObjectAllocLimit) || v.IsAborted() {
+				return nil, err
+			}
+			ret = trappedError(err)
+		}
+		if _, ok := ret.(*Error); !ok {
+			return ret, nil
+		}
+	}
+	return ret, nil
+}
+
+// builtinMapValues returns a new map with the keys of the given map and the
+// values returned by the given function for its values. The function is
+// called in the order of the keys.
+func builtinMapValues(v *VM, args ...Object) (Object, error) {
+	keys, m, fn, err := mapCallbackArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]Object, len(keys))
+	for _, key := range keys {
+		val, err := v.Call(fn, m[key])
+		if err != nil {
+			return nil, err
+		}
+		res[key] = val
+	}
+	return &Map{Value: res}, nil
+}
+
+// builtinMapKeys returns a new map with the keys returned by the given
+// function for the keys of the given map, and the same values. Keys must be
+// strings or ints, and two keys mapping to the same key return an error
+// object rather than dropping one of the values.
+func builtinMapKeys(v *VM, args ...Object) (Object, error) {
+	keys, m, fn, err := mapCallbackArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]Object, len(keys))
+	for _, key := range keys {
+		ret, err := v.Call(fn, &String{Value: key})
+		if err != nil {
+			return nil, err
+		}
+		var newKey string
+		switch ret := ret.(type) {
+		case *String:
+			newKey = ret.Value
+		case *Int:
+			newKey = strconv.FormatInt(ret.Value, 10)
+		default:
+			return &Error{Value: &String{
+				Value: "invalid map key: " + ret.TypeName(),
+			}}, nil
+		}
+		if _, ok := res[newKey]; ok {
+			return &Error{Value: &String{
+				Value: "duplicate map key: " + newKey,
+			}}, nil
+		}
+		res[newKey] = m[key]
+	}
+	return &Map{Value: res}, nil
+}
+
+// mapCallbackArgs returns the sorted keys and the entries of the map and the
+// function passed to map_values and map_keys.
+func mapCallbackArgs(args []Object) ([]string, map[string]Object, Object, error) {
+	if len(args) != 2 {
+		return nil, nil, nil, ErrWrongNumArguments
+	}
+	keys, m, err := sortedMapKeys(args[:1])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	fn := args[1]
+	if !fn.CanCall() {
+		return nil, nil, nil, ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "callable",
+			Found:    fn.TypeName(),
+		}
+	}
+	return keys, m, fn, nil
+}
+
+// builtinPanic returns ErrPanic, which unwinds the frames of the script until
+// a deferred function recovers it.
+func builtinPanic(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	return nil, ErrPanic{Value: args[0]}
+}
+
+// builtinRecover stops the unwinding of a runtime error and returns the value
+// passed to panic, or the error as an error value. Like in Go, it only does
+// so when called directly by a deferred function run during the unwinding,
+// and returns undefined otherwise.
+func builtinRecover(v *VM, args ...Object) (Object, error) {
+	if len(args) != 0 {
+		return nil, ErrWrongNumArguments
+	}
+	if v == nil || v.caller == nil || v.framesIndex != 1 {
+		return UndefinedValue, nil
+	}
+	p := v.caller.panicking
+	if p == nil || p.recovered || p.fn != v.frames[0].fn {
+		return UndefinedValue, nil
+	}
+	p.recovered = true
+	var perr ErrPanic
+	if errors.As(p.err, &perr) {
+		return perr.Value, nil
+	}
+	return trappedError(p.err), nil
+}
+
+// jsonEncode and jsonDecode are the codec of the builtin functions to_json
+// and from_json, registered with SetJSONCodec.
+var (
+	jsonEncode func(o Object) ([]byte, error)
+	jsonDecode func(data []byte) (Object, error)
+)
+
+// errNoJSONCodec is the error of to_json and from_json when no codec has been
+// registered with SetJSONCodec.
+var errNoJSONCodec = errors.New("no JSON codec registered")
+
+// SetJSONCodec registers the functions the builtin functions to_json and
+// from_json use to encode and decode JSON. The json package of the standard
+// library registers its codec when it's linked into the program, so it's
+// only needed to replace it. SetJSONCodec must be called before running any
+// script, e.g. from an init function.
+func SetJSONCodec(
+	encode func(o Object) ([]byte, error),
+	decode func(data []byte) (Object, error),
+) {
+	jsonEncode = encode
+	jsonDecode = decode
+}
+
+// builtinToJSON returns the JSON encoding of its argument as a string, or an
+// error object if it holds values that can't be encoded, such as functions.
+func builtinToJSON(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	if jsonEncode == nil {
+		return nil, errNoJSONCodec
+	}
+	b, err := jsonEncode(args[0])
+	if err != nil {
+		return &Error{Value: &String{Value: err.Error()}}, nil
+	}
+	if len(b) > MaxStringLen {
+		return nil, ErrStringLimit
+	}
+	return &String{Value: string(b)}, nil
+}
+
+// builtinFromJSON returns the object a JSON string or bytes encodes, or an
+// error object if it's malformed.
+func builtinFromJSON(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	var data []byte
+	switch arg := args[0].(type) {
+	case *String:
+		data = []byte(arg.Value)
+	case *Bytes:
+		data = arg.Value
+	default:
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string/bytes",
+			Found:    args[0].TypeName(),
+		}
+	}
+	if jsonDecode == nil {
+		return nil, errNoJSONCodec
+	}
+	v, err := jsonDecode(data)
+	if err != nil {
+		return &Error{Value: &String{Value: err.Error()}}, nil
+	}
+	return v, nil
+}
+
+// builtinUnique returns a new array with the elements of the given array,
+// without duplicates, in the order of their first occurrence.
+func builtinUnique(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	elems, ok := arrayElements(args[0])
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "array",
+			Found:    args[0].TypeName(),
+		}
+	}
+	var seen uniqueSet
+	res := make([]Object, 0, len(elems))
+	for _, elem := range elems {
+		if seen.add(elem) {
+			res = append(res, elem)
+		}
+	}
+	return &Array{Value: res}, nil
+}
+
+// builtinUniqueBy returns a new array with the elements of the given array
+// for which the given function returns a key not returned for a previous
+// element.
+func builtinUniqueBy(v *VM, args ...Object) (Object, error) {
+	if len(args) != 2 {
+		return nil, ErrWrongNumArguments
+	}
+	elems, ok := arrayElements(args[0])
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "array",
+			Found:    args[0].TypeName(),
+		}
+	}
+	fn := args[1]
+	if !fn.CanCall() {
+		return nil, ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "callable",
+			Found:    fn.TypeName(),
+		}
+	}
+	var seen uniqueSet
+	res := make([]Object, 0, len(elems))
+	for _, elem := range elems {
+		key, err := v.Call(fn, elem)
+		if err != nil {
+			return nil, err
+		}
+		if seen.add(key) {
+			res = append(res, elem)
+		}
+	}
+	return &Array{Value: res}, nil
+}
+
+// builtinFrequencies returns a map of the number of occurrences of each
+// distinct element of the given array. Elements are keyed by their string
+// form, so elements of different types with the same string form, such as 1
+// and "1", are counted together. Elements other than scalars return an error
+// object.
+func builtinFrequencies(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	elems, ok := arrayElements(args[0])
+	if !ok {
+		return nil, ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "array",
+			Found:    args[0].TypeName(),
+		}
+	}
+	counts := make(map[string]int64)
+	for _, elem := range elems {
+		if _, ok := memoizeKey([]Object{elem}); !ok || elem == UndefinedValue {
+			return &Error{Value: &String{
+				Value: "unhashable element: " + elem.TypeName(),
+			}}, nil
+		}
+		key, _ := ToString(elem)
+		counts[key]++
+	}
+	res := make(map[string]Object, len(counts))
+	for key, n := range counts {
+		res[key] = &Int{Value: n}
+	}
+	return &Map{Value: res}, nil
+}
+
+// uniqueSet is a set of values compared by value. Scalars are looked up by
+// their memoizeKey, and other values, such as arrays and maps, are compared
+// with deepEqual against the other non-scalar values of the set.
+type uniqueSet struct {
+	keys   map[string]struct{}
+	others []Object
+}
+
+// add adds o to the set, and returns false if it was already in the set.
+func (s *uniqueSet) add(o Object) bool {
+	if key, ok := memoizeKey([]Object{o}); ok {
+		if _, ok := s.keys[key]; ok {
+			return false
+		}
+		if s.keys == nil {
+			s.keys = make(map[string]struct{})
+		}
+		s.keys[key] = struct{}{}
+		return true
+	}
+	for _, other := range s.others {
+		if deepEqual(o, other, make(map[[2]Object]bool)) {
+			return false
+		}
+	}
+	s.others = append(s.others, o)
+	return true
+}
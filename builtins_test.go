@@ -2,6 +2,7 @@ package tengo_test
 
 import (
 	"errors"
+	"math"
 	"reflect"
 	"testing"
 
@@ -400,14 +401,56 @@ func Test_builtinRange(t *testing.T) {
 				Name: "step", Expected: "int", Found: "string"},
 		},
 		{name: "zero step",
-			args:      []tengo.Object{&tengo.Int{}, &tengo.Int{}, &tengo.Int{}}, //must greate than 0
+			args:      []tengo.Object{&tengo.Int{}, &tengo.Int{}, &tengo.Int{}}, //must not be 0
 			wantErr:   true,
 			wantedErr: tengo.ErrInvalidRangeStep,
 		},
-		{name: "negative step",
-			args:      []tengo.Object{&tengo.Int{}, &tengo.Int{}, intObject(-2)}, //must greate than 0
+		{name: "negative step up",
+			args:      []tengo.Object{&tengo.Int{}, intObject(5), intObject(-2)}, //must count down
 			wantErr:   true,
-			wantedErr: tengo.ErrInvalidRangeStep,
+			wantedErr: tengo.ErrRangeStepDirection,
+		},
+		{name: "negative step same bound",
+			args:    []tengo.Object{&tengo.Int{}, &tengo.Int{}, intObject(-2)},
+			wantErr: false,
+			result: &tengo.Array{
+				Value: nil,
+			},
+		},
+		{name: "negative step down",
+			args:    []tengo.Object{intObject(10), &tengo.Int{}, intObject(-2)},
+			wantErr: false,
+			result: &tengo.Array{
+				Value: []tengo.Object{
+					intObject(10),
+					intObject(8),
+					intObject(6),
+					intObject(4),
+					intObject(2),
+				},
+			},
+		},
+		{name: "negative step down uneven",
+			args:    []tengo.Object{intObject(5), intObject(-5), intObject(-3)},
+			wantErr: false,
+			result: &tengo.Array{
+				Value: []tengo.Object{
+					intObject(5),
+					intObject(2),
+					intObject(-1),
+					intObject(-4),
+				},
+			},
+		},
+		{name: "extreme bounds",
+			args:    []tengo.Object{intObject(math.MaxInt64), intObject(math.MinInt64), intObject(math.MinInt64)},
+			wantErr: false,
+			result: &tengo.Array{
+				Value: []tengo.Object{
+					intObject(math.MaxInt64),
+					intObject(-1),
+				},
+			},
 		},
 		{name: "same bound",
 			args:    []tengo.Object{&tengo.Int{}, &tengo.Int{}},
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/tiagoj/tengo/v2/parser"
@@ -41,6 +43,28 @@ func (e *CompilerError) Error() string {
 	return fmt.Sprintf("Compile Error: %s\n\tat %s", e.Err.Error(), filePos)
 }
 
+// Warning is a non-fatal issue found while compiling a script, such as an
+// unused variable.
+type Warning struct {
+	Message string
+	Pos     parser.SourceFilePos
+}
+
+// compilerWarnings collects the warnings of a compiler and of the compilers
+// of the modules it imports.
+type compilerWarnings struct {
+	list []Warning
+	vars map[*Symbol]*varUsage // local variables, reported if never read
+}
+
+// varUsage records how a local variable is used.
+type varUsage struct {
+	name     string
+	pos      parser.SourceFilePos
+	read     bool
+	assigned bool // assigned after its definition
+}
+
 // Compiler compiles the AST into a bytecode.
 type Compiler struct {
 	file            *parser.SourceFile
@@ -54,11 +78,15 @@ type Compiler struct {
 	scopeIndex      int
 	modules         ModuleGetter
 	compiledModules map[string]*CompiledFunction
+	imported        map[string]struct{}
 	allowFileImport bool
 	loops           []*loop
 	loopIndex       int
 	trace           io.Writer
 	indent          int
+	warnings        *compilerWarnings
+
+	disableConstantFolding bool
 }
 
 // NewCompiler creates a Compiler.
@@ -95,10 +123,12 @@ func NewCompiler(
 		constants:       constants,
 		scopes:          []compilationScope{mainScope},
 		scopeIndex:      0,
+		warnings:        &compilerWarnings{vars: make(map[*Symbol]*varUsage)},
 		loopIndex:       -1,
 		trace:           trace,
 		modules:         modules,
 		compiledModules: make(map[string]*CompiledFunction),
+		imported:        make(map[string]struct{}),
 		importFileExt:   []string{SourceFileExtDefault},
 	}
 }
@@ -142,6 +172,13 @@ func (c *Compiler) Compile(node parser.Node) error {
 			return c.compileLogical(node)
 		}
 
+		if !c.disableConstantFolding {
+			if folded, ok := c.foldConstant(node); ok {
+				c.emit(node, parser.OpConstant, c.addConstant(folded))
+				return nil
+			}
+		}
+
 		if err := c.Compile(node.LHS); err != nil {
 			return err
 		}
@@ -302,6 +339,7 @@ func (c *Compiler) Compile(node parser.Node) error {
 			c.symbolTable = c.symbolTable.Parent(false)
 		}()
 
+		c.checkReachable(node.Stmts)
 		for _, stmt := range node.Stmts {
 			if err := c.Compile(stmt); err != nil {
 				return err
@@ -317,6 +355,11 @@ func (c *Compiler) Compile(node parser.Node) error {
 		if !ok {
 			return c.errorf(node, "unresolved reference '%s'", node.Name)
 		}
+		c.useVar(symbol, true)
+		if symbol.value != nil {
+			c.emitValue(node, symbol.value)
+			return nil
+		}
 
 		switch symbol.Scope {
 		case ScopeGlobal:
@@ -329,14 +372,58 @@ func (c *Compiler) Compile(node parser.Node) error {
 			c.emit(node, parser.OpGetFree, symbol.Index)
 		}
 	case *parser.ArrayLit:
+		// elements are collected into arrays that are spread into the first
+		// one around every spread element
+		collected, n := false, 0
+		collect := func() {
+			c.emit(node, parser.OpArray, n)
+			if collected {
+				c.emit(node, parser.OpSpread)
+			}
+			collected, n = true, 0
+		}
 		for _, elem := range node.Elements {
+			if spread, ok := elem.(*parser.SpreadExpr); ok {
+				if !collected || n > 0 {
+					collect()
+				}
+				if err := c.Compile(spread.Expr); err != nil {
+					return err
+				}
+				c.emit(spread, parser.OpSpread)
+				continue
+			}
 			if err := c.Compile(elem); err != nil {
 				return err
 			}
+			n++
+		}
+		if !collected || n > 0 {
+			collect()
 		}
-		c.emit(node, parser.OpArray, len(node.Elements))
 	case *parser.MapLit:
+		// same as for arrays, with maps of the elements between spread
+		// elements
+		collected, n := false, 0
+		collect := func() {
+			c.emit(node, parser.OpMap, n*2)
+			if collected {
+				c.emit(node, parser.OpSpread)
+			}
+			collected, n = true, 0
+		}
 		for _, elt := range node.Elements {
+			if spread, ok := elt.Value.(*parser.SpreadExpr); ok {
+				if !collected || n > 0 {
+					collect()
+				}
+				if err := c.Compile(spread.Expr); err != nil {
+					return err
+				}
+				c.emit(spread, parser.OpSpread)
+				continue
+			}
+
 			// key
 			if len(elt.Key) > MaxStringLen {
 				return c.error(node, ErrStringLimit)
@@ -348,8 +435,11 @@ func (c *Compiler) Compile(node parser.Node) error {
 			if err := c.Compile(elt.Value); err != nil {
 				return err
 			}
+			n++
+		}
+		if !collected || n > 0 {
+			collect()
 		}
-		c.emit(node, parser.OpMap, len(node.Elements)*2)
 
 	case *parser.SelectorExpr: // selector on RHS side
 		if err := c.Compile(node.Expr); err != nil {
@@ -387,92 +477,45 @@ func (c *Compiler) Compile(node parser.Node) error {
 		}
 		c.emit(node, parser.OpSliceIndex)
 	case *parser.FuncLit:
-		c.enterScope()
-
-		for _, p := range node.Type.Params.List {
-			s := c.symbolTable.Define(p.Name)
+		return c.compileFuncLit(node, "")
+	case *parser.YieldStmt:
+		if c.symbolTable.Parent(true) == nil {
+			// outside the function
+			return c.errorf(node, "yield not allowed outside function")
+		}
 
-			// function arguments is not assigned directly.
-			s.LocalAssigned = true
+		if node.Result == nil {
+			c.emit(node, parser.OpNull)
+		} else {
+			if err := c.Compile(node.Result); err != nil {
+				return err
+			}
+		}
+		c.emit(node, parser.OpYield)
+	case *parser.ConstStmt:
+		return c.compileConst(node)
+	case *parser.DeferStmt:
+		if c.symbolTable.Parent(true) == nil {
+			// outside the function
+			return c.errorf(node, "defer not allowed outside function")
 		}
 
-		if err := c.Compile(node.Body); err != nil {
+		// the function and the arguments are evaluated now, and called when
+		// the function returns
+		call := node.Call
+		if err := c.Compile(call.Func); err != nil {
 			return err
 		}
-
-		// code optimization
-		c.optimizeFunc(node)
-
-		freeSymbols := c.symbolTable.FreeSymbols()
-		numLocals := c.symbolTable.MaxSymbols()
-		instructions, sourceMap := c.leaveScope()
-
-		for _, s := range freeSymbols {
-			switch s.Scope {
-			case ScopeLocal:
-				if !s.LocalAssigned {
-					// Here, the closure is capturing a local variable that's
-					// not yet assigned its value. One example is a local
-					// recursive function:
-					//
-					//   func() {
-					//     foo := func(x) {
-					//       // ..
-					//       return foo(x-1)
-					//     }
-					//   }
-					//
-					// which translate into
-					//
-					//   0000 GETL    0
-					//   0002 CLOSURE ?     1
-					//   0006 DEFL    0
-					//
-					// . So the local variable (0) is being captured before
-					// it's assigned the value.
-					//
-					// Solution is to transform the code into something like
-					// this:
-					//
-					//   func() {
-					//     foo := undefined
-					//     foo = func(x) {
-					//       // ..
-					//       return foo(x-1)
-					//     }
-					//   }
-					//
-					// that is equivalent to
-					//
-					//   0000 NULL
-					//   0001 DEFL    0
-					//   0003 GETL    0
-					//   0005 CLOSURE ?     1
-					//   0009 SETL    0
-					//
-					c.emit(node, parser.OpNull)
-					c.emit(node, parser.OpDefineLocal, s.Index)
-					s.LocalAssigned = true
-				}
-				c.emit(node, parser.OpGetLocalPtr, s.Index)
-			case ScopeFree:
-				c.emit(node, parser.OpGetFreePtr, s.Index)
+		for _, arg := range call.Args {
+			if err := c.Compile(arg); err != nil {
+				return err
 			}
 		}
-
-		compiledFunction := &CompiledFunction{
-			Instructions:  instructions,
-			NumLocals:     numLocals,
-			NumParameters: len(node.Type.Params.List),
-			VarArgs:       node.Type.Params.VarArgs,
-			SourceMap:     sourceMap,
-		}
-		if len(freeSymbols) > 0 {
-			c.emit(node, parser.OpClosure,
-				c.addConstant(compiledFunction), len(freeSymbols))
-		} else {
-			c.emit(node, parser.OpConstant, c.addConstant(compiledFunction))
+		ellipsis := 0
+		if call.Ellipsis.IsValid() {
+			ellipsis = 1
 		}
+		c.emit(node, parser.OpDefer, len(call.Args), ellipsis)
 	case *parser.ReturnStmt:
 		if c.symbolTable.Parent(true) == nil {
 			// outside the function
@@ -511,6 +554,7 @@ func (c *Compiler) Compile(node parser.Node) error {
 			if err != nil {
 				return err
 			}
+			c.imported[node.ModuleName] = struct{}{}
 
 			switch v := v.(type) {
 			case []byte: // module written in Tengo
@@ -540,6 +584,7 @@ func (c *Compiler) Compile(node parser.Node) error {
 				return c.errorf(node, "module file read error: %s",
 					err.Error())
 			}
+			c.imported[moduleName] = struct{}{}
 
 			compiled, err := c.compileModule(node, modulePath, moduleSrc, true)
 			if err != nil {
@@ -621,6 +666,12 @@ func (c *Compiler) EnableFileImport(enable bool) {
 	c.allowFileImport = enable
 }
 
+// EnableConstantFolding enables or disables the evaluation of constant
+// arithmetic expressions at compile time. It is enabled by default.
+func (c *Compiler) EnableConstantFolding(enable bool) {
+	c.disableConstantFolding = !enable
+}
+
 // SetImportDir sets the initial import directory path for file imports.
 func (c *Compiler) SetImportDir(dir string) {
 	c.importDir = dir
@@ -665,9 +716,19 @@ func (c *Compiler) compileAssign(
 	op token.Token,
 ) error {
 	numLHS, numRHS := len(lhs), len(rhs)
+	if numRHS == 1 && (op == token.Define || op == token.Assign) {
+		if pattern, ok := lhs[0].(*parser.MapPattern); ok && numLHS == 1 {
+			return c.compileDestructure(node, pattern, rhs[0], op)
+		} else if numLHS > 1 {
+			return c.compileDestructure(node, lhs, rhs[0], op)
+		}
+	}
 	if numLHS > 1 || numRHS > 1 {
 		return c.errorf(node, "tuple assignment not allowed")
 	}
+	if _, ok := lhs[0].(*parser.MapPattern); ok {
+		return c.errorf(node, "operator '%s' not allowed with destructuring", op)
+	}
 
 	// resolve and compile left-hand side
 	ident, selectors := resolveAssignLHS(lhs[0])
@@ -681,16 +742,23 @@ func (c *Compiler) compileAssign(
 	_, isFunc := rhs[0].(*parser.FuncLit)
 	symbol, depth, exists := c.symbolTable.Resolve(ident, false)
 	if op == token.Define {
-		if depth == 0 && exists {
+		// builtin functions can be shadowed, so that adding a builtin
+		// doesn't break scripts already using its name
+		if depth == 0 && exists && symbol.Scope != ScopeBuiltin {
 			return c.errorf(node, "'%s' redeclared in this block", ident)
 		}
 		if isFunc {
-			symbol = c.symbolTable.Define(ident)
+			symbol = c.defineVar(node, ident, false)
 		}
 	} else {
 		if !exists {
 			return c.errorf(node, "unresolved reference '%s'", ident)
 		}
+		if err := c.checkAssignable(node, symbol, numSel); err != nil {
+			return err
+		}
+		// assigning to an element reads the variable
+		c.useVar(symbol, numSel > 0)
 	}
 
 	// +=, -=, *=, /=
@@ -701,14 +769,21 @@ func (c *Compiler) compileAssign(
 	}
 
 	// compile RHSs
-	for _, expr := range rhs {
-		if err := c.Compile(expr); err != nil {
+	if isFunc && numSel == 0 {
+		err := c.compileFuncLit(rhs[0].(*parser.FuncLit), ident)
+		if err != nil {
 			return err
 		}
+	} else {
+		for _, expr := range rhs {
+			if err := c.Compile(expr); err != nil {
+				return err
+			}
+		}
 	}
 
 	if op == token.Define && !isFunc {
-		symbol = c.symbolTable.Define(ident)
+		symbol = c.defineVar(node, ident, false)
 	}
 
 	switch op {
@@ -736,6 +811,19 @@ func (c *Compiler) compileAssign(
 		c.emit(node, parser.OpBinaryOp, int(token.Shr))
 	}
 
+	return c.compileStore(node, symbol, selectors, op)
+}
+
+// compileStore emits the instructions to store the value on top of the stack
+// in the variable symbol, through the selectors if any.
+func (c *Compiler) compileStore(
+	node parser.Node,
+	symbol *Symbol,
+	selectors []parser.Expr,
+	op token.Token,
+) error {
+	numSel := len(selectors)
+
 	// compile selector expressions (right to left)
 	for i := numSel - 1; i >= 0; i-- {
 		if err := c.Compile(selectors[i]); err != nil {
@@ -776,6 +864,230 @@ func (c *Compiler) compileAssign(
 	return nil
 }
 
+// checkAssignable returns an error if the variable symbol, or its elements
+// through numSel selectors, can't be assigned: constants can't be reassigned,
+// and the values of constants known at compile time, which have no variable
+// in the scope of the assignment, can't be modified either.
+func (c *Compiler) checkAssignable(
+	node parser.Node,
+	symbol *Symbol,
+	numSel int,
+) error {
+	if symbol.Constant && (numSel == 0 || symbol.value != nil) {
+		return c.errorf(node, "cannot assign to constant '%s'", symbol.Name)
+	}
+	return nil
+}
+
+// compileConst compiles a constant declaration. The constant is stored in a
+// variable like with ":=", and its value is also recorded in the symbol
+// table if it's known at compile time, so that the references to it are
+// compiled as that value.
+func (c *Compiler) compileConst(node *parser.ConstStmt) error {
+	name := node.Name.Name
+	symbol, depth, exists := c.symbolTable.Resolve(name, false)
+	if depth == 0 && exists && symbol.Scope != ScopeBuiltin {
+		return c.errorf(node, "'%s' redeclared in this block", name)
+	}
+	var value Object
+	if !c.disableConstantFolding {
+		value, _ = c.constValue(node.Value)
+	}
+	if fn, ok := node.Value.(*parser.FuncLit); ok {
+		// defined first, so that the function can call itself
+		symbol = c.defineVar(node.Name, name, false)
+		symbol.Constant = true
+		if err := c.compileFuncLit(fn, name); err != nil {
+			return err
+		}
+	} else {
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		symbol = c.defineVar(node.Name, name, false)
+		symbol.Constant = true
+		symbol.value = value
+	}
+	return c.compileStore(node, symbol, nil, token.Define)
+}
+
+// compileDestructure compiles an assignment that unpacks the elements of an
+// array ("a, b := arr") or the values of a map ("{a, b} := m") into several
+// variables. target is either the list of left-hand side expressions or a
+// map pattern.
+func (c *Compiler) compileDestructure(
+	node parser.Node,
+	target interface{},
+	rhs parser.Expr,
+	op token.Token,
+) error {
+	var lhs []parser.Expr
+	var keys []string
+	switch target := target.(type) {
+	case []parser.Expr:
+		lhs = target
+	case *parser.MapPattern:
+		if len(target.Names) == 0 {
+			return c.errorf(node, "empty destructuring pattern")
+		}
+		for _, name := range target.Names {
+			lhs = append(lhs, name)
+			keys = append(keys, name.Name)
+		}
+	}
+	if len(lhs) > 255 {
+		return c.errorf(node, "too many variables in destructuring")
+	}
+
+	// resolve left-hand sides
+	idents := make([]string, len(lhs))
+	selectors := make([][]parser.Expr, len(lhs))
+	seen := make(map[string]bool, len(lhs))
+	for i, expr := range lhs {
+		idents[i], selectors[i] = resolveAssignLHS(expr)
+		if op == token.Define && len(selectors[i]) > 0 {
+			// using selector on new variable does not make sense
+			return c.errorf(node, "operator ':=' not allowed with selector")
+		}
+		symbol, depth, exists := c.symbolTable.Resolve(idents[i], false)
+		if op == token.Define {
+			shadows := exists && symbol.Scope == ScopeBuiltin
+			if (depth == 0 && exists && !shadows) || seen[idents[i]] {
+				return c.errorf(node, "'%s' redeclared in this block",
+					idents[i])
+			}
+			seen[idents[i]] = true
+		} else if !exists {
+			return c.errorf(node, "unresolved reference '%s'", idents[i])
+		} else if err := c.checkAssignable(node, symbol,
+			len(selectors[i])); err != nil {
+			return err
+		} else {
+			c.useVar(symbol, len(selectors[i]) > 0)
+		}
+	}
+
+	// compile RHS, then the keys for a map pattern
+	if err := c.Compile(rhs); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		c.emit(node, parser.OpConstant, c.addConstant(&String{Value: key}))
+	}
+	fromMap := 0
+	if keys != nil {
+		fromMap = 1
+	}
+	c.emit(node, parser.OpDestructure, len(lhs), fromMap)
+
+	// the first element is now on top of the stack
+	for i := range lhs {
+		var symbol *Symbol
+		if op == token.Define {
+			symbol = c.defineVar(lhs[i], idents[i], false)
+		} else {
+			symbol, _, _ = c.symbolTable.Resolve(idents[i], false)
+		}
+		if err := c.compileStore(node, symbol, selectors[i], op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileFuncLit compiles a function literal. name is the name the function
+// is assigned to, used in stack traces; it is empty for anonymous functions.
+func (c *Compiler) compileFuncLit(node *parser.FuncLit, name string) error {
+	c.enterScope()
+
+	for _, p := range node.Type.Params.List {
+		s := c.defineVar(p, p.Name, true)
+
+		// function arguments is not assigned directly.
+		s.LocalAssigned = true
+	}
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+
+	// code optimization
+	c.optimizeFunc(node)
+
+	freeSymbols := c.symbolTable.FreeSymbols()
+	numLocals := c.symbolTable.MaxSymbols()
+	instructions, sourceMap := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		switch s.Scope {
+		case ScopeLocal:
+			if !s.LocalAssigned {
+				// Here, the closure is capturing a local variable that's
+				// not yet assigned its value. One example is a local
+				// recursive function:
+				//
+				//   func() {
+				//     foo := func(x) {
+				//       // ..
+				//       return foo(x-1)
+				//     }
+				//   }
+				//
+				// which translate into
+				//
+				//   0000 GETL    0
+				//   0002 CLOSURE ?     1
+				//   0006 DEFL    0
+				//
+				// . So the local variable (0) is being captured before
+				// it's assigned the value.
+				//
+				// Solution is to transform the code into something like
+				// this:
+				//
+				//   func() {
+				//     foo := undefined
+				//     foo = func(x) {
+				//       // ..
+				//       return foo(x-1)
+				//     }
+				//   }
+				//
+				// that is equivalent to
+				//
+				//   0000 NULL
+				//   0001 DEFL    0
+				//   0003 GETL    0
+				//   0005 CLOSURE ?     1
+				//   0009 SETL    0
+				//
+				c.emit(node, parser.OpNull)
+				c.emit(node, parser.OpDefineLocal, s.Index)
+				s.LocalAssigned = true
+			}
+			c.emit(node, parser.OpGetLocalPtr, s.Index)
+		case ScopeFree:
+			c.emit(node, parser.OpGetFreePtr, s.Index)
+		}
+	}
+
+	compiledFunction := &CompiledFunction{
+		Name:          name,
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Type.Params.List),
+		VarArgs:       node.Type.Params.VarArgs,
+		SourceMap:     sourceMap,
+	}
+	if len(freeSymbols) > 0 {
+		c.emit(node, parser.OpClosure,
+			c.addConstant(compiledFunction), len(freeSymbols))
+	} else {
+		c.emit(node, parser.OpConstant, c.addConstant(compiledFunction))
+	}
+	return nil
+}
+
 func (c *Compiler) compileLogical(node *parser.BinaryExpr) error {
 	// left side term
 	if err := c.Compile(node.LHS); err != nil {
@@ -915,7 +1227,7 @@ func (c *Compiler) compileForInStmt(stmt *parser.ForInStmt) error {
 
 	// assign key variable
 	if stmt.Key.Name != "_" {
-		keySymbol := c.symbolTable.Define(stmt.Key.Name)
+		keySymbol := c.defineVar(stmt.Key, stmt.Key.Name, false)
 		if itSymbol.Scope == ScopeGlobal {
 			c.emit(stmt, parser.OpGetGlobal, itSymbol.Index)
 		} else {
@@ -932,7 +1244,7 @@ func (c *Compiler) compileForInStmt(stmt *parser.ForInStmt) error {
 
 	// assign value variable
 	if stmt.Value.Name != "_" {
-		valueSymbol := c.symbolTable.Define(stmt.Value.Name)
+		valueSymbol := c.defineVar(stmt.Value, stmt.Value.Name, false)
 		if itSymbol.Scope == ScopeGlobal {
 			c.emit(stmt, parser.OpGetGlobal, itSymbol.Index)
 		} else {
@@ -1125,12 +1437,110 @@ func (c *Compiler) fork(
 	child.allowFileImport = c.allowFileImport
 	child.importDir = c.importDir
 	child.importFileExt = c.importFileExt
+	child.disableConstantFolding = c.disableConstantFolding
+	child.warnings = c.warnings
+	child.imported = c.imported
 	if isFile && c.importDir != "" {
 		child.importDir = filepath.Dir(modulePath)
 	}
 	return child
 }
 
+// Warnings returns the non-fatal issues found while compiling, including in
+// the imported modules, in the order of their positions: local variables that
+// are never read, declarations shadowing a global variable, and unreachable
+// statements.
+func (c *Compiler) Warnings() []Warning {
+	warnings := append([]Warning(nil), c.warnings.list...)
+	for _, u := range c.warnings.vars {
+		switch {
+		case u.read:
+			continue
+		case u.assigned:
+			warnings = append(warnings, Warning{
+				Message: fmt.Sprintf(
+					"variable '%s' is assigned but never read", u.name),
+				Pos: u.pos,
+			})
+		default:
+			warnings = append(warnings, Warning{
+				Message: fmt.Sprintf("unused variable '%s'", u.name),
+				Pos:     u.pos,
+			})
+		}
+	}
+	sort.SliceStable(warnings, func(i, j int) bool {
+		a, b := warnings[i].Pos, warnings[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+	return warnings
+}
+
+// ImportedModules returns the sorted names of the modules imported while
+// compiling, as written in the import expressions, including the modules
+// imported by other modules and the modules loaded from files.
+func (c *Compiler) ImportedModules() []string {
+	names := make([]string, 0, len(c.imported))
+	for name := range c.imported {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Compiler) warnf(node parser.Node, format string, args ...interface{}) {
+	c.warnings.list = append(c.warnings.list, Warning{
+		Message: fmt.Sprintf(format, args...),
+		Pos:     c.file.Set().Position(node.Pos()),
+	})
+}
+
+// defineVar defines a variable declared by node in the current scope. It
+// warns if the variable shadows a global variable, and records local
+// variables other than the parameters of functions to warn if they're never
+// read. Variables whose name starts with "_" are never reported as unused.
+func (c *Compiler) defineVar(node parser.Node, name string, param bool) *Symbol {
+	if s := c.symbolTable.lookup(name); s != nil && s.Scope == ScopeGlobal {
+		c.warnf(node, "'%s' shadows a global variable", name)
+	}
+	symbol := c.symbolTable.Define(name)
+	if symbol.Scope == ScopeLocal && !param && !strings.HasPrefix(name, "_") {
+		c.warnings.vars[symbol] = &varUsage{
+			name: name,
+			pos:  c.file.Set().Position(node.Pos()),
+		}
+	}
+	return symbol
+}
+
+// useVar records that the variable of symbol is read, or assigned.
+func (c *Compiler) useVar(symbol *Symbol, read bool) {
+	u := c.warnings.vars[c.symbolTable.origin(symbol)]
+	if u == nil {
+		return
+	}
+	if read {
+		u.read = true
+	} else {
+		u.assigned = true
+	}
+}
+
+// checkReachable warns about the first statement following a return, break
+// or continue statement, which never runs.
+func (c *Compiler) checkReachable(stmts []parser.Stmt) {
+	for i := 1; i < len(stmts); i++ {
+		switch stmts[i-1].(type) {
+		case *parser.ReturnStmt, *parser.BranchStmt:
+			c.warnf(stmts[i], "unreachable code")
+			return
+		}
+	}
+}
+
 func (c *Compiler) error(node parser.Node, err error) error {
 	return &CompilerError{
 		FileSet: c.file.Set(),
@@ -1151,6 +1561,130 @@ func (c *Compiler) errorf(
 	}
 }
 
+// constValue returns the value of expr if it's known at compile time: a
+// string, char or bool literal, an arithmetic expression foldConstant can
+// evaluate, or a constant whose value is known.
+func (c *Compiler) constValue(expr parser.Expr) (Object, bool) {
+	switch expr := expr.(type) {
+	case *parser.StringLit:
+		if len(expr.Value) > MaxStringLen {
+			return nil, false
+		}
+		return &String{Value: expr.Value}, true
+	case *parser.CharLit:
+		return &Char{Value: expr.Value}, true
+	case *parser.BoolLit:
+		if expr.Value {
+			return TrueValue, true
+		}
+		return FalseValue, true
+	case *parser.ParenExpr:
+		return c.constValue(expr.Expr)
+	case *parser.Ident:
+		if symbol, _, ok := c.symbolTable.Resolve(expr.Name, false); ok &&
+			symbol.value != nil {
+			return symbol.value, true
+		}
+		return nil, false
+	}
+	return c.foldConstant(expr)
+}
+
+// emitValue emits the instruction pushing a value known at compile time.
+func (c *Compiler) emitValue(node parser.Node, value Object) {
+	switch value {
+	case TrueValue:
+		c.emit(node, parser.OpTrue)
+	case FalseValue:
+		c.emit(node, parser.OpFalse)
+	default:
+		c.emit(node, parser.OpConstant, c.addConstant(value))
+	}
+}
+
+// foldConstant evaluates an arithmetic expression whose operands are all
+// int or float literals, or constants with int or float values. It uses the
+// same BinaryOp implementations as the VM, and gives up on anything that
+// would fail at runtime (e.g. integer division by zero, or int overflows with
+// overflow checks enabled) so that the error is still reported when the code
+// runs.
+func (c *Compiler) foldConstant(expr parser.Expr) (Object, bool) {
+	switch expr := expr.(type) {
+	case *parser.IntLit:
+		return &Int{Value: expr.Value}, true
+	case *parser.FloatLit:
+		return &Float{Value: expr.Value}, true
+	case *parser.ParenExpr:
+		return c.foldConstant(expr.Expr)
+	case *parser.Ident:
+		symbol, _, ok := c.symbolTable.Resolve(expr.Name, false)
+		if !ok {
+			return nil, false
+		}
+		switch symbol.value.(type) {
+		case *Int, *Float:
+			return symbol.value, true
+		}
+	case *parser.UnaryExpr:
+		operand, ok := c.foldConstant(expr.Expr)
+		if !ok {
+			return nil, false
+		}
+		switch expr.Token {
+		case token.Add:
+			return operand, true
+		case token.Sub:
+			switch x := operand.(type) {
+			case *Int:
+				if x.Value == math.MinInt64 {
+					return nil, false
+				}
+				return &Int{Value: -x.Value}, true
+			case *Float:
+				return &Float{Value: -x.Value}, true
+			}
+		case token.Xor:
+			if x, ok := operand.(*Int); ok {
+				return &Int{Value: ^x.Value}, true
+			}
+		}
+	case *parser.BinaryExpr:
+		switch expr.Token {
+		case token.Add, token.Sub, token.Mul, token.Quo, token.Rem,
+			token.And, token.Or, token.Xor, token.AndNot, token.Shl,
+			token.Shr:
+		default:
+			return nil, false
+		}
+		lhs, ok := c.foldConstant(expr.LHS)
+		if !ok {
+			return nil, false
+		}
+		rhs, ok := c.foldConstant(expr.RHS)
+		if !ok {
+			return nil, false
+		}
+		if expr.Token == token.Quo || expr.Token == token.Rem {
+			_, lhsInt := lhs.(*Int)
+			if r, ok := rhs.(*Int); ok && lhsInt && r.Value == 0 {
+				return nil, false
+			}
+		}
+		if checkIntOverflow(expr.Token, lhs, rhs) != nil {
+			return nil, false
+		}
+		res, err := lhs.BinaryOp(expr.Token, rhs)
+		if err != nil {
+			return nil, false
+		}
+		switch res.(type) {
+		case *Int, *Float:
+			return res, true
+		}
+	}
+	return nil, false
+}
+
 func (c *Compiler) addConstant(o Object) int {
 	if c.parent != nil {
 		// module compilers will use their parent's constants array
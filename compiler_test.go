@@ -18,13 +18,10 @@ func TestCompiler_Compile(t *testing.T) {
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
-				tengo.MakeInstruction(parser.OpConstant, 1),
-				tengo.MakeInstruction(parser.OpBinaryOp, 11),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray(
-				intObject(1),
-				intObject(2))))
+				intObject(3))))
 
 	expectCompile(t, `1; 2`,
 		bytecode(
@@ -42,37 +39,28 @@ func TestCompiler_Compile(t *testing.T) {
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
-				tengo.MakeInstruction(parser.OpConstant, 1),
-				tengo.MakeInstruction(parser.OpBinaryOp, 12),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray(
-				intObject(1),
-				intObject(2))))
+				intObject(-1))))
 
 	expectCompile(t, `1 * 2`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
-				tengo.MakeInstruction(parser.OpConstant, 1),
-				tengo.MakeInstruction(parser.OpBinaryOp, 13),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray(
-				intObject(1),
 				intObject(2))))
 
 	expectCompile(t, `2 / 1`,
 		bytecode(
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
-				tengo.MakeInstruction(parser.OpConstant, 1),
-				tengo.MakeInstruction(parser.OpBinaryOp, 14),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray(
-				intObject(2),
-				intObject(1))))
+				intObject(2))))
 
 	expectCompile(t, `true`,
 		bytecode(
@@ -313,23 +301,14 @@ func TestCompiler_Compile(t *testing.T) {
 			concatInsts(
 				tengo.MakeInstruction(parser.OpConstant, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
-				tengo.MakeInstruction(parser.OpBinaryOp, 11),
 				tengo.MakeInstruction(parser.OpConstant, 2),
-				tengo.MakeInstruction(parser.OpConstant, 3),
-				tengo.MakeInstruction(parser.OpBinaryOp, 12),
-				tengo.MakeInstruction(parser.OpConstant, 4),
-				tengo.MakeInstruction(parser.OpConstant, 5),
-				tengo.MakeInstruction(parser.OpBinaryOp, 13),
 				tengo.MakeInstruction(parser.OpArray, 3),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray(
-				intObject(1),
-				intObject(2),
 				intObject(3),
-				intObject(4),
-				intObject(5),
-				intObject(6))))
+				intObject(-1),
+				intObject(30))))
 
 	expectCompile(t, `{}`,
 		bytecode(
@@ -365,21 +344,15 @@ func TestCompiler_Compile(t *testing.T) {
 				tengo.MakeInstruction(parser.OpConstant, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
 				tengo.MakeInstruction(parser.OpConstant, 2),
-				tengo.MakeInstruction(parser.OpBinaryOp, 11),
 				tengo.MakeInstruction(parser.OpConstant, 3),
-				tengo.MakeInstruction(parser.OpConstant, 4),
-				tengo.MakeInstruction(parser.OpConstant, 5),
-				tengo.MakeInstruction(parser.OpBinaryOp, 13),
 				tengo.MakeInstruction(parser.OpMap, 4),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray(
 				stringObject("a"),
-				intObject(2),
-				intObject(3),
-				stringObject("b"),
 				intObject(5),
-				intObject(6))))
+				stringObject("b"),
+				intObject(30))))
 
 	expectCompile(t, `[1, 2, 3][1 + 1]`,
 		bytecode(
@@ -388,9 +361,7 @@ func TestCompiler_Compile(t *testing.T) {
 				tengo.MakeInstruction(parser.OpConstant, 1),
 				tengo.MakeInstruction(parser.OpConstant, 2),
 				tengo.MakeInstruction(parser.OpArray, 3),
-				tengo.MakeInstruction(parser.OpConstant, 0),
-				tengo.MakeInstruction(parser.OpConstant, 0),
-				tengo.MakeInstruction(parser.OpBinaryOp, 11),
+				tengo.MakeInstruction(parser.OpConstant, 1),
 				tengo.MakeInstruction(parser.OpIndex),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
@@ -405,9 +376,7 @@ func TestCompiler_Compile(t *testing.T) {
 				tengo.MakeInstruction(parser.OpConstant, 0),
 				tengo.MakeInstruction(parser.OpConstant, 1),
 				tengo.MakeInstruction(parser.OpMap, 2),
-				tengo.MakeInstruction(parser.OpConstant, 1),
 				tengo.MakeInstruction(parser.OpConstant, 2),
-				tengo.MakeInstruction(parser.OpBinaryOp, 12),
 				tengo.MakeInstruction(parser.OpIndex),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
@@ -508,31 +477,25 @@ func TestCompiler_Compile(t *testing.T) {
 	expectCompile(t, `func() { return 5 + 10 }`,
 		bytecode(
 			concatInsts(
-				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpConstant, 1),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray(
-				intObject(5),
-				intObject(10),
+				intObject(15),
 				compiledFunction(0, 0,
 					tengo.MakeInstruction(parser.OpConstant, 0),
-					tengo.MakeInstruction(parser.OpConstant, 1),
-					tengo.MakeInstruction(parser.OpBinaryOp, 11),
 					tengo.MakeInstruction(parser.OpReturn, 1)))))
 
 	expectCompile(t, `func() { 5 + 10 }`,
 		bytecode(
 			concatInsts(
-				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpConstant, 1),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpSuspend)),
 			objectsArray(
-				intObject(5),
-				intObject(10),
+				intObject(15),
 				compiledFunction(0, 0,
 					tengo.MakeInstruction(parser.OpConstant, 0),
-					tengo.MakeInstruction(parser.OpConstant, 1),
-					tengo.MakeInstruction(parser.OpBinaryOp, 11),
 					tengo.MakeInstruction(parser.OpPop),
 					tengo.MakeInstruction(parser.OpReturn, 0)))))
 
@@ -1029,9 +992,23 @@ func TestCompilerErrorReport(t *testing.T) {
 		"Compile Error: tuple assignment not allowed\n\tat test:1:1")
 	expectCompileError(t, `a.b := 1`,
 		"not allowed with selector")
+	expectCompileError(t, `a, b = [1, 2]`,
+		"Compile Error: unresolved reference 'a'\n\tat test:1:1")
+	expectCompileError(t, `a, a := [1, 2]`,
+		"Compile Error: 'a' redeclared in this block\n\tat test:1:1")
+	expectCompileError(t, `a := {}; {a, b} := a`,
+		"Compile Error: 'a' redeclared in this block\n\tat test:1:10")
+	expectCompileError(t, `a := {}; a.b, c := [1, 2]`,
+		"not allowed with selector")
 	expectCompileError(t, `a:=1; a:=3`,
 		"Compile Error: 'a' redeclared in this block\n\tat test:1:7")
+	expectCompileError(t, `len:=1; len:=3`,
+		"Compile Error: 'len' redeclared in this block\n\tat test:1:9")
 
+	expectCompileError(t, `defer func() {}()`,
+		"Compile Error: defer not allowed outside function\n\tat test:1:1")
+	expectCompileError(t, `yield 5`,
+		"Compile Error: yield not allowed outside function\n\tat test:1:1")
 	expectCompileError(t, `return 5`,
 		"Compile Error: return not allowed outside function\n\tat test:1:1")
 	expectCompileError(t, `func() { break }`,
@@ -1126,9 +1103,7 @@ func() {
 				tengo.MakeInstruction(parser.OpJumpFalsy, 21),
 				tengo.MakeInstruction(parser.OpConstant, 2),
 				tengo.MakeInstruction(parser.OpReturn, 1),
-				tengo.MakeInstruction(parser.OpConstant, 1),
-				tengo.MakeInstruction(parser.OpConstant, 1),
-				tengo.MakeInstruction(parser.OpBinaryOp, 11),
+				tengo.MakeInstruction(parser.OpConstant, 2),
 				tengo.MakeInstruction(parser.OpPop),
 				tengo.MakeInstruction(parser.OpConstant, 3),
 				tengo.MakeInstruction(parser.OpReturn, 1)))))
@@ -1355,6 +1330,299 @@ func bytecode(
 	}
 }
 
+func TestCompilerDestructuring(t *testing.T) {
+	expectCompile(t, `a, b := [1, 2]`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpArray, 2),
+				tengo.MakeInstruction(parser.OpDestructure, 2, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				intObject(2))))
+
+	expectCompile(t, `m := {}; {x, y} := m`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpMap, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpDestructure, 2, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 2),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				stringObject("x"),
+				stringObject("y"))))
+
+	expectCompile(t, `func(p) { a, b := p }`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				compiledFunction(3, 1,
+					tengo.MakeInstruction(parser.OpGetLocal, 0),
+					tengo.MakeInstruction(parser.OpDestructure, 2, 0),
+					tengo.MakeInstruction(parser.OpDefineLocal, 1),
+					tengo.MakeInstruction(parser.OpDefineLocal, 2),
+					tengo.MakeInstruction(parser.OpReturn, 0)))))
+}
+
+func TestCompilerSpread(t *testing.T) {
+	expectCompile(t, `a := []; [1, ...a, 2, 3]`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpArray, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpArray, 1),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpSpread),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpArray, 2),
+				tengo.MakeInstruction(parser.OpSpread),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				intObject(2),
+				intObject(3))))
+
+	expectCompile(t, `a := {}; {...a, k: 1}`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpMap, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpMap, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpSpread),
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpMap, 2),
+				tengo.MakeInstruction(parser.OpSpread),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				stringObject("k"),
+				intObject(1))))
+}
+
+func TestCompilerConstantFolding(t *testing.T) {
+	exprs := []string{
+		`2 * 3 + 4`,
+		`(1 + 2) * (3 - 4) / 2`,
+		`-5 % 3`,
+		`7 / 2`,
+		`7 / 2.0`,
+		`1 + 2.5 * 2`,
+		`1.5 - -2`,
+		`^7 & 12 | 1 ^ 2`,
+		`1 << 62 << 1`,
+		`9223372036854775807 + 1`,
+		`-(3 * 4)`,
+		`10 &^ 2 >> 1`,
+		`1.0 / 0`,
+	}
+	for _, expr := range exprs {
+		src := []byte(`out := ` + expr)
+
+		folded := tengo.NewScript(src)
+		foldedCompiled, err := folded.Run()
+		require.NoError(t, err, expr)
+
+		unfolded := tengo.NewScript(src)
+		unfolded.EnableConstantFolding(false)
+		unfoldedCompiled, err := unfolded.Run()
+		require.NoError(t, err, expr)
+
+		require.Equal(t, unfoldedCompiled.Get("out").Value(),
+			foldedCompiled.Get("out").Value(), expr)
+	}
+
+	// folded expressions are emitted as a single constant
+	expectCompile(t, `2 * 3 + 4`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(10))))
+	expectCompile(t, `1 + 2.5`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				floatObject(3.5))))
+
+	// only the constant operand is folded
+	expectCompile(t, `a := 1; a + 2 * 3`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpBinaryOp, 11),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				intObject(6))))
+
+	// comparisons and non-numeric operands are not folded
+	expectCompile(t, `1 < 2`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpBinaryOp, 38),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				intObject(2))))
+
+	// integer division by zero is left to the runtime
+	for _, expr := range []string{`1 / 0`, `1 % 0`, `(2 * 3) / (1 - 1)`} {
+		_, err := tengo.NewScript([]byte(`out := ` + expr)).Compile()
+		require.NoError(t, err, expr)
+	}
+	expectCompile(t, `(2 * 3) / (1 - 1)`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpBinaryOp, 14),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(6),
+				intObject(0))))
+}
+
+func TestCompilerConst(t *testing.T) {
+	// references to constants known at compile time are folded into the
+	// constant pool
+	expectCompile(t, `const PI = 3; out := PI * 2; PI`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpConstant, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(3),
+				intObject(6))))
+	expectCompile(t, `const a = "x"; const b = a; const c = !true; b; c`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 1),
+				tengo.MakeInstruction(parser.OpTrue),
+				tengo.MakeInstruction(parser.OpLNot),
+				tengo.MakeInstruction(parser.OpSetGlobal, 2),
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpGetGlobal, 2),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				stringObject("x"))))
+
+	// closures don't capture them
+	expectCompile(t, `func() { const n = 2; return func() { return n * 3 } }`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 3),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(2),
+				intObject(6),
+				compiledFunction(0, 0,
+					tengo.MakeInstruction(parser.OpConstant, 1),
+					tengo.MakeInstruction(parser.OpReturn, 1)),
+				compiledFunction(1, 0,
+					tengo.MakeInstruction(parser.OpConstant, 0),
+					tengo.MakeInstruction(parser.OpDefineLocal, 0),
+					tengo.MakeInstruction(parser.OpConstant, 2),
+					tengo.MakeInstruction(parser.OpReturn, 1)))))
+
+	// other values are read from the variable
+	expectCompile(t, `const a = [1]; a`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpArray, 1),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpGetGlobal, 0),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1))))
+
+	// constants can't be reassigned, even in nested functions
+	expectCompileError(t, `const a = 1; a = 2`,
+		"Compile Error: cannot assign to constant 'a'\n\tat test:1:14")
+	expectCompileError(t, `const a = 1; a += 2`,
+		"cannot assign to constant 'a'")
+	expectCompileError(t, `const a = 1; a++`,
+		"cannot assign to constant 'a'")
+	expectCompileError(t, `const a = 1; b := 0; a, b = [2, 3]`,
+		"cannot assign to constant 'a'")
+	expectCompileError(t, `const a = 1; {a} = {a: 2}`,
+		"cannot assign to constant 'a'")
+	expectCompileError(t, `const a = 1; f := func() { a = 2 }`,
+		"cannot assign to constant 'a'")
+	expectCompileError(t, `func() { const a = len([]); return func() { a = 2 } }`,
+		"cannot assign to constant 'a'")
+	expectCompileError(t, `const f = func() { f = 1 }`,
+		"cannot assign to constant 'f'")
+	expectCompileError(t, `const s = "ab"; s[0] = 'c'`,
+		"cannot assign to constant 's'")
+	expectCompileError(t, `const a = 1; a := 2`,
+		"'a' redeclared in this block")
+	expectCompileError(t, `a := 1; const a = 2`,
+		"'a' redeclared in this block")
+	expectCompileError(t, `const a = a`, "unresolved reference 'a'")
+
+	// but they can be shadowed, and their elements modified
+	expectCompile(t, `const a = 1; func() { a := 2 }`,
+		bytecode(
+			concatInsts(
+				tengo.MakeInstruction(parser.OpConstant, 0),
+				tengo.MakeInstruction(parser.OpSetGlobal, 0),
+				tengo.MakeInstruction(parser.OpConstant, 2),
+				tengo.MakeInstruction(parser.OpPop),
+				tengo.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				intObject(2),
+				compiledFunction(1, 0,
+					tengo.MakeInstruction(parser.OpConstant, 1),
+					tengo.MakeInstruction(parser.OpDefineLocal, 0),
+					tengo.MakeInstruction(parser.OpReturn, 0)))))
+	_, err := tengo.NewScript([]byte(`const m = {}; m.a = 1`)).Compile()
+	require.NoError(t, err)
+}
+
 func expectCompile(
 	t *testing.T,
 	input string,
@@ -1464,6 +1732,10 @@ func intObject(v int64) *tengo.Int {
 	return &tengo.Int{Value: v}
 }
 
+func floatObject(v float64) *tengo.Float {
+	return &tengo.Float{Value: v}
+}
+
 func stringObject(v string) *tengo.String {
 	return &tengo.String{Value: v}
 }
@@ -769,3 +769,56 @@ func TestConcurrentLongRunning(t *testing.T) {
 	t.Logf("Total operations: %d", totalOperations)
 	t.Logf("Operations per second: %.2f", float64(totalOperations)/actualDuration.Seconds())
 }
+
+// TestConcurrentMemoize tests a memoized function called concurrently by
+// forked contexts, whose copies of it share the cache
+func TestConcurrentMemoize(t *testing.T) {
+	script := NewScript([]byte(`
+		square := memoize(func(x) { return x * x })
+		run := func(x) { return square(x) }
+	`))
+
+	compiled, err := script.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = compiled.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runFn := compiled.Get("run").Value().(*CompiledFunction)
+	const numGoroutines = 20
+	const callsPerGoroutine = 50
+	children := NewExecutionContext(compiled).Fork(numGoroutines)
+	var wg sync.WaitGroup
+	executionErrors := make(chan error, numGoroutines)
+
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func(id int, ctx *ExecutionContext) {
+			defer wg.Done()
+
+			for j := 0; j < callsPerGoroutine; j++ {
+				x := int64((id + j) % 10)
+				result, err := ctx.Call(runFn, &Int{Value: x})
+				if err != nil {
+					executionErrors <- fmt.Errorf("goroutine %d, call %d: %v", id, j, err)
+					return
+				}
+				if got := result.(*Int).Value; got != x*x {
+					executionErrors <- fmt.Errorf("goroutine %d, call %d: got %d, want %d", id, j, got, x*x)
+					return
+				}
+			}
+		}(i, children[i])
+	}
+
+	wg.Wait()
+	close(executionErrors)
+
+	for err := range executionErrors {
+		t.Error(err)
+	}
+}
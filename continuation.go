@@ -0,0 +1,118 @@
+package tengo
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Suspend returns the error a host function returns to suspend the call of
+// an ExecutionContext that invoked it, handing value to the caller of the
+// ExecutionContext. The call then fails with a *Continuation that resumes it
+// with ExecutionContext.Resume, the value given to Resume becoming the result
+// of the host function.
+//
+// Only the host functions called by the function invoked through the
+// ExecutionContext, or by the functions it calls, can suspend the call: the
+// suspension of a host function called by a callback of a builtin function,
+// such as map_values, by a coroutine or outside of an ExecutionContext is a
+// runtime error.
+func Suspend(value Object) error {
+	if value == nil {
+		value = UndefinedValue
+	}
+	return &suspendSignal{value: value}
+}
+
+// suspendSignal is the error returned by Suspend.
+type suspendSignal struct {
+	value Object
+}
+
+func (s *suspendSignal) Error() string {
+	return "cannot suspend the call here: only host functions called " +
+		"directly by the script of an ExecutionContext call can suspend it"
+}
+
+// Continuation is the error of an ExecutionContext call suspended by a host
+// function with Suspend. It holds the state of the suspended VM until the
+// call is resumed with ExecutionContext.Resume. A Continuation can be resumed
+// only once and is not safe for concurrent use.
+type Continuation struct {
+	ctx         context.Context // Of the call, under which it is resumed
+	ec          *ExecutionContext
+	fn          *CompiledFunction
+	vm          *VM
+	value       Object
+	globals     []Object
+	callGlobals []Object
+	elapsed     time.Duration
+}
+
+// Error returns the message of ErrSuspended.
+func (c *Continuation) Error() string {
+	return ErrSuspended.Error()
+}
+
+// Unwrap returns ErrSuspended.
+func (c *Continuation) Unwrap() error {
+	return ErrSuspended
+}
+
+// Value returns the value passed to Suspend by the host function that
+// suspended the call.
+func (c *Continuation) Value() Object {
+	return c.value
+}
+
+// Resume continues the call suspended with cont, which must have been
+// returned by a call of ec, with value as the result of the host function
+// that suspended it, and returns the result of the call. The call resumes
+// under the context.Context it was made or last resumed with, so cancelling
+// that context aborts it. If the call is suspended again, the error is a new
+// *Continuation. The globals updated by the call are committed to ec once it
+// completes.
+func (ec *ExecutionContext) Resume(cont *Continuation, value Object) (Object, error) {
+	ctx := context.Background()
+	if cont != nil && cont.ctx != nil {
+		ctx = cont.ctx
+	}
+	return ec.ResumeContext(ctx, cont, value)
+}
+
+// ResumeContext is like Resume, but resumes the call under ctx: the call is
+// aborted and the error of ctx returned once ctx is done. The continuation of
+// a further suspension keeps ctx.
+func (ec *ExecutionContext) ResumeContext(ctx context.Context, cont *Continuation, value Object) (Object, error) {
+	if cont == nil {
+		return nil, errors.New("nil continuation")
+	}
+	if cont.ec != ec {
+		return nil, errors.New(
+			"continuation does not belong to the execution context")
+	}
+	vm := cont.vm
+	if vm == nil {
+		return nil, errors.New("continuation already resumed")
+	}
+	cont.vm = nil
+
+	start := time.Now()
+	result, updatedGlobals, err := cont.fn.runCall(ctx, ec, vm,
+		func() error {
+			return vm.resume(value)
+		})
+	elapsed := cont.elapsed + time.Since(start)
+	if next, ok := err.(*Continuation); ok {
+		next.ctx, next.ec = ctx, ec
+		next.globals, next.callGlobals = cont.globals, cont.callGlobals
+		next.elapsed = elapsed
+		return nil, next
+	}
+	result, _, err = ec.finishCall(result, updatedGlobals, err,
+		cont.globals, cont.callGlobals)
+	if ec.metrics != nil {
+		ec.metrics.recordCall(elapsed, err)
+	}
+	return result, err
+}
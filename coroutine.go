@@ -0,0 +1,254 @@
+package tengo
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Coroutine represents a compiled function running in its own VM that can
+// suspend itself with the yield statement and be resumed later. Coroutines
+// are created by the builtin function 'coroutine' and share the constants
+// and globals of the VM that created them. A Coroutine is not safe for
+// concurrent use.
+type Coroutine struct {
+	ObjectImpl
+	vm      *VM
+	running bool
+	done    bool
+}
+
+func newCoroutine(v *VM, fn *CompiledFunction, args []Object) (*Coroutine, error) {
+	if err := fn.checkArity(len(args)); err != nil {
+		return nil, err
+	}
+	co := &VM{
+		constants:  v.constants,
+		globals:    v.globals,
+		fileSet:    v.fileSet,
+		maxAllocs:  v.maxAllocs,
+		allocs:     v.allocs,
+		ctx:        v.ctx,
+		stackTrace: v.stackTrace,
+		overflow:   v.overflow,
+		readOnly:   v.readOnly,
+		sortedMaps: v.sortedMaps,
+		profile:    v.profile,
+		lazy:       v.lazy,
+		alloc:      v.alloc,
+		metrics:    v.metrics,
+		recorder:   v.recorder,
+		tracer:     v.tracer,
+		traceDepth: v.callDepth(),
+		frameBase:  v.frameBase + v.framesIndex,
+		depth:      v.depth,
+		observer:   v.observer,
+		output:     v.output,
+		coroutine:  true,
+	}
+	if len(fn.Instructions) == 0 {
+		return &Coroutine{vm: co, done: true}, nil
+	}
+	fn.setupCall(co, args)
+	if co.profile != nil {
+		co.profile.count(fn)
+	}
+	return &Coroutine{vm: co}, nil
+}
+
+// TypeName returns the name of the type.
+func (o *Coroutine) TypeName() string {
+	return "coroutine"
+}
+
+func (o *Coroutine) String() string {
+	return "<coroutine>"
+}
+
+// IsFalsy returns true if the coroutine has completed.
+func (o *Coroutine) IsFalsy() bool {
+	return o.done
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (o *Coroutine) Equals(x Object) bool {
+	return o == x // pointer equality
+}
+
+// Copy returns a copy of the type. The copy continues independently from the
+// point the coroutine is currently suspended at.
+func (o *Coroutine) Copy() Object {
+	vm := *o.vm
+	vm.curFrame = &vm.frames[vm.framesIndex-1]
+	vm.deferred = append([]deferredCall(nil), o.vm.deferred...)
+	return &Coroutine{vm: &vm, running: o.running, done: o.done}
+}
+
+// IndexGet returns the methods of the coroutine: 'resume' and 'done'.
+func (o *Coroutine) IndexGet(index Object) (Object, error) {
+	name, _ := ToString(index)
+	switch name {
+	case "resume":
+		return &UserFunction{
+			Name: "resume",
+			Value: func(args ...Object) (Object, error) {
+				if len(args) != 0 {
+					return nil, ErrWrongNumArguments
+				}
+				return o.Resume()
+			},
+			VMValue: func(v *VM, args ...Object) (Object, error) {
+				if len(args) != 0 {
+					return nil, ErrWrongNumArguments
+				}
+				return o.resume(v)
+			},
+		}, nil
+	case "done":
+		return &UserFunction{
+			Name: "done",
+			Value: func(args ...Object) (Object, error) {
+				if len(args) != 0 {
+					return nil, ErrWrongNumArguments
+				}
+				if o.done {
+					return TrueValue, nil
+				}
+				return FalseValue, nil
+			},
+		}, nil
+	}
+	return nil, ErrInvalidIndexType
+}
+
+// CanIterate returns true.
+func (o *Coroutine) CanIterate() bool {
+	return true
+}
+
+// Iterate returns an iterator over the values yielded by the coroutine.
+func (o *Coroutine) Iterate() Iterator {
+	return &CoroutineIterator{co: o}
+}
+
+// Done returns true if the coroutine has completed.
+func (o *Coroutine) Done() bool {
+	return o.done
+}
+
+// Resume runs the coroutine until it yields a value or completes, and
+// returns the yielded or the returned value. Once the coroutine has
+// completed, Resume returns undefined.
+func (o *Coroutine) Resume() (Object, error) {
+	return o.resume(nil)
+}
+
+// resume resumes the coroutine on behalf of the VM caller, if not nil, so
+// that aborting caller also aborts the coroutine.
+func (o *Coroutine) resume(caller *VM) (Object, error) {
+	if o.done {
+		return UndefinedValue, nil
+	}
+	if o.running {
+		return nil, errors.New("coroutine is already running")
+	}
+
+	v := o.vm
+	v.sharedAbort = nil
+	if caller != nil {
+		v.sharedAbort = caller.abortFlag()
+	}
+	o.running = true
+	allocs := v.allocs
+	v.run()
+	v.unwindDeferred()
+	o.running = false
+	if v.err == nil && atomic.LoadInt64(v.abortFlag()) != 0 {
+		v.err = errCallAborted
+	}
+	if v.metrics != nil {
+		// coroutines outlive the calls that create them, so they report
+		// their work after each resumption
+		v.metrics.recordWork(v.executed, allocs-v.allocs)
+		v.executed = 0
+	}
+	if v.err != nil {
+		o.done = true
+		return nil, v.callError()
+	}
+	if v.yielded {
+		v.yielded = false
+		v.sp--
+		return v.stack[v.sp], nil
+	}
+	o.done = true
+	return v.stack[v.sp-1], nil
+}
+
+// CoroutineIterator is an iterator over the values yielded by a coroutine.
+type CoroutineIterator struct {
+	ObjectImpl
+	co    *Coroutine
+	i     int
+	value Object
+	err   error
+}
+
+// TypeName returns the name of the type.
+func (i *CoroutineIterator) TypeName() string {
+	return "coroutine-iterator"
+}
+
+func (i *CoroutineIterator) String() string {
+	return "<coroutine-iterator>"
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (i *CoroutineIterator) IsFalsy() bool {
+	return true
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (i *CoroutineIterator) Equals(Object) bool {
+	return false
+}
+
+// Copy returns a copy of the type.
+func (i *CoroutineIterator) Copy() Object {
+	return &CoroutineIterator{co: i.co, i: i.i, value: i.value, err: i.err}
+}
+
+// Next resumes the coroutine and returns true if it yielded a value. The
+// value returned when the coroutine completes is not part of the iteration.
+func (i *CoroutineIterator) Next() bool {
+	return i.next(nil)
+}
+
+// next is Next on behalf of the VM caller, if not nil.
+func (i *CoroutineIterator) next(caller *VM) bool {
+	if i.co.done {
+		return false
+	}
+	value, err := i.co.resume(caller)
+	if err != nil {
+		i.err = err
+		return false
+	}
+	if i.co.done {
+		return false
+	}
+	i.i++
+	i.value = value
+	return true
+}
+
+// Key returns the number of values yielded before the current one.
+func (i *CoroutineIterator) Key() Object {
+	return internInt(int64(i.i - 1))
+}
+
+// Value returns the value yielded by the coroutine.
+func (i *CoroutineIterator) Value() Object {
+	return i.value
+}
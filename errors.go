@@ -3,6 +3,8 @@ package tengo
 import (
 	"errors"
 	"fmt"
+
+	"github.com/tiagoj/tengo/v2/parser"
 )
 
 var (
@@ -28,6 +30,44 @@ var (
 	// ErrInvalidOperator represents an error for invalid operator usage.
 	ErrInvalidOperator = errors.New("invalid operator")
 
+	// ErrFunctionContextMismatch represents an error where a function is
+	// called through an ExecutionContext of a script other than the one it
+	// was compiled with.
+	ErrFunctionContextMismatch = errors.New(
+		"function does not belong to the script of the execution context")
+
+	// ErrIntOverflow represents an error where the result of an int
+	// operation overflows int64. It's only reported by contexts created with
+	// ExecutionContext.WithOverflowChecks.
+	ErrIntOverflow = errors.New("integer overflow")
+
+	// ErrResultTooLarge represents an error where the result of a call made
+	// through an ExecutionContext has more objects than allowed by
+	// ExecutionContext.WithMaxResultSize.
+	ErrResultTooLarge = errors.New("result too large")
+
+	// ErrOutputLimit represents an error where a call made through an
+	// ExecutionContext writes more output than allowed by
+	// ExecutionContext.WithMaxOutput.
+	ErrOutputLimit = errors.New("exceeding output size limit")
+
+	// ErrSuspended represents an error where a call made through an
+	// ExecutionContext was suspended by a host function with Suspend. The
+	// error is a *Continuation that resumes the call.
+	ErrSuspended = errors.New("call suspended")
+
+	// ErrReplayDiverged represents an error where a call made through an
+	// ExecutionContext created by ExecutionContext.ReplayFrom calls host
+	// functions that don't match the recording.
+	ErrReplayDiverged = errors.New("replay diverged from recording")
+
+	// ErrReadOnlyGlobal represents an error where a function called by
+	// ExecutionContext.CallStrictReadOnly assigns to a global variable.
+	ErrReadOnlyGlobal = errors.New("cannot assign to a global in a read-only call")
+
+	// ErrDivisionByZero represents an error where an int is divided by zero.
+	ErrDivisionByZero = errors.New("division by zero")
+
 	// ErrWrongNumArguments represents a wrong number of arguments error.
 	ErrWrongNumArguments = errors.New("wrong number of arguments")
 
@@ -50,8 +90,13 @@ var (
 	// required method.
 	ErrNotImplemented = errors.New("not implemented")
 
-	// ErrInvalidRangeStep is an error where the step parameter is less than or equal to 0 when using builtin range function.
-	ErrInvalidRangeStep = errors.New("range step must be greater than 0")
+	// ErrInvalidRangeStep is an error where the step parameter is 0 when using builtin range function.
+	ErrInvalidRangeStep = errors.New("range step must not be 0")
+
+	// ErrRangeStepDirection is an error where the step parameter of the
+	// builtin range function is negative while start is less than stop.
+	ErrRangeStepDirection = errors.New(
+		"negative range step with start less than stop")
 
 	// ErrMissingConstants represents an error where constants are required but not provided.
 	ErrMissingConstants = errors.New("missing constants for function execution")
@@ -119,3 +164,79 @@ func (e ErrInvalidGlobalsArray) Error() string {
 	}
 	return fmt.Sprintf("invalid globals array: %s", e.Reason)
 }
+
+// ErrInvalidBytecode represents an error where a compiled function cannot be
+// executed against the constants and globals of an execution context.
+type ErrInvalidBytecode struct {
+	Reason string
+	Offset int
+}
+
+func (e ErrInvalidBytecode) Error() string {
+	if e.Offset >= 0 {
+		return fmt.Sprintf("invalid bytecode at offset %d: %s", e.Offset, e.Reason)
+	}
+	return fmt.Sprintf("invalid bytecode: %s", e.Reason)
+}
+
+// ErrInvalidGlobalType represents an error where a global variable cannot be
+// converted to the requested Go type.
+type ErrInvalidGlobalType struct {
+	Name     string
+	Expected string
+	Found    string
+}
+
+func (e ErrInvalidGlobalType) Error() string {
+	return fmt.Sprintf("invalid type for global '%s': expected %s, found %s",
+		e.Name, e.Expected, e.Found)
+}
+
+// ErrAssertionFailed represents an error raised by the builtin function
+// assert when its condition is falsy. Pos is the source position of the
+// assert call if available.
+type ErrAssertionFailed struct {
+	Message string
+	Pos     parser.SourceFilePos
+}
+
+func (e ErrAssertionFailed) Error() string {
+	if e.Message == "" {
+		return "assertion failed"
+	}
+	return fmt.Sprintf("assertion failed: %s", e.Message)
+}
+
+// ErrPanic represents an error raised by the builtin function panic and not
+// recovered by a deferred function. Value is the value passed to panic.
+type ErrPanic struct {
+	Value Object
+}
+
+func (e ErrPanic) Error() string {
+	if s, ok := e.Value.(*String); ok {
+		return "panic: " + s.Value
+	}
+	return "panic: " + e.Value.String()
+}
+
+// ErrRuntime is a runtime error annotated with the script call stack at the
+// point the error occurred. It is only returned when stack traces are
+// enabled.
+type ErrRuntime struct {
+	Err   error
+	Trace []Frame
+}
+
+func (e ErrRuntime) Error() string {
+	return e.Err.Error()
+}
+
+func (e ErrRuntime) Unwrap() error {
+	return e.Err
+}
+
+// StackTrace returns the script call stack, innermost frame first.
+func (e ErrRuntime) StackTrace() []Frame {
+	return e.Trace
+}
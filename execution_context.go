@@ -1,74 +1,1381 @@
 package tengo
 
 import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tiagoj/tengo/v2/parser"
 )
 
 // ExecutionContext provides a context-aware execution environment for compiled functions.
 // It bundles constants, globals, and the original compiled object together to ensure
 // that closures have access to their complete execution context.
 type ExecutionContext struct {
-	constants []Object
-	globals   []Object
-	source    *Compiled
-	lock      sync.RWMutex // Protects globals for concurrent access
+	constants  []Object
+	globals    []Object
+	source     *Compiled
+	logger     LoggerFunc
+	output     io.Writer
+	values     map[string]Object
+	transform  GlobalsTransformFunc
+	validator  ArgValidatorFunc
+	intercept  ArgInterceptorFunc
+	lazy       map[int]*lazyGlobal
+	alloc      AllocatorFunc
+	stackTrace bool
+	overflow   bool
+	readOnly   bool
+	sortedMaps bool
+	coercion   bool
+	groupLimit int
+	maxResult  int
+	maxOutput  int
+	profile    *callProfile
+	metrics    *callMetrics
+	recorder   *callRecorder
+	tracer     *callTracer
+	observer   ReturnObserverFunc
+	normalize  ResultTransformFunc
+	random     *lockedSource
+	lock       sync.RWMutex  // Protects globals for concurrent access
+	deadline   *callDeadline // Shared with the contexts derived from ec
+
+	callsLock sync.Mutex       // Protects calls
+	calls     map[*VM]struct{} // VMs of the calls in progress through ec
+}
+
+// callDeadline is the deadline of the calls made through an ExecutionContext
+// and the contexts derived from it.
+type callDeadline struct {
+	lock    sync.Mutex // Protects the fields below
+	at      time.Time
+	timer   *time.Timer
+	running map[*VM]struct{} // VMs of the calls in progress
 }
 
+// LoggerFunc receives log events emitted by scripts through the builtin
+// 'log' function. The fields map holds copies of the script values and may be
+// retained by the callee.
+type LoggerFunc func(level string, msg string, fields map[string]Object)
+
+// GlobalsTransformFunc receives a copy of the globals before each call and
+// returns the globals the call runs against.
+type GlobalsTransformFunc func(globals []Object) []Object
+
+// ArgValidatorFunc receives the name of a function and the arguments it's
+// about to be called with, and returns an error to reject the call. The name
+// is the one the function was defined with in the script, e.g. "f" for
+// f := func(x) {...}, or an empty string for anonymous functions.
+type ArgValidatorFunc func(fnName string, args []Object) error
+
+// ArgInterceptorFunc receives the name of a function and the arguments it's
+// about to be called with, and returns the arguments to call it with
+// instead. The name is the same as for ArgValidatorFunc. The args slice is a
+// copy that may be modified and returned.
+type ArgInterceptorFunc func(fnName string, args []Object) []Object
+
+// ReturnObserverFunc receives the value returned by a compiled function and
+// the depth of its frame, as counted by ExecutionContext.CurrentDepth.
+type ReturnObserverFunc func(depth int, value Object)
+
+// ResultTransformFunc receives the result of a call and returns the value
+// to return to the host instead.
+type ResultTransformFunc func(result Object) Object
+
+// ObjectKind identifies the type of the objects an AllocatorFunc creates.
+type ObjectKind int
+
+// The kinds of objects the VM creates with an AllocatorFunc.
+const (
+	ObjectKindInt   ObjectKind = iota // *Int
+	ObjectKindArray                   // *Array
+	ObjectKindMap                     // *Map
+)
+
+// AllocatorFunc returns a new object of the given kind, e.g. taken from a
+// pool or an arena. The VM overwrites the Value of the object before using
+// it.
+type AllocatorFunc func(kind ObjectKind) Object
+
 // NewExecutionContext creates a new ExecutionContext from a compiled script.
 // It captures the constants and globals from the compiled object to provide
 // a complete execution context for closures.
 func NewExecutionContext(compiled *Compiled) *ExecutionContext {
 	return &ExecutionContext{
-		constants: compiled.Constants(),
-		globals:   compiled.Globals(),
-		source:    compiled,
+		constants:  compiled.Constants(),
+		globals:    compiled.Globals(),
+		source:     compiled,
+		stackTrace: compiled.stackTrace,
+		deadline:   &callDeadline{},
+	}
+}
+
+// WithGlobals creates a new ExecutionContext with specific globals.
+// This is useful for creating isolated execution contexts or for testing.
+func (ec *ExecutionContext) WithGlobals(globals []Object) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	return ec.derive(globals)
+}
+
+// WithIsolatedGlobals creates a new ExecutionContext with a copy of the current globals.
+// This ensures thread-safe execution by providing each context with its own globals copy.
+func (ec *ExecutionContext) WithIsolatedGlobals() *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	// Create a deep copy of globals to ensure isolation
+	return ec.derive(copyGlobals(ec.globals))
+}
+
+// Fork creates n isolated ExecutionContexts at once. The children share the
+// constants and configuration of ec, and each gets its own deep copy of the
+// current globals, as if created by WithIsolatedGlobals. The copies are made
+// in parallel for large n.
+func (ec *ExecutionContext) Fork(n int) []*ExecutionContext {
+	if n <= 0 {
+		return nil
+	}
+
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	children := make([]*ExecutionContext, n)
+	workers := runtime.GOMAXPROCS(0)
+	if workers > n {
+		workers = n
+	}
+	if n < forkParallelThreshold || workers < 2 {
+		for i := range children {
+			children[i] = ec.derive(copyGlobals(ec.globals))
+		}
+		return children
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < n; i += workers {
+				children[i] = ec.derive(copyGlobals(ec.globals))
+			}
+		}(w)
+	}
+	wg.Wait()
+	return children
+}
+
+// forkParallelThreshold is the number of children from which Fork copies
+// globals in parallel.
+const forkParallelThreshold = 16
+
+// copyGlobals returns a deep copy of globals.
+func copyGlobals(globals []Object) []Object {
+	copied := make([]Object, len(globals))
+	for i, g := range globals {
+		if g != nil {
+			copied[i] = g.Copy()
+		}
+	}
+	return copied
+}
+
+// WithLogger creates a new ExecutionContext that routes log events emitted by
+// the builtin 'log' function to fn. Without a logger, 'log' is a no-op.
+func (ec *ExecutionContext) WithLogger(fn LoggerFunc) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.logger = fn
+	return derived
+}
+
+// WithValues creates a new ExecutionContext whose scripts can read the given
+// values with the builtin 'ctx_value', e.g. to pass request-scoped data such
+// as a tenant or trace ID without adding globals. The map is copied, and the
+// values are copied again each time they are read, so scripts cannot modify
+// them. Values are not part of the globals and are never updated by calls.
+func (ec *ExecutionContext) WithValues(values map[string]Object) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.values = make(map[string]Object, len(values))
+	for k, v := range values {
+		derived.values[k] = v
+	}
+	return derived
+}
+
+// WithOutput creates a new ExecutionContext whose calls write the output of
+// the print functions of the "fmt" module, and of other functions using
+// VM.Output, to w. Without an output, they write to os.Stdout.
+func (ec *ExecutionContext) WithOutput(w io.Writer) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.output = w
+	return derived
+}
+
+// WithGlobalsTransform creates a new ExecutionContext that applies fn to a
+// copy of the globals at the start of each CallEx and runs the call against
+// the transformed globals. Values put in place by fn are discarded after the
+// call; only globals the script itself assigns are committed to the context.
+// This is useful for injecting request-scoped values.
+func (ec *ExecutionContext) WithGlobalsTransform(fn GlobalsTransformFunc) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.transform = fn
+	return derived
+}
+
+// WithArgValidator creates a new ExecutionContext that passes the function
+// and arguments of each call to fn before running it. If fn returns an error,
+// the call is rejected with that error without executing, and the globals are
+// left unchanged. This lets hosts enforce argument policies, such as size
+// limits, in one place. Only the calls made through the context are
+// validated, not the calls the script makes itself.
+func (ec *ExecutionContext) WithArgValidator(fn ArgValidatorFunc) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.validator = fn
+	return derived
+}
+
+// WithArgInterceptor creates a new ExecutionContext that passes the function
+// and arguments of each call to fn before running it, and calls the function
+// with the arguments fn returns instead, e.g. to redact sensitive values or
+// add default arguments. The arguments are rewritten before they're coerced
+// and validated. Only the calls made through the context are intercepted,
+// not the calls the script makes itself.
+func (ec *ExecutionContext) WithArgInterceptor(fn ArgInterceptorFunc) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.intercept = fn
+	return derived
+}
+
+// WithReturnObserver creates a new ExecutionContext that passes the value
+// returned by every compiled function during its calls to fn, with the depth
+// of the returning frame: 1 for the function passed to Call, 2 for the
+// functions it calls, and so on. Returns are observed innermost first, so a
+// value can be followed through nested returns. A function that recovers
+// from a runtime error returns undefined, and functions left by an error or
+// replaced by a tail call don't return. fn runs on the goroutine of the call
+// and receives the values themselves, not copies. A nil fn disables the
+// observer, which is the default.
+func (ec *ExecutionContext) WithReturnObserver(fn ReturnObserverFunc) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.observer = fn
+	return derived
+}
+
+// WithResultTransform creates a new ExecutionContext that passes the result
+// of each successful call to fn and returns the value fn returns instead,
+// e.g. to convert error values into a standard shape in one place rather
+// than at every call site. fn isn't called when the call fails with a Go
+// error, and a nil value returned by fn is returned as undefined. The globals
+// the call left are committed before fn runs, and the result size limit set
+// by WithMaxResultSize applies to the result of the call, not to the value
+// fn returns. A nil fn disables the transform, which is the default.
+func (ec *ExecutionContext) WithResultTransform(fn ResultTransformFunc) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.normalize = fn
+	return derived
+}
+
+// WithLazyGlobal creates a new ExecutionContext that computes the value of
+// the global variable with the given name by calling provider the first time
+// a script reads it while it's undefined, e.g. to fetch configuration only
+// when it's used. The value is stored into the global and returned by all
+// the later reads, including the reads of the contexts derived from the new
+// one, so provider is called at most once. Once a script assigns the global,
+// the assigned value is used, even if undefined. The name must be a global of the
+// script, declared by the script or added with Script.Add; otherwise the
+// returned context behaves like ec. provider must be safe to call from the
+// goroutine of any call.
+func (ec *ExecutionContext) WithLazyGlobal(name string, provider func() Object) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	if ec.source == nil {
+		return derived
+	}
+	idx, ok := ec.source.globalIndexes[name]
+	if !ok {
+		return derived
+	}
+	derived.lazy = make(map[int]*lazyGlobal, len(ec.lazy)+1)
+	for i, g := range ec.lazy {
+		derived.lazy[i] = g
+	}
+	derived.lazy[idx] = &lazyGlobal{provider: provider}
+	return derived
+}
+
+// WithAllocator creates a new ExecutionContext whose calls get the *Int,
+// *Array and *Map objects the VM creates from alloc instead of allocating
+// them, so that hosts making many short calls can recycle them, e.g. from a
+// sync.Pool or an arena reset between calls. The VM creates these objects for
+// the results of integer arithmetic and of the unary operators, for array and
+// map literals, for array slices and for the arguments of variadic functions.
+// The objects created by builtin functions, Go functions, user types and
+// other operators are still allocated with new.
+//
+// alloc must return a non-nil object of the type the kind stands for; any
+// other result is ignored and the object allocated with new. alloc is called
+// from the goroutine of the call and must be safe for concurrent use if the
+// context is.
+//
+// The objects are ordinary tengo values once created: the VM doesn't tell
+// when they are no longer used. They may be stored into globals, captured by
+// closures, returned by the call or kept by Go functions, and must not be
+// reused while reachable from any of these. A host that recycles them must
+// only do so once it knows the results of the call and the globals don't
+// reference them, e.g. after converting the result to Go values and without
+// committing the globals.
+func (ec *ExecutionContext) WithAllocator(alloc AllocatorFunc) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.alloc = alloc
+	return derived
+}
+
+// lazyGlobal is a global variable whose value is computed on first read.
+type lazyGlobal struct {
+	once     sync.Once
+	provider func() Object
+	value    Object
+	assigned atomic.Bool // set once a script assigns the global
+}
+
+// get returns the value of the global, calling the provider on first use.
+func (g *lazyGlobal) get() Object {
+	g.once.Do(func() {
+		g.value = g.provider()
+		if g.value == nil {
+			g.value = UndefinedValue
+		}
+	})
+	return g.value
+}
+
+// WithStackTrace creates a new ExecutionContext that captures the script call
+// stack for errors raised during calls: error values created by scripts
+// provide it through Error.StackTrace, and runtime errors are returned as
+// ErrRuntime. Capturing stack traces makes creating error values slower. It
+// defaults to the setting of the source Compiled.
+func (ec *ExecutionContext) WithStackTrace(enable bool) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.stackTrace = enable
+	return derived
+}
+
+// WithOverflowChecks creates a new ExecutionContext whose calls fail with a
+// runtime error wrapping ErrIntOverflow when the result of +, - or * on ints,
+// or the negation of an int, overflows int64, instead of wrapping around.
+// Checks are disabled by default, as they make int arithmetic slower.
+func (ec *ExecutionContext) WithOverflowChecks(enable bool) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.overflow = enable
+	return derived
+}
+
+// WithDeterministicMaps creates a new ExecutionContext whose calls iterate
+// maps and immutable maps with for-in statements in the ascending order of
+// their keys, instead of a random order. Only the iteration order changes,
+// not how maps are stored, but the keys are sorted each time a loop starts,
+// which makes iterating large maps slower. It's disabled by default.
+func (ec *ExecutionContext) WithDeterministicMaps(enable bool) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.sortedMaps = enable
+	return derived
+}
+
+// WithArgCoercion creates a new ExecutionContext that promotes numeric
+// arguments passed to Call and CallEx the way binary operators in scripts
+// promote their operands: if at least one argument is a *Float, every *Int
+// argument is converted to a *Float of the same value. Arguments are left
+// unchanged when none of them is a *Float, and values nested in arrays or
+// maps are never converted. Coercion is disabled by default, so functions
+// receive the arguments exactly as given, like calls made from scripts.
+func (ec *ExecutionContext) WithArgCoercion(enable bool) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.coercion = enable
+	return derived
+}
+
+// WithCallGroupLimit creates a new ExecutionContext whose CallGroup runs at
+// most n calls at the same time. If n is not greater than 0, which is the
+// default, the limit is runtime.GOMAXPROCS(0).
+func (ec *ExecutionContext) WithCallGroupLimit(n int) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.groupLimit = n
+	return derived
+}
+
+// WithMaxResultSize creates a new ExecutionContext whose calls fail with
+// ErrResultTooLarge if they return more than n objects, counting the elements
+// of the arrays and maps of the result recursively. If n is not greater than
+// 0, which is the default, results are not limited.
+func (ec *ExecutionContext) WithMaxResultSize(n int) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.maxResult = n
+	return derived
+}
+
+// WithMaxOutput creates a new ExecutionContext whose calls fail with
+// ErrOutputLimit if they write more than n bytes to their output, see
+// WithOutput. The output is written up to the limit and the rest is discarded,
+// while the call runs to completion. Each call has its own limit. If n is not
+// greater than 0, which is the default, the output is not limited.
+func (ec *ExecutionContext) WithMaxOutput(n int) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.maxOutput = n
+	return derived
+}
+
+// outputLimit writes the output of a call to w until the limit is reached,
+// and discards the rest.
+type outputLimit struct {
+	w        io.Writer
+	left     int  // bytes that can still be written
+	exceeded bool // set once some output was discarded
+}
+
+func (o *outputLimit) Write(p []byte) (int, error) {
+	if len(p) <= o.left {
+		n, err := o.w.Write(p)
+		o.left -= n
+		return n, err
+	}
+	o.exceeded = true
+	n, err := o.w.Write(p[:o.left])
+	o.left -= n
+	if err != nil {
+		return n, err
+	}
+	return n, ErrOutputLimit
+}
+
+// resultSize returns the number of objects of o, including the elements of
+// its arrays, maps and error values recursively, stopping once the count
+// exceeds max. Objects referenced several times are counted each time, but
+// their elements only once.
+func resultSize(o Object, max int) int {
+	var n int
+	seen := make(map[Object]struct{})
+	pending := []Object{o}
+	for len(pending) > 0 && n <= max {
+		o := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		n++
+		switch o.(type) {
+		case *Array, *ImmutableArray, *Map, *ImmutableMap, *Error:
+		default:
+			continue
+		}
+		if _, ok := seen[o]; ok {
+			continue
+		}
+		seen[o] = struct{}{}
+		switch o := o.(type) {
+		case *Array:
+			pending = append(pending, o.Value...)
+		case *ImmutableArray:
+			pending = append(pending, o.Value...)
+		case *Map:
+			for _, v := range o.Value {
+				pending = append(pending, v)
+			}
+		case *ImmutableMap:
+			for _, v := range o.Value {
+				pending = append(pending, v)
+			}
+		case *Error:
+			pending = append(pending, o.Value)
+		}
+	}
+	return n
+}
+
+// WithSeed creates a new ExecutionContext with its own random source seeded
+// with n, which the functions of the 'rand' module use instead of the global
+// one, so that the same sequence of calls returns the same random numbers.
+// The source is shared by the contexts derived from the new one, and isn't
+// affected by other contexts, but calls running concurrently draw numbers in
+// an unpredictable order.
+func (ec *ExecutionContext) WithSeed(n int64) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.random = &lockedSource{src: rand.NewSource(n).(rand.Source64)}
+	return derived
+}
+
+// lockedSource is a rand.Source64 safe for concurrent use.
+type lockedSource struct {
+	lock sync.Mutex
+	src  rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.src.Seed(seed)
+}
+
+// StartRecording creates a new ExecutionContext that records the results of
+// the host functions called during its calls, so that ReplayFrom can
+// reproduce them later. Host functions are the Go functions that don't call
+// back into the VM, such as the functions of the stdlib modules, including
+// the random numbers of 'rand' and the clock of 'times', and the functions
+// added with Script.Add. The returned Recording is filled as the calls run,
+// and is shared by the contexts derived from the new one.
+func (ec *ExecutionContext) StartRecording() (*ExecutionContext, *Recording) {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	rec := &Recording{}
+	derived := ec.derive(ec.globals)
+	derived.recorder = &callRecorder{rec: rec}
+	return derived, rec
+}
+
+// ReplayFrom creates a new ExecutionContext whose calls don't call host
+// functions, but return the results recorded in rec instead, in the order
+// they were recorded. Replaying the calls that were recorded, with the same
+// arguments and in the same order, produces the same results. If the script
+// calls a different host function than the recorded one, or more host
+// functions than were recorded, the call fails with ErrReplayDiverged. The
+// calls must run sequentially, as they did when recording.
+func (ec *ExecutionContext) ReplayFrom(rec *Recording) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.recorder = &callRecorder{rec: rec, replay: true}
+	return derived
+}
+
+// Recording holds the results of the host functions called through an
+// ExecutionContext created by StartRecording. It can be written with Encode
+// and read back with Decode, e.g. to replay calls in another process.
+type Recording struct {
+	lock    sync.Mutex
+	entries []recordedCall
+}
+
+// recordedCall is the result of a host function call. Errors are kept as
+// their messages.
+type recordedCall struct {
+	Name    string
+	Result  Object
+	Err     string
+	ArgType *ErrInvalidArgumentType // set if the call failed with one
+	Failed  bool
+}
+
+// err returns the error the recorded call failed with.
+func (c recordedCall) err() error {
+	switch {
+	case c.ArgType != nil:
+		return *c.ArgType
+	case c.Err == ErrWrongNumArguments.Error():
+		return ErrWrongNumArguments
+	}
+	return errors.New(c.Err)
+}
+
+// Len returns the number of host function calls recorded in r.
+func (r *Recording) Len() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.entries)
+}
+
+// Encode writes r to w. Results that cannot be serialized, such as functions,
+// result in an error.
+func (r *Recording) Encode(w io.Writer) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i, e := range r.entries {
+		if e.Result == nil {
+			continue
+		}
+		if err := checkSavable(e.Result); err != nil {
+			return fmt.Errorf("cannot encode result of call %d to '%s': %w",
+				i, e.Name, err)
+		}
+	}
+	return gob.NewEncoder(w).Encode(r.entries)
+}
+
+// Decode replaces the content of r with the recording read from rd, as
+// written by Encode.
+func (r *Recording) Decode(rd io.Reader) error {
+	var entries []recordedCall
+	if err := gob.NewDecoder(rd).Decode(&entries); err != nil {
+		return err
+	}
+	for i, e := range entries {
+		if e.Result == nil {
+			continue
+		}
+		v, err := fixDecodedObject(e.Result, NewModuleMap())
+		if err != nil {
+			return err
+		}
+		entries[i].Result = v
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.entries = entries
+	return nil
+}
+
+// callRecorder records the results of the host functions called by a VM in
+// a Recording, or replays them from it.
+type callRecorder struct {
+	rec    *Recording
+	replay bool
+	lock   sync.Mutex
+	next   int // index of the next call to replay
+}
+
+// call calls fn with args, or returns its recorded result when replaying.
+func (c *callRecorder) call(fn *UserFunction, args []Object) (Object, error) {
+	if c.replay {
+		return c.replayCall(fn)
+	}
+
+	ret, err := fn.Call(args...)
+	entry := recordedCall{Name: fn.Name}
+	if err != nil {
+		entry.Err = err.Error()
+		if e, ok := err.(ErrInvalidArgumentType); ok {
+			entry.ArgType = &e
+		}
+		entry.Failed = true
+	} else if ret != nil {
+		entry.Result = ret.Copy()
+	}
+	c.rec.lock.Lock()
+	c.rec.entries = append(c.rec.entries, entry)
+	c.rec.lock.Unlock()
+	return ret, err
+}
+
+func (c *callRecorder) replayCall(fn *UserFunction) (Object, error) {
+	c.lock.Lock()
+	i := c.next
+	c.next++
+	c.lock.Unlock()
+
+	c.rec.lock.Lock()
+	defer c.rec.lock.Unlock()
+	if i >= len(c.rec.entries) {
+		return nil, fmt.Errorf("%w: unexpected call to '%s'",
+			ErrReplayDiverged, fn.Name)
+	}
+	entry := c.rec.entries[i]
+	if entry.Name != fn.Name {
+		return nil, fmt.Errorf("%w: expected call to '%s', found '%s'",
+			ErrReplayDiverged, entry.Name, fn.Name)
+	}
+	if entry.Failed {
+		return nil, entry.err()
+	}
+	if entry.Result == nil {
+		return nil, nil
+	}
+	return entry.Result.Copy(), nil
+}
+
+// WithExecutionTrace creates a new ExecutionContext that writes a trace of
+// the function calls made during its calls to w: one line when a function is
+// entered, with its arguments, and one when it returns, with its result or
+// error, indented by the depth of the call. Compiled functions, builtins and
+// host functions are all traced, including the callbacks run by builtins.
+// Recursive tail calls are traced as the return of the caller followed by a
+// new call, and other tail calls are not optimized while tracing. The lines
+// of concurrent calls are written whole but may be interleaved. A nil w
+// disables the trace, which is the default.
+func (ec *ExecutionContext) WithExecutionTrace(w io.Writer) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.tracer = nil
+	if w != nil {
+		derived.tracer = &callTracer{w: w}
+	}
+	return derived
+}
+
+// callTracer writes the call trace of an ExecutionContext created by
+// WithExecutionTrace. It's safe for concurrent use.
+type callTracer struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// enter traces a call of fn at the given depth.
+func (t *callTracer) enter(depth int, fn Object, args []Object) {
+	var b strings.Builder
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteString("-> ")
+	b.WriteString(callName(fn))
+	b.WriteByte('(')
+	for i, arg := range args {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(arg.String())
+	}
+	b.WriteString(")\n")
+	t.write(b.String())
+}
+
+// exit traces the return of a call of fn at the given depth, with either its
+// result or its error.
+func (t *callTracer) exit(depth int, fn Object, result Object, err error) {
+	var b strings.Builder
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteString("<- ")
+	b.WriteString(callName(fn))
+	switch {
+	case err != nil:
+		b.WriteString(" error: ")
+		b.WriteString(err.Error())
+	case result == nil:
+		b.WriteString(" = ")
+		b.WriteString(UndefinedValue.String())
+	default:
+		b.WriteString(" = ")
+		b.WriteString(result.String())
+	}
+	b.WriteByte('\n')
+	t.write(b.String())
+}
+
+// tailCall traces the return of a call of fn at the given depth that is
+// replaced by a tail call.
+func (t *callTracer) tailCall(depth int, fn Object) {
+	t.write(strings.Repeat("  ", depth) + "<- " + callName(fn) +
+		" (tail call)\n")
+}
+
+func (t *callTracer) write(line string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	_, _ = io.WriteString(t.w, line)
+}
+
+// callName returns the name of a callable object for the call trace.
+func callName(fn Object) string {
+	var name string
+	switch fn := fn.(type) {
+	case *CompiledFunction:
+		name = fn.Name
+	case *BuiltinFunction:
+		name = fn.Name
+	case *UserFunction:
+		name = fn.Name
+	default:
+		return "<" + fn.TypeName() + ">"
+	}
+	if name == "" {
+		return "<anonymous>"
+	}
+	return name
+}
+
+// WithProfiling creates a new ExecutionContext that counts how many times
+// each compiled function is called during its calls, including the functions
+// passed to Call and the callbacks run by builtins. The counts are shared by
+// the contexts derived from the new one, and start from zero each time
+// profiling is enabled. It's disabled by default.
+func (ec *ExecutionContext) WithProfiling(enable bool) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.profile = nil
+	if enable {
+		derived.profile = &callProfile{}
+	}
+	return derived
+}
+
+// Profile returns the number of calls of each compiled function counted since
+// profiling was enabled with WithProfiling, keyed by function name. Functions
+// are named after the variable they were defined with, e.g. "f" for
+// f := func() {}. Anonymous functions are counted together as "<anonymous>",
+// and so are the functions sharing a name. It returns nil if profiling is
+// disabled.
+func (ec *ExecutionContext) Profile() map[string]int64 {
+	if ec.profile == nil {
+		return nil
+	}
+	profile := make(map[string]int64)
+	ec.profile.counts.Range(func(name, n interface{}) bool {
+		profile[name.(string)] = atomic.LoadInt64(n.(*int64))
+		return true
+	})
+	return profile
+}
+
+// callProfile holds the call counts of an ExecutionContext with profiling
+// enabled. It's safe for concurrent use.
+type callProfile struct {
+	counts sync.Map // function name -> *int64
+}
+
+// count increments the call count of fn.
+func (p *callProfile) count(fn *CompiledFunction) {
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	n, ok := p.counts.Load(name)
+	if !ok {
+		n, _ = p.counts.LoadOrStore(name, new(int64))
+	}
+	atomic.AddInt64(n.(*int64), 1)
+}
+
+// WithMetrics creates a new ExecutionContext that aggregates statistics about
+// its calls: their number, errors, executed instructions, allocated objects
+// and durations, as returned by MetricsSnapshot. The statistics are shared by
+// the contexts derived from the new one, and start from zero each time metrics
+// are enabled. They are disabled by default.
+func (ec *ExecutionContext) WithMetrics(enable bool) *ExecutionContext {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	derived := ec.derive(ec.globals)
+	derived.metrics = nil
+	if enable {
+		derived.metrics = &callMetrics{}
+	}
+	return derived
+}
+
+// MetricsSnapshot returns the statistics of the calls made since metrics were
+// enabled with WithMetrics, or zero Metrics if they are disabled. Each counter
+// is read atomically, but calls in progress may be reflected in some counters
+// and not in others.
+func (ec *ExecutionContext) MetricsSnapshot() Metrics {
+	if ec.metrics == nil {
+		return Metrics{}
+	}
+	return ec.metrics.snapshot()
+}
+
+// Metrics are the statistics of the calls made through an ExecutionContext,
+// as returned by MetricsSnapshot.
+type Metrics struct {
+	Calls        int64 // calls made, including the failed ones
+	Errors       int64 // calls that returned an error
+	Instructions int64 // VM instructions executed
+	Allocations  int64 // objects allocated, as counted by Script.SetMaxAllocs
+
+	// Latency is the histogram of the durations of the calls: each bucket
+	// counts the calls that took at most its upper bound, so the counts are
+	// cumulative. Calls is the count of an implicit last bucket without bound.
+	Latency    []LatencyBucket
+	LatencySum time.Duration // total duration of the calls
+}
+
+// LatencyBucket is a bucket of a latency histogram.
+type LatencyBucket struct {
+	UpperBound time.Duration
+	Count      int64
+}
+
+// WritePrometheus writes the metrics to w in the Prometheus text exposition
+// format, as counters named after namespace, e.g. "tengo_calls_total", and a
+// "_call_duration_seconds" histogram.
+func (m Metrics) WritePrometheus(w io.Writer, namespace string) error {
+	var sb strings.Builder
+	counter := func(name, help string, value int64) {
+		name = namespace + "_" + name
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s counter\n%s %d\n",
+			name, help, name, name, value)
+	}
+	counter("calls_total", "Calls made through the execution context.",
+		m.Calls)
+	counter("call_errors_total", "Calls that returned an error.", m.Errors)
+	counter("instructions_total", "VM instructions executed by the calls.",
+		m.Instructions)
+	counter("allocations_total", "Objects allocated by the calls.",
+		m.Allocations)
+
+	name := namespace + "_call_duration_seconds"
+	fmt.Fprintf(&sb, "# HELP %s Duration of the calls.\n# TYPE %s histogram\n",
+		name, name)
+	for _, b := range m.Latency {
+		fmt.Fprintf(&sb, "%s_bucket{le=\"%s\"} %d\n", name,
+			formatSeconds(b.UpperBound), b.Count)
+	}
+	fmt.Fprintf(&sb, "%s_bucket{le=\"+Inf\"} %d\n", name, m.Calls)
+	fmt.Fprintf(&sb, "%s_sum %s\n", name, formatSeconds(m.LatencySum))
+	fmt.Fprintf(&sb, "%s_count %d\n", name, m.Calls)
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// formatSeconds formats d as a number of seconds.
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+// latencyBounds are the upper bounds of the buckets of the latency histogram.
+var latencyBounds = [...]time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// callMetrics holds the statistics of an ExecutionContext with metrics
+// enabled. It's safe for concurrent use.
+type callMetrics struct {
+	calls        int64
+	errors       int64
+	instructions int64
+	allocations  int64
+	latencySum   int64                     // nanoseconds
+	latency      [len(latencyBounds)]int64 // calls per bucket, not cumulative
+}
+
+// recordCall counts a call that took d and failed if err is not nil.
+func (m *callMetrics) recordCall(d time.Duration, err error) {
+	atomic.AddInt64(&m.calls, 1)
+	if err != nil {
+		atomic.AddInt64(&m.errors, 1)
+	}
+	atomic.AddInt64(&m.latencySum, int64(d))
+	for i, bound := range latencyBounds {
+		if d <= bound {
+			atomic.AddInt64(&m.latency[i], 1)
+			break
+		}
+	}
+}
+
+// recordWork counts the instructions executed and the objects allocated by a
+// VM.
+func (m *callMetrics) recordWork(instructions, allocations int64) {
+	atomic.AddInt64(&m.instructions, instructions)
+	atomic.AddInt64(&m.allocations, allocations)
+}
+
+func (m *callMetrics) snapshot() Metrics {
+	s := Metrics{
+		Calls:        atomic.LoadInt64(&m.calls),
+		Errors:       atomic.LoadInt64(&m.errors),
+		Instructions: atomic.LoadInt64(&m.instructions),
+		Allocations:  atomic.LoadInt64(&m.allocations),
+		Latency:      make([]LatencyBucket, len(latencyBounds)),
+		LatencySum:   time.Duration(atomic.LoadInt64(&m.latencySum)),
+	}
+	var count int64
+	for i, bound := range latencyBounds {
+		count += atomic.LoadInt64(&m.latency[i])
+		s.Latency[i] = LatencyBucket{UpperBound: bound, Count: count}
+	}
+	return s
+}
+
+// derive returns a new ExecutionContext sharing the configuration of ec but
+// using the given globals. The caller must hold ec.lock.
+func (ec *ExecutionContext) derive(globals []Object) *ExecutionContext {
+	return &ExecutionContext{
+		constants:  ec.constants,
+		globals:    globals,
+		source:     ec.source,
+		logger:     ec.logger,
+		output:     ec.output,
+		values:     ec.values,
+		transform:  ec.transform,
+		validator:  ec.validator,
+		intercept:  ec.intercept,
+		lazy:       ec.lazy,
+		alloc:      ec.alloc,
+		stackTrace: ec.stackTrace,
+		overflow:   ec.overflow,
+		sortedMaps: ec.sortedMaps,
+		coercion:   ec.coercion,
+		groupLimit: ec.groupLimit,
+		deadline:   ec.deadline,
+		maxResult:  ec.maxResult,
+		maxOutput:  ec.maxOutput,
+		profile:    ec.profile,
+		metrics:    ec.metrics,
+		recorder:   ec.recorder,
+		tracer:     ec.tracer,
+		observer:   ec.observer,
+		normalize:  ec.normalize,
+		random:     ec.random,
+	}
+}
+
+// SetDeadline sets the time after which calls made through ec fail with
+// context.DeadlineExceeded. Calls started after the deadline fail right away,
+// and calls in progress when it's reached are aborted. A zero t clears the
+// deadline. Contexts derived from ec share its deadline, so setting it on any
+// of them affects all.
+func (ec *ExecutionContext) SetDeadline(t time.Time) {
+	ec.lock.Lock()
+	if ec.deadline == nil {
+		ec.deadline = &callDeadline{}
+	}
+	d := ec.deadline
+	ec.lock.Unlock()
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.at = t
+	if !t.IsZero() {
+		d.timer = time.AfterFunc(time.Until(t), d.abortRunning)
+	}
+}
+
+// exceeded returns true if the deadline has been reached. The caller must
+// hold d.lock.
+func (d *callDeadline) exceeded() bool {
+	return !d.at.IsZero() && !time.Now().Before(d.at)
+}
+
+// abortRunning aborts the calls in progress once the deadline is reached.
+func (d *callDeadline) abortRunning() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	// the timer may fire after the deadline has been changed
+	if !d.exceeded() {
+		return
+	}
+	for vm := range d.running {
+		vm.Abort()
+	}
+}
+
+// startCall registers the VM of a call so that it's aborted when the
+// deadline is reached. It returns context.DeadlineExceeded if the deadline
+// has already passed.
+func (ec *ExecutionContext) startCall(vm *VM) error {
+	if d := ec.deadline; d != nil {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+
+		if d.exceeded() {
+			return context.DeadlineExceeded
+		}
+		if d.running == nil {
+			d.running = make(map[*VM]struct{})
+		}
+		d.running[vm] = struct{}{}
+	}
+
+	ec.callsLock.Lock()
+	if ec.calls == nil {
+		ec.calls = make(map[*VM]struct{})
+	}
+	ec.calls[vm] = struct{}{}
+	ec.callsLock.Unlock()
+	return nil
+}
+
+// endCall unregisters the VM of a call and returns
+// context.DeadlineExceeded if the deadline has passed.
+func (ec *ExecutionContext) endCall(vm *VM) error {
+	ec.callsLock.Lock()
+	delete(ec.calls, vm)
+	ec.callsLock.Unlock()
+
+	d := ec.deadline
+	if d == nil {
+		return nil
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	delete(d.running, vm)
+	if d.exceeded() {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// Call invokes a compiled function with the execution context.
+// It provides the function with access to constants and globals from the original compilation.
+func (ec *ExecutionContext) Call(fn *CompiledFunction, args ...Object) (Object, error) {
+	result, _, err := ec.CallEx(fn, args...)
+	return result, err
+}
+
+// CallResult is like Call but wraps the result in a Result, whose accessors
+// check the type of the value.
+func (ec *ExecutionContext) CallResult(fn *CompiledFunction, args ...Object) (Result, error) {
+	result, err := ec.Call(fn, args...)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{value: result}, nil
+}
+
+// Result is the value returned by a function called with CallResult. Unlike
+// the methods of Variable, its accessors don't convert the value: they report
+// whether it has the type they expect.
+type Result struct {
+	value Object
+}
+
+// Object returns the value.
+func (r Result) Object() Object {
+	return r.value
+}
+
+// Value returns the value converted to a Go value by ToInterface.
+func (r Result) Value() interface{} {
+	return ToInterface(r.value)
+}
+
+// IsUndefined returns true if the value is undefined.
+func (r Result) IsUndefined() bool {
+	return r.value == UndefinedValue
+}
+
+// Int returns the value of an int.
+func (r Result) Int() (int64, bool) {
+	if v, ok := r.value.(*Int); ok {
+		return v.Value, true
+	}
+	return 0, false
+}
+
+// Float returns the value of a float.
+func (r Result) Float() (float64, bool) {
+	if v, ok := r.value.(*Float); ok {
+		return v.Value, true
+	}
+	return 0, false
+}
+
+// String returns the value of a string.
+func (r Result) String() (string, bool) {
+	if v, ok := r.value.(*String); ok {
+		return v.Value, true
+	}
+	return "", false
+}
+
+// Bool returns the value of a bool.
+func (r Result) Bool() (bool, bool) {
+	if v, ok := r.value.(*Bool); ok {
+		return !v.IsFalsy(), true
+	}
+	return false, false
+}
+
+// Map returns the elements of a map or an immutable map, converted to Go
+// values by ToInterface.
+func (r Result) Map() (map[string]interface{}, bool) {
+	switch r.value.(type) {
+	case *Map, *ImmutableMap:
+		return ToInterface(r.value).(map[string]interface{}), true
+	}
+	return nil, false
+}
+
+// Array returns the elements of an array or an immutable array, converted to
+// Go values by ToInterface.
+func (r Result) Array() ([]interface{}, bool) {
+	switch r.value.(type) {
+	case *Array, *ImmutableArray:
+		return ToInterface(r.value).([]interface{}), true
 	}
+	return nil, false
 }
 
-// WithGlobals creates a new ExecutionContext with specific globals.
-// This is useful for creating isolated execution contexts or for testing.
-func (ec *ExecutionContext) WithGlobals(globals []Object) *ExecutionContext {
-	ec.lock.RLock()
-	defer ec.lock.RUnlock()
+// IsError returns true if the value is an error.
+func (r Result) IsError() bool {
+	_, ok := r.value.(*Error)
+	return ok
+}
 
-	return &ExecutionContext{
-		constants: ec.constants,
-		globals:   globals,
-		source:    ec.source,
-	}
+// Error returns the value if it's an error, and nil otherwise.
+func (r Result) Error() *Error {
+	e, _ := r.value.(*Error)
+	return e
 }
 
-// WithIsolatedGlobals creates a new ExecutionContext with a copy of the current globals.
-// This ensures thread-safe execution by providing each context with its own globals copy.
-func (ec *ExecutionContext) WithIsolatedGlobals() *ExecutionContext {
+// CallForking invokes a compiled function against a deep copy of the globals
+// and returns the result together with a new ExecutionContext holding the
+// globals as left by the call. The globals of ec are never modified. On
+// error, no context is returned.
+func (ec *ExecutionContext) CallForking(fn *CompiledFunction, args ...Object) (Object, *ExecutionContext, error) {
 	ec.lock.RLock()
-	defer ec.lock.RUnlock()
+	forked := ec.derive(copyGlobals(ec.globals))
+	ec.lock.RUnlock()
 
-	// Create a deep copy of globals to ensure isolation
-	isolatedGlobals := make([]Object, len(ec.globals))
-	for i, g := range ec.globals {
-		if g != nil {
-			isolatedGlobals[i] = g.Copy()
-		}
+	result, _, err := forked.CallEx(fn, args...)
+	if err != nil {
+		return nil, nil, err
 	}
+	return result, forked, nil
+}
 
-	return &ExecutionContext{
-		constants: ec.constants,
-		globals:   isolatedGlobals,
-		source:    ec.source,
-	}
+// CallStrictReadOnly invokes a compiled function like Call, but fails with
+// ErrReadOnlyGlobal as soon as the function, or a function it calls, assigns
+// to a global variable or to an element of one, e.g. with count += 1 or
+// config.debug = true. It guarantees that the globals of ec keep referencing
+// the same values, but not that these values aren't modified through other
+// references, such as a local variable holding the same map.
+func (ec *ExecutionContext) CallStrictReadOnly(fn *CompiledFunction, args ...Object) (Object, error) {
+	ec.lock.RLock()
+	strict := ec.derive(ec.globals)
+	ec.lock.RUnlock()
+
+	strict.readOnly = true
+	return strict.Call(fn, args...)
 }
 
-// Call invokes a compiled function with the execution context.
-// It provides the function with access to constants and globals from the original compilation.
-func (ec *ExecutionContext) Call(fn *CompiledFunction, args ...Object) (Object, error) {
-	result, _, err := ec.CallEx(fn, args...)
-	return result, err
+// CurrentDepth returns the number of compiled function frames of the call in
+// progress through ec, including the function passed to Call and the
+// callbacks run by builtins. It's meant to be called by the host functions
+// the call invokes, e.g. to limit recursion, and reports the depth at which
+// the last host function was called. Tail calls reuse the frame of their
+// caller, so they don't increase the depth. It returns 0 if no call is in
+// progress.
+// If calls run concurrently through ec, it returns the depth of the deepest
+// one; give each goroutine its own context, e.g. with Fork, to read the depth
+// of its call.
+func (ec *ExecutionContext) CurrentDepth() int {
+	ec.callsLock.Lock()
+	defer ec.callsLock.Unlock()
+
+	var depth int64
+	for vm := range ec.calls {
+		if d := atomic.LoadInt64(vm.depth); d > depth {
+			depth = d
+		}
+	}
+	return int(depth)
 }
 
 // CallEx invokes a compiled function with the execution context and returns both
 // the result and the updated globals (if any were modified).
 func (ec *ExecutionContext) CallEx(fn *CompiledFunction, args ...Object) (Object, []Object, error) {
+	return ec.callContext(context.Background(), fn, args...)
+}
+
+// callContext is like CallEx, but aborts the call and returns the error of
+// ctx once ctx is done.
+func (ec *ExecutionContext) callContext(ctx context.Context, fn *CompiledFunction, args ...Object) (Object, []Object, error) {
+	if ec.metrics == nil {
+		return ec.call(ctx, fn, args...)
+	}
+	start := time.Now()
+	result, globals, err := ec.call(ctx, fn, args...)
+	if cont, ok := err.(*Continuation); ok {
+		cont.elapsed = time.Since(start)
+	} else {
+		ec.metrics.recordCall(time.Since(start), err)
+	}
+	return result, globals, err
+}
+
+// call implements callContext.
+func (ec *ExecutionContext) call(ctx context.Context, fn *CompiledFunction, args ...Object) (Object, []Object, error) {
 	// Validate execution context before use
 	if err := ec.Validate(); err != nil {
 		return nil, nil, err
@@ -82,14 +1389,53 @@ func (ec *ExecutionContext) CallEx(fn *CompiledFunction, args ...Object) (Object
 			Suggestion: "provide a valid CompiledFunction",
 		}
 	}
+	if fn.origin != nil && ec.source != nil && fn.origin != ec.source.origin {
+		return nil, nil, ErrFunctionContextMismatch
+	}
 
 	ec.lock.RLock()
 	constants := ec.constants
 	globals := ec.globals
 	ec.lock.RUnlock()
 
+	if ec.intercept != nil {
+		args = ec.intercept(fn.Name, append([]Object(nil), args...))
+	}
+	if ec.coercion {
+		args = coerceArgs(args)
+	}
+	if ec.validator != nil {
+		if err := ec.validator(fn.Name, args); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	callGlobals := globals
+	if ec.transform != nil {
+		callGlobals = ec.transform(append([]Object(nil), globals...))
+	}
+
 	// Call the function with the complete context
-	result, updatedGlobals, err := fn.CallWithGlobalsExAndConstants(constants, globals, args...)
+	result, updatedGlobals, err := fn.callContext(ctx, ec, constants,
+		callGlobals, args...)
+	if cont, ok := err.(*Continuation); ok {
+		cont.ctx, cont.ec = ctx, ec
+		cont.globals, cont.callGlobals = globals, callGlobals
+		return nil, nil, cont
+	}
+	return ec.finishCall(result, updatedGlobals, err, globals, callGlobals)
+}
+
+// finishCall checks the result of a call made with the given globals and
+// commits the globals it updated.
+func (ec *ExecutionContext) finishCall(result Object, updatedGlobals []Object, err error, globals, callGlobals []Object) (Object, []Object, error) {
+	if err == nil && ec.maxResult > 0 &&
+		resultSize(result, ec.maxResult) > ec.maxResult {
+		return nil, nil, ErrResultTooLarge
+	}
+	if err == nil && ec.transform != nil {
+		updatedGlobals = commitScriptGlobals(globals, callGlobals, updatedGlobals)
+	}
 
 	// Update our globals if they were modified
 	if err == nil && updatedGlobals != nil {
@@ -98,9 +1444,336 @@ func (ec *ExecutionContext) CallEx(fn *CompiledFunction, args ...Object) (Object
 		ec.lock.Unlock()
 	}
 
+	if err == nil && ec.normalize != nil {
+		if result = ec.normalize(result); result == nil {
+			result = UndefinedValue
+		}
+	}
 	return result, updatedGlobals, err
 }
 
+// BatchCall is a function call run by CallGroup.
+type BatchCall struct {
+	Fn   *CompiledFunction
+	Args []Object
+}
+
+// CallGroup runs the calls concurrently, each in its own isolated copy of the
+// context as created by Fork, and returns their results in the order of
+// calls. At most runtime.GOMAXPROCS(0) calls run at the same time, unless
+// configured otherwise with WithCallGroupLimit. If a call fails, the calls
+// still running are aborted, the remaining ones are not started, and the
+// first error is returned. Cancelling ctx aborts the group the same way and
+// returns the error of ctx. The globals of ec are never modified.
+func (ec *ExecutionContext) CallGroup(ctx context.Context, calls []BatchCall) ([]Object, error) {
+	if err := ec.Validate(); err != nil {
+		return nil, err
+	}
+	results := make([]Object, len(calls))
+	if len(calls) == 0 {
+		return results, nil
+	}
+
+	workers := ec.groupLimit
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(calls) {
+		workers = len(calls)
+	}
+	children := ec.Fork(len(calls))
+	groupCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		next     = make(chan int)
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				res, _, err := children[i].callContext(groupCtx, calls[i].Fn,
+					calls[i].Args...)
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					continue
+				}
+				results[i] = res
+			}
+		}()
+	}
+feed:
+	for i := range calls {
+		select {
+		case next <- i:
+		case <-groupCtx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return results, nil
+}
+
+// coerceArgs returns args with every *Int converted to *Float if any of the
+// arguments is a *Float. It returns args itself if nothing is converted.
+func coerceArgs(args []Object) []Object {
+	hasFloat := false
+	for _, arg := range args {
+		if _, ok := arg.(*Float); ok {
+			hasFloat = true
+			break
+		}
+	}
+	if !hasFloat {
+		return args
+	}
+	coerced := make([]Object, len(args))
+	for i, arg := range args {
+		if n, ok := arg.(*Int); ok {
+			arg = &Float{Value: float64(n.Value)}
+		}
+		coerced[i] = arg
+	}
+	return coerced
+}
+
+// Prepare validates fn against the execution context without running it. It
+// verifies the arity metadata of fn and of every function it references, and
+// bounds-checks all constant, global, builtin and jump operands, so that a
+// malformed function is rejected at registration time rather than on its
+// first Call. Calls don't keep any state between them that Prepare could set
+// up in advance, so it only validates fn.
+func (ec *ExecutionContext) Prepare(fn *CompiledFunction) error {
+	if err := ec.Validate(); err != nil {
+		return err
+	}
+	if fn == nil {
+		return ErrMissingExecutionContext{
+			Function:   "execution-context",
+			Missing:    "compiled function",
+			Suggestion: "provide a valid CompiledFunction",
+		}
+	}
+
+	ec.lock.RLock()
+	constants := ec.constants
+	numGlobals := len(ec.globals)
+	if ec.globals == nil {
+		numGlobals = GlobalsSize
+	}
+	ec.lock.RUnlock()
+
+	return prepareFunction(fn, constants, numGlobals,
+		make(map[*CompiledFunction]bool))
+}
+
+func prepareFunction(
+	fn *CompiledFunction,
+	constants []Object,
+	numGlobals int,
+	visited map[*CompiledFunction]bool,
+) error {
+	if visited[fn] {
+		return nil
+	}
+	visited[fn] = true
+
+	if fn.NumParameters < 0 || fn.NumLocals < fn.NumParameters {
+		return ErrInvalidBytecode{
+			Reason: fmt.Sprintf("%d locals cannot hold %d parameters",
+				fn.NumLocals, fn.NumParameters),
+			Offset: -1,
+		}
+	}
+	if fn.VarArgs && fn.NumParameters == 0 {
+		return ErrInvalidBytecode{
+			Reason: "variadic function without parameters",
+			Offset: -1,
+		}
+	}
+
+	insts := fn.Instructions
+	for i := 0; i < len(insts); {
+		op := insts[i]
+		if int(op) >= len(parser.OpcodeOperands) {
+			return ErrInvalidBytecode{
+				Reason: fmt.Sprintf("unknown opcode %d", op),
+				Offset: i,
+			}
+		}
+		widths := parser.OpcodeOperands[op]
+		size := 0
+		for _, w := range widths {
+			size += w
+		}
+		if i+1+size > len(insts) {
+			return ErrInvalidBytecode{
+				Reason: fmt.Sprintf("truncated %s instruction",
+					parser.OpcodeNames[op]),
+				Offset: i,
+			}
+		}
+		operands, _ := parser.ReadOperands(widths, insts[i+1:])
+
+		var limit int
+		var what string
+		switch op {
+		case parser.OpConstant, parser.OpClosure:
+			limit, what = len(constants), "constant"
+		case parser.OpGetGlobal, parser.OpSetGlobal, parser.OpSetSelGlobal:
+			limit, what = numGlobals, "global"
+		case parser.OpGetBuiltin:
+			limit, what = len(builtinFuncs), "builtin"
+		case parser.OpJump, parser.OpJumpFalsy, parser.OpAndJump,
+			parser.OpOrJump:
+			limit, what = len(insts)+1, "jump target"
+		}
+		if what != "" && operands[0] >= limit {
+			return ErrInvalidBytecode{
+				Reason: fmt.Sprintf("%s index %d out of range [0, %d)",
+					what, operands[0], limit),
+				Offset: i,
+			}
+		}
+
+		if op == parser.OpConstant || op == parser.OpClosure {
+			nested, ok := constants[operands[0]].(*CompiledFunction)
+			if !ok && op == parser.OpClosure {
+				return ErrInvalidBytecode{
+					Reason: fmt.Sprintf("closure over non-function constant %d",
+						operands[0]),
+					Offset: i,
+				}
+			}
+			if ok {
+				err := prepareFunction(nested, constants, numGlobals, visited)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		i += 1 + size
+	}
+	return nil
+}
+
+// IsPure reports whether fn leaves the globals alone: neither fn nor any
+// function it references through the constants assigns a global variable or
+// an element of one. As a global can be aliased by a local variable, e.g.
+// m := g; m.x = 1, or passed to a builtin that modifies its arguments, such
+// as delete, functions that read a global are only considered pure if none
+// of them assigns elements of their local or free variables or references
+// delete or splice. The check is static, so functions fn only reaches at run
+// time, through globals or arguments, are not inspected. Callers can use it
+// to skip their own bookkeeping of globals, e.g. by calling pure functions
+// through Call instead of CallForking.
+func (ec *ExecutionContext) IsPure(fn *CompiledFunction) bool {
+	if fn == nil {
+		return false
+	}
+	ec.lock.RLock()
+	constants := ec.constants
+	ec.lock.RUnlock()
+
+	scan := &purityScan{
+		constants: constants,
+		visited:   make(map[*CompiledFunction]bool),
+	}
+	return scan.scan(fn) && !(scan.readsGlobal && scan.mutates)
+}
+
+// purityScan collects what the functions reachable from the one checked by
+// IsPure do with variables.
+type purityScan struct {
+	constants   []Object
+	visited     map[*CompiledFunction]bool
+	readsGlobal bool // a function reads a global variable
+	mutates     bool // a function may modify a value it did not create
+}
+
+// scan inspects fn and the functions it references, and returns false if any
+// of them assigns a global variable or an element of one.
+func (s *purityScan) scan(fn *CompiledFunction) bool {
+	if s.visited[fn] {
+		return true
+	}
+	s.visited[fn] = true
+
+	insts := fn.Instructions
+	for i := 0; i < len(insts); {
+		op := insts[i]
+		if int(op) >= len(parser.OpcodeOperands) {
+			return false
+		}
+		widths := parser.OpcodeOperands[op]
+		size := 0
+		for _, w := range widths {
+			size += w
+		}
+		if i+1+size > len(insts) {
+			return false
+		}
+		operands, _ := parser.ReadOperands(widths, insts[i+1:])
+		switch op {
+		case parser.OpSetGlobal, parser.OpSetSelGlobal:
+			return false
+		case parser.OpGetGlobal:
+			s.readsGlobal = true
+		case parser.OpSetSelLocal, parser.OpSetSelFree:
+			s.mutates = true
+		case parser.OpGetBuiltin:
+			if operands[0] < len(builtinFuncs) {
+				switch builtinFuncs[operands[0]].Name {
+				case "delete", "splice":
+					s.mutates = true
+				}
+			}
+		case parser.OpConstant, parser.OpClosure:
+			if operands[0] < len(s.constants) {
+				nested, ok := s.constants[operands[0]].(*CompiledFunction)
+				if ok && !s.scan(nested) {
+					return false
+				}
+			}
+		}
+		i += 1 + size
+	}
+	return true
+}
+
+// commitScriptGlobals returns base updated with the globals that the script
+// assigned during a call that ran against the transformed globals.
+func commitScriptGlobals(base, transformed, updated []Object) []Object {
+	size := len(base)
+	if len(updated) > size {
+		size = len(updated)
+	}
+	committed := make([]Object, size)
+	copy(committed, base)
+	for i, g := range updated {
+		if i >= len(transformed) || g != transformed[i] {
+			committed[i] = g
+		}
+	}
+	return committed
+}
+
 // Constants returns a copy of the constants array.
 func (ec *ExecutionContext) Constants() []Object {
 	ec.lock.RLock()
@@ -119,11 +1792,369 @@ func (ec *ExecutionContext) Globals() []Object {
 	return result
 }
 
+// GlobalsLen returns the number of globals without copying them.
+func (ec *ExecutionContext) GlobalsLen() int {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	return len(ec.globals)
+}
+
+// GlobalAt returns the global at index i without copying the globals. It
+// returns ErrIndexOutOfBounds if i is out of range.
+func (ec *ExecutionContext) GlobalAt(i int) (Object, error) {
+	ec.lock.RLock()
+	defer ec.lock.RUnlock()
+
+	if i < 0 || i >= len(ec.globals) {
+		return nil, ErrIndexOutOfBounds
+	}
+	return ec.globals[i], nil
+}
+
+// GlobalsInto populates the tagged fields of the struct pointed to by dst from
+// the named globals of the context. Fields are mapped with a `tengo:"name"`
+// tag; appending ",required" to the name makes a missing or undefined global
+// an error, otherwise the field is left untouched. Supported field types are
+// integers, floats, strings, bools, interface{}, and pointers, slices and
+// structs of those; nested structs are populated from maps using the same
+// tags.
+func (ec *ExecutionContext) GlobalsInto(dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() ||
+		rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("destination must be a non-nil pointer to a struct, found %T", dst)
+	}
+	if ec.source == nil {
+		return ErrInvalidExecutionContext
+	}
+
+	ec.lock.RLock()
+	globals := ec.globals
+	ec.lock.RUnlock()
+
+	return assignStruct(rv.Elem(), "", func(name string) Object {
+		idx, ok := ec.source.globalIndexes[name]
+		if !ok || idx >= len(globals) {
+			return nil
+		}
+		return globals[idx]
+	})
+}
+
+// assignStruct sets the tagged fields of the struct dst to the values
+// returned by lookup.
+func assignStruct(
+	dst reflect.Value,
+	path string,
+	lookup func(name string) Object,
+) error {
+	typ := dst.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, ok := field.Tag.Lookup("tengo")
+		if !ok || tag == "-" || field.PkgPath != "" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		fieldPath := name
+		if path != "" {
+			fieldPath = path + "." + name
+		}
+
+		obj := lookup(name)
+		if obj == nil || obj == UndefinedValue {
+			if opts == "required" {
+				return fmt.Errorf("required global '%s' is not defined", fieldPath)
+			}
+			continue
+		}
+		if err := assignObject(dst.Field(i), obj, fieldPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assignObject converts obj to the type of dst and stores it.
+func assignObject(dst reflect.Value, obj Object, path string) error {
+	mismatch := func() error {
+		return ErrInvalidGlobalType{
+			Name:     path,
+			Expected: dst.Type().String(),
+			Found:    obj.TypeName(),
+		}
+	}
+
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		v, ok := obj.(*Int)
+		if !ok {
+			return mismatch()
+		}
+		if dst.OverflowInt(v.Value) {
+			return fmt.Errorf("global '%s': value %d overflows %s",
+				path, v.Value, dst.Type())
+		}
+		dst.SetInt(v.Value)
+	case reflect.Float32, reflect.Float64:
+		switch v := obj.(type) {
+		case *Float:
+			dst.SetFloat(v.Value)
+		case *Int:
+			dst.SetFloat(float64(v.Value))
+		default:
+			return mismatch()
+		}
+	case reflect.String:
+		v, ok := obj.(*String)
+		if !ok {
+			return mismatch()
+		}
+		dst.SetString(v.Value)
+	case reflect.Bool:
+		v, ok := obj.(*Bool)
+		if !ok {
+			return mismatch()
+		}
+		dst.SetBool(!v.IsFalsy())
+	case reflect.Interface:
+		v := ToInterface(obj)
+		if v == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		rv := reflect.ValueOf(v)
+		if !rv.Type().AssignableTo(dst.Type()) {
+			return mismatch()
+		}
+		dst.Set(rv)
+	case reflect.Ptr:
+		elem := reflect.New(dst.Type().Elem())
+		if err := assignObject(elem.Elem(), obj, path); err != nil {
+			return err
+		}
+		dst.Set(elem)
+	case reflect.Slice:
+		var items []Object
+		switch v := obj.(type) {
+		case *Array:
+			items = v.Value
+		case *ImmutableArray:
+			items = v.Value
+		case *Bytes:
+			if dst.Type().Elem().Kind() != reflect.Uint8 {
+				return mismatch()
+			}
+			dst.SetBytes(append([]byte{}, v.Value...))
+			return nil
+		default:
+			return mismatch()
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		for i, item := range items {
+			err := assignObject(slice.Index(i), item,
+				fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+	case reflect.Struct:
+		var m map[string]Object
+		switch v := obj.(type) {
+		case *Map:
+			m = v.Value
+		case *ImmutableMap:
+			m = v.Value
+		default:
+			return mismatch()
+		}
+		return assignStruct(dst, path, func(name string) Object {
+			return m[name]
+		})
+	default:
+		return mismatch()
+	}
+	return nil
+}
+
+// savedGlobals is the form in which SaveGlobals writes the globals. Slots
+// holding program values are listed in Program, and the remaining non-nil
+// slots in Indexes, with their values in Values.
+type savedGlobals struct {
+	Len     int
+	Indexes []int
+	Values  []Object
+	Program []int
+}
+
+// SaveGlobals writes the current globals to w, so that LoadGlobals can
+// restore them later, e.g. after a restart of the host. Scalars, bytes,
+// times, errors, arrays and maps are saved. Compiled functions and imported
+// modules stored directly in globals are part of the program rather than of
+// its state: only their slots are recorded, and LoadGlobals keeps the values
+// of the context it loads into. Any other value, including functions nested
+// in arrays or maps and Go functions, cannot be saved and results in an
+// error.
+func (ec *ExecutionContext) SaveGlobals(w io.Writer) error {
+	if err := ec.Validate(); err != nil {
+		return err
+	}
+
+	ec.lock.RLock()
+	saved := savedGlobals{Len: len(ec.globals)}
+	for i, g := range ec.globals {
+		if g == nil {
+			continue
+		}
+		if isProgramValue(g) {
+			saved.Program = append(saved.Program, i)
+			continue
+		}
+		if err := checkSavable(g); err != nil {
+			ec.lock.RUnlock()
+			return fmt.Errorf("cannot save global '%s': %w",
+				ec.globalName(i), err)
+		}
+		saved.Indexes = append(saved.Indexes, i)
+		saved.Values = append(saved.Values, g)
+	}
+	ec.lock.RUnlock()
+
+	return gob.NewEncoder(w).Encode(&saved)
+}
+
+// LoadGlobals replaces the globals with the ones written by SaveGlobals. The
+// saved globals must come from the same program: an error is returned if
+// their number doesn't match the compiled program, or if a slot that held a
+// function or module when saving doesn't hold one in ec.
+func (ec *ExecutionContext) LoadGlobals(r io.Reader) error {
+	if err := ec.Validate(); err != nil {
+		return err
+	}
+
+	var saved savedGlobals
+	if err := gob.NewDecoder(r).Decode(&saved); err != nil {
+		return err
+	}
+	ec.source.lock.RLock()
+	numGlobals := len(ec.source.globals)
+	ec.source.lock.RUnlock()
+	if saved.Len != numGlobals || len(saved.Indexes) != len(saved.Values) {
+		return fmt.Errorf("saved globals do not match the program: "+
+			"want %d globals, got %d", numGlobals, saved.Len)
+	}
+
+	globals := make([]Object, saved.Len)
+	for n, i := range saved.Indexes {
+		if i < 0 || i >= saved.Len {
+			return fmt.Errorf("saved global index %d out of range", i)
+		}
+		v, err := fixDecodedObject(saved.Values[n], NewModuleMap())
+		if err != nil {
+			return err
+		}
+		globals[i] = v
+	}
+
+	ec.lock.Lock()
+	defer ec.lock.Unlock()
+	for _, i := range saved.Program {
+		var g Object
+		if i >= 0 && i < len(ec.globals) && i < saved.Len {
+			g = ec.globals[i]
+		}
+		if g == nil || !isProgramValue(g) {
+			return fmt.Errorf("saved global '%s' is a function or module, "+
+				"but the context has none for it", ec.globalName(i))
+		}
+		globals[i] = g
+	}
+	ec.globals = globals
+	return nil
+}
+
+// isProgramValue returns true if o is a compiled function or an imported
+// module, which SaveGlobals doesn't save.
+func isProgramValue(o Object) bool {
+	switch o := o.(type) {
+	case *CompiledFunction:
+		return true
+	case *ImmutableMap:
+		return inferModuleName(o) != ""
+	}
+	return false
+}
+
+// checkSavable returns an error if o cannot be written by SaveGlobals.
+func checkSavable(o Object) error {
+	switch o := o.(type) {
+	case *Int, *Float, *String, *Bool, *Char, *Bytes, *Time, *Undefined:
+		return nil
+	case *Error:
+		return checkSavable(o.Value)
+	case *Array:
+		return checkSavableElements(o.Value)
+	case *ImmutableArray:
+		return checkSavableElements(o.Value)
+	case *Map:
+		for _, v := range o.Value {
+			if err := checkSavable(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *ImmutableMap:
+		for _, v := range o.Value {
+			if err := checkSavable(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%s is not serializable", o.TypeName())
+}
+
+func checkSavableElements(elements []Object) error {
+	for _, v := range elements {
+		if err := checkSavable(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// globalName returns the name of the global at index i, or the index if the
+// name is unknown.
+func (ec *ExecutionContext) globalName(i int) string {
+	for name, idx := range ec.source.globalIndexes {
+		if idx == i {
+			return name
+		}
+	}
+	return fmt.Sprintf("#%d", i)
+}
+
 // Source returns the original compiled object.
 func (ec *ExecutionContext) Source() *Compiled {
 	return ec.source
 }
 
+// ImportedModules returns the sorted names of the modules imported by the
+// script of ec at compile time, see Compiled.ImportedModules. It returns nil
+// if ec has no source.
+func (ec *ExecutionContext) ImportedModules() []string {
+	if ec.source == nil {
+		return nil
+	}
+	return ec.source.ImportedModules()
+}
+
 // Validate checks if the execution context is valid and complete.
 func (ec *ExecutionContext) Validate() error {
 	if ec.source == nil {
@@ -1,10 +1,22 @@
 package tengo_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/tiagoj/tengo/v2"
+	"github.com/tiagoj/tengo/v2/parser"
 	"github.com/tiagoj/tengo/v2/require"
+	"github.com/tiagoj/tengo/v2/stdlib"
 )
 
 func TestExecutionContext_Basic(t *testing.T) {
@@ -163,3 +175,2638 @@ func TestExecutionContext_ConstantsImmutability(t *testing.T) {
 	// But should have same content
 	require.Equal(t, len(constants1), len(constants2))
 }
+
+func TestExecutionContext_WithLogger(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		service := "billing"
+		fields := {service: service, attempt: 1}
+		run := func(x) {
+			log("info", "processing", fields)
+			log("debug", "no fields")
+			fields.attempt = 2
+			return x * 2
+		}
+	`))
+
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+
+	runFn, ok := compiled.Get("run").Value().(*tengo.CompiledFunction)
+	require.True(t, ok)
+
+	type event struct {
+		level  string
+		msg    string
+		fields map[string]tengo.Object
+	}
+	var events []event
+	ctx := tengo.NewExecutionContext(compiled).WithLogger(
+		func(level string, msg string, fields map[string]tengo.Object) {
+			events = append(events, event{level, msg, fields})
+		})
+
+	result, err := ctx.Call(runFn, &tengo.Int{Value: 21})
+	require.NoError(t, err)
+	require.Equal(t, int64(42), result.(*tengo.Int).Value)
+
+	require.Equal(t, 2, len(events))
+	require.Equal(t, "info", events[0].level)
+	require.Equal(t, "processing", events[0].msg)
+	require.Equal(t, "billing", events[0].fields["service"].(*tengo.String).Value)
+	// fields are copied before being handed to the logger
+	require.Equal(t, int64(1), events[0].fields["attempt"].(*tengo.Int).Value)
+	require.Equal(t, "debug", events[1].level)
+	require.Equal(t, 0, len(events[1].fields))
+
+	// without a logger, log is a no-op
+	result, err = tengo.NewExecutionContext(compiled).Call(runFn, &tengo.Int{Value: 1})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), result.(*tengo.Int).Value)
+
+	// invalid arguments are still reported
+	_, err = tengo.NewScript([]byte(`log(1, "msg")`)).Run()
+	require.Error(t, err)
+}
+
+func TestExecutionContext_WithOutput(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		fmt := import("fmt")
+		greet := func(name) {
+			fmt.print("hello, ", name)
+			fmt.println("!")
+			fmt.printf("%d items\n", 3)
+			each := func(arr, fn) { for x in arr { fn(x) } }
+			each([1, 2], func(x) { fmt.println(x) })
+			return len(name)
+		}
+	`))
+	script.SetImports(stdlib.GetModuleMap("fmt"))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	greet := compiled.Get("greet").Value().(*tengo.CompiledFunction)
+
+	var out bytes.Buffer
+	ctx := tengo.NewExecutionContext(compiled).WithOutput(&out)
+	res, err := ctx.Call(greet, &tengo.String{Value: "tengo"})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 5}, res)
+	require.Equal(t, "hello, tengo!\n3 items\n1\n2\n", out.String())
+
+	// derived contexts keep the output
+	out.Reset()
+	_, err = ctx.WithStackTrace(true).Call(greet, &tengo.String{Value: "x"})
+	require.NoError(t, err)
+	require.Equal(t, "hello, x!\n3 items\n1\n2\n", out.String())
+
+	// each context has its own output
+	var other bytes.Buffer
+	out.Reset()
+	_, err = ctx.WithOutput(&other).Call(greet, &tengo.String{Value: "y"})
+	require.NoError(t, err)
+	require.Equal(t, "", out.String())
+	require.Equal(t, "hello, y!\n3 items\n1\n2\n", other.String())
+}
+
+func TestExecutionContext_WithMaxOutput(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		fmt := import("fmt")
+		printed := 0
+		spam := func(n) {
+			for i := 0; i < n; i++ {
+				fmt.println("line ", i)
+				printed = i + 1
+			}
+			return printed
+		}
+		nested := func(n) {
+			each := func(arr, fn) { for x in arr { fn(x) } }
+			each([1, 2, 3], func(x) { fmt.print(x * 11111) })
+			return n
+		}
+	`))
+	script.SetImports(stdlib.GetModuleMap("fmt"))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	fn := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+
+	var out bytes.Buffer
+	ctx := tengo.NewExecutionContext(compiled).WithOutput(&out).WithMaxOutput(20)
+
+	// output past the limit is discarded, and the call fails once it's done
+	_, err = ctx.Call(fn("spam"), &tengo.Int{Value: 100})
+	require.True(t, errors.Is(err, tengo.ErrOutputLimit), err)
+	require.Equal(t, "line 0\nline 1\nline 2", out.String())
+	printed, err := ctx.GlobalAt(1)
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 0}, printed)
+
+	// the limit resets for each call
+	out.Reset()
+	res, err := ctx.Call(fn("spam"), &tengo.Int{Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 2}, res)
+	require.Equal(t, "line 0\nline 1\n", out.String())
+	out.Reset()
+	res, err = ctx.Call(fn("spam"), &tengo.Int{Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 2}, res)
+	require.Equal(t, "line 0\nline 1\n", out.String())
+
+	// output exactly reaching the limit is fine
+	out.Reset()
+	_, err = ctx.WithMaxOutput(14).Call(fn("spam"), &tengo.Int{Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, "line 0\nline 1\n", out.String())
+
+	// the output of callbacks counts towards the limit of the call
+	out.Reset()
+	_, err = ctx.WithMaxOutput(12).Call(fn("nested"), &tengo.Int{Value: 1})
+	require.True(t, errors.Is(err, tengo.ErrOutputLimit), err)
+	require.Equal(t, "111112222233", out.String())
+
+	// the output is not limited by default
+	out.Reset()
+	_, err = ctx.WithMaxOutput(0).Call(fn("spam"), &tengo.Int{Value: 100})
+	require.NoError(t, err)
+	require.Equal(t, 790, out.Len())
+}
+
+func TestExecutionContext_WithValues(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		prefix := "req"
+		describe := func() {
+			label := func(key) {
+				v := ctx_value(key)
+				return is_undefined(v) ? key + "=none" : key + "=" + string(v)
+			}
+			return prefix + ":" + label("tenant") + "," + label("trace")
+		}
+		tamper := func() {
+			m := ctx_value("meta")
+			m.role = "admin"
+			return [m.role, ctx_value("meta").role]
+		}
+		read := ctx_value("tenant")
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	// not running through an ExecutionContext
+	require.Equal(t, tengo.UndefinedValue, compiled.Get("read").Object())
+
+	describe := compiled.Get("describe").Value().(*tengo.CompiledFunction)
+	tamper := compiled.Get("tamper").Value().(*tengo.CompiledFunction)
+	base := tengo.NewExecutionContext(compiled)
+	values := map[string]tengo.Object{
+		"tenant": &tengo.String{Value: "acme"},
+		"trace":  &tengo.Int{Value: 42},
+		"meta": &tengo.Map{Value: map[string]tengo.Object{
+			"role": &tengo.String{Value: "user"},
+		}},
+	}
+	ctx := base.WithValues(values)
+	res, err := ctx.Call(describe)
+	require.NoError(t, err)
+	require.Equal(t, "req:tenant=acme,trace=42", res.(*tengo.String).Value)
+
+	// values don't leak into other contexts, and later changes to the map
+	// don't affect the context
+	values["tenant"] = &tengo.String{Value: "other"}
+	res, err = base.Call(describe)
+	require.NoError(t, err)
+	require.Equal(t, "req:tenant=none,trace=none", res.(*tengo.String).Value)
+	res, err = ctx.WithStackTrace(true).Call(describe)
+	require.NoError(t, err)
+	require.Equal(t, "req:tenant=acme,trace=42", res.(*tengo.String).Value)
+
+	// scripts cannot modify the values
+	res, err = ctx.Call(tamper)
+	require.NoError(t, err)
+	require.Equal(t, "admin", res.(*tengo.Array).Value[0].(*tengo.String).Value)
+	require.Equal(t, "user", res.(*tengo.Array).Value[1].(*tengo.String).Value)
+	require.Equal(t, "user", values["meta"].(*tengo.Map).Value["role"].(*tengo.String).Value)
+
+	// values are not globals
+	require.Equal(t, len(compiled.Globals()), ctx.GlobalsLen())
+
+	_, err = tengo.NewScript([]byte(`ctx_value(1)`)).Run()
+	require.Error(t, err)
+}
+
+func TestExecutionContext_Prepare(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		base := 10
+		fib := func(n) {
+			if n < 2 { return n }
+			return fib(n-1) + fib(n-2)
+		}
+		make_adder := func(x) {
+			return func(y) { return x + y + base }
+		}
+		adder := make_adder(5)
+		sum := func(...xs) {
+			total := 0
+			for x in xs { total += x }
+			return total
+		}
+	`))
+
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+
+	ctx := tengo.NewExecutionContext(compiled)
+	for _, name := range []string{"fib", "make_adder", "adder", "sum"} {
+		fn, ok := compiled.Get(name).Value().(*tengo.CompiledFunction)
+		require.True(t, ok)
+		require.NoError(t, ctx.Prepare(fn), name)
+	}
+
+	// out-of-range constant reference
+	numConstants := len(ctx.Constants())
+	badFn := &tengo.CompiledFunction{
+		Instructions: append(
+			tengo.MakeInstruction(parser.OpConstant, numConstants),
+			tengo.MakeInstruction(parser.OpReturn, 1)...),
+	}
+	err = ctx.Prepare(badFn)
+	require.Error(t, err)
+	bytecodeErr, ok := err.(tengo.ErrInvalidBytecode)
+	require.True(t, ok)
+	require.Equal(t, 0, bytecodeErr.Offset)
+
+	// inconsistent arity metadata
+	err = ctx.Prepare(&tengo.CompiledFunction{
+		Instructions:  tengo.MakeInstruction(parser.OpReturn, 0),
+		NumParameters: 2,
+		NumLocals:     1,
+	})
+	require.Error(t, err)
+
+	// truncated instruction
+	err = ctx.Prepare(&tengo.CompiledFunction{
+		Instructions: tengo.MakeInstruction(parser.OpConstant, 0)[:2],
+	})
+	require.Error(t, err)
+
+	require.Error(t, ctx.Prepare(nil))
+}
+
+func TestExecutionContext_GlobalsInto(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		global_counter := 0
+		precision := 2
+		ratio := 0.5
+		name := "calculator"
+		enabled := true
+		history := []
+		limits := {min: -100, max: 100.5}
+
+		calculate := func(a, b) {
+			global_counter += 1
+			history = append(history, a + b)
+			return a + b
+		}
+	`))
+
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+
+	ctx := tengo.NewExecutionContext(compiled)
+	calculate := compiled.Get("calculate").Value().(*tengo.CompiledFunction)
+	_, err = ctx.Call(calculate, &tengo.Int{Value: 1}, &tengo.Int{Value: 2})
+	require.NoError(t, err)
+	_, err = ctx.Call(calculate, &tengo.Int{Value: 3}, &tengo.Int{Value: 4})
+	require.NoError(t, err)
+
+	type limits struct {
+		Min float64 `tengo:"min"`
+		Max float64 `tengo:"max"`
+	}
+	var state struct {
+		Counter   int64   `tengo:"global_counter,required"`
+		Precision int     `tengo:"precision"`
+		Ratio     float64 `tengo:"ratio"`
+		Name      string  `tengo:"name"`
+		Enabled   *bool   `tengo:"enabled"`
+		History   []int64 `tengo:"history"`
+		Limits    limits  `tengo:"limits"`
+		Optional  string  `tengo:"not_defined"`
+		Untagged  string
+	}
+	state.Optional = "default"
+	require.NoError(t, ctx.GlobalsInto(&state))
+	require.Equal(t, int64(2), state.Counter)
+	require.Equal(t, 2, state.Precision)
+	require.Equal(t, 0.5, state.Ratio)
+	require.Equal(t, "calculator", state.Name)
+	require.True(t, *state.Enabled)
+	require.Equal(t, 2, len(state.History))
+	require.Equal(t, int64(3), state.History[0])
+	require.Equal(t, int64(7), state.History[1])
+	require.Equal(t, -100.0, state.Limits.Min)
+	require.Equal(t, 100.5, state.Limits.Max)
+	require.Equal(t, "default", state.Optional)
+
+	var missing struct {
+		Value int64 `tengo:"not_defined,required"`
+	}
+	err = ctx.GlobalsInto(&missing)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "not_defined"))
+
+	var mismatch struct {
+		Name int64 `tengo:"name"`
+	}
+	err = ctx.GlobalsInto(&mismatch)
+	require.Error(t, err)
+	_, ok := err.(tengo.ErrInvalidGlobalType)
+	require.True(t, ok)
+
+	var badElem struct {
+		History []string `tengo:"history"`
+	}
+	err = ctx.GlobalsInto(&badElem)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "history[0]"))
+
+	require.Error(t, ctx.GlobalsInto(state))
+	require.Error(t, ctx.GlobalsInto(nil))
+}
+
+func TestExecutionContext_RuntimeError(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		empty := func() {}
+		fail := func(x) { return x + {} }
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+
+	ctx := tengo.NewExecutionContext(compiled)
+
+	empty := compiled.Get("empty").Value().(*tengo.CompiledFunction)
+	res, err := ctx.Call(empty)
+	require.NoError(t, err)
+	require.Equal(t, tengo.UndefinedValue, res)
+
+	fail := compiled.Get("fail").Value().(*tengo.CompiledFunction)
+	_, err = ctx.Call(fail, &tengo.Int{Value: 1})
+	require.Error(t, err)
+	require.Equal(t, "Runtime Error: invalid operation: int + map\n\tat (main):3:28",
+		err.Error())
+}
+
+func TestExecutionContext_WithGlobalsTransform(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		request_id := "none"
+		last_seen := ""
+		calls := 0
+		handle := func() {
+			calls += 1
+			last_seen = request_id
+			return "handled " + request_id
+		}
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+
+	ctx := tengo.NewExecutionContext(compiled)
+	placeholder := compiled.Get("request_id").Object()
+	requestIDIndex := -1
+	for i, g := range ctx.Globals() {
+		if g == placeholder {
+			requestIDIndex = i
+		}
+	}
+	require.True(t, requestIDIndex >= 0)
+
+	next := 0
+	ctx = ctx.WithGlobalsTransform(func(globals []tengo.Object) []tengo.Object {
+		next++
+		globals[requestIDIndex] = &tengo.String{Value: fmt.Sprintf("req-%d", next)}
+		return globals
+	})
+
+	handle := compiled.Get("handle").Value().(*tengo.CompiledFunction)
+	for i := 1; i <= 3; i++ {
+		res, err := ctx.Call(handle)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("handled req-%d", i),
+			res.(*tengo.String).Value)
+	}
+
+	var state struct {
+		RequestID string `tengo:"request_id"`
+		LastSeen  string `tengo:"last_seen"`
+		Calls     int    `tengo:"calls"`
+	}
+	require.NoError(t, ctx.GlobalsInto(&state))
+	// injected value is discarded, script assignments are committed
+	require.Equal(t, "none", state.RequestID)
+	require.Equal(t, "req-3", state.LastSeen)
+	require.Equal(t, 3, state.Calls)
+
+	// derived contexts keep the transform
+	res, err := ctx.WithIsolatedGlobals().Call(handle)
+	require.NoError(t, err)
+	require.Equal(t, "handled req-4", res.(*tengo.String).Value)
+}
+
+func TestExecutionContext_Assert(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		balance := 100
+		withdraw := func(amount) {
+			assert(amount <= balance, "insufficient funds")
+			balance -= amount
+			return balance
+		}
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+
+	ctx := tengo.NewExecutionContext(compiled)
+	withdraw := compiled.Get("withdraw").Value().(*tengo.CompiledFunction)
+
+	res, _, err := ctx.CallEx(withdraw, &tengo.Int{Value: 30})
+	require.NoError(t, err)
+	require.Equal(t, int64(70), res.(*tengo.Int).Value)
+
+	_, _, err = ctx.CallEx(withdraw, &tengo.Int{Value: 80})
+	require.Error(t, err)
+	var assertErr tengo.ErrAssertionFailed
+	require.True(t, errors.As(err, &assertErr))
+	require.Equal(t, "insufficient funds", assertErr.Message)
+	require.Equal(t, 4, assertErr.Pos.Line)
+	require.Equal(t, 4, assertErr.Pos.Column)
+	require.True(t, strings.HasPrefix(err.Error(),
+		"Runtime Error: assertion failed: insufficient funds"))
+
+	// failed calls do not commit globals
+	var state struct {
+		Balance int64 `tengo:"balance"`
+	}
+	require.NoError(t, ctx.GlobalsInto(&state))
+	require.Equal(t, int64(70), state.Balance)
+}
+
+func TestExecutionContext_Fork(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		counter := 0
+		seen := []
+		increment := func(id) {
+			counter += 1
+			seen = append(seen, id)
+			return counter
+		}
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+
+	ctx := tengo.NewExecutionContext(compiled)
+	increment := compiled.Get("increment").Value().(*tengo.CompiledFunction)
+
+	require.Nil(t, ctx.Fork(0))
+
+	const n = 50
+	children := ctx.Fork(n)
+	require.Equal(t, n, len(children))
+
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i, child := range children {
+		wg.Add(1)
+		go func(i int, child *tengo.ExecutionContext) {
+			defer wg.Done()
+			// child i increments its counter i+1 times
+			for j := 0; j <= i; j++ {
+				if _, err := child.Call(increment, &tengo.Int{Value: int64(i)}); err != nil {
+					errs[i] = err
+					return
+				}
+			}
+		}(i, child)
+	}
+	wg.Wait()
+
+	for i, child := range children {
+		require.NoError(t, errs[i])
+		var state struct {
+			Counter int     `tengo:"counter"`
+			Seen    []int64 `tengo:"seen"`
+		}
+		require.NoError(t, child.GlobalsInto(&state))
+		require.Equal(t, i+1, state.Counter)
+		require.Equal(t, i+1, len(state.Seen))
+		for _, id := range state.Seen {
+			require.Equal(t, int64(i), id)
+		}
+	}
+
+	// the parent is unaffected
+	var parent struct {
+		Counter int `tengo:"counter"`
+	}
+	require.NoError(t, ctx.GlobalsInto(&parent))
+	require.Equal(t, 0, parent.Counter)
+}
+
+func TestExecutionContext_StackTrace(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+validate := func(x) {
+	if x < 0 { return error("negative") }
+	return x
+}
+process := func(x) { return validate(x) }
+handle := func(x) { return process(x) }
+
+fail := func(x) { return x + {} }
+outer := func(x) {
+	return each([x], func(v) { return fail(v) })
+}
+`))
+	require.NoError(t, script.Add("each", &tengo.UserFunction{
+		Name: "each",
+		VMValue: func(vm *tengo.VM, args ...tengo.Object) (tengo.Object, error) {
+			for _, item := range args[0].(*tengo.Array).Value {
+				if _, err := vm.Call(args[1], item); err != nil {
+					return nil, err
+				}
+			}
+			return tengo.UndefinedValue, nil
+		},
+	}))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+
+	frameNames := func(trace []tengo.Frame) []string {
+		var names []string
+		for _, f := range trace {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+
+	handle := compiled.Get("handle").Value().(*tengo.CompiledFunction)
+	outer := compiled.Get("outer").Value().(*tengo.CompiledFunction)
+	ctx := tengo.NewExecutionContext(compiled)
+
+	// disabled by default
+	res, err := ctx.Call(handle, &tengo.Int{Value: -1})
+	require.NoError(t, err)
+	require.Nil(t, res.(*tengo.Error).StackTrace())
+	_, err = ctx.Call(outer, &tengo.Int{Value: 1})
+	require.Error(t, err)
+	require.False(t, errors.As(err, &tengo.ErrRuntime{}))
+
+	ctx = ctx.WithStackTrace(true)
+	res, err = ctx.Call(handle, &tengo.Int{Value: -1})
+	require.NoError(t, err)
+	trace := res.(*tengo.Error).StackTrace()
+	require.Equal(t, []string{"validate", "process", "handle"},
+		frameNames(trace))
+	require.Equal(t, "validate ((main):3:20)", trace[0].String())
+	require.Equal(t, 6, trace[1].Pos.Line)
+	require.Equal(t, 7, trace[2].Pos.Line)
+
+	// runtime errors, including those raised in callbacks run by VM.Call
+	_, err = ctx.Call(outer, &tengo.Int{Value: 1})
+	require.Error(t, err)
+	var runtimeErr tengo.ErrRuntime
+	require.True(t, errors.As(err, &runtimeErr))
+	require.Equal(t, []string{"fail", "", "outer"},
+		frameNames(runtimeErr.StackTrace()))
+	require.Equal(t, 9, runtimeErr.Trace[0].Pos.Line)
+	require.Equal(t, 11, runtimeErr.Trace[1].Pos.Line)
+	require.Equal(t, 11, runtimeErr.Trace[2].Pos.Line)
+	require.True(t, strings.HasPrefix(err.Error(),
+		"Runtime Error: invalid operation: int + map"))
+
+	// scripts run with stack traces enabled
+	script = tengo.NewScript([]byte(`
+f := func() { return error("oops") }
+g := func() { return f() }
+out := g()
+`))
+	script.EnableStackTrace(true)
+	compiled, err = script.Run()
+	require.NoError(t, err)
+	trace = compiled.Get("out").Object().(*tengo.Error).StackTrace()
+	require.Equal(t, []string{"f", "g", ""}, frameNames(trace))
+	require.Equal(t, 4, trace[2].Pos.Line)
+}
+
+func TestExecutionContext_GlobalAt(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		a := 10
+		b := "x"
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+
+	ctx := tengo.NewExecutionContext(compiled)
+	globals := ctx.Globals()
+	require.Equal(t, len(globals), ctx.GlobalsLen())
+	for i, expected := range globals {
+		g, err := ctx.GlobalAt(i)
+		require.NoError(t, err)
+		require.True(t, g == expected)
+	}
+
+	_, err = ctx.GlobalAt(-1)
+	require.True(t, errors.Is(err, tengo.ErrIndexOutOfBounds))
+	_, err = ctx.GlobalAt(ctx.GlobalsLen())
+	require.True(t, errors.Is(err, tengo.ErrIndexOutOfBounds))
+}
+
+func TestExecutionContext_WithOverflowChecks(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		add := func(a, b) { return a + b }
+		sub := func(a, b) { return a - b }
+		mul := func(a, b) { return a * b }
+		neg := func(a) { return -a }
+		inc := func(a) { a++; return a }
+		folded := func() { return 9223372036854775807 + 1 }
+		nested := func(a) { return memoize(add)(a, 1) }
+		mixed := func(a) { return a + 0.5 }
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	get := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+	i := func(v int64) tengo.Object { return &tengo.Int{Value: v} }
+
+	const max, min = math.MaxInt64, math.MinInt64
+	unchecked := tengo.NewExecutionContext(compiled)
+	checked := unchecked.WithOverflowChecks(true)
+	tests := []struct {
+		fn      string
+		args    []tengo.Object
+		wrapped int64
+	}{
+		{"add", []tengo.Object{i(max), i(1)}, min},
+		{"add", []tengo.Object{i(min), i(-1)}, max},
+		{"sub", []tengo.Object{i(min), i(1)}, max},
+		{"sub", []tengo.Object{i(max), i(-1)}, min},
+		{"sub", []tengo.Object{i(0), i(min)}, min},
+		{"mul", []tengo.Object{i(max), i(2)}, -2},
+		{"mul", []tengo.Object{i(min), i(-1)}, min},
+		{"mul", []tengo.Object{i(-1), i(min)}, min},
+		{"mul", []tengo.Object{i(1 << 32), i(1 << 31)}, min},
+		{"neg", []tengo.Object{i(min)}, min},
+		{"inc", []tengo.Object{i(max)}, min},
+		{"folded", nil, min},
+		{"nested", []tengo.Object{i(max)}, min},
+	}
+	for _, tc := range tests {
+		// wraps around by default
+		res, err := unchecked.Call(get(tc.fn), tc.args...)
+		require.NoError(t, err, tc.fn)
+		require.Equal(t, i(tc.wrapped), res, tc.fn)
+
+		_, err = checked.Call(get(tc.fn), tc.args...)
+		require.Error(t, err, tc.fn)
+		require.True(t, errors.Is(err, tengo.ErrIntOverflow), tc.fn)
+	}
+	_, err = checked.Call(get("add"), i(max), i(1))
+	require.True(t, strings.HasPrefix(err.Error(),
+		"Runtime Error: integer overflow: 9223372036854775807 + 1"), err.Error())
+	_, err = checked.Call(get("neg"), i(min))
+	require.True(t, strings.HasPrefix(err.Error(),
+		"Runtime Error: integer overflow: negation of -9223372036854775808"),
+		err.Error())
+
+	// results at the boundary are fine
+	for _, tc := range []struct {
+		fn       string
+		args     []tengo.Object
+		expected int64
+	}{
+		{"add", []tengo.Object{i(max - 1), i(1)}, max},
+		{"add", []tengo.Object{i(min), i(max)}, -1},
+		{"sub", []tengo.Object{i(min + 1), i(1)}, min},
+		{"sub", []tengo.Object{i(-1), i(max)}, min},
+		{"mul", []tengo.Object{i(min / 2), i(2)}, min},
+		{"mul", []tengo.Object{i(max), i(-1)}, -max},
+		{"mul", []tengo.Object{i(min), i(1)}, min},
+		{"mul", []tengo.Object{i(min), i(0)}, 0},
+		{"neg", []tengo.Object{i(max)}, -max},
+		{"inc", []tengo.Object{i(max - 1)}, max},
+	} {
+		res, err := checked.Call(get(tc.fn), tc.args...)
+		require.NoError(t, err, tc.fn)
+		require.Equal(t, i(tc.expected), res, tc.fn)
+	}
+	res, err := checked.Call(get("mixed"), i(max))
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Float{Value: float64(max) + 0.5}, res)
+}
+
+func TestExecutionContext_WithDeterministicMaps(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		m := {}
+		for i := 0; i < 26; i++ { m[string(char(122 - i))] = i }
+		order := func(x) {
+			s := ""
+			for k, _ in x { s += k }
+			return s
+		}
+		orders := func(x) {
+			// nested loops and callbacks iterate in the same order
+			inner := ""
+			for k in x { inner += order({a: 1, c: 2, b: 3}) }
+			return [order(x), order(immutable(x)), memoize(order)(x), inner[:3]]
+		}
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	orders := compiled.Get("orders").Value().(*tengo.CompiledFunction)
+	m := compiled.Get("m").Object()
+
+	ctx := tengo.NewExecutionContext(compiled)
+	sorted := ctx.WithDeterministicMaps(true)
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		res, err := sorted.Call(orders, m)
+		require.NoError(t, err)
+		arr := res.(*tengo.Array).Value
+		for _, o := range arr[:3] {
+			require.Equal(t, "abcdefghijklmnopqrstuvwxyz", o.(*tengo.String).Value)
+		}
+		require.Equal(t, "abc", arr[3].(*tengo.String).Value)
+
+		res, err = ctx.Call(orders, m)
+		require.NoError(t, err)
+		seen[res.(*tengo.Array).Value[0].(*tengo.String).Value] = true
+	}
+	// the order is random by default
+	require.True(t, len(seen) > 1)
+}
+
+func TestExecutionContext_WithArgCoercion(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		scale := func(x, factor) { return x / 2 * factor }
+		inline := scale(5.0, 1.5)
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+
+	fn := compiled.Get("scale").Value().(*tengo.CompiledFunction)
+	inline := compiled.Get("inline").Object()
+	args := []tengo.Object{&tengo.Int{Value: 5}, &tengo.Float{Value: 1.5}}
+
+	// without coercion, x / 2 is an integer division
+	ctx := tengo.NewExecutionContext(compiled)
+	res, err := ctx.Call(fn, args...)
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Float{Value: 3}, res)
+
+	res, err = ctx.WithArgCoercion(true).Call(fn, args...)
+	require.NoError(t, err)
+	require.Equal(t, inline, res)
+	require.Equal(t, &tengo.Float{Value: 3.75}, res)
+	require.Equal(t, int64(5), args[0].(*tengo.Int).Value)
+
+	// ints are left alone when no float is passed
+	res, err = ctx.WithArgCoercion(true).Call(fn,
+		&tengo.Int{Value: 5}, &tengo.Int{Value: 3})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 6}, res)
+}
+
+func TestExecutionContext_CallForking(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		counter := 0
+		seen := {}
+		increment := func(id) {
+			counter += 1
+			seen[id] = counter
+			return counter
+		}
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+
+	increment := compiled.Get("increment").Value().(*tengo.CompiledFunction)
+	ctx := tengo.NewExecutionContext(compiled)
+	before := ctx.Globals()
+
+	res, forked, err := ctx.CallForking(increment, &tengo.String{Value: "a"})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 1}, res)
+
+	res, forked, err = forked.CallForking(increment, &tengo.String{Value: "b"})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 2}, res)
+
+	// the original context is unchanged, including values mutated in place
+	after := ctx.Globals()
+	require.Equal(t, len(before), len(after))
+	for i := range before {
+		require.True(t, before[i] == after[i])
+		if m, ok := after[i].(*tengo.Map); ok {
+			require.Equal(t, 0, len(m.Value))
+		}
+	}
+	res, err = ctx.Call(increment, &tengo.String{Value: "c"})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 1}, res)
+
+	// the forked context reflects both calls
+	res, err = forked.Call(increment, &tengo.String{Value: "d"})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 3}, res)
+
+	_, forked, err = ctx.CallForking(increment)
+	require.Error(t, err)
+	require.Nil(t, forked)
+}
+
+func TestExecutionContext_CallStrictReadOnly(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		counter := 0
+		config := {debug: false}
+		query := func(n) { return counter + n }
+		increment := func() { counter += 1; return counter }
+		nested := func() {
+			f := func() { counter = 10 }
+			f()
+			return "unreachable"
+		}
+		enable := func() { config.debug = true }
+		local := func() {
+			c := counter
+			c += 1
+			return c
+		}
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	fn := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+	ctx := tengo.NewExecutionContext(compiled)
+
+	// reading globals and assigning to locals is allowed
+	res, err := ctx.CallStrictReadOnly(fn("query"), &tengo.Int{Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 2}, res)
+	res, err = ctx.CallStrictReadOnly(fn("local"))
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 1}, res)
+
+	// assigning to a global or to its elements fails, even in nested calls
+	for _, c := range []struct{ name, global string }{
+		{"increment", "counter"},
+		{"nested", "counter"},
+		{"enable", "config"},
+	} {
+		_, err = ctx.CallStrictReadOnly(fn(c.name))
+		require.Error(t, err)
+		require.True(t, errors.Is(err, tengo.ErrReadOnlyGlobal), err)
+		require.True(t, strings.Contains(err.Error(),
+			"cannot assign to a global in a read-only call: "+c.global), err)
+	}
+
+	// the globals are unchanged, and regular calls can still assign them
+	res, err = ctx.Call(fn("query"), &tengo.Int{Value: 0})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 0}, res)
+	res, err = ctx.Call(fn("increment"))
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 1}, res)
+	config, _ := ctx.GlobalAt(1)
+	require.Equal(t, "{debug: false}", config.String())
+}
+
+func TestExecutionContext_CurrentDepth(t *testing.T) {
+	var ctx *tengo.ExecutionContext
+	var depths []int
+	script := tengo.NewScript([]byte(`
+		nest := func(n) {
+			probe()
+			if n == 0 { return 0 }
+			return 1 + nest(n - 1)
+		}
+		viaBuiltin := func() {
+			probe()
+			return map_values({a: 1}, func(v) { probe(); return nest(v) + 1 })
+		}
+	`))
+	require.NoError(t, script.Add("probe", &tengo.UserFunction{
+		Name: "probe",
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			depths = append(depths, ctx.CurrentDepth())
+			return tengo.UndefinedValue, nil
+		},
+	}))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	ctx = tengo.NewExecutionContext(compiled)
+	fn := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+	require.Equal(t, 0, ctx.CurrentDepth())
+
+	// each nested call is one frame deeper
+	_, err = ctx.Call(fn("nest"), &tengo.Int{Value: 3})
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 3, 4}, depths)
+
+	// callbacks run by builtins count the frames of their caller
+	depths = nil
+	_, err = ctx.Call(fn("viaBuiltin"))
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 2, 3, 4}, depths)
+
+	// calls through other contexts, even forked ones, aren't seen
+	depths = nil
+	_, err = ctx.Fork(1)[0].Call(fn("nest"), &tengo.Int{Value: 1})
+	require.NoError(t, err)
+	require.Equal(t, []int{0, 0}, depths)
+
+	require.Equal(t, 0, ctx.CurrentDepth())
+}
+
+func TestExecutionContext_WithReturnObserver(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		outer := func(n) {
+			middle := func(x) {
+				inner := func(y) { return y * 10 }
+				return inner(x + 1) + 2
+			}
+			return middle(n) * 3
+		}
+		safe := func() {
+			risky := func() {
+				defer func() { recover() }()
+				return 1 / 0
+			}
+			risky()
+			return "ok"
+		}
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	fn := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+
+	type ret struct {
+		depth int
+		value string
+	}
+	var returns []ret
+	ctx := tengo.NewExecutionContext(compiled).WithReturnObserver(
+		func(depth int, value tengo.Object) {
+			returns = append(returns, ret{depth, value.String()})
+		})
+
+	// the returns of the nested closures are observed innermost first
+	res, err := ctx.Call(fn("outer"), &tengo.Int{Value: 1})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 66}, res)
+	require.True(t, reflect.DeepEqual([]ret{{3, "20"}, {2, "22"}, {1, "66"}},
+		returns), returns)
+
+	// deferred calls return before their function, and a function that
+	// recovers returns undefined
+	returns = nil
+	_, err = ctx.Call(fn("safe"))
+	require.NoError(t, err)
+	require.True(t, reflect.DeepEqual([]ret{
+		{3, "<undefined>"}, {2, "<undefined>"}, {1, `"ok"`},
+	}, returns), returns)
+
+	// a nil observer disables it
+	returns = nil
+	_, err = ctx.WithReturnObserver(nil).Call(fn("outer"), &tengo.Int{Value: 1})
+	require.NoError(t, err)
+	require.Equal(t, 0, len(returns))
+}
+
+func TestExecutionContext_WithResultTransform(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		count := 0
+		add := func(a, b) { count += 1; return a + b }
+		fail := func() { return error("bad input") }
+		crash := func() { return 1 / 0 }
+		nothing := func() {}
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	fn := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+
+	var calls int
+	wrap := func(result tengo.Object) tengo.Object {
+		calls++
+		return &tengo.Map{Value: map[string]tengo.Object{"value": result}}
+	}
+	base := tengo.NewExecutionContext(compiled)
+	ctx := base.WithResultTransform(wrap)
+
+	// every result is wrapped, by each call method
+	res, err := ctx.Call(fn("add"), &tengo.Int{Value: 1}, &tengo.Int{Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Map{Value: map[string]tengo.Object{
+		"value": &tengo.Int{Value: 3}}}, res)
+
+	res, globals, err := ctx.CallEx(fn("nothing"))
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Map{Value: map[string]tengo.Object{
+		"value": tengo.UndefinedValue}}, res)
+	require.True(t, globals != nil)
+
+	// error values are results like any other
+	result, err := ctx.CallResult(fn("fail"))
+	require.NoError(t, err)
+	_, ok := result.Map()
+	require.True(t, ok)
+	require.Equal(t, &tengo.Error{Value: &tengo.String{Value: "bad input"}},
+		result.Object().(*tengo.Map).Value["value"])
+
+	results, err := ctx.CallGroup(context.Background(), []tengo.BatchCall{
+		{Fn: fn("add"), Args: []tengo.Object{
+			&tengo.Int{Value: 2}, &tengo.Int{Value: 3}}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Map{Value: map[string]tengo.Object{
+		"value": &tengo.Int{Value: 5}}}, results[0])
+
+	// the transform doesn't run on Go errors
+	calls = 0
+	_, err = ctx.Call(fn("crash"))
+	require.Error(t, err)
+	_, err = ctx.Call(fn("add"), &tengo.Int{Value: 1})
+	require.Error(t, err)
+	require.Equal(t, 0, calls)
+
+	// the globals left by the call are committed
+	count, err := ctx.GlobalAt(0)
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 1}, count)
+
+	// a nil value is returned as undefined
+	res, err = base.WithResultTransform(func(tengo.Object) tengo.Object {
+		return nil
+	}).Call(fn("add"), &tengo.Int{Value: 1}, &tengo.Int{Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, tengo.UndefinedValue, res)
+
+	// the context it's derived from and a nil transform are unaffected
+	res, err = base.Call(fn("add"), &tengo.Int{Value: 1}, &tengo.Int{Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 3}, res)
+	res, err = ctx.WithResultTransform(nil).Call(fn("add"),
+		&tengo.Int{Value: 1}, &tengo.Int{Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 3}, res)
+}
+
+func TestExecutionContext_IsPure(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		counter := 0
+		seen := {}
+		get_counter := func() { return counter }
+		increment := func() { counter += 1; return counter }
+		mark := func(id) { seen[id] = true }
+		local := func(x) { y := x * 2; z := {}; z.y = y; return z }
+		nested := func() { return func() { counter = 0 } }
+		call := func(f) { return f() }
+		alias := func() { m := seen; m.x = 1 }
+		remove := func(k) { delete(seen, k) }
+		set_key := func(m) { m.x = 1 }
+		copy_seen := func() { m := copy(seen); return m }
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+
+	ctx := tengo.NewExecutionContext(compiled)
+	isPure := func(name string) bool {
+		fn := compiled.Get(name).Value().(*tengo.CompiledFunction)
+		return ctx.IsPure(fn)
+	}
+	require.True(t, isPure("get_counter"))
+	require.True(t, isPure("local"))
+	require.True(t, isPure("call"))
+	require.False(t, isPure("increment"))
+	require.False(t, isPure("mark"))
+	require.False(t, isPure("nested"))
+	require.True(t, isPure("set_key"))
+	require.True(t, isPure("copy_seen"))
+	require.False(t, isPure("alias"))
+	require.False(t, isPure("remove"))
+	require.False(t, ctx.IsPure(nil))
+}
+
+func TestExecutionContext_SaveLoadGlobals(t *testing.T) {
+	src := []byte(`
+		times := import("times")
+		counter := 0
+		history := []
+		info := {name: "svc", started: times.unix(0, 0), ratio: 0.5}
+		increment := func() {
+			counter += 1
+			history = append(history, counter)
+			return counter
+		}
+	`)
+	newContext := func() (*tengo.ExecutionContext, *tengo.CompiledFunction) {
+		script := tengo.NewScript(src)
+		script.SetImports(stdlib.GetModuleMap("times"))
+		compiled, err := script.Compile()
+		require.NoError(t, err)
+		require.NoError(t, compiled.Run())
+		fn := compiled.Get("increment").Value().(*tengo.CompiledFunction)
+		return tengo.NewExecutionContext(compiled), fn
+	}
+
+	ctx, increment := newContext()
+	for i := 0; i < 3; i++ {
+		_, err := ctx.Call(increment)
+		require.NoError(t, err)
+	}
+	var buf bytes.Buffer
+	require.NoError(t, ctx.SaveGlobals(&buf))
+
+	// a fresh context of the same program continues from the saved state
+	restored, restoredIncrement := newContext()
+	require.NoError(t, restored.LoadGlobals(&buf))
+	res, err := restored.Call(restoredIncrement)
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 4}, res)
+
+	var state struct {
+		Counter int64   `tengo:"counter"`
+		History []int64 `tengo:"history"`
+		Info    struct {
+			Name  string  `tengo:"name"`
+			Ratio float64 `tengo:"ratio"`
+		} `tengo:"info"`
+	}
+	require.NoError(t, restored.GlobalsInto(&state))
+	require.Equal(t, int64(4), state.Counter)
+	require.Equal(t, 4, len(state.History))
+	require.Equal(t, int64(3), state.History[2])
+	require.Equal(t, "svc", state.Info.Name)
+	require.Equal(t, 0.5, state.Info.Ratio)
+
+	// the original context is unaffected
+	res, err = ctx.Call(increment)
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 4}, res)
+
+	// functions that are not globals themselves cannot be saved
+	script := tengo.NewScript([]byte(`handlers := {f: func() {}}`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	err = tengo.NewExecutionContext(compiled).SaveGlobals(&buf)
+	require.Error(t, err)
+	require.Equal(t, "cannot save global 'handlers': "+
+		"compiled-function is not serializable", err.Error())
+
+	script = tengo.NewScript([]byte(`f := len`))
+	compiled, err = script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	err = tengo.NewExecutionContext(compiled).SaveGlobals(&buf)
+	require.Error(t, err)
+
+	// globals of a different program are rejected
+	buf.Reset()
+	require.NoError(t, ctx.SaveGlobals(&buf))
+	script = tengo.NewScript([]byte(`a := 1`))
+	compiled, err = script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	err = tengo.NewExecutionContext(compiled).LoadGlobals(&buf)
+	require.Error(t, err)
+}
+
+func TestExecutionContext_CallGroup(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		counter := 0
+		square := func(i) {
+			counter += 1
+			for j := 0; j < 1000; j++ {}
+			return i * i
+		}
+		spin := func() { for {} }
+		fail := func() { return 1 + {} }
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	get := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+
+	ctx := tengo.NewExecutionContext(compiled)
+	var calls []tengo.BatchCall
+	for i := 0; i < 20; i++ {
+		calls = append(calls, tengo.BatchCall{
+			Fn:   get("square"),
+			Args: []tengo.Object{&tengo.Int{Value: int64(i)}},
+		})
+	}
+	for _, group := range []*tengo.ExecutionContext{
+		ctx, ctx.WithCallGroupLimit(1), ctx.WithCallGroupLimit(3),
+	} {
+		results, err := group.CallGroup(context.Background(), calls)
+		require.NoError(t, err)
+		require.Equal(t, 20, len(results))
+		for i, res := range results {
+			require.Equal(t, &tengo.Int{Value: int64(i * i)}, res)
+		}
+	}
+	var state struct {
+		Counter int64 `tengo:"counter"`
+	}
+	require.NoError(t, ctx.GlobalsInto(&state))
+	require.Equal(t, int64(0), state.Counter)
+
+	results, err := ctx.CallGroup(context.Background(), nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(results))
+
+	// the first error aborts the calls still running
+	calls = []tengo.BatchCall{{Fn: get("fail")}}
+	for i := 0; i < 19; i++ {
+		calls = append(calls, tengo.BatchCall{Fn: get("spin")})
+	}
+	start := time.Now()
+	results, err = ctx.CallGroup(context.Background(), calls)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "invalid operation"))
+	require.Nil(t, results)
+	require.True(t, time.Since(start) < 5*time.Second)
+
+	// so does cancelling the context
+	timeout, cancel := context.WithTimeout(context.Background(),
+		50*time.Millisecond)
+	defer cancel()
+	results, err = ctx.CallGroup(timeout, calls[1:])
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.Nil(t, results)
+}
+
+func TestExecutionContext_SetDeadline(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		spin := func() { for {} }
+		add := func(a, b) { return a + b }
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	spin := compiled.Get("spin").Value().(*tengo.CompiledFunction)
+	add := compiled.Get("add").Value().(*tengo.CompiledFunction)
+	one := &tengo.Int{Value: 1}
+
+	// a call started before the deadline is aborted when it's reached
+	ctx := tengo.NewExecutionContext(compiled)
+	ctx.SetDeadline(time.Now().Add(50 * time.Millisecond))
+	res, err := ctx.Call(add, one, one)
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 2}, res)
+	start := time.Now()
+	_, err = ctx.Call(spin)
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.True(t, time.Since(start) < 5*time.Second)
+
+	// calls started after the deadline fail right away, including calls
+	// through derived contexts
+	_, err = ctx.Call(add, one, one)
+	require.Equal(t, context.DeadlineExceeded, err)
+	_, _, err = ctx.CallForking(add, one, one)
+	require.Equal(t, context.DeadlineExceeded, err)
+	_, err = ctx.WithStackTrace(true).Call(add, one, one)
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	// clearing the deadline
+	ctx.SetDeadline(time.Time{})
+	res, err = ctx.Call(add, one, one)
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 2}, res)
+
+	// setting a deadline while a call is in progress
+	done := make(chan error)
+	go func() {
+		_, err := ctx.Call(spin)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	ctx.SetDeadline(time.Now())
+	require.Equal(t, context.DeadlineExceeded, <-done)
+
+	// extending the deadline before it's reached
+	ctx.SetDeadline(time.Now().Add(20 * time.Millisecond))
+	ctx.SetDeadline(time.Now().Add(time.Hour))
+	time.Sleep(40 * time.Millisecond)
+	res, err = ctx.Call(add, one, one)
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 2}, res)
+
+	// derived contexts share the deadline
+	derived := ctx.WithIsolatedGlobals()
+	derived.SetDeadline(time.Now())
+	_, err = ctx.Call(add, one, one)
+	require.Equal(t, context.DeadlineExceeded, err)
+	ctx.SetDeadline(time.Time{})
+	res, err = derived.Call(add, one, one)
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 2}, res)
+}
+
+func TestExecutionContext_FunctionContextMismatch(t *testing.T) {
+	compile := func(src string) *tengo.Compiled {
+		compiled, err := tengo.NewScript([]byte(src)).Compile()
+		require.NoError(t, err)
+		require.NoError(t, compiled.Run())
+		return compiled
+	}
+	a := compile(`
+		greeting := "hello"
+		f := func() { return greeting }
+		make := func(x) { return func() { return x } }
+	`)
+	b := compile(`
+		n := 42
+		f := func() { return n }
+	`)
+	fnA := a.Get("f").Value().(*tengo.CompiledFunction)
+	fnB := b.Get("f").Value().(*tengo.CompiledFunction)
+
+	// a function of script A can't be called through a context of script B
+	_, err := tengo.NewExecutionContext(b).Call(fnA)
+	require.True(t, errors.Is(err, tengo.ErrFunctionContextMismatch), err)
+	_, _, err = tengo.NewExecutionContext(a).CallEx(fnB)
+	require.True(t, errors.Is(err, tengo.ErrFunctionContextMismatch), err)
+
+	// functions of the same script, including closures created at runtime,
+	// copies and functions of a clone, are accepted
+	ctx := tengo.NewExecutionContext(a)
+	res, err := ctx.Call(fnA)
+	require.NoError(t, err)
+	require.Equal(t, &tengo.String{Value: "hello"}, res)
+	closure, err := ctx.Call(a.Get("make").Value().(*tengo.CompiledFunction),
+		&tengo.Int{Value: 7})
+	require.NoError(t, err)
+	res, err = ctx.Call(closure.(*tengo.CompiledFunction))
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 7}, res)
+	res, err = ctx.Call(fnA.Copy().(*tengo.CompiledFunction))
+	require.NoError(t, err)
+	require.Equal(t, &tengo.String{Value: "hello"}, res)
+	clone := a.Clone()
+	res, err = tengo.NewExecutionContext(clone).
+		Call(clone.Get("f").Value().(*tengo.CompiledFunction))
+	require.NoError(t, err)
+	require.Equal(t, &tengo.String{Value: "hello"}, res)
+
+	// functions built by hand carry no origin and aren't checked
+	res, err = tengo.NewExecutionContext(b).Call(&tengo.CompiledFunction{
+		Instructions: fnB.Instructions,
+		NumLocals:    fnB.NumLocals,
+	})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 42}, res)
+}
+
+func TestExecutionContext_WithProfiling(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		hot := func(x) { return x * 2 }
+		cold := func(n) {
+			total := 0
+			for i := 0; i < n; i++ {
+				total += hot(i)
+			}
+			return total
+		}
+		rec := func(n) { return n == 0 ? 0 : rec(n - 1) }
+		each := func(arr, fn) {
+			for x in arr { fn(x) }
+		}
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	fn := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+	expectProfile := func(expected, actual map[string]int64) {
+		require.NotNil(t, actual)
+		// maps are printed in key order
+		require.Equal(t, fmt.Sprint(expected), fmt.Sprint(actual))
+	}
+
+	// disabled by default
+	ctx := tengo.NewExecutionContext(compiled)
+	_, err = ctx.Call(fn("cold"), &tengo.Int{Value: 10})
+	require.NoError(t, err)
+	require.Nil(t, ctx.Profile())
+
+	// the hot inner function dominates the profile
+	profiled := ctx.WithProfiling(true)
+	res, err := profiled.Call(fn("cold"), &tengo.Int{Value: 1000})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 999000}, res)
+	expectProfile(map[string]int64{"cold": 1, "hot": 1000}, profiled.Profile())
+
+	// counts accumulate over calls, including tail calls, calls of derived
+	// contexts and callbacks run by builtins
+	_, err = profiled.Call(fn("rec"), &tengo.Int{Value: 5})
+	require.NoError(t, err)
+	_, _, err = profiled.WithStackTrace(true).CallForking(fn("cold"),
+		&tengo.Int{Value: 1})
+	require.NoError(t, err)
+	_, err = profiled.Call(fn("each"), &tengo.Array{Value: []tengo.Object{
+		&tengo.Int{Value: 1}, &tengo.Int{Value: 2},
+	}}, fn("hot"))
+	require.NoError(t, err)
+	expectProfile(map[string]int64{
+		"cold": 2, "hot": 1003, "rec": 6, "each": 1,
+	}, profiled.Profile())
+
+	// the original context isn't profiled, and enabling profiling again
+	// starts from zero
+	require.Nil(t, ctx.Profile())
+	expectProfile(map[string]int64{}, profiled.WithProfiling(true).Profile())
+	require.Nil(t, profiled.WithProfiling(false).Profile())
+
+	// concurrent calls of forks count into the same profile
+	var wg sync.WaitGroup
+	concurrent := ctx.WithProfiling(true)
+	for _, fork := range concurrent.Fork(8) {
+		wg.Add(1)
+		go func(fork *tengo.ExecutionContext) {
+			defer wg.Done()
+			_, err := fork.Call(fn("cold"), &tengo.Int{Value: 100})
+			require.NoError(t, err)
+		}(fork)
+	}
+	wg.Wait()
+	expectProfile(map[string]int64{"cold": 8, "hot": 800},
+		concurrent.Profile())
+}
+
+func TestExecutionContext_WithArgValidator(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		calls := 0
+		total := func(arr) {
+			calls++
+			s := 0
+			for x in arr { s += x }
+			return s
+		}
+		anon := [func(x) { return x }]
+		upTo := func(n) {
+			arr := []
+			for i := 1; i <= n; i++ { arr = append(arr, i) }
+			return total(arr)
+		}
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	total := compiled.Get("total").Value().(*tengo.CompiledFunction)
+	anon := compiled.Get("anon").Object().(*tengo.Array).
+		Value[0].(*tengo.CompiledFunction)
+	upTo := compiled.Get("upTo").Value().(*tengo.CompiledFunction)
+
+	errTooLarge := errors.New("array argument too large")
+	var names []string
+	ctx := tengo.NewExecutionContext(compiled).WithArgValidator(
+		func(fnName string, args []tengo.Object) error {
+			names = append(names, fnName)
+			for _, arg := range args {
+				if arr, ok := arg.(*tengo.Array); ok && len(arr.Value) > 3 {
+					return errTooLarge
+				}
+			}
+			return nil
+		})
+	array := func(n int) *tengo.Array {
+		arr := &tengo.Array{}
+		for i := 1; i <= n; i++ {
+			arr.Value = append(arr.Value, &tengo.Int{Value: int64(i)})
+		}
+		return arr
+	}
+	calls := func(ctx *tengo.ExecutionContext) tengo.Object {
+		for i, name := range compiled.GlobalNames() {
+			if name == "calls" {
+				return ctx.Globals()[i]
+			}
+		}
+		t.Fatal("calls not found")
+		return nil
+	}
+
+	res, err := ctx.Call(total, array(3))
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 6}, res)
+	require.Equal(t, &tengo.Int{Value: 1}, calls(ctx))
+
+	// the oversized array is rejected without running the function
+	_, err = ctx.Call(total, array(4))
+	require.Equal(t, errTooLarge, err)
+	_, _, err = ctx.CallEx(total, array(100))
+	require.Equal(t, errTooLarge, err)
+	_, _, err = ctx.CallForking(total, array(4))
+	require.Equal(t, errTooLarge, err)
+	require.Equal(t, &tengo.Int{Value: 1}, calls(ctx))
+
+	// anonymous functions have no name, and derived contexts keep the
+	// validator
+	res, err = ctx.WithStackTrace(true).Call(anon, &tengo.Int{Value: 1})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 1}, res)
+	require.Equal(t, "[total total total total ]", fmt.Sprint(names))
+	_, err = ctx.WithIsolatedGlobals().Call(anon, array(5))
+	require.Equal(t, errTooLarge, err)
+
+	// calls the script makes itself are not validated
+	names = nil
+	res, err = ctx.Call(upTo, &tengo.Int{Value: 5})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 15}, res)
+	require.Equal(t, "[upTo]", fmt.Sprint(names))
+
+	// removing the validator
+	res, err = ctx.WithArgValidator(nil).Call(total, array(5))
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 15}, res)
+}
+
+func TestExecutionContext_WithArgInterceptor(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		greet := func(name, opts) {
+			return opts.greeting + ", " + name
+		}
+		login := func(user) { return user.password }
+		greetAll := func(names) {
+			out := []
+			for n in names { out = append(out, greet(n, {greeting: "Hi"})) }
+			return out
+		}
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	fn := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+	str := func(s string) tengo.Object { return &tengo.String{Value: s} }
+
+	var names []string
+	ctx := tengo.NewExecutionContext(compiled).WithArgInterceptor(
+		func(fnName string, args []tengo.Object) []tengo.Object {
+			names = append(names, fnName)
+			switch fnName {
+			case "greet":
+				// inject the default options when they're left out
+				if len(args) == 1 {
+					args = append(args, &tengo.Map{Value: map[string]tengo.Object{
+						"greeting": str("Hello"),
+					}})
+				}
+			case "login":
+				user := args[0].(*tengo.Map)
+				redacted := user.Copy().(*tengo.Map)
+				redacted.Value["password"] = str("***")
+				args[0] = redacted
+			}
+			return args
+		})
+
+	res, err := ctx.Call(fn("greet"), str("Ann"))
+	require.NoError(t, err)
+	require.Equal(t, "Hello, Ann", res.(*tengo.String).Value)
+
+	// the arguments given are kept
+	opts := &tengo.Map{Value: map[string]tengo.Object{"greeting": str("Hey")}}
+	res, err = ctx.Call(fn("greet"), str("Bob"), opts)
+	require.NoError(t, err)
+	require.Equal(t, "Hey, Bob", res.(*tengo.String).Value)
+
+	// the caller's arguments aren't modified
+	user := &tengo.Map{Value: map[string]tengo.Object{"password": str("secret")}}
+	args := []tengo.Object{user}
+	res, err = ctx.Call(fn("login"), args...)
+	require.NoError(t, err)
+	require.Equal(t, "***", res.(*tengo.String).Value)
+	require.Equal(t, user, args[0])
+	require.Equal(t, "secret", user.Value["password"].(*tengo.String).Value)
+
+	// the calls the script makes itself aren't intercepted
+	names = nil
+	res, err = ctx.Call(fn("greetAll"), &tengo.Array{Value: []tengo.Object{
+		str("Ann"), str("Bob"),
+	}})
+	require.NoError(t, err)
+	require.Equal(t, "Hi, Bob", res.(*tengo.Array).Value[1].(*tengo.String).Value)
+	require.Equal(t, []string{"greetAll"}, names)
+
+	// the validator sees the rewritten arguments
+	var validated int
+	_, err = ctx.WithArgValidator(func(fnName string, args []tengo.Object) error {
+		validated = len(args)
+		return nil
+	}).Call(fn("greet"), str("Ann"))
+	require.NoError(t, err)
+	require.Equal(t, 2, validated)
+
+	// without the interceptor, the missing argument is an error
+	_, err = tengo.NewExecutionContext(compiled).Call(fn("greet"), str("Ann"))
+	require.Error(t, err)
+}
+
+func TestExecutionContext_WithLazyGlobal(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		config := undefined
+		other := 1
+		get := func(key) { return config[key] }
+		getTwice := func(key) { return [config[key], get(key)] }
+		getLater := func(key) {
+			return coroutine(func() { yield config[key] }).resume()
+		}
+		reset := func() { config = {timeout: 1} }
+		clear := func() { config = undefined }
+		getConfig := func() { return config }
+		getSecret := func() { return secret }
+	`))
+	require.NoError(t, script.Add("secret", nil))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	fn := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+	timeout := &tengo.String{Value: "timeout"}
+
+	var calls int64
+	provider := func() tengo.Object {
+		atomic.AddInt64(&calls, 1)
+		return &tengo.Map{Value: map[string]tengo.Object{
+			"timeout": &tengo.Int{Value: 30},
+		}}
+	}
+	base := tengo.NewExecutionContext(compiled)
+	ctx := base.WithLazyGlobal("config", provider)
+	require.Equal(t, int64(0), atomic.LoadInt64(&calls))
+
+	// the provider runs once, on first read, and the value is cached into
+	// the globals
+	res, err := ctx.Call(fn("getTwice"), timeout)
+	require.NoError(t, err)
+	require.Equal(t, "[30, 30]", res.String())
+	for i := 0; i < 3; i++ {
+		res, err = ctx.Call(fn("get"), timeout)
+		require.NoError(t, err)
+		require.Equal(t, &tengo.Int{Value: 30}, res)
+	}
+	res, err = ctx.Call(fn("getLater"), timeout)
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 30}, res)
+	require.Equal(t, int64(1), atomic.LoadInt64(&calls))
+	for i, name := range compiled.GlobalNames() {
+		if name == "config" {
+			require.Equal(t, "{timeout: 30}", ctx.Globals()[i].String())
+		}
+	}
+
+	// derived contexts, even with globals copied before the first read,
+	// share the value
+	fresh := base.WithLazyGlobal("config", provider)
+	forks := fresh.Fork(4)
+	var wg sync.WaitGroup
+	for _, fork := range forks {
+		wg.Add(1)
+		go func(fork *tengo.ExecutionContext) {
+			defer wg.Done()
+			res, err := fork.Call(fn("get"), timeout)
+			require.NoError(t, err)
+			require.Equal(t, &tengo.Int{Value: 30}, res)
+		}(fork)
+	}
+	wg.Wait()
+	require.Equal(t, int64(2), atomic.LoadInt64(&calls))
+
+	// values assigned by the script take precedence, and the original
+	// context is left alone
+	_, err = ctx.Call(fn("reset"))
+	require.NoError(t, err)
+	res, err = ctx.Call(fn("get"), timeout)
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 1}, res)
+	res, err = base.Call(fn("getTwice"), timeout)
+	require.NoError(t, err)
+	require.Equal(t, "[<undefined>, <undefined>]", res.String())
+	require.Equal(t, int64(2), atomic.LoadInt64(&calls))
+
+	// including undefined
+	_, err = ctx.Call(fn("clear"))
+	require.NoError(t, err)
+	res, err = ctx.Call(fn("getConfig"))
+	require.NoError(t, err)
+	require.Equal(t, tengo.UndefinedValue, res)
+	require.Equal(t, int64(2), atomic.LoadInt64(&calls))
+
+	// globals added by the host, nil values and unknown names
+	res, err = base.WithLazyGlobal("secret", func() tengo.Object {
+		return &tengo.String{Value: "s3cr3t"}
+	}).Call(fn("getSecret"))
+	require.NoError(t, err)
+	require.Equal(t, &tengo.String{Value: "s3cr3t"}, res)
+	res, err = base.WithLazyGlobal("secret", func() tengo.Object { return nil }).
+		WithLazyGlobal("unknown", provider).
+		Call(fn("getSecret"))
+	require.NoError(t, err)
+	require.Equal(t, tengo.UndefinedValue, res)
+	require.Equal(t, int64(2), atomic.LoadInt64(&calls))
+}
+
+func TestExecutionContext_WithAllocator(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		build := func(n) {
+			arr := []
+			for i := 0; i < n; i++ {
+				arr = append(arr, i * 2)
+			}
+			return {arr: arr, neg: -n, head: arr[:1]}
+		}
+		collect := func(...xs) { return xs }
+		div := func(n) { return n / 0 }
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	fn := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+
+	// an allocator recording the objects it hands out
+	allocated := map[tengo.Object]tengo.ObjectKind{}
+	alloc := func(kind tengo.ObjectKind) tengo.Object {
+		var o tengo.Object
+		switch kind {
+		case tengo.ObjectKindInt:
+			o = &tengo.Int{}
+		case tengo.ObjectKindArray:
+			o = &tengo.Array{}
+		case tengo.ObjectKindMap:
+			o = &tengo.Map{}
+		}
+		allocated[o] = kind
+		return o
+	}
+	isAllocated := func(o tengo.Object, kind tengo.ObjectKind) bool {
+		k, ok := allocated[o]
+		return ok && k == kind
+	}
+	base := tengo.NewExecutionContext(compiled)
+	ctx := base.WithAllocator(alloc)
+
+	res, err := ctx.Call(fn("build"), &tengo.Int{Value: 3})
+	require.NoError(t, err)
+	m := res.(*tengo.Map)
+	require.True(t, isAllocated(m, tengo.ObjectKindMap))
+	require.Equal(t, &tengo.Int{Value: -3}, m.Value["neg"])
+	require.True(t, isAllocated(m.Value["neg"], tengo.ObjectKindInt))
+	require.Equal(t, "[0]", m.Value["head"].String())
+	require.True(t, isAllocated(m.Value["head"], tengo.ObjectKindArray))
+	arr := m.Value["arr"].(*tengo.Array)
+	require.Equal(t, "[0, 2, 4]", arr.String())
+	require.True(t, isAllocated(arr.Value[2], tengo.ObjectKindInt))
+
+	// variadic arguments are rolled up into an allocated array
+	res, err = ctx.Call(fn("collect"), &tengo.Int{Value: 1},
+		&tengo.Int{Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, "[1, 2]", res.String())
+	require.True(t, isAllocated(res, tengo.ObjectKindArray))
+
+	// errors are still reported by the operators
+	_, err = ctx.Call(fn("div"), &tengo.Int{Value: 1})
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "division by zero"))
+
+	// contexts without the allocator, or with an allocator returning nil,
+	// allocate with new
+	n := len(allocated)
+	res, err = base.Call(fn("build"), &tengo.Int{Value: 3})
+	require.NoError(t, err)
+	require.Equal(t, "[0, 2, 4]", res.(*tengo.Map).Value["arr"].String())
+	res, err = ctx.WithAllocator(func(tengo.ObjectKind) tengo.Object {
+		return nil
+	}).Call(fn("build"), &tengo.Int{Value: 3})
+	require.NoError(t, err)
+	require.Equal(t, "[0, 2, 4]", res.(*tengo.Map).Value["arr"].String())
+	require.Equal(t, n, len(allocated))
+}
+
+func TestExecutionContext_CallResult(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		base := 10
+		get := func(kind) {
+			if kind == "int" { return base + 1 }
+			if kind == "float" { return 1.5 }
+			if kind == "string" { return "s" + base }
+			if kind == "bool" { return base > 5 }
+			if kind == "map" { return {a: base, b: [1]} }
+			if kind == "imap" { return immutable({a: 1}) }
+			if kind == "array" { return [base, "x"] }
+			if kind == "iarray" { return immutable([1]) }
+			if kind == "error" { return error("bad " + kind) }
+		}
+		fail := func() { return 1 / 0 }
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	get := compiled.Get("get").Value().(*tengo.CompiledFunction)
+	fail := compiled.Get("fail").Value().(*tengo.CompiledFunction)
+	ctx := tengo.NewExecutionContext(compiled)
+	call := func(kind string) tengo.Result {
+		res, err := ctx.CallResult(get, &tengo.String{Value: kind})
+		require.NoError(t, err)
+		return res
+	}
+
+	res := call("int")
+	i, ok := res.Int()
+	require.True(t, ok)
+	require.Equal(t, int64(11), i)
+	require.Equal(t, &tengo.Int{Value: 11}, res.Object())
+	require.Equal(t, int64(11), res.Value())
+	_, ok = res.Float()
+	require.False(t, ok)
+	_, ok = res.String()
+	require.False(t, ok)
+
+	f, ok := call("float").Float()
+	require.True(t, ok)
+	require.Equal(t, 1.5, f)
+	_, ok = call("float").Int()
+	require.False(t, ok)
+
+	s, ok := call("string").String()
+	require.True(t, ok)
+	require.Equal(t, "s10", s)
+
+	b, ok := call("bool").Bool()
+	require.True(t, ok)
+	require.True(t, b)
+	_, ok = call("int").Bool()
+	require.False(t, ok)
+
+	m, ok := call("map").Map()
+	require.True(t, ok)
+	require.Equal(t, "map[a:10 b:[1]]", fmt.Sprint(m))
+	m, ok = call("imap").Map()
+	require.True(t, ok)
+	require.Equal(t, "map[a:1]", fmt.Sprint(m))
+	_, ok = call("array").Map()
+	require.False(t, ok)
+
+	arr, ok := call("array").Array()
+	require.True(t, ok)
+	require.Equal(t, "[10 x]", fmt.Sprint(arr))
+	arr, ok = call("iarray").Array()
+	require.True(t, ok)
+	require.Equal(t, "[1]", fmt.Sprint(arr))
+	_, ok = call("map").Array()
+	require.False(t, ok)
+
+	res = call("error")
+	require.True(t, res.IsError())
+	require.Equal(t, &tengo.String{Value: "bad error"}, res.Error().Value)
+	require.False(t, call("int").IsError())
+	require.Nil(t, call("int").Error())
+
+	res = call("other")
+	require.True(t, res.IsUndefined())
+	require.Nil(t, res.Value())
+	require.False(t, call("int").IsUndefined())
+
+	// call errors are returned as is
+	res, err = ctx.CallResult(fail)
+	require.Error(t, err)
+	require.Nil(t, res.Object())
+}
+
+func TestExecutionContext_WithMetrics(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		add := func(a, b) { return [a + b][0] }
+		div := func(a, b) { return a / b }
+		slow := func() { for i := 0; i < 1000; i++ {} }
+		each := func(f) { return f(1, 2) }
+		gen := func() { return coroutine(func() { yield [1]; yield [2] }) }
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	fn := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+	one := &tengo.Int{Value: 1}
+	zero := &tengo.Int{Value: 0}
+
+	base := tengo.NewExecutionContext(compiled)
+	_, err = base.Call(fn("add"), one, one)
+	require.NoError(t, err)
+	require.True(t, reflect.DeepEqual(tengo.Metrics{}, base.MetricsSnapshot()))
+
+	ctx := base.WithMetrics(true)
+	_, err = ctx.Call(fn("add"), one, one)
+	require.NoError(t, err)
+	m := ctx.MetricsSnapshot()
+	require.Equal(t, int64(1), m.Calls)
+	require.Equal(t, int64(0), m.Errors)
+	require.True(t, m.Instructions > 0)
+	require.Equal(t, int64(2), m.Allocations) // the sum and the array
+	perAdd := m.Instructions
+
+	// errors, including rejected calls, and callbacks run by the call
+	_, err = ctx.Call(fn("div"), one, zero)
+	require.Error(t, err)
+	_, err = ctx.Call(fn("add"), one)
+	require.Error(t, err)
+	_, err = ctx.Call(fn("each"), fn("add"))
+	require.NoError(t, err)
+	m = ctx.MetricsSnapshot()
+	require.Equal(t, int64(4), m.Calls)
+	require.Equal(t, int64(2), m.Errors)
+	require.True(t, m.Instructions > 2*perAdd)
+	require.Equal(t, int64(4), m.Allocations)
+
+	// the number of instructions is deterministic
+	before := m.Instructions
+	for i := 0; i < 3; i++ {
+		_, err = ctx.Call(fn("add"), one, one)
+		require.NoError(t, err)
+	}
+	require.Equal(t, before+3*perAdd, ctx.MetricsSnapshot().Instructions)
+
+	// coroutines count their work when resumed, even after the call
+	res, err := ctx.Call(fn("gen"))
+	require.NoError(t, err)
+	m = ctx.MetricsSnapshot()
+	_, err = res.(*tengo.Coroutine).Resume()
+	require.NoError(t, err)
+	m2 := ctx.MetricsSnapshot()
+	require.Equal(t, m.Calls, m2.Calls)
+	require.True(t, m2.Instructions > m.Instructions)
+	require.Equal(t, m.Allocations+1, m2.Allocations)
+
+	// derived contexts share the counters, which are safe for concurrent use
+	fresh := base.WithMetrics(true)
+	forks := fresh.Fork(8)
+	var wg sync.WaitGroup
+	for i, fork := range forks {
+		wg.Add(1)
+		go func(i int, fork *tengo.ExecutionContext) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if i%2 == 0 {
+					_, _ = fork.Call(fn("div"), one, zero)
+				} else {
+					_, _ = fork.Call(fn("add"), one, one)
+				}
+			}
+		}(i, fork)
+	}
+	wg.Wait()
+	_, err = fresh.Call(fn("slow"))
+	require.NoError(t, err)
+	m = fresh.MetricsSnapshot()
+	require.Equal(t, int64(81), m.Calls)
+	require.Equal(t, int64(40), m.Errors)
+	require.True(t, m.Instructions > 40*perAdd+1000)
+	require.True(t, m.LatencySum > 0)
+	require.Equal(t, 16, len(m.Latency))
+	for i := 1; i < len(m.Latency); i++ {
+		require.True(t, m.Latency[i].UpperBound > m.Latency[i-1].UpperBound)
+		require.True(t, m.Latency[i].Count >= m.Latency[i-1].Count)
+	}
+	require.True(t, m.Latency[len(m.Latency)-1].Count <= m.Calls)
+
+	// enabling metrics again starts from zero
+	require.Equal(t, int64(0), fresh.WithMetrics(true).MetricsSnapshot().Calls)
+	require.True(t, reflect.DeepEqual(tengo.Metrics{}, fresh.WithMetrics(false).MetricsSnapshot()))
+
+	var sb strings.Builder
+	require.NoError(t, tengo.Metrics{
+		Calls:        3,
+		Errors:       1,
+		Instructions: 100,
+		Allocations:  7,
+		Latency: []tengo.LatencyBucket{
+			{UpperBound: time.Millisecond, Count: 1},
+			{UpperBound: 2500 * time.Millisecond, Count: 2},
+		},
+		LatencySum: 1500 * time.Millisecond,
+	}.WritePrometheus(&sb, "tengo"))
+	require.Equal(t, `# HELP tengo_calls_total Calls made through the execution context.
+# TYPE tengo_calls_total counter
+tengo_calls_total 3
+# HELP tengo_call_errors_total Calls that returned an error.
+# TYPE tengo_call_errors_total counter
+tengo_call_errors_total 1
+# HELP tengo_instructions_total VM instructions executed by the calls.
+# TYPE tengo_instructions_total counter
+tengo_instructions_total 100
+# HELP tengo_allocations_total Objects allocated by the calls.
+# TYPE tengo_allocations_total counter
+tengo_allocations_total 7
+# HELP tengo_call_duration_seconds Duration of the calls.
+# TYPE tengo_call_duration_seconds histogram
+tengo_call_duration_seconds_bucket{le="0.001"} 1
+tengo_call_duration_seconds_bucket{le="2.5"} 2
+tengo_call_duration_seconds_bucket{le="+Inf"} 3
+tengo_call_duration_seconds_sum 1.5
+tengo_call_duration_seconds_count 3
+`, sb.String())
+}
+
+func TestExecutionContext_WithMaxResultSize(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		calls := 0
+		build := func(n) {
+			calls++
+			m := {}
+			for i := 0; i < n; i++ {
+				m["k" + i] = {id: i, tags: ["a", "b"]}
+			}
+			return m
+		}
+		scalar := func() { return 1 }
+		cyclic := func() { a := [1, 2]; a[1] = a; m := {a: a}; m.self = m; return m }
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	fn := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+	n := func(v int64) tengo.Object { return &tengo.Int{Value: v} }
+
+	// unlimited by default
+	base := tengo.NewExecutionContext(compiled)
+	res, err := base.Call(fn("build"), n(1000))
+	require.NoError(t, err)
+	require.Equal(t, 1000, len(res.(*tengo.Map).Value))
+
+	// each entry has 5 objects: the map, its 2 values and the 2 tags, plus
+	// the outer map
+	limited := base.WithMaxResultSize(51)
+	res, err = limited.Call(fn("build"), n(10))
+	require.NoError(t, err)
+	require.Equal(t, 10, len(res.(*tengo.Map).Value))
+	_, err = limited.Call(fn("build"), n(11))
+	require.True(t, errors.Is(err, tengo.ErrResultTooLarge))
+	_, err = limited.Call(fn("build"), n(1000))
+	require.True(t, errors.Is(err, tengo.ErrResultTooLarge))
+	_, _, err = limited.CallEx(fn("build"), n(1000))
+	require.True(t, errors.Is(err, tengo.ErrResultTooLarge))
+	res, err = limited.Call(fn("scalar"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), res.(*tengo.Int).Value)
+
+	// a failed call doesn't update the globals
+	var state struct {
+		Calls int64 `tengo:"calls"`
+	}
+	require.NoError(t, limited.GlobalsInto(&state))
+	require.Equal(t, int64(2), state.Calls)
+
+	// cycles are walked once: the map, the array, its 2 elements and the map
+	// again
+	res, err = base.WithMaxResultSize(5).Call(fn("cyclic"))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(res.(*tengo.Map).Value))
+	_, err = base.WithMaxResultSize(4).Call(fn("cyclic"))
+	require.True(t, errors.Is(err, tengo.ErrResultTooLarge))
+
+	// the limit is inherited, and can be lifted
+	_, err = limited.Fork(1)[0].Call(fn("build"), n(11))
+	require.True(t, errors.Is(err, tengo.ErrResultTooLarge))
+	_, err = limited.WithMaxResultSize(0).Call(fn("build"), n(11))
+	require.NoError(t, err)
+}
+
+func TestExecutionContext_Recording(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		rand := import("rand")
+		sample := func(n) {
+			vals := {}
+			for i := 0; i < n; i++ {
+				vals["k" + i] = i
+			}
+			return map_values(vals, func(v) {
+				return [rand.intn(1000), fetch(v)]
+			})
+		}
+		lookup := func() { return fetch(0) }
+		misuse := func() { return [try(fetch), try(fetch, "a")] }
+	`))
+	script.SetImports(stdlib.GetModuleMap("rand"))
+	var fetched int64
+	require.NoError(t, script.Add("fetch", &tengo.UserFunction{
+		Name: "fetch",
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			if len(args) != 1 {
+				return nil, tengo.ErrWrongNumArguments
+			}
+			if _, ok := args[0].(*tengo.Int); !ok {
+				return nil, tengo.ErrInvalidArgumentType{
+					Name:     "first",
+					Expected: "int",
+					Found:    args[0].TypeName(),
+				}
+			}
+			n := atomic.AddInt64(&fetched, 1)
+			if n == 3 {
+				return nil, errors.New("unavailable")
+			}
+			return &tengo.String{Value: fmt.Sprintf("item%d-%d",
+				args[0].(*tengo.Int).Value, n)}, nil
+		},
+	}))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	sample := compiled.Get("sample").Value().(*tengo.CompiledFunction)
+	n := func(v int64) tengo.Object { return &tengo.Int{Value: v} }
+	base := tengo.NewExecutionContext(compiled)
+
+	recording, rec := base.StartRecording()
+	first, err := recording.Call(sample, n(2))
+	require.NoError(t, err)
+	_, liveErr := recording.Call(sample, n(2))
+	require.Error(t, liveErr)
+	require.True(t, strings.Contains(liveErr.Error(), "unavailable"))
+	misuse := compiled.Get("misuse").Value().(*tengo.CompiledFunction)
+	liveMisuse, err := recording.Call(misuse)
+	require.NoError(t, err)
+	require.Equal(t, 8, rec.Len())
+
+	var buf bytes.Buffer
+	require.NoError(t, rec.Encode(&buf))
+	decoded := &tengo.Recording{}
+	require.NoError(t, decoded.Decode(&buf))
+	require.Equal(t, 8, decoded.Len())
+
+	// the replayed calls don't call the host functions and return the same
+	// results, including the errors
+	fetched = 100
+	replay := base.ReplayFrom(decoded)
+	res, err := replay.Call(sample, n(2))
+	require.NoError(t, err)
+	require.True(t, first.Equals(res))
+	_, err = replay.Call(sample, n(2))
+	require.Error(t, err)
+	require.Equal(t, liveErr.Error(), err.Error())
+	res, err = replay.Call(misuse)
+	require.NoError(t, err)
+	require.Equal(t, liveMisuse.String(), res.String())
+	require.Equal(t, int64(100), atomic.LoadInt64(&fetched))
+
+	// each ReplayFrom starts from the beginning of the recording
+	res, err = base.ReplayFrom(decoded).Call(sample, n(2))
+	require.NoError(t, err)
+	require.True(t, first.Equals(res))
+
+	// calling other host functions, or more than were recorded, diverges
+	_, err = replay.Call(sample, n(1))
+	require.True(t, errors.Is(err, tengo.ErrReplayDiverged))
+	_, err = base.ReplayFrom(decoded).Call(
+		compiled.Get("lookup").Value().(*tengo.CompiledFunction))
+	require.True(t, errors.Is(err, tengo.ErrReplayDiverged))
+	require.True(t, strings.Contains(err.Error(),
+		"expected call to 'intn', found 'fetch'"))
+
+	// results that aren't serializable can't be encoded
+	script = tengo.NewScript([]byte(`f := func() { return [fn()] }`))
+	require.NoError(t, script.Add("fn", &tengo.UserFunction{
+		Name: "fn",
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			return &tengo.UserFunction{Name: "inner"}, nil
+		},
+	}))
+	compiled, err = script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	ctx, bad := tengo.NewExecutionContext(compiled).StartRecording()
+	_, err = ctx.Call(compiled.Get("f").Value().(*tengo.CompiledFunction))
+	require.NoError(t, err)
+	require.Error(t, bad.Encode(&buf))
+}
+
+func TestExecutionContext_WithSeed(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		rand := import("rand")
+		roll := func() {
+			b := bytes(4)
+			rand.read(b)
+			return [rand.int(), rand.intn(100), rand.float(), rand.perm(4), b]
+		}
+		reseed := func(n) { rand.seed(n) }
+	`))
+	script.SetImports(stdlib.GetModuleMap("rand"))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	roll := compiled.Get("roll").Value().(*tengo.CompiledFunction)
+	reseed := compiled.Get("reseed").Value().(*tengo.CompiledFunction)
+	base := tengo.NewExecutionContext(compiled)
+
+	sequence := func(ctx *tengo.ExecutionContext, n int) []string {
+		var seq []string
+		for i := 0; i < n; i++ {
+			res, err := ctx.Call(roll)
+			require.NoError(t, err)
+			seq = append(seq, res.String())
+		}
+		return seq
+	}
+
+	// contexts seeded identically return the same sequence, even when their
+	// calls are interleaved
+	a, b := base.WithSeed(42), base.WithSeed(42)
+	var seqA, seqB []string
+	for i := 0; i < 5; i++ {
+		seqA = append(seqA, sequence(a, 1)...)
+		seqB = append(seqB, sequence(b, 1)...)
+	}
+	require.Equal(t, seqA, seqB)
+	require.Equal(t, seqA, sequence(base.WithSeed(42), 5))
+	require.False(t, reflect.DeepEqual(seqA, sequence(base.WithSeed(7), 5)))
+
+	// the global source isn't affected by seeding a context
+	_, err = a.Call(reseed, &tengo.Int{Value: 42})
+	require.NoError(t, err)
+	require.Equal(t, seqA, sequence(a, 5))
+	require.False(t, reflect.DeepEqual(seqA, sequence(base, 5)))
+
+	// derived contexts share the source of the context they derive from
+	c := base.WithSeed(42)
+	d := c.WithStackTrace(true)
+	require.Equal(t, seqA[:2], sequence(c, 2))
+	require.Equal(t, seqA[2:4], sequence(d, 2))
+}
+
+func TestExecutionContext_WithExecutionTrace(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		outer := func(n) {
+			middle := func(x) {
+				inner := func(y) { return x + y + len([1, 2]) }
+				return inner(x * 10)
+			}
+			return middle(n) * 2
+		}
+		countdown := func(n) {
+			if n == 0 { return "done" }
+			return countdown(n - 1)
+		}
+		double := func(m) {
+			return map_values(m, func(v) { return v * 2 })
+		}
+		fail := func() {
+			inner := func() { return 1 / 0 }
+			return inner() + 1
+		}
+		safe := func() {
+			risky := func() {
+				defer func() { recover() }()
+				fail()
+			}
+			risky()
+			return "ok"
+		}
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	fn := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+	trace := func(name string, args ...tengo.Object) string {
+		var buf bytes.Buffer
+		ctx := tengo.NewExecutionContext(compiled).WithExecutionTrace(&buf)
+		_, _ = ctx.Call(fn(name), args...)
+		return buf.String()
+	}
+
+	// nested closures enter and exit in call order, indented by depth
+	require.Equal(t, `-> outer(1)
+  -> middle(1)
+    -> inner(10)
+      -> len([1, 2])
+      <- len = 2
+    <- inner = 13
+  <- middle = 13
+<- outer = 26
+`, trace("outer", &tengo.Int{Value: 1}))
+
+	// recursive tail calls reuse their frame
+	require.Equal(t, `-> countdown(2)
+<- countdown (tail call)
+-> countdown(1)
+<- countdown (tail call)
+-> countdown(0)
+<- countdown = "done"
+`, trace("countdown", &tengo.Int{Value: 2}))
+
+	// callbacks of builtins are nested in the builtin call
+	require.Equal(t, `-> double({a: 1})
+  -> map_values({a: 1}, <compiled-function>)
+    -> <anonymous>(1)
+    <- <anonymous> = 2
+  <- map_values = {a: 2}
+<- double = {a: 2}
+`, trace("double", &tengo.Map{Value: map[string]tengo.Object{
+		"a": &tengo.Int{Value: 1}}}))
+
+	// runtime errors exit every active call
+	out := trace("fail")
+	require.True(t, strings.HasPrefix(out, `-> fail()
+  -> inner()
+  <- inner error: `), out)
+	require.True(t, strings.Contains(out, "\n<- fail error: "), out)
+
+	// recovered errors exit the calls up to the recovering function
+	require.Equal(t, `-> safe()
+  -> risky()
+    -> fail()
+      -> inner()
+        -> <anonymous>()
+          -> recover()
+          <- recover = error: "division by zero"
+        <- <anonymous> = <undefined>
+      <- inner error: division by zero
+    <- fail error: division by zero
+  <- risky = <undefined>
+<- safe = "ok"
+`, trace("safe"))
+
+	// the trace is disabled by default and by a nil writer
+	var buf bytes.Buffer
+	ctx := tengo.NewExecutionContext(compiled).WithExecutionTrace(&buf)
+	_, err = ctx.WithExecutionTrace(nil).Call(fn("outer"), &tengo.Int{Value: 1})
+	require.NoError(t, err)
+	require.Equal(t, "", buf.String())
+}
+
+func TestExecutionContext_ReusedVMs(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		g := 0
+		fill := func(a) {
+			b := "stale"
+			c := [a, b]
+			return c[0]
+		}
+		probe := func(a) {
+			b := undefined
+			c := undefined
+			return [a, b, c]
+		}
+		sum := func(...xs) {
+			t := 0
+			for x in xs { t += x }
+			return t
+		}
+		fail := func(n) {
+			deep := func(k) { return k == 0 ? 1 / k : deep(k - 1) + 1 }
+			return deep(n)
+		}
+		incr := func(m) { return map_values(m, func(v) { return v + 1 }) }
+		bad := func(m) { return map_values(m, func(v) { return v / 0 }) }
+		set := func(v) { g = v; return g }
+		spin := func() { for {} }
+		keep := func(s) { return len(s) }
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	fn := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+	ec := tengo.NewExecutionContext(compiled)
+
+	// the stack of a previous call doesn't show through in the next one
+	res, err := ec.Call(fn("fill"), &tengo.Int{Value: 7})
+	require.NoError(t, err)
+	require.Equal(t, int64(7), res.(*tengo.Int).Value)
+	res, err = ec.Call(fn("probe"), &tengo.Int{Value: 1})
+	require.NoError(t, err)
+	require.Equal(t, []tengo.Object{&tengo.Int{Value: 1},
+		tengo.UndefinedValue, tengo.UndefinedValue}, res.(*tengo.Array).Value)
+
+	// nor do the frames of a call that failed deep in its stack
+	_, err = ec.Call(fn("fail"), &tengo.Int{Value: 50})
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(), "division by zero"), err.Error())
+	res, err = ec.Call(fn("sum"), &tengo.Int{Value: 1}, &tengo.Int{Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), res.(*tengo.Int).Value)
+
+	// callbacks of builtins run in reused VMs too
+	arg := &tengo.Map{Value: map[string]tengo.Object{"a": &tengo.Int{Value: 1}}}
+	_, err = ec.Call(fn("bad"), arg)
+	require.Error(t, err)
+	res, err = ec.Call(fn("incr"), arg)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), res.(*tengo.Map).Value["a"].(*tengo.Int).Value)
+
+	// the settings of a context don't carry over to the calls of another
+	var buf bytes.Buffer
+	_, err = ec.WithExecutionTrace(&buf).CallStrictReadOnly(fn("set"),
+		&tengo.Int{Value: 1})
+	require.True(t, errors.Is(err, tengo.ErrReadOnlyGlobal), err)
+	traced := buf.String()
+	require.True(t, traced != "")
+	res, err = ec.Call(fn("set"), &tengo.Int{Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), res.(*tengo.Int).Value)
+	require.Equal(t, traced, buf.String())
+
+	// an aborted call doesn't abort the calls that follow
+	timeout, cancel := context.WithTimeout(context.Background(),
+		20*time.Millisecond)
+	defer cancel()
+	_, err = ec.CallGroup(timeout, []tengo.BatchCall{{Fn: fn("spin")}})
+	require.True(t, errors.Is(err, context.DeadlineExceeded), err)
+	for i := 0; i < 10; i++ {
+		res, err = ec.Call(fn("sum"), &tengo.Int{Value: int64(i)})
+		require.NoError(t, err)
+		require.Equal(t, int64(i), res.(*tengo.Int).Value)
+	}
+
+	// concurrent calls get distinct VMs
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for w, child := range ec.Fork(8) {
+		wg.Add(1)
+		go func(w int, child *tengo.ExecutionContext) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				want := int64(w*1000 + i)
+				res, err := child.Call(fn("sum"), &tengo.Int{Value: want},
+					&tengo.Int{Value: 1})
+				if err == nil && res.(*tengo.Int).Value != want+1 {
+					err = fmt.Errorf("got %s, want %d", res, want+1)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w, child)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
+
+func TestExecutionContext_Resume(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		total := 0
+		sum := func(a, b) {
+			x := await(a)
+			y := await(b)
+			total = x + y
+			return total
+		}
+		nested := func() {
+			double := func(v) { return await(v) * 2 }
+			return double(3) + 1
+		}
+		mapped := func() { return map_values({a: 1}, func(v) { return await(v) }) }
+		generated := func() {
+			out := []
+			for v in coroutine(func() { yield await(1) }) { out = append(out, v) }
+			return out
+		}
+		read := func() { return total }
+		spin := func() {
+			await(1)
+			await(2)
+			for {}
+		}
+	`))
+	require.NoError(t, script.Add("await", &tengo.UserFunction{
+		Name: "await",
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			return nil, tengo.Suspend(args[0])
+		},
+	}))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+	fn := func(name string) *tengo.CompiledFunction {
+		return compiled.Get(name).Value().(*tengo.CompiledFunction)
+	}
+	n := func(v int64) tengo.Object { return &tengo.Int{Value: v} }
+	ctx := tengo.NewExecutionContext(compiled)
+
+	// each await suspends the call, and resuming it substitutes the value
+	// for the result of await
+	res, _, err := ctx.CallEx(fn("sum"), &tengo.String{Value: "a"},
+		&tengo.String{Value: "b"})
+	require.Nil(t, res)
+	require.True(t, errors.Is(err, tengo.ErrSuspended), err)
+	var cont *tengo.Continuation
+	require.True(t, errors.As(err, &cont))
+	require.Equal(t, &tengo.String{Value: "a"}, cont.Value())
+
+	// the globals are only committed once the call completes
+	_, err = ctx.Resume(cont, n(40))
+	var next *tengo.Continuation
+	require.True(t, errors.As(err, &next))
+	require.Equal(t, &tengo.String{Value: "b"}, next.Value())
+	res, err = ctx.Call(fn("read"))
+	require.NoError(t, err)
+	require.Equal(t, n(0), res)
+
+	res, err = ctx.Resume(next, n(2))
+	require.NoError(t, err)
+	require.Equal(t, n(42), res)
+	res, err = ctx.Call(fn("read"))
+	require.NoError(t, err)
+	require.Equal(t, n(42), res)
+
+	// a continuation can only be resumed once, by its context
+	_, err = ctx.Resume(next, n(1))
+	require.Error(t, err)
+	require.Equal(t, "continuation already resumed", err.Error())
+	_, err = ctx.Call(fn("nested"))
+	require.True(t, errors.As(err, &cont))
+	_, err = tengo.NewExecutionContext(compiled).Resume(cont, n(1))
+	require.Error(t, err)
+	require.Equal(t, "continuation does not belong to the execution context",
+		err.Error())
+
+	// the call resumes in the frame of the function that called await
+	res, err = ctx.Resume(cont, n(20))
+	require.NoError(t, err)
+	require.Equal(t, n(41), res)
+
+	// the call resumes under the context.Context it was last resumed with
+	_, err = ctx.Call(fn("spin"))
+	require.True(t, errors.As(err, &cont))
+	cancelled, cancel := context.WithCancel(context.Background())
+	_, err = ctx.ResumeContext(cancelled, cont, n(1))
+	require.True(t, errors.As(err, &next))
+	cancel()
+	start := time.Now()
+	_, err = ctx.Resume(next, n(2))
+	require.Equal(t, context.Canceled, err)
+	require.True(t, time.Since(start) < 5*time.Second)
+
+	// which aborts it once done
+	_, err = ctx.Call(fn("spin"))
+	require.True(t, errors.As(err, &cont))
+	_, err = ctx.Resume(cont, n(1))
+	require.True(t, errors.As(err, &next))
+	timeout, cancel := context.WithTimeout(context.Background(),
+		10*time.Millisecond)
+	defer cancel()
+	_, err = ctx.ResumeContext(timeout, next, n(2))
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	// callbacks and coroutines can't suspend the call
+	for _, name := range []string{"mapped", "generated"} {
+		_, err = ctx.Call(fn(name))
+		require.Error(t, err, name)
+		require.False(t, errors.Is(err, tengo.ErrSuspended), name)
+		require.True(t, strings.Contains(err.Error(),
+			"cannot suspend the call here"), err.Error())
+	}
+}
@@ -1,6 +1,7 @@
 package tengo
 
 import (
+	"fmt"
 	"strconv"
 	"sync"
 	"unicode/utf8"
@@ -683,6 +684,11 @@ type pp struct {
 	// erroring is set when printing an error string to guard against calling
 	// handleMethods.
 	erroring bool
+
+	// strict makes the printer record the first formatting error in failed
+	// instead of only printing it.
+	strict bool
+	failed error
 }
 
 var ppFree = sync.Pool{
@@ -693,6 +699,8 @@ var ppFree = sync.Pool{
 func newPrinter() *pp {
 	p := ppFree.Get().(*pp)
 	p.erroring = false
+	p.strict = false
+	p.failed = nil
 	p.fmt.init(&p.buf)
 	return p
 }
@@ -785,7 +793,20 @@ func parsenum(s string, start, end int) (num int, isnum bool, newi int) {
 	return
 }
 
+// fail records a formatting error, if the printer is strict and no error
+// was recorded yet.
+func (p *pp) fail(format string, a ...interface{}) {
+	if p.strict && p.failed == nil {
+		p.failed = fmt.Errorf(format, a...)
+	}
+}
+
 func (p *pp) badVerb(verb rune) {
+	if p.arg != nil {
+		p.fail("invalid verb %%%c for %s", verb, p.arg.TypeName())
+	} else {
+		p.fail("invalid verb %%%c for %s", verb, UndefinedValue.TypeName())
+	}
 	p.erroring = true
 	_, _ = p.WriteString(percentBangString)
 	_, _ = p.WriteRune(verb)
@@ -927,6 +948,8 @@ func (p *pp) fmtBytes(v []byte, verb rune, typeString string) {
 		p.fmt.fmtBx(v, udigits)
 	case 'q':
 		p.fmt.fmtQ(string(v))
+	default:
+		p.badVerb(verb)
 	}
 }
 
@@ -1032,12 +1055,14 @@ func (p *pp) argNumber(
 }
 
 func (p *pp) badArgNum(verb rune) {
+	p.fail("invalid argument index for %%%c", verb)
 	_, _ = p.WriteString(percentBangString)
 	_, _ = p.WriteRune(verb)
 	_, _ = p.WriteString(badIndexString)
 }
 
 func (p *pp) missingArg(verb rune) {
+	p.fail("missing argument for %%%c", verb)
 	_, _ = p.WriteString(percentBangString)
 	_, _ = p.WriteRune(verb)
 	_, _ = p.WriteString(missingString)
@@ -1126,6 +1151,7 @@ formatLoop:
 			p.fmt.wid, p.fmt.widPresent, argNum = intFromArg(a, argNum)
 
 			if !p.fmt.widPresent {
+				p.fail("width is not an int")
 				_, _ = p.WriteString(badWidthString)
 			}
 
@@ -1160,6 +1186,7 @@ formatLoop:
 					p.fmt.precPresent = false
 				}
 				if !p.fmt.precPresent {
+					p.fail("precision is not an int")
 					_, _ = p.WriteString(badPrecString)
 				}
 				afterIndex = false
@@ -1177,6 +1204,7 @@ formatLoop:
 		}
 
 		if i >= end {
+			p.fail("missing verb at end of format")
 			_, _ = p.WriteString(noVerbString)
 			break
 		}
@@ -1214,6 +1242,7 @@ formatLoop:
 	// out of order, in which case it's too expensive to detect if they've all
 	// been used and arguably OK if they're not.
 	if !p.reordered && argNum < len(a) {
+		p.fail("too many arguments: %d unused", len(a)-argNum)
 		p.fmt.clearFlags()
 		_, _ = p.WriteString(extraString)
 		for i, arg := range a[argNum:] {
@@ -1243,3 +1272,19 @@ func Format(format string, a ...Object) (string, error) {
 
 	return s, err
 }
+
+// formatStrict is like Format, but fails with the first verb that doesn't
+// match its argument, or with a missing or extra argument or a malformed
+// verb, instead of formatting them as Format does, e.g. as %!d(string=x).
+func formatStrict(format string, a []Object) (string, error) {
+	p := newPrinter()
+	p.strict = true
+	err := p.doFormat(format, a)
+	if err == nil {
+		err = p.failed
+	}
+	s := string(p.buf)
+	p.free()
+
+	return s, err
+}
@@ -0,0 +1,336 @@
+package tengo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tiagoj/tengo/v2/token"
+)
+
+// GoMap exposes a Go map to scripts without copying it. Its values are
+// converted with FromInterface when the script reads them, and the nested
+// maps and slices are exposed as GoMap and GoSlice in turn, so that passing
+// a large map only costs the values the script reads. Values that can't be
+// converted are read as error values.
+//
+// If Writable is false, assigning to a GoMap or to its nested maps and
+// slices is a runtime error. Otherwise, the assigned values are converted
+// with ToInterface and stored in the Go map. The script sees the changes the
+// host makes to the map, so the host must not modify it while the script
+// runs.
+type GoMap struct {
+	ObjectImpl
+	Value    map[string]interface{}
+	Writable bool
+}
+
+// TypeName returns the name of the type.
+func (o *GoMap) TypeName() string {
+	return "go-map"
+}
+
+func (o *GoMap) String() string {
+	var pairs []string
+	for k, v := range o.Value {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", k,
+			goValue(v, o.Writable).String()))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+}
+
+// Copy returns a copy of the type, as a Map holding copies of the values.
+func (o *GoMap) Copy() Object {
+	c := make(map[string]Object, len(o.Value))
+	for k, v := range o.Value {
+		c[k] = goValue(v, o.Writable).Copy()
+	}
+	return &Map{Value: c}
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (o *GoMap) IsFalsy() bool {
+	return len(o.Value) == 0
+}
+
+// IndexGet returns the value for the given key.
+func (o *GoMap) IndexGet(index Object) (Object, error) {
+	strIdx, ok := ToString(index)
+	if !ok {
+		return nil, ErrInvalidIndexType
+	}
+	v, ok := o.Value[strIdx]
+	if !ok {
+		return UndefinedValue, nil
+	}
+	return goValue(v, o.Writable), nil
+}
+
+// IndexSet stores the given value for the given key, if the map is writable.
+func (o *GoMap) IndexSet(index, value Object) error {
+	if !o.Writable {
+		return ErrNotIndexAssignable
+	}
+	strIdx, ok := ToString(index)
+	if !ok {
+		return ErrInvalidIndexType
+	}
+	o.Value[strIdx] = ToInterface(value)
+	return nil
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (o *GoMap) Equals(x Object) bool {
+	if x, ok := x.(*GoMap); ok {
+		return o.Copy().Equals(x.Copy())
+	}
+	return o.Copy().Equals(x)
+}
+
+// entries returns the values of the map converted to objects, as the script
+// reads them.
+func (o *GoMap) entries() map[string]Object {
+	entries := make(map[string]Object, len(o.Value))
+	for k, v := range o.Value {
+		entries[k] = goValue(v, o.Writable)
+	}
+	return entries
+}
+
+// Iterate creates a Go map iterator.
+func (o *GoMap) Iterate() Iterator {
+	keys := make([]string, 0, len(o.Value))
+	for k := range o.Value {
+		keys = append(keys, k)
+	}
+	return &GoMapIterator{m: o, k: keys, l: len(keys)}
+}
+
+// CanIterate returns whether the Object can be Iterated.
+func (o *GoMap) CanIterate() bool {
+	return true
+}
+
+// GoSlice exposes a Go slice to scripts without copying it, the way GoMap
+// exposes a Go map. Scripts can assign to its elements if Writable is true,
+// but not append to it.
+type GoSlice struct {
+	ObjectImpl
+	Value    []interface{}
+	Writable bool
+}
+
+// TypeName returns the name of the type.
+func (o *GoSlice) TypeName() string {
+	return "go-slice"
+}
+
+func (o *GoSlice) String() string {
+	var elements []string
+	for _, e := range o.Value {
+		elements = append(elements, goValue(e, o.Writable).String())
+	}
+	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
+}
+
+// Copy returns a copy of the type, as an Array holding copies of the
+// elements.
+func (o *GoSlice) Copy() Object {
+	c := make([]Object, len(o.Value))
+	for i, e := range o.Value {
+		c[i] = goValue(e, o.Writable).Copy()
+	}
+	return &Array{Value: c}
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (o *GoSlice) IsFalsy() bool {
+	return len(o.Value) == 0
+}
+
+// IndexGet returns an element at a given index.
+func (o *GoSlice) IndexGet(index Object) (Object, error) {
+	intIdx, ok := index.(*Int)
+	if !ok {
+		return nil, ErrInvalidIndexType
+	}
+	idxVal := int(intIdx.Value)
+	if idxVal < 0 || idxVal >= len(o.Value) {
+		return UndefinedValue, nil
+	}
+	return goValue(o.Value[idxVal], o.Writable), nil
+}
+
+// IndexSet sets an element at a given index, if the slice is writable.
+func (o *GoSlice) IndexSet(index, value Object) error {
+	if !o.Writable {
+		return ErrNotIndexAssignable
+	}
+	intIdx, ok := index.(*Int)
+	if !ok {
+		return ErrInvalidIndexType
+	}
+	idxVal := int(intIdx.Value)
+	if idxVal < 0 || idxVal >= len(o.Value) {
+		return ErrIndexOutOfBounds
+	}
+	o.Value[idxVal] = ToInterface(value)
+	return nil
+}
+
+// BinaryOp returns a new array of the elements of the slice followed by the
+// elements of rhs for the + operator with an array or a slice.
+func (o *GoSlice) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	if elems, ok := arrayElements(rhs); ok && op == token.Add {
+		return &Array{Value: append(o.elements(), elems...)}, nil
+	}
+	return nil, ErrInvalidOperator
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (o *GoSlice) Equals(x Object) bool {
+	if x, ok := x.(*GoSlice); ok {
+		return o.Copy().Equals(x.Copy())
+	}
+	return o.Copy().Equals(x)
+}
+
+// elements returns the elements of the slice converted to objects, as the
+// script reads them.
+func (o *GoSlice) elements() []Object {
+	elems := make([]Object, len(o.Value))
+	for i, e := range o.Value {
+		elems[i] = goValue(e, o.Writable)
+	}
+	return elems
+}
+
+// Iterate creates a Go slice iterator.
+func (o *GoSlice) Iterate() Iterator {
+	return &GoSliceIterator{s: o, l: len(o.Value)}
+}
+
+// CanIterate returns whether the Object can be Iterated.
+func (o *GoSlice) CanIterate() bool {
+	return true
+}
+
+// goValue converts a value of a GoMap or GoSlice to an object, exposing maps
+// and slices as GoMap and GoSlice with the same writability.
+func goValue(v interface{}, writable bool) Object {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return &GoMap{Value: v, Writable: writable}
+	case []interface{}:
+		return &GoSlice{Value: v, Writable: writable}
+	}
+	o, err := FromInterface(v)
+	if err != nil {
+		return &Error{Value: &String{Value: err.Error()}}
+	}
+	return o
+}
+
+// GoMapIterator represents an iterator for a GoMap.
+type GoMapIterator struct {
+	ObjectImpl
+	m *GoMap
+	k []string
+	i int
+	l int
+}
+
+// TypeName returns the name of the type.
+func (i *GoMapIterator) TypeName() string {
+	return "go-map-iterator"
+}
+
+func (i *GoMapIterator) String() string {
+	return "<go-map-iterator>"
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (i *GoMapIterator) IsFalsy() bool {
+	return true
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (i *GoMapIterator) Equals(Object) bool {
+	return false
+}
+
+// Copy returns a copy of the type.
+func (i *GoMapIterator) Copy() Object {
+	return &GoMapIterator{m: i.m, k: i.k, i: i.i, l: i.l}
+}
+
+// Next returns true if there are more elements to iterate.
+func (i *GoMapIterator) Next() bool {
+	i.i++
+	return i.i <= i.l
+}
+
+// Key returns the key or index value of the current element.
+func (i *GoMapIterator) Key() Object {
+	return &String{Value: i.k[i.i-1]}
+}
+
+// Value returns the value of the current element.
+func (i *GoMapIterator) Value() Object {
+	v, ok := i.m.Value[i.k[i.i-1]]
+	if !ok {
+		return UndefinedValue
+	}
+	return goValue(v, i.m.Writable)
+}
+
+// GoSliceIterator represents an iterator for a GoSlice.
+type GoSliceIterator struct {
+	ObjectImpl
+	s *GoSlice
+	i int
+	l int
+}
+
+// TypeName returns the name of the type.
+func (i *GoSliceIterator) TypeName() string {
+	return "go-slice-iterator"
+}
+
+func (i *GoSliceIterator) String() string {
+	return "<go-slice-iterator>"
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (i *GoSliceIterator) IsFalsy() bool {
+	return true
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (i *GoSliceIterator) Equals(Object) bool {
+	return false
+}
+
+// Copy returns a copy of the type.
+func (i *GoSliceIterator) Copy() Object {
+	return &GoSliceIterator{s: i.s, i: i.i, l: i.l}
+}
+
+// Next returns true if there are more elements to iterate.
+func (i *GoSliceIterator) Next() bool {
+	i.i++
+	return i.i <= i.l
+}
+
+// Key returns the key or index value of the current element.
+func (i *GoSliceIterator) Key() Object {
+	return &Int{Value: int64(i.i - 1)}
+}
+
+// Value returns the value of the current element.
+func (i *GoSliceIterator) Value() Object {
+	return goValue(i.s.Value[i.i-1], i.s.Writable)
+}
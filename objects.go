@@ -2,8 +2,10 @@ package tengo
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -170,7 +172,8 @@ func (o *Array) String() string {
 // BinaryOp returns another object that is the result of a given binary
 // operator and a right-hand side object.
 func (o *Array) BinaryOp(op token.Token, rhs Object) (Object, error) {
-	if rhs, ok := rhs.(*Array); ok {
+	switch rhs := rhs.(type) {
+	case *Array:
 		switch op {
 		case token.Add:
 			if len(rhs.Value) == 0 {
@@ -178,6 +181,11 @@ func (o *Array) BinaryOp(op token.Token, rhs Object) (Object, error) {
 			}
 			return &Array{Value: append(o.Value, rhs.Value...)}, nil
 		}
+	case *GoSlice:
+		switch op {
+		case token.Add:
+			return &Array{Value: append(o.Value, rhs.elements()...)}, nil
+		}
 	}
 	return nil, ErrInvalidOperator
 }
@@ -263,6 +271,13 @@ func (o *Array) CanIterate() bool {
 	return true
 }
 
+// Items returns a snapshot of the array elements. The returned slice is
+// independent of the array, so it is not affected by later appends or
+// element assignments; the elements themselves are not copied.
+func (o *Array) Items() []Object {
+	return append([]Object{}, o.Value...)
+}
+
 // Bool represents a boolean value.
 type Bool struct {
 	ObjectImpl
@@ -322,6 +337,10 @@ type BuiltinFunction struct {
 	ObjectImpl
 	Name  string
 	Value CallableFunc
+
+	// vmValue, if set, is invoked instead of Value when the function is
+	// called from a running VM, giving it access to the VM's state.
+	vmValue func(v *VM, args ...Object) (Object, error)
 }
 
 // TypeName returns the name of the type.
@@ -335,7 +354,7 @@ func (o *BuiltinFunction) String() string {
 
 // Copy returns a copy of the type.
 func (o *BuiltinFunction) Copy() Object {
-	return &BuiltinFunction{Value: o.Value}
+	return &BuiltinFunction{Value: o.Value, vmValue: o.vmValue}
 }
 
 // Equals returns true if the value of the type is equal to the value of
@@ -437,7 +456,7 @@ func (o *Bytes) IndexGet(index Object) (res Object, err error) {
 		res = UndefinedValue
 		return
 	}
-	res = &Int{Value: int64(o.Value[idxVal])}
+	res = internInt(int64(o.Value[idxVal]))
 	return
 }
 
@@ -570,12 +589,14 @@ func (o *Char) Equals(x Object) bool {
 // CompiledFunction represents a compiled function.
 type CompiledFunction struct {
 	ObjectImpl
+	Name          string // name the function literal was assigned to, if any
 	Instructions  []byte
 	NumLocals     int // number of local variables (including function parameters)
 	NumParameters int
 	VarArgs       bool
 	SourceMap     map[int]parser.Pos
 	Free          []*ObjectPtr
+	origin        *Bytecode // bytecode of the script it belongs to, if known
 }
 
 // TypeName returns the name of the type.
@@ -590,11 +611,13 @@ func (o *CompiledFunction) String() string {
 // Copy returns a copy of the type.
 func (o *CompiledFunction) Copy() Object {
 	return &CompiledFunction{
+		Name:          o.Name,
 		Instructions:  append([]byte{}, o.Instructions...),
 		NumLocals:     o.NumLocals,
 		NumParameters: o.NumParameters,
 		VarArgs:       o.VarArgs,
 		Free:          append([]*ObjectPtr{}, o.Free...), // DO NOT Copy() of elements; these are variable pointers
+		origin:        o.origin,
 	}
 }
 
@@ -640,15 +663,21 @@ func (o *CompiledFunction) CallWithGlobalsEx(globals []Object, args ...Object) (
 // CallWithGlobalsExAndConstants invokes a compiled function with the given arguments, globals, and constants,
 // and returns both the result and the updated globals (if any were modified).
 func (o *CompiledFunction) CallWithGlobalsExAndConstants(constants []Object, globals []Object, args ...Object) (Object, []Object, error) {
+	return o.call(nil, constants, globals, args...)
+}
+
+// call runs the function in a fresh VM bound to the given execution context,
+// which may be nil.
+func (o *CompiledFunction) call(ec *ExecutionContext, constants []Object, globals []Object, args ...Object) (Object, []Object, error) {
+	return o.callContext(context.Background(), ec, constants, globals, args...)
+}
+
+// callContext is like call, but aborts the VM and returns the error of ctx
+// once ctx is done.
+func (o *CompiledFunction) callContext(ctx context.Context, ec *ExecutionContext, constants []Object, globals []Object, args ...Object) (Object, []Object, error) {
 	// Validate arguments count
-	if o.VarArgs {
-		if len(args) < o.NumParameters-1 {
-			return nil, nil, fmt.Errorf("wrong number of arguments: want>=%d, got=%d", o.NumParameters-1, len(args))
-		}
-	} else {
-		if len(args) != o.NumParameters {
-			return nil, nil, fmt.Errorf("wrong number of arguments: want=%d, got=%d", o.NumParameters, len(args))
-		}
+	if err := o.checkArity(len(args)); err != nil {
+		return nil, nil, err
 	}
 
 	// Handle empty bytecode case - just return undefined
@@ -688,15 +717,147 @@ func (o *CompiledFunction) CallWithGlobalsExAndConstants(constants []Object, glo
 		}
 	}
 
-	// Create a simple VM with just the necessary constants
-	vm := &VM{
-		constants:   constants,
-		sp:          0,
-		globals:     vmGlobals,
-		fileSet:     nil,
-		framesIndex: 2,
-		ip:          -1,
-		maxAllocs:   -1, // no allocation limit
+	// Create a simple VM with just the necessary constants, reusing the
+	// storage of a finished call. It is freed once the result is read.
+	vm := newCallVM()
+	vm.constants = constants
+	vm.globals = vmGlobals
+	vm.maxAllocs = -1 // no allocation limit
+	vm.ctx = ec
+	if ec != nil {
+		vm.stackTrace = ec.stackTrace
+		vm.overflow = ec.overflow
+		vm.readOnly = ec.readOnly
+		vm.sortedMaps = ec.sortedMaps
+		vm.profile = ec.profile
+		vm.lazy = ec.lazy
+		vm.alloc = ec.alloc
+		vm.metrics = ec.metrics
+		vm.recorder = ec.recorder
+		vm.tracer = ec.tracer
+		vm.observer = ec.observer
+		vm.depth = new(int64)
+		vm.resumable = true
+		if ec.maxOutput > 0 {
+			vm.output = &outputLimit{w: vm.Output(), left: ec.maxOutput}
+		}
+		if ec.source != nil {
+			vm.fileSet = ec.source.bytecode.FileSet
+		}
+	}
+	o.setupCall(vm, args)
+	if vm.profile != nil {
+		vm.profile.count(o)
+	}
+	return o.runCall(ctx, ec, vm, func() error {
+		if vm.tracer != nil {
+			vm.tracer.enter(0, o, args)
+		}
+		return vm.Run()
+	})
+}
+
+// runCall runs vm, set up for a call of o, with run and returns the result and
+// the globals of the call. If a host function suspends the call, the error is
+// a *Continuation holding vm; otherwise vm is freed.
+func (o *CompiledFunction) runCall(ctx context.Context, ec *ExecutionContext, vm *VM, run func() error) (Object, []Object, error) {
+	suspended := false
+	defer func() {
+		if !suspended {
+			freeCallVM(vm)
+		}
+	}()
+
+	if done := ctx.Done(); done != nil {
+		// wait for the goroutine to exit, so that it doesn't abort the
+		// next call using vm
+		stop := make(chan struct{})
+		exited := make(chan struct{})
+		defer func() {
+			close(stop)
+			<-exited
+		}()
+		go func() {
+			defer close(exited)
+			select {
+			case <-done:
+				vm.Abort()
+			case <-stop:
+			}
+		}()
+	}
+
+	if ec != nil {
+		if err := ec.startCall(vm); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Run the function
+	err := run()
+	if vm.tracer != nil && vm.suspended == nil {
+		var result Object
+		if err == nil && vm.sp > 0 {
+			result = vm.stack[vm.sp-1]
+		}
+		vm.tracer.exit(0, o, result, err)
+	}
+	if vm.metrics != nil && vm.suspended == nil {
+		vm.metrics.recordWork(vm.executed, vm.maxAllocs+1-vm.allocs)
+	}
+	var deadlineErr error
+	if ec != nil {
+		deadlineErr = ec.endCall(vm)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, nil, ctxErr
+	}
+	if deadlineErr != nil {
+		return nil, nil, deadlineErr
+	}
+	if vm.output != nil && vm.output.exceeded {
+		return nil, nil, ErrOutputLimit
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if vm.suspended != nil {
+		suspended = true
+		return nil, nil, &Continuation{fn: o, vm: vm,
+			value: vm.suspended.value}
+	}
+
+	// Get the result from the VM stack
+	var result Object = UndefinedValue
+	if vm.sp > 0 {
+		result = vm.stack[vm.sp-1]
+	}
+
+	// Return the result and updated globals
+	return result, vm.globals, nil
+}
+
+// checkArity returns an error if the function cannot be called with numArgs
+// arguments.
+func (o *CompiledFunction) checkArity(numArgs int) error {
+	if o.VarArgs {
+		if numArgs < o.NumParameters-1 {
+			return fmt.Errorf("wrong number of arguments: want>=%d, got=%d", o.NumParameters-1, numArgs)
+		}
+	} else if numArgs != o.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", o.NumParameters, numArgs)
+	}
+	return nil
+}
+
+// setupCall prepares an idle VM to execute the function as its root frame.
+// The arguments must satisfy checkArity.
+func (o *CompiledFunction) setupCall(vm *VM, args []Object) {
+	// roll up variadic arguments into an array
+	if o.VarArgs {
+		realArgs := o.NumParameters - 1
+		varArgs := append([]Object{}, args[realArgs:]...)
+		args = append(args[:realArgs:realArgs], vm.newArray(varArgs))
 	}
 
 	// Create a dummy main function for the parent frame
@@ -710,7 +871,7 @@ func (o *CompiledFunction) CallWithGlobalsExAndConstants(constants []Object, glo
 	vm.frames[0].fn = o
 	vm.frames[0].freeVars = o.Free
 	vm.frames[0].ip = -1
-	vm.frames[0].basePointer = vm.sp // base pointer at the start of function arguments
+	vm.frames[0].basePointer = 0 // base pointer at the start of function arguments
 
 	// Set up the dummy main frame as the parent frame
 	vm.frames[1].fn = dummyMainFunction
@@ -719,7 +880,9 @@ func (o *CompiledFunction) CallWithGlobalsExAndConstants(constants []Object, glo
 	// Set current frame to the actual function frame
 	vm.curFrame = &vm.frames[0]
 	vm.curInsts = o.Instructions
+	vm.framesIndex = 1
 	vm.ip = -1
+	vm.sp = 0
 
 	// Put the function arguments on the stack
 	for _, arg := range args {
@@ -732,27 +895,13 @@ func (o *CompiledFunction) CallWithGlobalsExAndConstants(constants []Object, glo
 		vm.stack[vm.sp] = UndefinedValue
 		vm.sp++
 	}
-
-	// Run the function
-	err := vm.Run()
-	if err != nil {
-		return nil, nil, err
-	}
-
-	// Get the result from the VM stack
-	var result Object = UndefinedValue
-	if vm.sp > 0 {
-		result = vm.stack[vm.sp-1]
-	}
-
-	// Return the result and updated globals
-	return result, vm.globals, nil
 }
 
 // Error represents an error value.
 type Error struct {
 	ObjectImpl
 	Value Object
+	trace []Frame
 }
 
 // TypeName returns the name of the type.
@@ -774,7 +923,13 @@ func (o *Error) IsFalsy() bool {
 
 // Copy returns a copy of the type.
 func (o *Error) Copy() Object {
-	return &Error{Value: o.Value.Copy()}
+	return &Error{Value: o.Value.Copy(), trace: o.trace}
+}
+
+// StackTrace returns the script call stack at the point the error was
+// created, innermost frame first. It is nil unless stack traces are enabled.
+func (o *Error) StackTrace() []Frame {
+	return o.trace
 }
 
 // Equals returns true if the value of the type is equal to the value of
@@ -1116,12 +1271,38 @@ func (o *ImmutableMap) CanIterate() bool {
 	return true
 }
 
-// Int represents an integer value.
+// Int represents an integer value. Ints are shared between the values of a
+// script, and the VM hands out the same objects for small integers, so an Int
+// must not be modified once it has been passed to the VM.
 type Int struct {
 	ObjectImpl
 	Value int64
 }
 
+// The range of the integers the VM interns.
+const (
+	minInternedInt = -128
+	maxInternedInt = 255
+)
+
+// internedInts holds the shared Ints of the integers from minInternedInt to
+// maxInternedInt.
+var internedInts = func() *[maxInternedInt - minInternedInt + 1]Int {
+	var ints [maxInternedInt - minInternedInt + 1]Int
+	for i := range ints {
+		ints[i].Value = int64(i + minInternedInt)
+	}
+	return &ints
+}()
+
+// internInt returns an Int holding v, the shared one if v is a small integer.
+func internInt(v int64) *Int {
+	if v >= minInternedInt && v <= maxInternedInt {
+		return &internedInts[v-minInternedInt]
+	}
+	return &Int{Value: v}
+}
+
 func (o *Int) String() string {
 	return strconv.FormatInt(o.Value, 10)
 }
@@ -1131,6 +1312,46 @@ func (o *Int) TypeName() string {
 	return "int"
 }
 
+// checkIntOverflow returns ErrIntOverflow, annotated with the operation, if
+// the int operation +, - or * on the given operands overflows int64. It
+// returns nil for any other operator or operand type.
+func checkIntOverflow(op token.Token, lhs, rhs Object) error {
+	l, ok := lhs.(*Int)
+	if !ok {
+		return nil
+	}
+	r, ok := rhs.(*Int)
+	if !ok {
+		return nil
+	}
+	if !intOverflows(op, l.Value, r.Value) {
+		return nil
+	}
+	return fmt.Errorf("%w: %d %s %d", ErrIntOverflow, l.Value, op, r.Value)
+}
+
+// intOverflows returns true if the int operation +, - or * on a and b
+// overflows int64.
+func intOverflows(op token.Token, a, b int64) bool {
+	switch op {
+	case token.Add:
+		r := a + b
+		return (a^r)&(b^r) < 0
+	case token.Sub:
+		r := a - b
+		return (a^b)&(a^r) < 0
+	case token.Mul:
+		if a == 0 || b == 0 {
+			return false
+		}
+		if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+			return true
+		}
+		return a*b/b != a
+	}
+	return false
+}
+
 // BinaryOp returns another object that is the result of a given binary
 // operator and a right-hand side object.
 func (o *Int) BinaryOp(op token.Token, rhs Object) (Object, error) {
@@ -1142,67 +1363,73 @@ func (o *Int) BinaryOp(op token.Token, rhs Object) (Object, error) {
 			if r == o.Value {
 				return o, nil
 			}
-			return &Int{Value: r}, nil
+			return internInt(r), nil
 		case token.Sub:
 			r := o.Value - rhs.Value
 			if r == o.Value {
 				return o, nil
 			}
-			return &Int{Value: r}, nil
+			return internInt(r), nil
 		case token.Mul:
 			r := o.Value * rhs.Value
 			if r == o.Value {
 				return o, nil
 			}
-			return &Int{Value: r}, nil
+			return internInt(r), nil
 		case token.Quo:
+			if rhs.Value == 0 {
+				return nil, ErrDivisionByZero
+			}
 			r := o.Value / rhs.Value
 			if r == o.Value {
 				return o, nil
 			}
-			return &Int{Value: r}, nil
+			return internInt(r), nil
 		case token.Rem:
+			if rhs.Value == 0 {
+				return nil, ErrDivisionByZero
+			}
 			r := o.Value % rhs.Value
 			if r == o.Value {
 				return o, nil
 			}
-			return &Int{Value: r}, nil
+			return internInt(r), nil
 		case token.And:
 			r := o.Value & rhs.Value
 			if r == o.Value {
 				return o, nil
 			}
-			return &Int{Value: r}, nil
+			return internInt(r), nil
 		case token.Or:
 			r := o.Value | rhs.Value
 			if r == o.Value {
 				return o, nil
 			}
-			return &Int{Value: r}, nil
+			return internInt(r), nil
 		case token.Xor:
 			r := o.Value ^ rhs.Value
 			if r == o.Value {
 				return o, nil
 			}
-			return &Int{Value: r}, nil
+			return internInt(r), nil
 		case token.AndNot:
 			r := o.Value &^ rhs.Value
 			if r == o.Value {
 				return o, nil
 			}
-			return &Int{Value: r}, nil
+			return internInt(r), nil
 		case token.Shl:
 			r := o.Value << uint64(rhs.Value)
 			if r == o.Value {
 				return o, nil
 			}
-			return &Int{Value: r}, nil
+			return internInt(r), nil
 		case token.Shr:
 			r := o.Value >> uint64(rhs.Value)
 			if r == o.Value {
 				return o, nil
 			}
-			return &Int{Value: r}, nil
+			return internInt(r), nil
 		case token.Less:
 			if o.Value < rhs.Value {
 				return TrueValue, nil
@@ -1406,6 +1633,25 @@ func (o *Map) CanIterate() bool {
 	return true
 }
 
+// MapEntry is a key-value pair of a Map.
+type MapEntry struct {
+	Key   string
+	Value Object
+}
+
+// Entries returns a snapshot of the map entries sorted by key. The returned
+// slice is independent of the map; the values themselves are not copied.
+func (o *Map) Entries() []MapEntry {
+	entries := make([]MapEntry, 0, len(o.Value))
+	for k, v := range o.Value {
+		entries = append(entries, MapEntry{Key: k, Value: v})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
 // ObjectPtr represents a free variable.
 type ObjectPtr struct {
 	ObjectImpl
@@ -1444,6 +1690,18 @@ type String struct {
 	runeStr []rune
 }
 
+// emptyString is the shared empty String. Its runes are set up front, as
+// they would otherwise be cached on first use by every goroutine using it.
+var emptyString = &String{runeStr: []rune{}}
+
+// internString returns a String holding s, the shared one if s is empty.
+func internString(s string) *String {
+	if s == "" {
+		return emptyString
+	}
+	return &String{Value: s}
+}
+
 // TypeName returns the name of the type.
 func (o *String) TypeName() string {
 	return "string"
@@ -1463,13 +1721,13 @@ func (o *String) BinaryOp(op token.Token, rhs Object) (Object, error) {
 			if len(o.Value)+len(rhs.Value) > MaxStringLen {
 				return nil, ErrStringLimit
 			}
-			return &String{Value: o.Value + rhs.Value}, nil
+			return internString(o.Value + rhs.Value), nil
 		default:
 			rhsStr := rhs.String()
 			if len(o.Value)+len(rhsStr) > MaxStringLen {
 				return nil, ErrStringLimit
 			}
-			return &String{Value: o.Value + rhsStr}, nil
+			return internString(o.Value + rhsStr), nil
 		}
 	case token.Less:
 		switch rhs := rhs.(type) {
@@ -1708,6 +1966,12 @@ type UserFunction struct {
 	ObjectImpl
 	Name  string
 	Value CallableFunc
+
+	// VMValue, if set, is invoked instead of Value when the function is
+	// called from a running VM. It can use the VM to call back into
+	// functions passed by the script. When VMValue is set, Value may be nil;
+	// calls made outside of a VM then receive a nil VM.
+	VMValue VMCallableFunc
 }
 
 // TypeName returns the name of the type.
@@ -1721,7 +1985,7 @@ func (o *UserFunction) String() string {
 
 // Copy returns a copy of the type.
 func (o *UserFunction) Copy() Object {
-	return &UserFunction{Value: o.Value, Name: o.Name}
+	return &UserFunction{Value: o.Value, VMValue: o.VMValue, Name: o.Name}
 }
 
 // Equals returns true if the value of the type is equal to the value of
@@ -1732,6 +1996,9 @@ func (o *UserFunction) Equals(_ Object) bool {
 
 // Call invokes a user function.
 func (o *UserFunction) Call(args ...Object) (Object, error) {
+	if o.Value == nil && o.VMValue != nil {
+		return o.VMValue(nil, args...)
+	}
 	return o.Value(args...)
 }
 
@@ -1,6 +1,9 @@
 package tengo_test
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/tiagoj/tengo/v2"
@@ -729,6 +732,52 @@ func TestMap_Index(t *testing.T) {
 	require.Equal(t, v, res)
 }
 
+func TestMap_Entries(t *testing.T) {
+	script := tengo.NewScript([]byte(`
+		make_record := func(id) {
+			return {zeta: id * 2, alpha: id, mid: "m"}
+		}
+	`))
+	compiled, err := script.Compile()
+	require.NoError(t, err)
+	require.NoError(t, compiled.Run())
+
+	fn := compiled.Get("make_record").Value().(*tengo.CompiledFunction)
+	res, err := tengo.NewExecutionContext(compiled).Call(fn, &tengo.Int{Value: 7})
+	require.NoError(t, err)
+
+	m := res.(*tengo.Map)
+	entries := m.Entries()
+	require.Equal(t, 3, len(entries))
+	require.Equal(t, "alpha", entries[0].Key)
+	require.Equal(t, &tengo.Int{Value: 7}, entries[0].Value)
+	require.Equal(t, "mid", entries[1].Key)
+	require.Equal(t, &tengo.String{Value: "m"}, entries[1].Value)
+	require.Equal(t, "zeta", entries[2].Key)
+	require.Equal(t, &tengo.Int{Value: 14}, entries[2].Value)
+
+	// the snapshot is not affected by later map mutations
+	m.Value["beta"] = tengo.TrueValue
+	require.Equal(t, 3, len(entries))
+	require.Equal(t, 4, len(m.Entries()))
+	require.Equal(t, 0, len((&tengo.Map{}).Entries()))
+}
+
+func TestArray_Items(t *testing.T) {
+	a := &tengo.Array{Value: []tengo.Object{
+		&tengo.Int{Value: 1}, &tengo.Int{Value: 2},
+	}}
+	items := a.Items()
+	require.Equal(t, a.Value, items)
+
+	a.Value[0] = &tengo.Int{Value: 100}
+	a.Value = append(a.Value, &tengo.Int{Value: 3})
+	require.Equal(t, []tengo.Object{
+		&tengo.Int{Value: 1}, &tengo.Int{Value: 2},
+	}, items)
+	require.Equal(t, 0, len((&tengo.Array{}).Items()))
+}
+
 func TestString_BinaryOp(t *testing.T) {
 	lstr := "abcde"
 	rstr := "01234"
@@ -748,6 +797,42 @@ func TestString_BinaryOp(t *testing.T) {
 	}
 }
 
+func TestInterning(t *testing.T) {
+	one := &tengo.Int{Value: 1}
+	for v := int64(-130); v <= 260; v++ {
+		res, err := (&tengo.Int{Value: v - 1}).BinaryOp(token.Add, one)
+		require.NoError(t, err)
+		require.Equal(t, &tengo.Int{Value: v}, res)
+	}
+
+	// small ints are shared, other ints and copies are not
+	sum := func(l, r int64) tengo.Object {
+		res, err := (&tengo.Int{Value: l}).BinaryOp(token.Add,
+			&tengo.Int{Value: r})
+		require.NoError(t, err)
+		return res
+	}
+	require.True(t, sum(1, 2) == sum(2, 1))
+	require.True(t, sum(-100, -28) == sum(-28, -100))
+	require.True(t, sum(200, 55) == sum(55, 200))
+	require.False(t, sum(200, 56) == sum(56, 200))
+	require.False(t, sum(-100, -29) == sum(-29, -100))
+	require.False(t, sum(1, 2) == sum(1, 2).Copy())
+
+	// the empty string is shared and usable as any other string
+	empty := &tengo.String{}
+	res, err := empty.BinaryOp(token.Add, empty)
+	require.NoError(t, err)
+	res2, err := empty.BinaryOp(token.Add, &tengo.String{})
+	require.NoError(t, err)
+	require.True(t, res == res2)
+	require.Equal(t, empty, res)
+	elem, err := res.IndexGet(&tengo.Int{Value: 0})
+	require.NoError(t, err)
+	require.Equal(t, tengo.UndefinedValue, elem)
+	require.False(t, res.Iterate().Next())
+}
+
 func testBinaryOp(
 	t *testing.T,
 	lhs tengo.Object,
@@ -767,3 +852,124 @@ func boolValue(b bool) tengo.Object {
 	}
 	return tengo.FalseValue
 }
+
+func TestGoMap(t *testing.T) {
+	type opaque struct{}
+	data := map[string]interface{}{
+		"name":   "svc",
+		"port":   8080,
+		"tags":   []interface{}{"a", "b"},
+		"limits": map[string]interface{}{"cpu": 1.5},
+		// values are only converted when read, so unconvertible values
+		// don't matter unless the script reads them
+		"blob": opaque{},
+	}
+	deepEqual := func(expected, actual interface{}) {
+		require.True(t, reflect.DeepEqual(expected, actual),
+			fmt.Sprintf("%v != %v", expected, actual))
+	}
+	run := func(src string, input tengo.Object) (*tengo.Compiled, error) {
+		script := tengo.NewScript([]byte(src))
+		require.NoError(t, script.Add("input", input))
+		compiled, err := script.Compile()
+		require.NoError(t, err)
+		return compiled, compiled.Run()
+	}
+
+	// lazy read-through, including nested values
+	compiled, err := run(`
+out := [input.name, input.port, input.tags[1], input.limits.cpu,
+	input.missing, len(input), len(input.tags)]
+keys := []
+for k, v in input.tags { keys = append(keys, k, v) }
+`, &tengo.GoMap{Value: data})
+	require.NoError(t, err)
+	deepEqual([]interface{}{"svc", int64(8080), "b", 1.5, nil,
+		int64(5), int64(2)}, compiled.Get("out").Array())
+	deepEqual([]interface{}{int64(0), "a", int64(1), "b"},
+		compiled.Get("keys").Array())
+
+	// the script sees the values of the Go map when it reads them
+	compiled, err = run(`f := func() { return input.port }`,
+		&tengo.GoMap{Value: data})
+	require.NoError(t, err)
+	data["port"] = 9090
+	res, err := tengo.NewExecutionContext(compiled).Call(
+		compiled.Get("f").Value().(*tengo.CompiledFunction))
+	require.NoError(t, err)
+	require.Equal(t, &tengo.Int{Value: 9090}, res)
+
+	// unconvertible values are read as errors
+	compiled, err = run(`out := is_error(input.blob)`,
+		&tengo.GoMap{Value: data})
+	require.NoError(t, err)
+	require.True(t, compiled.Get("out").Bool())
+
+	// read-only maps and slices reject writes
+	for _, src := range []string{
+		`input.port = 1`, `input.limits.cpu = 2`, `input.tags[0] = "x"`,
+	} {
+		_, err = run(src, &tengo.GoMap{Value: data})
+		require.Error(t, err)
+		require.True(t, strings.Contains(err.Error(), "not index-assignable"),
+			err.Error())
+	}
+	require.Equal(t, 9090, data["port"])
+	require.Equal(t, "a", data["tags"].([]interface{})[0])
+
+	// writable maps and slices mutate the Go data
+	_, err = run(`
+input.port = 1
+input.limits.cpu = 2
+input.tags[0] = "x"
+input.extra = {a: [1]}
+`, &tengo.GoMap{Value: data, Writable: true})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), data["port"])
+	require.Equal(t, int64(2), data["limits"].(map[string]interface{})["cpu"])
+	require.Equal(t, "x", data["tags"].([]interface{})[0])
+	deepEqual(map[string]interface{}{"a": []interface{}{int64(1)}},
+		data["extra"])
+	_, err = run(`input.tags[5] = 1`, &tengo.GoMap{Value: data, Writable: true})
+	require.Error(t, err)
+
+	// maps and slices work with the builtins and operators taking maps and
+	// arrays
+	compiled, err = run(`
+out := [is_map(input), is_array(input.nums), is_map(input.nums),
+	input.nums + [3], [0] + input.nums, input.nums + input.nums,
+	sum(input.nums), deep_equal(input.point, {x: 1}),
+	to_json(input.point), to_json(input.nums)]
+a, b := input.nums
+{x} := input.point
+out = append(out, a, b, x)
+`, &tengo.GoMap{Value: map[string]interface{}{
+		"nums":  []interface{}{1, 2},
+		"point": map[string]interface{}{"x": 1},
+	}})
+	require.NoError(t, err)
+	deepEqual([]interface{}{true, true, false,
+		[]interface{}{int64(1), int64(2), int64(3)},
+		[]interface{}{int64(0), int64(1), int64(2)},
+		[]interface{}{int64(1), int64(2), int64(1), int64(2)},
+		int64(3), true, `{"x":1}`, `[1,2]`, int64(1), int64(2), int64(1)},
+		compiled.Get("out").Array())
+	_, err = run(`out := to_json(input)`, &tengo.GoMap{Value: data})
+	require.NoError(t, err)
+
+	// slices take the same indexes for reads and writes
+	for _, src := range []string{`input[0.0]`, `input[0.0] = 1`} {
+		_, err = run(src, &tengo.GoSlice{Value: []interface{}{1},
+			Writable: true})
+		require.Error(t, err)
+		require.True(t, strings.Contains(err.Error(), "invalid index type"),
+			err.Error())
+	}
+
+	// copies are script values
+	compiled, err = run(`c := copy(input); c[0] = 5; out := [input[0], c[0], input == [1]]`,
+		&tengo.GoSlice{Value: []interface{}{1}})
+	require.NoError(t, err)
+	deepEqual([]interface{}{int64(1), int64(5), true},
+		compiled.Get("out").Array())
+}
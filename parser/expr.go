@@ -405,7 +405,8 @@ func (e *IntLit) String() string {
 	return e.Literal
 }
 
-// MapElementLit represents a map element.
+// MapElementLit represents a map element. Spread elements have an empty Key,
+// KeyPos at the ellipsis, and a SpreadExpr Value.
 type MapElementLit struct {
 	Key      string
 	KeyPos   Pos
@@ -426,6 +427,9 @@ func (e *MapElementLit) End() Pos {
 }
 
 func (e *MapElementLit) String() string {
+	if _, ok := e.Value.(*SpreadExpr); ok {
+		return e.Value.String()
+	}
 	return e.Key + ": " + e.Value.String()
 }
 
@@ -456,6 +460,34 @@ func (e *MapLit) String() string {
 	return "{" + strings.Join(elements, ", ") + "}"
 }
 
+// MapPattern represents the left-hand side of a map destructuring
+// assignment, e.g. "{x, y}" in "{x, y} := m".
+type MapPattern struct {
+	LBrace Pos
+	Names  []*Ident
+	RBrace Pos
+}
+
+func (e *MapPattern) exprNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (e *MapPattern) Pos() Pos {
+	return e.LBrace
+}
+
+// End returns the position of first character immediately after the node.
+func (e *MapPattern) End() Pos {
+	return e.RBrace + 1
+}
+
+func (e *MapPattern) String() string {
+	var names []string
+	for _, n := range e.Names {
+		names = append(names, n.String())
+	}
+	return "{" + strings.Join(names, ", ") + "}"
+}
+
 // ParenExpr represents a parenthesis wrapped expression.
 type ParenExpr struct {
 	Expr   Expr
@@ -533,6 +565,29 @@ func (e *SliceExpr) String() string {
 	return e.Expr.String() + "[" + low + ":" + high + "]"
 }
 
+// SpreadExpr represents an element of an array or map literal whose elements
+// are copied into the literal, e.g. "...a" in "[...a, 1]".
+type SpreadExpr struct {
+	Ellipsis Pos
+	Expr     Expr
+}
+
+func (e *SpreadExpr) exprNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (e *SpreadExpr) Pos() Pos {
+	return e.Ellipsis
+}
+
+// End returns the position of first character immediately after the node.
+func (e *SpreadExpr) End() Pos {
+	return e.Expr.End()
+}
+
+func (e *SpreadExpr) String() string {
+	return "..." + e.Expr.String()
+}
+
 // StringLit represents a string literal.
 type StringLit struct {
 	Value    string
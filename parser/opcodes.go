@@ -47,6 +47,10 @@ const (
 	OpIteratorValue               // Iterator value
 	OpBinaryOp                    // Binary operation
 	OpSuspend                     // Suspend VM
+	OpDestructure                 // Destructure array or map
+	OpYield                       // Suspend coroutine
+	OpSpread                      // Copy elements into array or map
+	OpDefer                       // Defer function call
 )
 
 // OpcodeNames are string representation of opcodes.
@@ -93,6 +97,10 @@ var OpcodeNames = [...]string{
 	OpIteratorValue: "ITVAL",
 	OpBinaryOp:      "BINARYOP",
 	OpSuspend:       "SUSPEND",
+	OpDestructure:   "DESTRUCT",
+	OpYield:         "YIELD",
+	OpSpread:        "SPREAD",
+	OpDefer:         "DEFER",
 }
 
 // OpcodeOperands is the number of operands.
@@ -139,6 +147,10 @@ var OpcodeOperands = [...][]int{
 	OpIteratorValue: {},
 	OpBinaryOp:      {1},
 	OpSuspend:       {},
+	OpDestructure:   {1, 1},
+	OpYield:         {},
+	OpSpread:        {},
+	OpDefer:         {1, 1},
 }
 
 // ReadOperands reads operands from the bytecode.
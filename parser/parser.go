@@ -18,6 +18,9 @@ var stmtStart = map[token.Token]bool{
 	token.If:       true,
 	token.Return:   true,
 	token.Export:   true,
+	token.Yield:    true,
+	token.Defer:    true,
+	token.Const:    true,
 }
 
 // Error represents a parser error.
@@ -539,7 +542,11 @@ func (p *Parser) parseArrayLit() Expr {
 
 	var elements []Expr
 	for p.token != token.RBrack && p.token != token.EOF {
-		elements = append(elements, p.parseExpr())
+		if p.token == token.Ellipsis {
+			elements = append(elements, p.parseSpreadExpr())
+		} else {
+			elements = append(elements, p.parseExpr())
+		}
 
 		if !p.expectComma(token.RBrack, "array element") {
 			break
@@ -691,6 +698,12 @@ func (p *Parser) parseStmt() (stmt Stmt) {
 		return s
 	case token.Return:
 		return p.parseReturnStmt()
+	case token.Yield:
+		return p.parseYieldStmt()
+	case token.Defer:
+		return p.parseDeferStmt()
+	case token.Const:
+		return p.parseConstStmt()
 	case token.Export:
 		return p.parseExportStmt()
 	case token.If:
@@ -924,6 +937,62 @@ func (p *Parser) parseReturnStmt() Stmt {
 	}
 }
 
+func (p *Parser) parseYieldStmt() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "YieldStmt"))
+	}
+
+	pos := p.pos
+	p.expect(token.Yield)
+
+	var x Expr
+	if p.token != token.Semicolon && p.token != token.RBrace {
+		x = p.parseExpr()
+	}
+	p.expectSemi()
+	return &YieldStmt{
+		YieldPos: pos,
+		Result:   x,
+	}
+}
+
+func (p *Parser) parseDeferStmt() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "DeferStmt"))
+	}
+
+	pos := p.pos
+	p.expect(token.Defer)
+	x := p.parseExpr()
+	p.expectSemi()
+	call, ok := x.(*CallExpr)
+	if !ok {
+		p.error(x.Pos(), "expression in defer must be function call")
+		return &BadStmt{From: pos, To: p.safePos(x.End())}
+	}
+	return &DeferStmt{
+		DeferPos: pos,
+		Call:     call,
+	}
+}
+
+func (p *Parser) parseConstStmt() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "ConstStmt"))
+	}
+
+	pos := p.expect(token.Const)
+	name := p.parseIdent()
+	p.expect(token.Assign)
+	value := p.parseExpr()
+	p.expectSemi()
+	return &ConstStmt{
+		ConstPos: pos,
+		Name:     name,
+		Value:    value,
+	}
+}
+
 func (p *Parser) parseExportStmt() Stmt {
 	if p.trace {
 		defer untracep(tracep(p, "ExportStmt"))
@@ -944,7 +1013,12 @@ func (p *Parser) parseSimpleStmt(forIn bool) Stmt {
 		defer untracep(tracep(p, "SimpleStmt"))
 	}
 
-	x := p.parseExprList()
+	var x []Expr
+	if p.token == token.LBrace && p.isMapPattern() {
+		x = []Expr{p.parseMapPattern()}
+	} else {
+		x = p.parseExprList()
+	}
 
 	switch p.token {
 	case token.Assign, token.Define: // assignment statement
@@ -1021,6 +1095,53 @@ func (p *Parser) parseSimpleStmt(forIn bool) Stmt {
 	return &ExprStmt{Expr: x[0]}
 }
 
+// isMapPattern reports whether the tokens starting at the current "{" form
+// the left-hand side of a map destructuring assignment: a brace-enclosed list
+// of identifiers followed by ":=" or "=".
+func (p *Parser) isMapPattern() bool {
+	s := *p.scanner
+	s.errorHandler = nil
+
+	numNames := 0
+	tok, lit, _ := s.Scan()
+	for tok == token.Ident {
+		numNames++
+		if tok, lit, _ = s.Scan(); tok != token.Comma {
+			break
+		}
+		tok, lit, _ = s.Scan()
+	}
+	if tok == token.Semicolon && lit == "\n" {
+		tok, _, _ = s.Scan()
+	}
+	if numNames == 0 || tok != token.RBrace {
+		return false
+	}
+	tok, _, _ = s.Scan()
+	return tok == token.Define || tok == token.Assign
+}
+
+func (p *Parser) parseMapPattern() *MapPattern {
+	if p.trace {
+		defer untracep(tracep(p, "MapPattern"))
+	}
+
+	lbrace := p.expect(token.LBrace)
+	var names []*Ident
+	for p.token != token.RBrace && p.token != token.EOF {
+		names = append(names, p.parseIdent())
+		if !p.expectComma(token.RBrace, "identifier") {
+			break
+		}
+	}
+	rbrace := p.expect(token.RBrace)
+	return &MapPattern{
+		LBrace: lbrace,
+		Names:  names,
+		RBrace: rbrace,
+	}
+}
+
 func (p *Parser) parseExprList() (list []Expr) {
 	if p.trace {
 		defer untracep(tracep(p, "ExpressionList"))
@@ -1040,6 +1161,9 @@ func (p *Parser) parseMapElementLit() *MapElementLit {
 	}
 
 	pos := p.pos
+	if p.token == token.Ellipsis {
+		return &MapElementLit{KeyPos: pos, Value: p.parseSpreadExpr()}
+	}
 	name := "_"
 	if p.token == token.Ident {
 		name = p.tokenLit
@@ -1060,6 +1184,18 @@ func (p *Parser) parseMapElementLit() *MapElementLit {
 	}
 }
 
+func (p *Parser) parseSpreadExpr() *SpreadExpr {
+	if p.trace {
+		defer untracep(tracep(p, "SpreadExpr"))
+	}
+
+	ellipsis := p.expect(token.Ellipsis)
+	return &SpreadExpr{
+		Ellipsis: ellipsis,
+		Expr:     p.parseExpr(),
+	}
+}
+
 func (p *Parser) parseMapLit() *MapLit {
 	if p.trace {
 		defer untracep(tracep(p, "MapLit"))
@@ -228,6 +228,50 @@ func TestParseAssignment(t *testing.T) {
 				p(1, 3)))
 	})
 
+	expectParse(t, "a, b := c", func(p pfn) []Stmt {
+		return stmts(
+			assignStmt(
+				exprs(
+					ident("a", p(1, 1)),
+					ident("b", p(1, 4))),
+				exprs(ident("c", p(1, 9))),
+				token.Define,
+				p(1, 6)))
+	})
+
+	expectParse(t, "{a, b} := c", func(p pfn) []Stmt {
+		return stmts(
+			assignStmt(
+				exprs(mapPattern(p(1, 1), p(1, 6),
+					ident("a", p(1, 2)),
+					ident("b", p(1, 5)))),
+				exprs(ident("c", p(1, 11))),
+				token.Define,
+				p(1, 8)))
+	})
+
+	expectParse(t, "{a} = {a: 1}", func(p pfn) []Stmt {
+		return stmts(
+			assignStmt(
+				exprs(mapPattern(p(1, 1), p(1, 3),
+					ident("a", p(1, 2)))),
+				exprs(mapLit(p(1, 7), p(1, 12),
+					mapElementLit("a", p(1, 8), p(1, 9), intLit(1, p(1, 11))))),
+				token.Assign,
+				p(1, 5)))
+	})
+
+	expectParse(t, "{a: 1}", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				mapLit(p(1, 1), p(1, 6),
+					mapElementLit("a", p(1, 2), p(1, 3), intLit(1, p(1, 5))))))
+	})
+
+	expectParseError(t, "{a, b}")
+	expectParseError(t, "{a, 1} := c")
+	expectParseError(t, "{a, b} += c")
+
 	expectParse(t, "a += 5", func(p pfn) []Stmt {
 		return stmts(
 			assignStmt(
@@ -734,6 +778,70 @@ func TestParseFunction(t *testing.T) {
 	})
 }
 
+func TestParseYield(t *testing.T) {
+	expectParse(t, "func() { yield 1; yield }", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				funcLit(
+					funcType(
+						identList(p(1, 5), p(1, 6), false),
+						p(1, 1)),
+					blockStmt(p(1, 8), p(1, 25),
+						yieldStmt(p(1, 10), intLit(1, p(1, 16))),
+						yieldStmt(p(1, 19), nil)))))
+	})
+
+	expectParseError(t, "yield := 1")
+}
+
+func TestParseDefer(t *testing.T) {
+	expectParse(t, "func() { defer f(1) }", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				funcLit(
+					funcType(
+						identList(p(1, 5), p(1, 6), false),
+						p(1, 1)),
+					blockStmt(p(1, 8), p(1, 21),
+						deferStmt(p(1, 10),
+							callExpr(ident("f", p(1, 16)),
+								p(1, 17), p(1, 19), NoPos,
+								intLit(1, p(1, 18))))))))
+	})
+
+	expectParseError(t, "func() { defer f }")
+	expectParseError(t, "func() { defer }")
+	expectParseError(t, "defer := 1")
+}
+
+func TestParseConst(t *testing.T) {
+	expectParse(t, "const PI = 3", func(p pfn) []Stmt {
+		return stmts(
+			constStmt(p(1, 1), ident("PI", p(1, 7)), intLit(3, p(1, 12))))
+	})
+	expectParse(t, "func() { const a = b + 1 }", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				funcLit(
+					funcType(
+						identList(p(1, 5), p(1, 6), false),
+						p(1, 1)),
+					blockStmt(p(1, 8), p(1, 26),
+						constStmt(p(1, 10), ident("a", p(1, 16)),
+							binaryExpr(
+								ident("b", p(1, 20)),
+								intLit(1, p(1, 24)),
+								token.Add,
+								p(1, 22)))))))
+	})
+
+	expectParseError(t, "const a")
+	expectParseError(t, "const a := 1")
+	expectParseError(t, "const a, b = 1, 2")
+	expectParseError(t, "const = 1")
+	expectParseError(t, "const := 1")
+}
+
 func TestParseVariadicFunction(t *testing.T) {
 	expectParse(t, "a = func(...args) { return args }", func(p pfn) []Stmt {
 		return stmts(
@@ -1264,6 +1372,37 @@ key2: 2,
 }`)
 }
 
+func TestParseSpread(t *testing.T) {
+	expectParse(t, "[1, ...a, ...[2]]", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				arrayLit(p(1, 1), p(1, 17),
+					intLit(1, p(1, 2)),
+					spreadExpr(p(1, 5), ident("a", p(1, 8))),
+					spreadExpr(p(1, 11),
+						arrayLit(p(1, 14), p(1, 16),
+							intLit(2, p(1, 15)))))))
+	})
+
+	expectParse(t, "{...a, k: 1, ...f()}", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				mapLit(p(1, 1), p(1, 20),
+					spreadElementLit(p(1, 2), ident("a", p(1, 5))),
+					mapElementLit("k", p(1, 8), p(1, 9), intLit(1, p(1, 11))),
+					spreadElementLit(p(1, 14),
+						callExpr(ident("f", p(1, 17)), p(1, 18), p(1, 19),
+							NoPos)))))
+	})
+
+	expectParseString(t, "[...a, 1]", "[...a, 1]")
+	expectParseString(t, "{...a, b: 1}", "{...a, b: 1}")
+
+	expectParseError(t, "[...]")
+	expectParseError(t, "{...a: 1}")
+	expectParseError(t, "f(...a)")
+}
+
 func TestParsePrecedence(t *testing.T) {
 	expectParseString(t, `a + b + c`, `((a + b) + c)`)
 	expectParseString(t, `a + b * c`, `(a + (b * c))`)
@@ -1780,6 +1919,18 @@ func emptyStmt(implicit bool, pos Pos) *EmptyStmt {
 	return &EmptyStmt{Implicit: implicit, Semicolon: pos}
 }
 
+func constStmt(pos Pos, name *Ident, value Expr) *ConstStmt {
+	return &ConstStmt{ConstPos: pos, Name: name, Value: value}
+}
+
+func deferStmt(pos Pos, call *CallExpr) *DeferStmt {
+	return &DeferStmt{Call: call, DeferPos: pos}
+}
+
+func yieldStmt(pos Pos, result Expr) *YieldStmt {
+	return &YieldStmt{Result: result, YieldPos: pos}
+}
+
 func returnStmt(pos Pos, result Expr) *ReturnStmt {
 	return &ReturnStmt{Result: result, ReturnPos: pos}
 }
@@ -1925,6 +2076,18 @@ func mapLit(
 	return &MapLit{LBrace: lbrace, RBrace: rbrace, Elements: list}
 }
 
+func spreadExpr(ellipsis Pos, x Expr) *SpreadExpr {
+	return &SpreadExpr{Ellipsis: ellipsis, Expr: x}
+}
+
+func spreadElementLit(ellipsis Pos, x Expr) *MapElementLit {
+	return &MapElementLit{KeyPos: ellipsis, Value: spreadExpr(ellipsis, x)}
+}
+
+func mapPattern(lbrace, rbrace Pos, names ...*Ident) *MapPattern {
+	return &MapPattern{LBrace: lbrace, RBrace: rbrace, Names: names}
+}
+
 func funcLit(funcType *FuncType, body *BlockStmt) *FuncLit {
 	return &FuncLit{Type: funcType, Body: body}
 }
@@ -2041,6 +2204,23 @@ func equalStmt(t *testing.T, expected, actual Stmt) {
 			actual.(*ReturnStmt).Result)
 		require.Equal(t, expected.ReturnPos,
 			actual.(*ReturnStmt).ReturnPos)
+	case *ConstStmt:
+		equalExpr(t, expected.Name,
+			actual.(*ConstStmt).Name)
+		equalExpr(t, expected.Value,
+			actual.(*ConstStmt).Value)
+		require.Equal(t, expected.ConstPos,
+			actual.(*ConstStmt).ConstPos)
+	case *DeferStmt:
+		equalExpr(t, expected.Call,
+			actual.(*DeferStmt).Call)
+		require.Equal(t, expected.DeferPos,
+			actual.(*DeferStmt).DeferPos)
+	case *YieldStmt:
+		equalExpr(t, expected.Result,
+			actual.(*YieldStmt).Result)
+		require.Equal(t, expected.YieldPos,
+			actual.(*YieldStmt).YieldPos)
 	case *BranchStmt:
 		equalExpr(t, expected.Label,
 			actual.(*BranchStmt).Label)
@@ -2099,6 +2279,20 @@ func equalExpr(t *testing.T, expected, actual Expr) {
 			actual.(*ArrayLit).RBrack)
 		equalExprs(t, expected.Elements,
 			actual.(*ArrayLit).Elements)
+	case *SpreadExpr:
+		require.Equal(t, expected.Ellipsis,
+			actual.(*SpreadExpr).Ellipsis)
+		equalExpr(t, expected.Expr, actual.(*SpreadExpr).Expr)
+	case *MapPattern:
+		require.Equal(t, expected.LBrace,
+			actual.(*MapPattern).LBrace)
+		require.Equal(t, expected.RBrace,
+			actual.(*MapPattern).RBrace)
+		require.Equal(t, len(expected.Names),
+			len(actual.(*MapPattern).Names))
+		for i, name := range expected.Names {
+			equalExpr(t, name, actual.(*MapPattern).Names[i])
+		}
 	case *MapLit:
 		require.Equal(t, expected.LBrace,
 			actual.(*MapLit).LBrace)
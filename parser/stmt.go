@@ -347,3 +347,76 @@ func (s *ReturnStmt) String() string {
 	}
 	return "return"
 }
+
+// ConstStmt represents a constant declaration.
+type ConstStmt struct {
+	ConstPos Pos
+	Name     *Ident
+	Value    Expr
+}
+
+func (s *ConstStmt) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *ConstStmt) Pos() Pos {
+	return s.ConstPos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *ConstStmt) End() Pos {
+	return s.Value.End()
+}
+
+func (s *ConstStmt) String() string {
+	return "const " + s.Name.String() + " = " + s.Value.String()
+}
+
+// DeferStmt represents a defer statement.
+type DeferStmt struct {
+	DeferPos Pos
+	Call     *CallExpr
+}
+
+func (s *DeferStmt) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *DeferStmt) Pos() Pos {
+	return s.DeferPos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *DeferStmt) End() Pos {
+	return s.Call.End()
+}
+
+func (s *DeferStmt) String() string {
+	return "defer " + s.Call.String()
+}
+
+// YieldStmt represents a yield statement.
+type YieldStmt struct {
+	YieldPos Pos
+	Result   Expr
+}
+
+func (s *YieldStmt) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *YieldStmt) Pos() Pos {
+	return s.YieldPos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *YieldStmt) End() Pos {
+	if s.Result != nil {
+		return s.Result.End()
+	}
+	return s.YieldPos + 5
+}
+
+func (s *YieldStmt) String() string {
+	if s.Result != nil {
+		return "yield " + s.Result.String()
+	}
+	return "yield"
+}
@@ -2,8 +2,10 @@ package tengo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
+	"reflect"
 	"sync"
 
 	"github.com/tiagoj/tengo/v2/parser"
@@ -18,6 +20,9 @@ type Script struct {
 	maxConstObjects  int
 	enableFileImport bool
 	importDir        string
+	stackTrace       bool
+
+	disableConstantFolding bool
 }
 
 // NewScript creates a Script instance with an input script.
@@ -87,6 +92,21 @@ func (s *Script) EnableFileImport(enable bool) {
 	s.enableFileImport = enable
 }
 
+// EnableStackTrace enables or disables capturing the script call stack for
+// errors. When enabled, error values created by the script provide it
+// through Error.StackTrace, and runtime errors are returned as ErrRuntime.
+// It's disabled by default as it makes creating error values slower.
+func (s *Script) EnableStackTrace(enable bool) {
+	s.stackTrace = enable
+}
+
+// EnableConstantFolding enables or disables the evaluation of constant
+// arithmetic expressions at compile time. Constant folding is enabled by
+// default.
+func (s *Script) EnableConstantFolding(enable bool) {
+	s.disableConstantFolding = !enable
+}
+
 // Compile compiles the script with all the defined variables, and, returns
 // Compiled object.
 func (s *Script) Compile() (*Compiled, error) {
@@ -106,6 +126,7 @@ func (s *Script) Compile() (*Compiled, error) {
 	c := NewCompiler(srcFile, symbolTable, nil, s.modules, nil)
 	c.EnableFileImport(s.enableFileImport)
 	c.SetImportDir(s.importDir)
+	c.EnableConstantFolding(!s.disableConstantFolding)
 	if err := c.Compile(file); err != nil {
 		return nil, err
 	}
@@ -126,6 +147,15 @@ func (s *Script) Compile() (*Compiled, error) {
 	bytecode := c.Bytecode()
 	bytecode.RemoveDuplicates()
 
+	// tag the functions so that calls through an ExecutionContext of another
+	// script can be detected
+	bytecode.MainFunction.origin = bytecode
+	for _, cnst := range bytecode.Constants {
+		if fn, ok := cnst.(*CompiledFunction); ok {
+			fn.origin = bytecode
+		}
+	}
+
 	// check the constant objects limit
 	if s.maxConstObjects >= 0 {
 		cnt := bytecode.CountObjects()
@@ -136,8 +166,12 @@ func (s *Script) Compile() (*Compiled, error) {
 	return &Compiled{
 		globalIndexes: globalIndexes,
 		bytecode:      bytecode,
+		origin:        bytecode,
 		globals:       globals,
 		maxAllocs:     s.maxAllocs,
+		stackTrace:    s.stackTrace,
+		warnings:      c.Warnings(),
+		imports:       c.ImportedModules(),
 	}, nil
 }
 
@@ -197,8 +231,12 @@ func (s *Script) prepCompile() (
 type Compiled struct {
 	globalIndexes map[string]int // global symbol name to index
 	bytecode      *Bytecode
+	origin        *Bytecode // tags the functions of the program, shared by clones
 	globals       []Object
 	maxAllocs     int64
+	stackTrace    bool
+	warnings      []Warning
+	imports       []string
 	lock          sync.RWMutex
 }
 
@@ -208,6 +246,7 @@ func (c *Compiled) Run() error {
 	defer c.lock.Unlock()
 
 	v := NewVM(c.bytecode, c.globals, c.maxAllocs)
+	v.stackTrace = c.stackTrace
 	return v.Run()
 }
 
@@ -217,6 +256,7 @@ func (c *Compiled) RunContext(ctx context.Context) (err error) {
 	defer c.lock.Unlock()
 
 	v := NewVM(c.bytecode, c.globals, c.maxAllocs)
+	v.stackTrace = c.stackTrace
 	ch := make(chan error, 1)
 	go func() {
 		defer func() {
@@ -245,16 +285,25 @@ func (c *Compiled) RunContext(ctx context.Context) (err error) {
 }
 
 // Clone creates a new copy of Compiled. Cloned copies are safe for concurrent
-// use by multiple goroutines.
+// use by multiple goroutines. Each copy has its own globals and constants, so
+// that replacing a constant with SetConstant only affects one of them. The
+// instructions are immutable and shared. Functions of the program can be
+// called through the ExecutionContext of any copy.
 func (c *Compiled) Clone() *Compiled {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 
+	bytecode := *c.bytecode
+	bytecode.Constants = append([]Object(nil), c.bytecode.Constants...)
 	clone := &Compiled{
 		globalIndexes: c.globalIndexes,
-		bytecode:      c.bytecode,
+		bytecode:      &bytecode,
+		origin:        c.origin,
 		globals:       make([]Object, len(c.globals)),
 		maxAllocs:     c.maxAllocs,
+		stackTrace:    c.stackTrace,
+		warnings:      c.warnings,
+		imports:       c.imports,
 	}
 	// copy global objects
 	for idx, g := range c.globals {
@@ -265,6 +314,21 @@ func (c *Compiled) Clone() *Compiled {
 	return clone
 }
 
+// Warnings returns the non-fatal issues found while compiling the script and
+// the modules it imports, such as unused variables, in the order of their
+// positions. They don't prevent the script from running.
+func (c *Compiled) Warnings() []Warning {
+	return append([]Warning(nil), c.warnings...)
+}
+
+// ImportedModules returns the sorted names of the modules the script imports,
+// directly or through the modules it imports, as resolved by the compiler
+// from the modules set with Script.SetImports or from files. Hosts can check
+// them against the modules they permit before running the script.
+func (c *Compiled) ImportedModules() []string {
+	return append([]string(nil), c.imports...)
+}
+
 // IsDefined returns true if the variable name is defined (has value) before or
 // after the execution.
 func (c *Compiled) IsDefined(name string) bool {
@@ -319,6 +383,22 @@ func (c *Compiled) GetAll() []*Variable {
 	return vars
 }
 
+// GlobalNames returns the names of the global variables indexed by their slot
+// in Globals. Slots that are not bound to a name, such as those of variables
+// declared in blocks, are empty strings.
+func (c *Compiled) GlobalNames() []string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	names := make([]string, len(c.globals))
+	for name, idx := range c.globalIndexes {
+		if idx < len(names) {
+			names[idx] = name
+		}
+	}
+	return names
+}
+
 // Set replaces the value of a global variable identified by the name. An error
 // will be returned if the name was not defined during compilation.
 func (c *Compiled) Set(name string, value interface{}) error {
@@ -349,6 +429,37 @@ func (c *Compiled) Globals() []Object {
 	return result
 }
 
+// SetConstant replaces the constant at index idx of the constants returned by
+// Constants, e.g. to patch a string literal of the program for a tenant. The
+// value must have the same type as the constant it replaces, and constants
+// holding functions can't be replaced. The constants are replaced as a whole,
+// so execution contexts created from c beforehand, and clones of c, keep the
+// constants they had.
+func (c *Compiled) SetConstant(idx int, value Object) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	constants := c.bytecode.Constants
+	if idx < 0 || idx >= len(constants) {
+		return fmt.Errorf("constant index out of range: %d", idx)
+	}
+	if value == nil {
+		return errors.New("constant value is nil")
+	}
+	old := constants[idx]
+	if _, ok := old.(*CompiledFunction); ok {
+		return fmt.Errorf("constant %d is a function", idx)
+	}
+	if reflect.TypeOf(value) != reflect.TypeOf(old) {
+		return fmt.Errorf("constant %d is %s, not %s",
+			idx, old.TypeName(), value.TypeName())
+	}
+	constants = append([]Object(nil), constants...)
+	constants[idx] = value
+	c.bytecode.Constants = constants
+	return nil
+}
+
 // Constants returns the constants array from the compiled bytecode. This is useful for
 // passing constants to closures that need access to the script's constants.
 func (c *Compiled) Constants() []Object {
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -112,7 +114,7 @@ func TestScript_SetMaxConstObjects(t *testing.T) {
 	require.Equal(t, "exceeding constant objects limit: 1", err.Error())
 
 	// two constants '5' and '1'
-	s = tengo.NewScript([]byte(`a := 5 + 1`))
+	s = tengo.NewScript([]byte(`a := 5; b := a + 1`))
 	s.SetMaxConstObjects(2) // limit = 2
 	_, err = s.Compile()
 	require.NoError(t, err)
@@ -122,7 +124,7 @@ func TestScript_SetMaxConstObjects(t *testing.T) {
 	require.Equal(t, "exceeding constant objects limit: 2", err.Error())
 
 	// duplicates will be removed
-	s = tengo.NewScript([]byte(`a := 5 + 5`))
+	s = tengo.NewScript([]byte(`a := 5; b := a + 5`))
 	s.SetMaxConstObjects(1) // limit = 1
 	_, err = s.Compile()
 	require.NoError(t, err)
@@ -382,6 +384,26 @@ func BenchmarkArrayIndexCompare(b *testing.B) {
     `)
 }
 
+// BenchmarkSmallInts and BenchmarkLargeInts run the same loop; the ints of
+// the first one are interned, so it allocates less.
+func BenchmarkSmallInts(b *testing.B) {
+	b.ReportAllocs()
+	bench(b.N, `a := [];
+        for i := 0; i < 200; i++ {
+            a = append(a, i)
+        }
+    `)
+}
+
+func BenchmarkLargeInts(b *testing.B) {
+	b.ReportAllocs()
+	bench(b.N, `a := [];
+        for i := 1000; i < 1200; i++ {
+            a = append(a, i)
+        }
+    `)
+}
+
 func bench(n int, input string) {
 	s := tengo.NewScript([]byte(input))
 	c, err := s.Compile()
@@ -426,6 +448,35 @@ func TestCompiled_GetAll(t *testing.T) {
 	compiledGetAll(t, c, M{"a": "foo", "b": int64(5)})
 }
 
+func TestCompiled_GlobalNames(t *testing.T) {
+	c := compile(t, `
+a := 1
+if a > 0 {
+	tmp := 2
+	a = tmp
+}
+b := a + 1
+f := func() { local := 3; return local }
+`, M{"in": 5})
+	names := c.GlobalNames()
+	require.Equal(t, []string{"in", "a", "", "b", "f", ""}, names)
+	require.Equal(t, len(c.Globals()), len(names))
+	compiledRun(t, c)
+	require.Equal(t, int64(3), c.Globals()[3].(*tengo.Int).Value)
+
+	// names can be used to find the globals of an ExecutionContext
+	ctx := tengo.NewExecutionContext(c)
+	for i, name := range names {
+		if name != "" {
+			o, err := ctx.GlobalAt(i)
+			require.NoError(t, err)
+			require.Equal(t, c.Get(name).Object(), o)
+		}
+	}
+
+	require.Equal(t, []string{""}, compile(t, ``, nil).GlobalNames())
+}
+
 func TestCompiled_IsDefined(t *testing.T) {
 	c := compile(t, `a := 5`, nil)
 	compiledIsDefined(t, c, "a", false) // a is not defined before Run()
@@ -434,6 +485,81 @@ func TestCompiled_IsDefined(t *testing.T) {
 	compiledIsDefined(t, c, "b", false)
 }
 
+func TestCompiled_Warnings(t *testing.T) {
+	warnings := func(c *tengo.Compiled) []string {
+		var res []string
+		for _, w := range c.Warnings() {
+			res = append(res, fmt.Sprintf("%d:%d %s",
+				w.Pos.Line, w.Pos.Column, w.Message))
+		}
+		return res
+	}
+
+	// shadowed globals, by variables, parameters and block declarations
+	c := compile(t, `
+val := 1
+foo := func() { val := 2; return val }
+bar := func(val) { return val }
+if true { val := 3; val++ }
+global_val := val + foo() + bar(1)`, nil)
+	require.Equal(t, []string{
+		"3:17 'val' shadows a global variable",
+		"4:13 'val' shadows a global variable",
+		"5:11 'val' shadows a global variable",
+	}, warnings(c))
+	compiledRun(t, c)
+	compiledGet(t, c, "global_val", int64(4))
+
+	// unreachable code, reported once per block
+	c = compile(t, `
+f := func(x) {
+	for i := 0; i < x; i++ {
+		if i > 2 { break; x = 1 }
+		continue
+		x = 2
+	}
+	return x
+	x = 3
+	x = 4
+}
+out := f(5)`, nil)
+	require.Equal(t, []string{
+		"4:21 unreachable code",
+		"6:3 unreachable code",
+		"9:2 unreachable code",
+	}, warnings(c))
+	compiledRun(t, c)
+	compiledGet(t, c, "out", int64(5))
+
+	// local variables never read, including through closures
+	require.Equal(t, []string{
+		"3:2 unused variable 'a'",
+		"4:2 variable 'b' is assigned but never read",
+		"6:5 unused variable 'y'",
+		"8:6 unused variable 'k'",
+		"11:2 variable 'e' is assigned but never read",
+	}, warnings(compile(t, `
+f := func(unused) {
+	a := 1
+	b := 2
+	b = 3
+	x, y := [1, 2]
+	m := {}; m.k = x
+	for k, v in m { m.k = v }
+	c := 0; c++
+	d := 1; g := func() { return d }
+	e := 1; h := func() { e = 2 }
+	_ignored := 1
+	return [g, h]
+}
+global := 1`, nil)))
+
+	// no warnings, and they're kept by clones
+	require.Equal(t, 0, len(compile(t, `a := 1; f := func(x) { return a + x }`, nil).Warnings()))
+	c = compile(t, `f := func() { return; f() }`, nil)
+	require.Equal(t, []string{"1:23 unreachable code"}, warnings(c.Clone()))
+}
+
 func TestCompiled_Set(t *testing.T) {
 	c := compile(t, `a := b`, M{"b": "foo"})
 	compiledRun(t, c)
@@ -478,6 +604,27 @@ func TestCompiled_RunContext(t *testing.T) {
 	defer cancel()
 	err = c.RunContext(ctx)
 	require.Equal(t, context.DeadlineExceeded, err)
+
+	// timeout in callbacks of stdlib functions and in coroutines
+	for _, input := range []string{
+		`coroutine(func() { for true {} }).resume()`,
+		`for x in coroutine(func() { for true {} }) {}`,
+		`slices := import("slices"); slices.map([1], func(x) { for true {} })`,
+		`slices := import("slices")
+		slices.filter([1], func(x) { slices.map([1], func(y) { for true {} }) })`,
+	} {
+		s := tengo.NewScript([]byte(input))
+		s.SetImports(stdlib.GetModuleMap("slices"))
+		c, err = s.Compile()
+		require.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(),
+			10*time.Millisecond)
+		start := time.Now()
+		err = c.RunContext(ctx)
+		cancel()
+		require.Equal(t, context.DeadlineExceeded, err)
+		require.True(t, time.Since(start) < 5*time.Second)
+	}
 }
 
 func TestCompiled_CustomObject(t *testing.T) {
@@ -573,6 +720,75 @@ export func(ctx) {
 	require.True(t, strings.Contains(err.Error(), "expression:4:6"))
 }
 
+// moduleResolver is a ModuleGetter resolving the modules it doesn't have
+// with resolve.
+type moduleResolver struct {
+	*tengo.ModuleMap
+	resolve func(name string) tengo.Importable
+}
+
+func (r moduleResolver) Get(name string) tengo.Importable {
+	if mod := r.ModuleMap.Get(name); mod != nil {
+		return mod
+	}
+	return r.resolve(name)
+}
+
+func TestCompiled_ImportedModules(t *testing.T) {
+	s := tengo.NewScript([]byte(`
+fmt := import("fmt")
+text := import("text")
+text2 := import("text")
+greet := func(name) { return text.to_upper(name) }`))
+	s.SetImports(stdlib.GetModuleMap("fmt", "text", "times"))
+	c, err := s.Compile()
+	require.NoError(t, err)
+	require.Equal(t, []string{"fmt", "text"}, c.ImportedModules())
+	require.Equal(t, []string{"fmt", "text"}, c.Clone().ImportedModules())
+	ec := tengo.NewExecutionContext(c)
+	require.Equal(t, []string{"fmt", "text"}, ec.ImportedModules())
+	require.Equal(t, []string{"fmt", "text"}, ec.WithStackTrace(true).ImportedModules())
+
+	// modules from a dynamic resolver, and those imported by other modules
+	s = tengo.NewScript([]byte(`
+util := import("util")
+out := util.twice(2)`))
+	s.SetImports(moduleResolver{
+		ModuleMap: stdlib.GetModuleMap("math"),
+		resolve: func(name string) tengo.Importable {
+			if name != "util" {
+				return nil
+			}
+			return &tengo.SourceModule{Src: []byte(`
+math := import("math")
+export { twice: func(x) { return math.abs(x) * 2 } }`)}
+		},
+	})
+	c, err = s.Compile()
+	require.NoError(t, err)
+	require.Equal(t, []string{"math", "util"}, c.ImportedModules())
+	compiledRun(t, c)
+	compiledGet(t, c, "out", 4.0)
+
+	// modules loaded from files, by the name they're imported with
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib.tengo"),
+		[]byte(`export func() { return 1 }`), 0644))
+	s = tengo.NewScript([]byte(`lib := import("./lib"); out := lib()`))
+	s.EnableFileImport(true)
+	require.NoError(t, s.SetImportDir(dir))
+	c, err = s.Compile()
+	require.NoError(t, err)
+	require.Equal(t, []string{"./lib"}, c.ImportedModules())
+
+	// the returned names are a copy
+	c.ImportedModules()[0] = "other"
+	require.Equal(t, []string{"./lib"}, c.ImportedModules())
+
+	// no imports
+	require.Equal(t, 0, len(compile(t, `a := 1`, nil).ImportedModules()))
+}
+
 func compile(t *testing.T, input string, vars M) *tengo.Compiled {
 	s := tengo.NewScript([]byte(input))
 	for vn, vv := range vars {
@@ -665,3 +881,64 @@ data["b"] = 2
 	require.Equal(t, 1001, clone.Get("count").Int())
 	require.Equal(t, 2, len(clone.Get("data").Map()))
 }
+
+func TestCompiled_SetConstant(t *testing.T) {
+	compiled := compile(t, `
+greet := func(name) { return "hello, " + name }
+greeting := greet("world")`, nil)
+	compiledRun(t, compiled)
+	idx := -1
+	for i, c := range compiled.Constants() {
+		if s, ok := c.(*tengo.String); ok && s.Value == "hello, " {
+			idx = i
+		}
+	}
+	require.True(t, idx >= 0)
+	greet := func(c *tengo.Compiled, fn *tengo.CompiledFunction) string {
+		res, err := tengo.NewExecutionContext(c).Call(fn,
+			&tengo.String{Value: "ann"})
+		require.NoError(t, err)
+		return res.(*tengo.String).Value
+	}
+	fn := compiled.Get("greet").Value().(*tengo.CompiledFunction)
+	before := tengo.NewExecutionContext(compiled)
+
+	// patching a clone leaves the original and the other clones alone
+	tenantA, tenantB := compiled.Clone(), compiled.Clone()
+	require.NoError(t, tenantA.SetConstant(idx, &tengo.String{Value: "hola, "}))
+	require.Equal(t, "hola, ann", greet(tenantA, fn))
+	require.Equal(t, "hello, ann", greet(tenantB, fn))
+	require.Equal(t, "hello, ann", greet(compiled, fn))
+	require.Equal(t, &tengo.String{Value: "hello, "}, compiled.Constants()[idx])
+
+	// the main function of the clone runs with its constants too
+	compiledRun(t, tenantA)
+	compiledGet(t, tenantA, "greeting", "hola, world")
+	compiledRun(t, tenantB)
+	compiledGet(t, tenantB, "greeting", "hello, world")
+
+	// clones of a patched clone keep the patch until patched again
+	nested := tenantA.Clone()
+	require.NoError(t, nested.SetConstant(idx, &tengo.String{Value: "hi, "}))
+	require.Equal(t, "hi, ann", greet(nested, fn))
+	require.Equal(t, "hola, ann", greet(tenantA, fn))
+	require.Equal(t, "hola, ann", greet(tenantA.Clone(), fn))
+
+	// contexts created before the patch keep the constants they had
+	require.NoError(t, compiled.SetConstant(idx, &tengo.String{Value: "hey, "}))
+	res, err := before.Call(fn, &tengo.String{Value: "ann"})
+	require.NoError(t, err)
+	require.Equal(t, &tengo.String{Value: "hello, ann"}, res)
+	require.Equal(t, "hey, ann", greet(compiled, fn))
+
+	require.Error(t, compiled.SetConstant(-1, &tengo.String{}))
+	require.Error(t, compiled.SetConstant(len(compiled.Constants()),
+		&tengo.String{}))
+	require.Error(t, compiled.SetConstant(idx, nil))
+	require.Error(t, compiled.SetConstant(idx, &tengo.Int{Value: 1}))
+	for i, c := range compiled.Constants() {
+		if _, ok := c.(*tengo.CompiledFunction); ok {
+			require.Error(t, compiled.SetConstant(i, c))
+		}
+	}
+}
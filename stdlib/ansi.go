@@ -0,0 +1,66 @@
+package stdlib
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+// ANSIDisabled makes the color functions of the "ansi" module return their
+// input unchanged, e.g. when the output is not a terminal. It's not
+// recommended to change this value while any VM is executing.
+var ANSIDisabled = false
+
+var ansiModule = map[string]tengo.Object{
+	"red": &tengo.UserFunction{
+		Name:  "red",
+		Value: FuncASRS(func(s string) string { return ansiWrap(s, 31) }),
+	}, // red(s) => string
+	"green": &tengo.UserFunction{
+		Name:  "green",
+		Value: FuncASRS(func(s string) string { return ansiWrap(s, 32) }),
+	}, // green(s) => string
+	"bold": &tengo.UserFunction{
+		Name:  "bold",
+		Value: FuncASRS(func(s string) string { return ansiWrap(s, 1) }),
+	}, // bold(s) => string
+	"color": &tengo.UserFunction{
+		Name:  "color",
+		Value: FuncASIRS(ansiWrap),
+	}, // color(s, code) => string
+	"strip": &tengo.UserFunction{
+		Name:  "strip",
+		Value: FuncASRS(ansiStrip),
+	}, // strip(s) => string
+}
+
+// ansiWrap wraps s in the SGR sequence with the given code and a reset
+// sequence.
+func ansiWrap(s string, code int) string {
+	if ANSIDisabled {
+		return s
+	}
+	return "\x1b[" + strconv.Itoa(code) + "m" + s + "\x1b[0m"
+}
+
+// ansiStrip removes all SGR sequences ("ESC [ params m") from s. Other
+// characters, including incomplete or non-SGR escape sequences, are kept.
+func ansiStrip(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] == '\x1b' && i+1 < len(s) && s[i+1] == '[' {
+			j := i + 2
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == ';') {
+				j++
+			}
+			if j < len(s) && s[j] == 'm' {
+				i = j + 1
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+		i++
+	}
+	return sb.String()
+}
@@ -0,0 +1,31 @@
+package stdlib_test
+
+import (
+	"testing"
+
+	"github.com/tiagoj/tengo/v2/stdlib"
+)
+
+func TestANSI(t *testing.T) {
+	module(t, "ansi").call("red", "x").expect("\x1b[31mx\x1b[0m")
+	module(t, "ansi").call("green", "ok").expect("\x1b[32mok\x1b[0m")
+	module(t, "ansi").call("bold", "").expect("\x1b[1m\x1b[0m")
+	module(t, "ansi").call("color", "x", 35).expect("\x1b[35mx\x1b[0m")
+	module(t, "ansi").call("red").expectError()
+	module(t, "ansi").call("color", "x", "y").expectError()
+
+	module(t, "ansi").call("strip", "plain").expect("plain")
+	module(t, "ansi").call("strip", "\x1b[1;31mab\x1b[0mc\x1b[m").expect("abc")
+	module(t, "ansi").call("strip", "\x1b[2Jx\x1b[31").expect("\x1b[2Jx\x1b[31")
+	module(t, "ansi").call("strip", "\x1b").expect("\x1b")
+
+	expect(t, `
+ansi := import("ansi")
+out := ansi.strip(ansi.red("x")) == "x" && ansi.strip(ansi.bold(ansi.color("y", 4))) == "y"
+`, true)
+
+	stdlib.ANSIDisabled = true
+	defer func() { stdlib.ANSIDisabled = false }()
+	module(t, "ansi").call("red", "x").expect("x")
+	module(t, "ansi").call("color", "x", 35).expect("x")
+}
@@ -0,0 +1,80 @@
+package stdlib
+
+import (
+	"math/bits"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+var bitsModule = map[string]tengo.Object{
+	"count_ones": &tengo.UserFunction{
+		Name:  "count_ones",
+		Value: FuncAI64RI64(bitsCountOnes),
+	}, // count_ones(n) => int
+	"leading_zeros": &tengo.UserFunction{
+		Name:  "leading_zeros",
+		Value: FuncAI64RI64(bitsLeadingZeros),
+	}, // leading_zeros(n) => int
+	"trailing_zeros": &tengo.UserFunction{
+		Name:  "trailing_zeros",
+		Value: FuncAI64RI64(bitsTrailingZeros),
+	}, // trailing_zeros(n) => int
+	"reverse": &tengo.UserFunction{
+		Name:  "reverse",
+		Value: FuncAI64RI64(bitsReverse),
+	}, // reverse(n) => int
+	"rotate_left": &tengo.UserFunction{
+		Name:  "rotate_left",
+		Value: bitsRotateLeft,
+	}, // rotate_left(n, k) => int
+}
+
+// The functions below operate on the 64-bit two's complement representation
+// of n, i.e. n is reinterpreted as uint64.
+
+func bitsCountOnes(n int64) int64 {
+	return int64(bits.OnesCount64(uint64(n)))
+}
+
+func bitsLeadingZeros(n int64) int64 {
+	return int64(bits.LeadingZeros64(uint64(n)))
+}
+
+func bitsTrailingZeros(n int64) int64 {
+	return int64(bits.TrailingZeros64(uint64(n)))
+}
+
+func bitsReverse(n int64) int64 {
+	return int64(bits.Reverse64(uint64(n)))
+}
+
+func bitsRotateLeft(args ...tengo.Object) (ret tengo.Object, err error) {
+	if len(args) != 2 {
+		err = tengo.ErrWrongNumArguments
+		return
+	}
+
+	i1, ok := tengo.ToInt64(args[0])
+	if !ok {
+		err = tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "int(compatible)",
+			Found:    args[0].TypeName(),
+		}
+		return
+	}
+
+	i2, ok := tengo.ToInt(args[1])
+	if !ok {
+		err = tengo.ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "int(compatible)",
+			Found:    args[1].TypeName(),
+		}
+		return
+	}
+
+	ret = &tengo.Int{Value: int64(bits.RotateLeft64(uint64(i1), i2))}
+
+	return
+}
@@ -0,0 +1,39 @@
+package stdlib_test
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBits(t *testing.T) {
+	module(t, "bits").call("count_ones", 7).expect(3)
+	module(t, "bits").call("count_ones", 0).expect(0)
+	module(t, "bits").call("count_ones", 0xff00).expect(8)
+	module(t, "bits").call("count_ones", -1).expect(64)
+	module(t, "bits").call("count_ones", int64(math.MinInt64)).expect(1)
+	module(t, "bits").call("count_ones", "x").expectError()
+	module(t, "bits").call("count_ones").expectError()
+
+	module(t, "bits").call("leading_zeros", 1).expect(63)
+	module(t, "bits").call("leading_zeros", 0).expect(64)
+	module(t, "bits").call("leading_zeros", 256).expect(55)
+	module(t, "bits").call("leading_zeros", -1).expect(0)
+
+	module(t, "bits").call("trailing_zeros", 8).expect(3)
+	module(t, "bits").call("trailing_zeros", 0).expect(64)
+	module(t, "bits").call("trailing_zeros", -4).expect(2)
+	module(t, "bits").call("trailing_zeros", int64(math.MinInt64)).expect(63)
+
+	module(t, "bits").call("reverse", 1).expect(int64(math.MinInt64))
+	module(t, "bits").call("reverse", int64(math.MinInt64)).expect(1)
+	module(t, "bits").call("reverse", -1).expect(-1)
+	module(t, "bits").call("reverse", 0).expect(0)
+
+	module(t, "bits").call("rotate_left", 1, 1).expect(2)
+	module(t, "bits").call("rotate_left", 3, 64).expect(3)
+	module(t, "bits").call("rotate_left", int64(math.MinInt64), 1).expect(1)
+	module(t, "bits").call("rotate_left", 1, -1).expect(int64(math.MinInt64))
+	module(t, "bits").call("rotate_left", -2, 4).expect(-17)
+	module(t, "bits").call("rotate_left", 1).expectError()
+	module(t, "bits").call("rotate_left", 1, "x").expectError()
+}
@@ -6,13 +6,27 @@ import (
 
 // BuiltinModules are builtin type standard library modules.
 var BuiltinModules = map[string]map[string]tengo.Object{
-	"math":   mathModule,
-	"os":     osModule,
-	"text":   textModule,
-	"times":  timesModule,
-	"rand":   randModule,
-	"fmt":    fmtModule,
-	"json":   jsonModule,
-	"base64": base64Module,
-	"hex":    hexModule,
+	"math":     mathModule,
+	"os":       osModule,
+	"text":     textModule,
+	"times":    timesModule,
+	"rand":     randModule,
+	"fmt":      fmtModule,
+	"json":     jsonModule,
+	"base64":   base64Module,
+	"hex":      hexModule,
+	"path":     pathModule,
+	"numbers":  numbersModule,
+	"slices":   slicesModule,
+	"bits":     bitsModule,
+	"ansi":     ansiModule,
+	"validate": validateModule,
+	"compress": compressModule,
+	"ip":       ipModule,
+	"uuid":     uuidModule,
+	"html":     htmlModule,
+	"cron":     cronModule,
+	"diff":     diffModule,
+	"semver":   semverModule,
+	"encoding": encodingModule,
 }
@@ -0,0 +1,119 @@
+package stdlib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+// CompressMaxSize limits the size of the data produced by the decompression
+// functions of the "compress" module, which fail with tengo.ErrBytesLimit
+// once the limit is exceeded. This protects the host against decompression
+// bombs. If it's not greater than 0, tengo.MaxBytesLen is used. It's not
+// recommended to change this value while any VM is executing.
+var CompressMaxSize = 0
+
+var compressModule = map[string]tengo.Object{
+	"gzip": &tengo.UserFunction{
+		Name:  "gzip",
+		Value: compressFunc(compressGzip),
+	}, // gzip(bytes) => bytes
+	"gunzip": &tengo.UserFunction{
+		Name:  "gunzip",
+		Value: decompressFunc(decompressGzip),
+	}, // gunzip(bytes) => bytes/error
+	"zlib": &tengo.UserFunction{
+		Name:  "zlib",
+		Value: compressFunc(compressZlib),
+	}, // zlib(bytes) => bytes
+	"unzlib": &tengo.UserFunction{
+		Name:  "unzlib",
+		Value: decompressFunc(zlib.NewReader),
+	}, // unzlib(bytes) => bytes/error
+}
+
+// compressFunc transforms a function compressing a byte slice into a
+// CallableFunc that accepts bytes or a string.
+func compressFunc(fn func([]byte) []byte) tengo.CallableFunc {
+	return func(args ...tengo.Object) (tengo.Object, error) {
+		if len(args) != 1 {
+			return nil, tengo.ErrWrongNumArguments
+		}
+		data, ok := tengo.ToByteSlice(args[0])
+		if !ok {
+			return nil, tengo.ErrInvalidArgumentType{
+				Name:     "first",
+				Expected: "bytes(compatible)",
+				Found:    args[0].TypeName(),
+			}
+		}
+		res := fn(data)
+		if len(res) > tengo.MaxBytesLen {
+			return nil, tengo.ErrBytesLimit
+		}
+		return &tengo.Bytes{Value: res}, nil
+	}
+}
+
+// decompressFunc transforms a function returning a reader of the
+// decompressed data into a CallableFunc that accepts bytes or a string.
+// Corrupt data results in an error object.
+func decompressFunc(
+	fn func(io.Reader) (io.ReadCloser, error),
+) tengo.CallableFunc {
+	return func(args ...tengo.Object) (tengo.Object, error) {
+		if len(args) != 1 {
+			return nil, tengo.ErrWrongNumArguments
+		}
+		data, ok := tengo.ToByteSlice(args[0])
+		if !ok {
+			return nil, tengo.ErrInvalidArgumentType{
+				Name:     "first",
+				Expected: "bytes(compatible)",
+				Found:    args[0].TypeName(),
+			}
+		}
+		r, err := fn(bytes.NewReader(data))
+		if err != nil {
+			return wrapError(err), nil
+		}
+		defer r.Close()
+
+		limit := tengo.MaxBytesLen
+		if CompressMaxSize > 0 && CompressMaxSize < limit {
+			limit = CompressMaxSize
+		}
+		// read one byte more than allowed to detect oversized data
+		res, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+		if err != nil {
+			return wrapError(err), nil
+		}
+		if len(res) > limit {
+			return nil, tengo.ErrBytesLimit
+		}
+		return &tengo.Bytes{Value: res}, nil
+	}
+}
+
+func compressGzip(data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, _ = w.Write(data) // writes to a bytes.Buffer don't fail
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+func compressZlib(data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, _ = w.Write(data)
+	_ = w.Close()
+	return buf.Bytes()
+}
+
+func decompressGzip(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
@@ -0,0 +1,69 @@
+package stdlib_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tiagoj/tengo/v2"
+	"github.com/tiagoj/tengo/v2/require"
+	"github.com/tiagoj/tengo/v2/stdlib"
+)
+
+func TestCompress(t *testing.T) {
+	data := bytes.Repeat([]byte("tengo "), 100)
+	for _, pair := range [][2]string{{"gzip", "gunzip"}, {"zlib", "unzlib"}} {
+		res := module(t, "compress").call(pair[0], data)
+		require.NoError(t, res.e)
+		compressed := res.o.(*tengo.Bytes).Value
+		require.True(t, len(compressed) < len(data))
+		module(t, "compress").call(pair[1], compressed).expect(data)
+
+		// strings are accepted as input
+		res = module(t, "compress").call(pair[0], "hello")
+		require.NoError(t, res.e)
+		module(t, "compress").call(pair[1], res.o).expect([]byte("hello"))
+		res = module(t, "compress").call(pair[0], []byte{})
+		require.NoError(t, res.e)
+		module(t, "compress").call(pair[1], res.o).expect([]byte{})
+
+		// corrupt data results in an error object
+		res = module(t, "compress").call(pair[1], []byte("not compressed"))
+		require.NoError(t, res.e)
+		_, isError := res.o.(*tengo.Error)
+		require.True(t, isError)
+		res = module(t, "compress").call(pair[1], compressed[:len(compressed)/2])
+		require.NoError(t, res.e)
+		_, isError = res.o.(*tengo.Error)
+		require.True(t, isError)
+
+		module(t, "compress").call(pair[0]).expectError()
+		module(t, "compress").call(pair[0], 1).expectError()
+		module(t, "compress").call(pair[1], 1).expectError()
+	}
+
+	expect(t, `
+compress := import("compress")
+out := string(compress.gunzip(compress.gzip("abc"))) + string(compress.unzlib(compress.zlib("def")))
+`, "abcdef")
+}
+
+func TestCompressMaxSize(t *testing.T) {
+	bomb := make([]byte, 1<<20)
+	for _, pair := range [][2]string{{"gzip", "gunzip"}, {"zlib", "unzlib"}} {
+		res := module(t, "compress").call(pair[0], bomb)
+		require.NoError(t, res.e)
+		compressed := res.o
+
+		func() {
+			stdlib.CompressMaxSize = 1 << 10
+			defer func() { stdlib.CompressMaxSize = 0 }()
+			res = module(t, "compress").call(pair[1], compressed)
+			require.Equal(t, tengo.ErrBytesLimit, res.e)
+			module(t, "compress").call(pair[1],
+				module(t, "compress").call(pair[0], bomb[:1<<10]).o).
+				expect(bomb[:1<<10])
+		}()
+
+		module(t, "compress").call(pair[1], compressed).expect(bomb)
+	}
+}
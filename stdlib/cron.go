@@ -0,0 +1,338 @@
+package stdlib
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+var cronModule = map[string]tengo.Object{
+	"parse": &tengo.UserFunction{
+		Name:  "parse",
+		Value: cronParse,
+	}, // parse(expr) => bool
+	"next": &tengo.UserFunction{
+		Name:  "next",
+		Value: cronNext,
+	}, // next(expr, from_unix) => int/error
+	"describe": &tengo.UserFunction{
+		Name:  "describe",
+		Value: FuncASRSE(cronDescribe),
+	}, // describe(expr) => string/error
+}
+
+// cronField describes a field of a cron expression.
+type cronField struct {
+	name     string // singular, e.g. "minute"
+	min, max int
+	names    []string // names of the values from min, e.g. month names
+}
+
+var (
+	cronSecond = cronField{name: "second", max: 59}
+	cronMinute = cronField{name: "minute", max: 59}
+	cronHour   = cronField{name: "hour", max: 23}
+	cronDom    = cronField{name: "day of month", min: 1, max: 31}
+	cronMonth  = cronField{name: "month", min: 1, max: 12, names: []string{
+		"JAN", "FEB", "MAR", "APR", "MAY", "JUN",
+		"JUL", "AUG", "SEP", "OCT", "NOV", "DEC",
+	}}
+	// 7 is an alias of 0, Sunday
+	cronDow = cronField{name: "day of week", max: 7, names: []string{
+		"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT",
+	}}
+)
+
+// cronDescriptors are the expressions the "@" shortcuts stand for.
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronSchedule is a parsed cron expression. Each field is a set of values,
+// bit i being set if value i matches.
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+	// the day of month or the day of week is restricted, i.e. not "*" or
+	// "?". If both are, a day matches if either matches.
+	domRestricted, dowRestricted bool
+	fields                       []string
+	seconds                      bool // the expression has a seconds field
+}
+
+// parseCron parses a cron expression of 5 fields (minute, hour, day of
+// month, month and day of week), of 6 fields, with seconds first, or one of
+// the "@" shortcuts.
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "@") {
+		spec, ok := cronDescriptors[strings.ToLower(expr)]
+		if !ok {
+			return nil, fmt.Errorf("unknown cron descriptor: %s", expr)
+		}
+		expr = spec
+	}
+	fields := strings.Fields(expr)
+	s := &cronSchedule{fields: fields}
+	switch len(fields) {
+	case 5:
+		s.second = 1
+	case 6:
+		s.seconds = true
+		second, err := parseCronField(fields[0], cronSecond)
+		if err != nil {
+			return nil, err
+		}
+		s.second = second
+		fields = fields[1:]
+	default:
+		return nil, fmt.Errorf(
+			"invalid cron expression: expected 5 or 6 fields, found %d",
+			len(fields))
+	}
+	var err error
+	if s.minute, err = parseCronField(fields[0], cronMinute); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseCronField(fields[1], cronHour); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseCronField(fields[2], cronDom); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseCronField(fields[3], cronMonth); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseCronField(fields[4], cronDow); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domRestricted = fields[2] != "*" && fields[2] != "?"
+	s.dowRestricted = fields[4] != "*" && fields[4] != "?"
+	return s, nil
+}
+
+// parseCronField parses a comma-separated list of values, ranges ("a-b") and
+// steps ("*/n", "a-b/n" or "a/n") of the given field.
+func parseCronField(s string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		rng, step := part, 1
+		i := strings.IndexByte(part, '/')
+		if i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in cron %s field: %s",
+					f.name, part)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*" || rng == "?" && (f.is(cronDom) || f.is(cronDow)):
+			if f.is(cronDow) {
+				hi = 6
+			}
+		default:
+			var err error
+			bounds := strings.SplitN(rng, "-", 2)
+			if lo, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = f.value(bounds[1]); err != nil {
+					return 0, err
+				}
+			} else if i >= 0 {
+				// "a/n" runs from a to the maximum
+				hi = f.max
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range in cron %s field: %s",
+					f.name, part)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// is returns true if f and g are the same field.
+func (f cronField) is(g cronField) bool {
+	return f.name == g.name
+}
+
+// value parses a value of the field, a number or a name.
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid value in cron %s field: %s", f.name, s)
+	}
+	return v, nil
+}
+
+// dayMatches returns true if the day of t matches the schedule.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// next returns the first time after t, in UTC, matching the schedule. It
+// gives up after 5 years, e.g. for February 30.
+func (s *cronSchedule) next(t time.Time) (time.Time, error) {
+	t = t.UTC().Truncate(time.Second).Add(time.Second)
+	limit := t.Year() + 5
+
+wrap:
+	if t.Year() > limit {
+		return time.Time{}, errors.New("cron expression has no next time")
+	}
+	for s.month&(1<<uint(t.Month())) == 0 {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+	for !s.dayMatches(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+	for s.hour&(1<<uint(t.Hour())) == 0 {
+		t = t.Truncate(time.Hour).Add(time.Hour)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+	for s.minute&(1<<uint(t.Minute())) == 0 {
+		t = t.Truncate(time.Minute).Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+	for s.second&(1<<uint(t.Second())) == 0 {
+		t = t.Add(time.Second)
+		if t.Second() == 0 {
+			goto wrap
+		}
+	}
+	return t, nil
+}
+
+func cronParse(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	expr, ok := tengo.ToString(args[0])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string(compatible)",
+			Found:    args[0].TypeName(),
+		}
+	}
+	if _, err := parseCron(expr); err != nil {
+		return tengo.FalseValue, nil
+	}
+	return tengo.TrueValue, nil
+}
+
+func cronNext(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	expr, ok := tengo.ToString(args[0])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string(compatible)",
+			Found:    args[0].TypeName(),
+		}
+	}
+	from, ok := tengo.ToInt64(args[1])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "int(compatible)",
+			Found:    args[1].TypeName(),
+		}
+	}
+	s, err := parseCron(expr)
+	if err != nil {
+		return wrapError(err), nil
+	}
+	next, err := s.next(time.Unix(from, 0))
+	if err != nil {
+		return wrapError(err), nil
+	}
+	return &tengo.Int{Value: next.Unix()}, nil
+}
+
+// cronDescribe returns a short English description of a cron expression,
+// e.g. "every 15 minutes, at hour 9-17, on day of week MON-FRI".
+func cronDescribe(expr string) (string, error) {
+	s, err := parseCron(expr)
+	if err != nil {
+		return "", err
+	}
+	fields := s.fields
+	all := []cronField{cronMinute, cronHour, cronDom, cronMonth, cronDow}
+	if s.seconds {
+		all = append([]cronField{cronSecond}, all...)
+	}
+	var parts []string
+	for i, f := range all {
+		field := strings.ToUpper(fields[i])
+		switch {
+		case field == "*" || field == "?":
+			continue
+		case strings.HasPrefix(field, "*/"):
+			n := field[2:]
+			if n == "1" {
+				parts = append(parts, "every "+f.name)
+			} else {
+				parts = append(parts, "every "+n+" "+f.name+"s")
+			}
+		default:
+			prep := "at"
+			switch {
+			case f.is(cronDom) || f.is(cronDow):
+				prep = "on"
+			case f.is(cronMonth):
+				prep = "in"
+			}
+			parts = append(parts, prep+" "+f.name+" "+field)
+		}
+	}
+	if len(parts) == 0 {
+		if s.seconds {
+			return "every second", nil
+		}
+		return "every minute", nil
+	}
+	return strings.Join(parts, ", "), nil
+}
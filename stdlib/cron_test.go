@@ -0,0 +1,90 @@
+package stdlib_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+func TestCronParse(t *testing.T) {
+	for _, expr := range []string{
+		"* * * * *", "0 * * * *", "*/15 9-17 * * MON-FRI", "0 0 1,15 * ?",
+		"30 2 * JAN-MAR,dec 0-7", "5/10 * * * *", "0 0 12 * * *",
+		"*/5 * * * * *", "@hourly", "@Daily", "  0  0 * * 0 ",
+	} {
+		module(t, "cron").call("parse", expr).expect(true)
+	}
+	for _, expr := range []string{
+		"", "* * * *", "* * * * * * *", "60 * * * *", "* 24 * * *",
+		"* * 0 * *", "* * * 13 * ", "* * * * 8", "*/0 * * * *", "5-1 * * * *",
+		"? * * * *", "a * * * *", "1- * * * *", "@every 5m", "* * * FOO *",
+	} {
+		module(t, "cron").call("parse", expr).expect(false)
+	}
+	module(t, "cron").call("parse").expectError()
+}
+
+func TestCronNext(t *testing.T) {
+	unix := func(year int, month time.Month, day, hour, min, sec int) int64 {
+		return time.Date(year, month, day, hour, min, sec, 0, time.UTC).Unix()
+	}
+	next := func(expr string, from, expected int64) {
+		module(t, "cron").call("next", expr, from).expect(expected)
+	}
+	from := unix(2023, time.November, 14, 22, 13, 20) // a Tuesday
+
+	// the next hour, strictly after the given time
+	next("0 * * * *", from, unix(2023, time.November, 14, 23, 0, 0))
+	next("0 * * * *", unix(2023, time.November, 14, 23, 0, 0),
+		unix(2023, time.November, 15, 0, 0, 0))
+	next("0 * * * *", unix(2023, time.December, 31, 23, 30, 0),
+		unix(2024, time.January, 1, 0, 0, 0))
+
+	// 5 fields
+	next("* * * * *", from, unix(2023, time.November, 14, 22, 14, 0))
+	next("*/15 9-17 * * MON-FRI", from, unix(2023, time.November, 15, 9, 0, 0))
+	next("30 2 1 * *", from, unix(2023, time.December, 1, 2, 30, 0))
+	next("0 0 29 2 *", from, unix(2024, time.February, 29, 0, 0, 0))
+	next("0 12 * * 7", from, unix(2023, time.November, 19, 12, 0, 0))
+	next("@yearly", from, unix(2024, time.January, 1, 0, 0, 0))
+	// day of month or day of week when both are restricted
+	next("0 0 20 * MON", from, unix(2023, time.November, 20, 0, 0, 0))
+	next("0 0 16 * MON", from, unix(2023, time.November, 16, 0, 0, 0))
+
+	// 6 fields, with seconds
+	next("*/30 * * * * *", from, unix(2023, time.November, 14, 22, 13, 30))
+	next("0 0 12 * * *", from, unix(2023, time.November, 15, 12, 0, 0))
+	next("15 10 22 14 11 *", from, unix(2024, time.November, 14, 22, 10, 15))
+
+	// invalid and impossible expressions
+	module(t, "cron").call("next", "61 * * * *", from).
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "invalid value in cron minute field: 61"}})
+	module(t, "cron").call("next", "* * *", from).
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "invalid cron expression: expected 5 or 6 fields, found 3"}})
+	module(t, "cron").call("next", "0 0 30 2 *", from).
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "cron expression has no next time"}})
+	module(t, "cron").call("next", "* * * * *").expectError()
+	module(t, "cron").call("next", "* * * * *", "x").expectError()
+}
+
+func TestCronDescribe(t *testing.T) {
+	describe := func(expr, expected string) {
+		module(t, "cron").call("describe", expr).expect(expected)
+	}
+	describe("0 * * * *", "at minute 0")
+	describe("* * * * *", "every minute")
+	describe("* * * * * *", "every second")
+	describe("*/15 9-17 * * mon-fri",
+		"every 15 minutes, at hour 9-17, on day of week MON-FRI")
+	describe("*/1 0 1,15 JAN ?",
+		"every minute, at hour 0, on day of month 1,15, in month JAN")
+	describe("30 0 12 * * *", "at second 30, at minute 0, at hour 12")
+	describe("@weekly", "at minute 0, at hour 0, on day of week 0")
+	module(t, "cron").call("describe", "* * *").
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "invalid cron expression: expected 5 or 6 fields, found 3"}})
+}
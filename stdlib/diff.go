@@ -0,0 +1,181 @@
+package stdlib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+// DiffMaxSize limits the product of the lengths of the sequences compared by
+// the functions of the "diff" module, once their common prefix and suffix are
+// left out, as the comparison takes time and memory proportional to it. The
+// functions return an error once the limit is exceeded.
+var DiffMaxSize = 1 << 22
+
+var diffModule = map[string]tengo.Object{
+	"lines": &tengo.UserFunction{
+		Name:  "lines",
+		Value: diffLines,
+	}, // lines(a, b) => [map]/error
+	"arrays": &tengo.UserFunction{
+		Name:  "arrays",
+		Value: diffArrays,
+	}, // arrays(a, b) => [map]/error
+}
+
+// diffEdit is an edit of a diff: the element i of the first sequence is kept
+// ("eq") or deleted ("del"), or the element i of the second one is added
+// ("add").
+type diffEdit struct {
+	op string
+	i  int
+}
+
+// diffSequences returns the edits turning a sequence of n elements into a
+// sequence of m elements, eq comparing their elements, based on their longest
+// common subsequence. Deletions come before the additions they're replaced
+// with.
+func diffSequences(n, m int, eq func(i, j int) bool) ([]diffEdit, error) {
+	var prefix, suffix int
+	for prefix < n && prefix < m && eq(prefix, prefix) {
+		prefix++
+	}
+	for suffix < n-prefix && suffix < m-prefix &&
+		eq(n-1-suffix, m-1-suffix) {
+		suffix++
+	}
+	rows, cols := n-prefix-suffix, m-prefix-suffix
+	if rows > 0 && cols > 0 && rows > DiffMaxSize/cols {
+		return nil, fmt.Errorf(
+			"inputs too large to compare: %d and %d elements differ",
+			rows, cols)
+	}
+
+	// lcs[i*(cols+1)+j] is the length of the longest common subsequence of
+	// the elements from prefix+i and prefix+j
+	lcs := make([]int32, (rows+1)*(cols+1))
+	for i := rows - 1; i >= 0; i-- {
+		for j := cols - 1; j >= 0; j-- {
+			k := i*(cols+1) + j
+			if eq(prefix+i, prefix+j) {
+				lcs[k] = lcs[k+cols+2] + 1
+			} else if lcs[k+cols+1] >= lcs[k+1] {
+				lcs[k] = lcs[k+cols+1]
+			} else {
+				lcs[k] = lcs[k+1]
+			}
+		}
+	}
+
+	edits := make([]diffEdit, 0, n+m-prefix-suffix)
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, diffEdit{op: "eq", i: i})
+	}
+	i, j := 0, 0
+	for i < rows || j < cols {
+		k := i*(cols+1) + j
+		switch {
+		case i < rows && j < cols && eq(prefix+i, prefix+j):
+			edits = append(edits, diffEdit{op: "eq", i: prefix + i})
+			i++
+			j++
+		case j == cols || i < rows && lcs[k+cols+1] >= lcs[k+1]:
+			edits = append(edits, diffEdit{op: "del", i: prefix + i})
+			i++
+		default:
+			edits = append(edits, diffEdit{op: "add", i: prefix + j})
+			j++
+		}
+	}
+	for i := n - suffix; i < n; i++ {
+		edits = append(edits, diffEdit{op: "eq", i: i})
+	}
+	return edits, nil
+}
+
+// diffEntries returns the entries of a diff, with the given key set to the
+// elements of a or b.
+func diffEntries(edits []diffEdit, key string, a, b []tengo.Object) tengo.Object {
+	entries := make([]tengo.Object, len(edits))
+	for k, e := range edits {
+		elem := a
+		if e.op == "add" {
+			elem = b
+		}
+		entries[k] = &tengo.ImmutableMap{Value: map[string]tengo.Object{
+			"op": &tengo.String{Value: e.op},
+			key:  elem[e.i],
+		}}
+	}
+	return &tengo.Array{Value: entries}
+}
+
+// splitLines splits s into lines, a trailing newline not starting another
+// line.
+func splitLines(s string) []tengo.Object {
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	lines := make([]tengo.Object, len(parts))
+	for i, p := range parts {
+		lines[i] = &tengo.String{Value: p}
+	}
+	return lines
+}
+
+func diffLines(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	var lines [2][]tengo.Object
+	for k, name := range []string{"first", "second"} {
+		s, ok := tengo.ToString(args[k])
+		if !ok {
+			return nil, tengo.ErrInvalidArgumentType{
+				Name:     name,
+				Expected: "string(compatible)",
+				Found:    args[k].TypeName(),
+			}
+		}
+		lines[k] = splitLines(s)
+	}
+	a, b := lines[0], lines[1]
+	edits, err := diffSequences(len(a), len(b), func(i, j int) bool {
+		return a[i].(*tengo.String).Value == b[j].(*tengo.String).Value
+	})
+	if err != nil {
+		return wrapError(err), nil
+	}
+	return diffEntries(edits, "text", a, b), nil
+}
+
+func diffArrays(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	var elems [2][]tengo.Object
+	for k, name := range []string{"first", "second"} {
+		switch arg := args[k].(type) {
+		case *tengo.Array:
+			elems[k] = arg.Value
+		case *tengo.ImmutableArray:
+			elems[k] = arg.Value
+		default:
+			return nil, tengo.ErrInvalidArgumentType{
+				Name:     name,
+				Expected: "array",
+				Found:    args[k].TypeName(),
+			}
+		}
+	}
+	a, b := elems[0], elems[1]
+	edits, err := diffSequences(len(a), len(b), func(i, j int) bool {
+		return a[i].Equals(b[j])
+	})
+	if err != nil {
+		return wrapError(err), nil
+	}
+	return diffEntries(edits, "value", a, b), nil
+}
@@ -0,0 +1,90 @@
+package stdlib_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tiagoj/tengo/v2"
+	"github.com/tiagoj/tengo/v2/stdlib"
+)
+
+func TestDiffLines(t *testing.T) {
+	eq := func(s string) IMAP { return IMAP{"op": "eq", "text": s} }
+	del := func(s string) IMAP { return IMAP{"op": "del", "text": s} }
+	add := func(s string) IMAP { return IMAP{"op": "add", "text": s} }
+
+	// unchanged runs
+	module(t, "diff").call("lines", "a\nb\nc", "a\nb\nc").
+		expect(ARR{eq("a"), eq("b"), eq("c")})
+	module(t, "diff").call("lines", "", "").expect(ARR{})
+
+	// additions
+	module(t, "diff").call("lines", "a\nc", "a\nb\nc").
+		expect(ARR{eq("a"), add("b"), eq("c")})
+	module(t, "diff").call("lines", "", "a\nb\n").
+		expect(ARR{add("a"), add("b")})
+	module(t, "diff").call("lines", "b", "a\nb\nc").
+		expect(ARR{add("a"), eq("b"), add("c")})
+
+	// deletions
+	module(t, "diff").call("lines", "a\nb\nc\n", "a\nc\n").
+		expect(ARR{eq("a"), del("b"), eq("c")})
+	module(t, "diff").call("lines", "a\nb", "").
+		expect(ARR{del("a"), del("b")})
+
+	// changes: deletions come before additions
+	module(t, "diff").call("lines", "x = 1\ny = 2\nz = 3", "x = 1\ny = 5\nz = 3").
+		expect(ARR{eq("x = 1"), del("y = 2"), add("y = 5"), eq("z = 3")})
+	module(t, "diff").call("lines", "a\nb\nc\nd", "b\nx\nd\ne").
+		expect(ARR{del("a"), eq("b"), del("c"), add("x"), eq("d"), add("e")})
+	// a trailing newline doesn't start a line, but an empty line does
+	module(t, "diff").call("lines", "a\n", "a\n\n").
+		expect(ARR{eq("a"), add("")})
+
+	module(t, "diff").call("lines", "a").expectError()
+	module(t, "diff").call("lines", "a", tengo.UndefinedValue).expectError()
+}
+
+func TestDiffArrays(t *testing.T) {
+	eq := func(v interface{}) IMAP { return IMAP{"op": "eq", "value": v} }
+	del := func(v interface{}) IMAP { return IMAP{"op": "del", "value": v} }
+	add := func(v interface{}) IMAP { return IMAP{"op": "add", "value": v} }
+
+	module(t, "diff").call("arrays", ARR{1, 2, 3}, ARR{1, 2, 3}).
+		expect(ARR{eq(1), eq(2), eq(3)})
+	module(t, "diff").call("arrays", ARR{1, 2, 3}, ARR{0, 1, 3, 4}).
+		expect(ARR{add(0), eq(1), del(2), eq(3), add(4)})
+	module(t, "diff").call("arrays", ARR{"a", MAP{"k": 1}}, IARR{"a", MAP{"k": 2}}).
+		expect(ARR{eq("a"), del(MAP{"k": 1}), add(MAP{"k": 2})})
+	// elements of different types are different
+	module(t, "diff").call("arrays", ARR{1}, ARR{"1"}).
+		expect(ARR{del(1), add("1")})
+	module(t, "diff").call("arrays", ARR{}, ARR{}).expect(ARR{})
+
+	module(t, "diff").call("arrays", ARR{}).expectError()
+	module(t, "diff").call("arrays", "a", ARR{}).expectError()
+}
+
+func TestDiffMaxSize(t *testing.T) {
+	defer func(size int) { stdlib.DiffMaxSize = size }(stdlib.DiffMaxSize)
+	stdlib.DiffMaxSize = 100
+
+	a := strings.Repeat("a\n", 20)
+	b := strings.Repeat("b\n", 20)
+	module(t, "diff").call("lines", a, b).
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "inputs too large to compare: 20 and 20 elements differ",
+		}})
+
+	// the common prefix and suffix don't count
+	var expected ARR
+	for i := 0; i < 20; i++ {
+		expected = append(expected, IMAP{"op": "eq", "text": "a"})
+	}
+	expected = append(expected,
+		IMAP{"op": "del", "text": "x"}, IMAP{"op": "add", "text": "y"})
+	for i := 0; i < 20; i++ {
+		expected = append(expected, IMAP{"op": "eq", "text": "b"})
+	}
+	module(t, "diff").call("lines", a+"x\n"+b, a+"y\n"+b).expect(expected)
+}
@@ -0,0 +1,133 @@
+package stdlib
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+var encodingModule = map[string]tengo.Object{
+	"uvarint_encode": &tengo.UserFunction{
+		Name:  "uvarint_encode",
+		Value: encodingUvarintEncode,
+	}, // uvarint_encode(n) => bytes/error
+	"uvarint_decode": &tengo.UserFunction{
+		Name:  "uvarint_decode",
+		Value: encodingUvarintDecode,
+	}, // uvarint_decode(b) => [int, int]/error
+	"varint_encode": &tengo.UserFunction{
+		Name:  "varint_encode",
+		Value: encodingVarintEncode,
+	}, // varint_encode(n) => bytes
+	"varint_decode": &tengo.UserFunction{
+		Name:  "varint_decode",
+		Value: encodingVarintDecode,
+	}, // varint_decode(b) => [int, int]/error
+}
+
+var (
+	errVarintTruncated = errors.New("truncated varint")
+	errVarintOverflow  = errors.New("varint overflows a 64-bit integer")
+)
+
+func encodingUvarintEncode(args ...tengo.Object) (tengo.Object, error) {
+	n, err := varintArg(args)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return wrapError(errors.New("negative value for uvarint")), nil
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	return &tengo.Bytes{Value: buf[:binary.PutUvarint(buf, uint64(n))]}, nil
+}
+
+func encodingVarintEncode(args ...tengo.Object) (tengo.Object, error) {
+	n, err := varintArg(args)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	return &tengo.Bytes{Value: buf[:binary.PutVarint(buf, n)]}, nil
+}
+
+func encodingUvarintDecode(args ...tengo.Object) (tengo.Object, error) {
+	b, err := varintBytesArg(args)
+	if err != nil {
+		return nil, err
+	}
+	v, n := binary.Uvarint(b)
+	if err := varintError(n); err != nil {
+		return wrapError(err), nil
+	}
+	if v > math.MaxInt64 {
+		return wrapError(errVarintOverflow), nil
+	}
+	return varintResult(int64(v), n), nil
+}
+
+func encodingVarintDecode(args ...tengo.Object) (tengo.Object, error) {
+	b, err := varintBytesArg(args)
+	if err != nil {
+		return nil, err
+	}
+	v, n := binary.Varint(b)
+	if err := varintError(n); err != nil {
+		return wrapError(err), nil
+	}
+	return varintResult(v, n), nil
+}
+
+// varintArg returns the int argument of the encoding functions.
+func varintArg(args []tengo.Object) (int64, error) {
+	if len(args) != 1 {
+		return 0, tengo.ErrWrongNumArguments
+	}
+	n, ok := args[0].(*tengo.Int)
+	if !ok {
+		return 0, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "int",
+			Found:    args[0].TypeName(),
+		}
+	}
+	return n.Value, nil
+}
+
+// varintBytesArg returns the bytes argument of the decoding functions.
+func varintBytesArg(args []tengo.Object) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	b, ok := args[0].(*tengo.Bytes)
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "bytes",
+			Found:    args[0].TypeName(),
+		}
+	}
+	return b.Value, nil
+}
+
+// varintError returns the error the number of bytes returned by
+// binary.Uvarint or binary.Varint stands for, if any.
+func varintError(n int) error {
+	switch {
+	case n == 0:
+		return errVarintTruncated
+	case n < 0:
+		return errVarintOverflow
+	}
+	return nil
+}
+
+// varintResult returns the decoded value and the number of bytes read.
+func varintResult(v int64, n int) tengo.Object {
+	return &tengo.Array{Value: []tengo.Object{
+		&tengo.Int{Value: v},
+		&tengo.Int{Value: int64(n)},
+	}}
+}
@@ -0,0 +1,67 @@
+package stdlib_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+func TestEncodingVarint(t *testing.T) {
+	uvarint := func(n int64, encoded []byte) {
+		module(t, "encoding").call("uvarint_encode", n).expect(encoded)
+		module(t, "encoding").call("uvarint_decode", encoded).
+			expect(ARR{n, len(encoded)})
+	}
+	uvarint(0, []byte{0x00})
+	uvarint(1, []byte{0x01})
+	uvarint(127, []byte{0x7f})
+	uvarint(128, []byte{0x80, 0x01})
+	uvarint(300, []byte{0xac, 0x02})
+	uvarint(1<<35, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x01})
+	uvarint(math.MaxInt64, []byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f})
+
+	varint := func(n int64, encoded []byte) {
+		module(t, "encoding").call("varint_encode", n).expect(encoded)
+		module(t, "encoding").call("varint_decode", encoded).
+			expect(ARR{n, len(encoded)})
+	}
+	varint(0, []byte{0x00})
+	varint(-1, []byte{0x01})
+	varint(1, []byte{0x02})
+	varint(-64, []byte{0x7f})
+	varint(150, []byte{0xac, 0x02})
+	varint(-1<<35, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+	varint(math.MaxInt64, []byte{
+		0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+	varint(math.MinInt64, []byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+
+	// decoding stops after the first varint
+	module(t, "encoding").call("uvarint_decode", []byte{0xac, 0x02, 0x05}).
+		expect(ARR{300, 2})
+
+	// truncated and invalid input
+	truncated := &tengo.Error{Value: &tengo.String{Value: "truncated varint"}}
+	overflow := &tengo.Error{Value: &tengo.String{
+		Value: "varint overflows a 64-bit integer"}}
+	module(t, "encoding").call("uvarint_decode", []byte{}).expect(truncated)
+	module(t, "encoding").call("uvarint_decode", []byte{0x80, 0x80}).
+		expect(truncated)
+	module(t, "encoding").call("varint_decode", []byte{0xff}).
+		expect(truncated)
+	module(t, "encoding").call("uvarint_decode", []byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02}).
+		expect(overflow)
+	module(t, "encoding").call("uvarint_decode", []byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}).
+		expect(overflow)
+	module(t, "encoding").call("uvarint_encode", -1).
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "negative value for uvarint"}})
+
+	module(t, "encoding").call("uvarint_encode").expectError()
+	module(t, "encoding").call("uvarint_encode", "1").expectError()
+	module(t, "encoding").call("varint_decode", 1).expectError()
+}
@@ -7,22 +7,45 @@ import (
 )
 
 var fmtModule = map[string]tengo.Object{
-	"print":   &tengo.UserFunction{Name: "print", Value: fmtPrint},
-	"printf":  &tengo.UserFunction{Name: "printf", Value: fmtPrintf},
-	"println": &tengo.UserFunction{Name: "println", Value: fmtPrintln},
+	"print": &tengo.UserFunction{
+		Name:    "print",
+		Value:   fmtPrintFunc(fmtPrint),
+		VMValue: fmtPrint,
+	},
+	"printf": &tengo.UserFunction{
+		Name:    "printf",
+		Value:   fmtPrintFunc(fmtPrintf),
+		VMValue: fmtPrintf,
+	},
+	"println": &tengo.UserFunction{
+		Name:    "println",
+		Value:   fmtPrintFunc(fmtPrintln),
+		VMValue: fmtPrintln,
+	},
 	"sprintf": &tengo.UserFunction{Name: "sprintf", Value: fmtSprintf},
 }
 
-func fmtPrint(args ...tengo.Object) (ret tengo.Object, err error) {
+// fmtPrintFunc adapts a print function for calls made without a VM, which
+// write to os.Stdout.
+func fmtPrintFunc(
+	fn func(v *tengo.VM, args ...tengo.Object) (tengo.Object, error),
+) tengo.CallableFunc {
+	return func(args ...tengo.Object) (tengo.Object, error) {
+		return fn(nil, args...)
+	}
+}
+
+// fmtPrint writes to the output of the VM, see tengo.VM.Output.
+func fmtPrint(v *tengo.VM, args ...tengo.Object) (ret tengo.Object, err error) {
 	printArgs, err := getPrintArgs(args...)
 	if err != nil {
 		return nil, err
 	}
-	_, _ = fmt.Print(printArgs...)
+	_, _ = fmt.Fprint(v.Output(), printArgs...)
 	return nil, nil
 }
 
-func fmtPrintf(args ...tengo.Object) (ret tengo.Object, err error) {
+func fmtPrintf(v *tengo.VM, args ...tengo.Object) (ret tengo.Object, err error) {
 	numArgs := len(args)
 	if numArgs == 0 {
 		return nil, tengo.ErrWrongNumArguments
@@ -37,7 +60,7 @@ func fmtPrintf(args ...tengo.Object) (ret tengo.Object, err error) {
 		}
 	}
 	if numArgs == 1 {
-		fmt.Print(format)
+		_, _ = fmt.Fprint(v.Output(), format)
 		return nil, nil
 	}
 
@@ -45,17 +68,17 @@ func fmtPrintf(args ...tengo.Object) (ret tengo.Object, err error) {
 	if err != nil {
 		return nil, err
 	}
-	fmt.Print(s)
+	_, _ = fmt.Fprint(v.Output(), s)
 	return nil, nil
 }
 
-func fmtPrintln(args ...tengo.Object) (ret tengo.Object, err error) {
+func fmtPrintln(v *tengo.VM, args ...tengo.Object) (ret tengo.Object, err error) {
 	printArgs, err := getPrintArgs(args...)
 	if err != nil {
 		return nil, err
 	}
 	printArgs = append(printArgs, "\n")
-	_, _ = fmt.Print(printArgs...)
+	_, _ = fmt.Fprint(v.Output(), printArgs...)
 	return nil, nil
 }
 
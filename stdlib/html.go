@@ -0,0 +1,116 @@
+package stdlib
+
+import (
+	"html"
+	"strings"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+var htmlModule = map[string]tengo.Object{
+	"escape": &tengo.UserFunction{
+		Name:  "escape",
+		Value: FuncASRS(html.EscapeString),
+	}, // escape(s) => string
+	"unescape": &tengo.UserFunction{
+		Name:  "unescape",
+		Value: FuncASRS(html.UnescapeString),
+	}, // unescape(s) => string
+	"strip_tags": &tengo.UserFunction{
+		Name:  "strip_tags",
+		Value: FuncASRS(htmlStripTags),
+	}, // strip_tags(s) => string
+}
+
+// htmlStripTags removes the tags, comments and doctypes of s, as well as the
+// contents of script and style elements, and returns the remaining text.
+// Character references are kept as they are. s is tokenized following the
+// rules HTML parsers use: a "<" that can't start a tag is text, a ">" inside
+// a quoted attribute value doesn't end its tag, and an unterminated tag or
+// comment extends to the end of s.
+func htmlStripTags(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] != '<' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			i++
+			continue
+		}
+		switch c := s[i+1]; {
+		case strings.HasPrefix(s[i:], "<!--"):
+			end := strings.Index(s[i+4:], "-->")
+			if end < 0 {
+				return sb.String()
+			}
+			i += 4 + end + 3
+		case c == '!' || c == '?':
+			// doctype or bogus comment
+			end := strings.IndexByte(s[i:], '>')
+			if end < 0 {
+				return sb.String()
+			}
+			i += end + 1
+		case isASCIILetter(c) || c == '/' && i+2 < len(s) && isASCIILetter(s[i+2]):
+			name, end := htmlScanTag(s, i+1)
+			if end < 0 {
+				return sb.String()
+			}
+			i = end
+			if c != '/' && (name == "script" || name == "style") {
+				// raw text: the element ends at the first closing tag
+				closing := strings.Index(strings.ToLower(s[i:]), "</"+name)
+				if closing < 0 {
+					return sb.String()
+				}
+				i += closing
+			}
+		default:
+			sb.WriteByte('<')
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// htmlScanTag scans the tag starting at s[start], right after its "<", and
+// returns its lowercase name and the index following its ">", or -1 if the
+// tag is not terminated.
+func htmlScanTag(s string, start int) (string, int) {
+	i := start
+	if s[i] == '/' {
+		i++
+	}
+	nameStart := i
+	for i < len(s) && !isHTMLSpace(s[i]) && s[i] != '/' && s[i] != '>' {
+		i++
+	}
+	name := strings.ToLower(s[nameStart:i])
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '>':
+			return name, i + 1
+		case '=':
+			// skip a quoted attribute value, which may contain '>'
+			j := i + 1
+			for j < len(s) && isHTMLSpace(s[j]) {
+				j++
+			}
+			if j < len(s) && (s[j] == '"' || s[j] == '\'') {
+				end := strings.IndexByte(s[j+1:], s[j])
+				if end < 0 {
+					return name, -1
+				}
+				i = j + 1 + end
+			}
+		}
+	}
+	return name, -1
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
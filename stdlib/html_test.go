@@ -0,0 +1,54 @@
+package stdlib_test
+
+import "testing"
+
+func TestHTMLEscape(t *testing.T) {
+	module(t, "html").call("escape", `<a href="x">Tom & 'Jerry'</a>`).
+		expect("&lt;a href=&#34;x&#34;&gt;Tom &amp; &#39;Jerry&#39;&lt;/a&gt;")
+	module(t, "html").call("escape", "plain").expect("plain")
+	module(t, "html").call("escape", "").expect("")
+	module(t, "html").call("escape").expectError()
+	module(t, "html").call("escape", 1).expect("1")
+
+	module(t, "html").call("unescape", "&lt;b&gt; &amp;amp; &quot;&#39;&eacute;").
+		expect("<b> &amp; \"'é")
+	module(t, "html").call("unescape", "a & b").expect("a & b")
+
+	expect(t, `
+html := import("html")
+s := "<p class=\"x\">1 < 2 && 'y' > \"z\"</p>"
+out := html.unescape(html.escape(s)) == s && html.escape(s) != s
+`, true)
+}
+
+func TestHTMLStripTags(t *testing.T) {
+	strip := func(s, expected string) {
+		module(t, "html").call("strip_tags", s).expect(expected)
+	}
+	strip(`<p class="intro" id='a'>Hello, <b>world</b>!</p>`, "Hello, world!")
+	strip(`<a href="/x?a=1&b=2" title='1 > 0' data-x="<b>">link</a>`, "link")
+	strip(`<img src="x.png" alt="a"/>caption<br>`, "caption")
+	strip(`<ul><li>one<li>two</ul>`, "onetwo")
+	strip("<DIV\n\tCLASS=x>text</Div>", "text")
+
+	// text that merely looks like markup is kept
+	strip("1 < 2 && 3 > 2", "1 < 2 && 3 > 2")
+	strip("a <3 b, <> and < /b>", "a <3 b, <> and < /b>")
+	strip("ends with <", "ends with <")
+	strip("&lt;b&gt; &amp;", "&lt;b&gt; &amp;")
+
+	// comments, doctypes and raw text elements
+	strip("<!DOCTYPE html><!-- <b>hidden</b> -->shown<?xml x?>", "shown")
+	strip(`a<script type="text/javascript">if (x < 1) { y = "</b>" }</script>b`,
+		"ab")
+	strip("a<style>p > b { color: red }</STYLE>b", "ab")
+
+	// malformed markup
+	strip("before<b class='unterminated>after", "before")
+	strip("before<!-- unterminated", "before")
+	strip("before<script>x", "before")
+	strip("<<b>>x", "<>x")
+	strip("", "")
+
+	module(t, "html").call("strip_tags").expectError()
+}
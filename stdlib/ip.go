@@ -0,0 +1,148 @@
+package stdlib
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+var ipModule = map[string]tengo.Object{
+	"parse": &tengo.UserFunction{
+		Name:  "parse",
+		Value: FuncASRSE(ipParse),
+	}, // parse(s) => string/error
+	"is_v4": &tengo.UserFunction{
+		Name:  "is_v4",
+		Value: ipIs(netip.Addr.Is4),
+	}, // is_v4(s) => bool
+	"is_v6": &tengo.UserFunction{
+		Name:  "is_v6",
+		Value: ipIs(netip.Addr.Is6),
+	}, // is_v6(s) => bool
+	"in_cidr": &tengo.UserFunction{
+		Name:  "in_cidr",
+		Value: ipInCIDR,
+	}, // in_cidr(ip, cidr) => bool/error
+	"to_int": &tengo.UserFunction{
+		Name:  "to_int",
+		Value: ipToInt,
+	}, // to_int(ipv4) => int/error
+	"from_int": &tengo.UserFunction{
+		Name:  "from_int",
+		Value: ipFromInt,
+	}, // from_int(n) => string/error
+}
+
+func ipParse(s string) (string, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+// ipIs transforms a predicate on an IP address into a CallableFunc that
+// accepts a string. Invalid addresses result in false.
+func ipIs(fn func(netip.Addr) bool) tengo.CallableFunc {
+	return func(args ...tengo.Object) (tengo.Object, error) {
+		if len(args) != 1 {
+			return nil, tengo.ErrWrongNumArguments
+		}
+		s, ok := tengo.ToString(args[0])
+		if !ok {
+			return nil, tengo.ErrInvalidArgumentType{
+				Name:     "first",
+				Expected: "string(compatible)",
+				Found:    args[0].TypeName(),
+			}
+		}
+		addr, err := netip.ParseAddr(s)
+		if err == nil && fn(addr) {
+			return tengo.TrueValue, nil
+		}
+		return tengo.FalseValue, nil
+	}
+}
+
+func ipInCIDR(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	s, ok := tengo.ToString(args[0])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string(compatible)",
+			Found:    args[0].TypeName(),
+		}
+	}
+	cidr, ok := tengo.ToString(args[1])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "string(compatible)",
+			Found:    args[1].TypeName(),
+		}
+	}
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return wrapError(err), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return tengo.FalseValue, nil
+	}
+	if prefix.Addr().Is4() {
+		// IPv4-mapped IPv6 addresses belong to IPv4 networks
+		addr = addr.Unmap()
+	}
+	if prefix.Contains(addr) {
+		return tengo.TrueValue, nil
+	}
+	return tengo.FalseValue, nil
+}
+
+func ipToInt(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	s, ok := tengo.ToString(args[0])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string(compatible)",
+			Found:    args[0].TypeName(),
+		}
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return wrapError(err), nil
+	}
+	if !addr.Is4() {
+		return wrapError(errors.New("not an IPv4 address: " + s)), nil
+	}
+	b := addr.As4()
+	return &tengo.Int{Value: int64(binary.BigEndian.Uint32(b[:]))}, nil
+}
+
+func ipFromInt(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	n, ok := tengo.ToInt64(args[0])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "int(compatible)",
+			Found:    args[0].TypeName(),
+		}
+	}
+	if n < 0 || n > 0xFFFFFFFF {
+		return wrapError(errors.New("IPv4 address out of range")), nil
+	}
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(n))
+	return &tengo.String{Value: netip.AddrFrom4(b).String()}, nil
+}
@@ -0,0 +1,69 @@
+package stdlib_test
+
+import (
+	"testing"
+
+	"github.com/tiagoj/tengo/v2"
+	"github.com/tiagoj/tengo/v2/require"
+)
+
+func TestIP(t *testing.T) {
+	module(t, "ip").call("parse", "192.168.0.1").expect("192.168.0.1")
+	module(t, "ip").call("parse", "2001:0DB8:0:0:0:0:0:1").expect("2001:db8::1")
+	module(t, "ip").call("parse", "::ffff:1.2.3.4").expect("::ffff:1.2.3.4")
+	expectErrorObject(t, module(t, "ip").call("parse", "1.2.3"))
+	module(t, "ip").call("parse").expectError()
+
+	module(t, "ip").call("is_v4", "10.0.0.1").expect(true)
+	module(t, "ip").call("is_v4", "::1").expect(false)
+	module(t, "ip").call("is_v4", "::ffff:1.2.3.4").expect(false)
+	module(t, "ip").call("is_v4", "256.0.0.1").expect(false)
+	module(t, "ip").call("is_v6", "::1").expect(true)
+	module(t, "ip").call("is_v6", "fe80::1%eth0").expect(true)
+	module(t, "ip").call("is_v6", "::ffff:1.2.3.4").expect(true)
+	module(t, "ip").call("is_v6", "10.0.0.1").expect(false)
+	module(t, "ip").call("is_v6", "foo").expect(false)
+	module(t, "ip").call("is_v6").expectError()
+
+	module(t, "ip").call("in_cidr", "192.168.1.20", "192.168.0.0/16").expect(true)
+	module(t, "ip").call("in_cidr", "192.169.1.20", "192.168.0.0/16").expect(false)
+	module(t, "ip").call("in_cidr", "10.1.2.3", "0.0.0.0/0").expect(true)
+	module(t, "ip").call("in_cidr", "::ffff:10.1.2.3", "10.0.0.0/8").expect(true)
+	module(t, "ip").call("in_cidr", "2001:db8::5", "2001:db8::/32").expect(true)
+	module(t, "ip").call("in_cidr", "2001:db9::5", "2001:db8::/32").expect(false)
+	module(t, "ip").call("in_cidr", "10.1.2.3", "2001:db8::/32").expect(false)
+	module(t, "ip").call("in_cidr", "foo", "10.0.0.0/8").expect(false)
+	expectErrorObject(t, module(t, "ip").call("in_cidr", "10.1.2.3", "10.0.0.0/33"))
+	expectErrorObject(t, module(t, "ip").call("in_cidr", "10.1.2.3", "10.0.0.0"))
+	module(t, "ip").call("in_cidr", "10.1.2.3").expectError()
+
+	module(t, "ip").call("to_int", "0.0.0.0").expect(0)
+	module(t, "ip").call("to_int", "192.168.0.1").expect(3232235521)
+	module(t, "ip").call("to_int", "255.255.255.255").expect(4294967295)
+	module(t, "ip").call("to_int", "::1").
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "not an IPv4 address: ::1"}})
+	module(t, "ip").call("from_int", 3232235521).expect("192.168.0.1")
+	module(t, "ip").call("from_int", -1).
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "IPv4 address out of range"}})
+	module(t, "ip").call("from_int", 4294967296).
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "IPv4 address out of range"}})
+
+	for _, s := range []string{"0.0.0.0", "10.0.0.255", "172.16.254.1",
+		"255.255.255.255"} {
+		res := module(t, "ip").call("to_int", s)
+		module(t, "ip").call("from_int", res.o).expect(s)
+	}
+	expect(t, `
+ip := import("ip")
+out := ip.from_int(ip.to_int("10.0.0.255") + 1)`, "10.0.1.0")
+}
+
+// expectErrorObject checks that a function returned an error object, whose
+// message depends on the Go version.
+func expectErrorObject(t *testing.T, res callres) {
+	require.NoError(t, res.e)
+	require.IsType(t, &tengo.Error{}, res.o)
+}
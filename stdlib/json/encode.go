@@ -129,6 +129,8 @@ func Encode(o tengo.Object) ([]byte, error) {
 	var b []byte
 
 	switch o := o.(type) {
+	case *tengo.GoMap, *tengo.GoSlice:
+		return Encode(o.Copy())
 	case *tengo.Array:
 		b = append(b, '[')
 		len1 := len(o.Value) - 1
@@ -251,7 +253,7 @@ func Encode(o tengo.Object) ([]byte, error) {
 	case *tengo.Undefined:
 		b = append(b, "null"...)
 	default:
-		// unknown type: ignore
+		return nil, errors.New("unsupported type: " + o.TypeName())
 	}
 	return b, nil
 }
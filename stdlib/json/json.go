@@ -0,0 +1,11 @@
+package json
+
+import (
+	"github.com/tiagoj/tengo/v2"
+)
+
+func init() {
+	// the builtin functions to_json and from_json use the codec of this
+	// package
+	tengo.SetJSONCodec(Encode, Decode)
+}
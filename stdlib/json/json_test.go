@@ -86,6 +86,16 @@ func TestDecode(t *testing.T) {
 	testDecodeError(t, `{"a":"b":"c"}`)
 }
 
+func TestEncodeUnsupported(t *testing.T) {
+	_, err := json.Encode(&tengo.Array{Value: []tengo.Object{
+		&tengo.Int{Value: 1},
+		&tengo.UserFunction{Name: "f"},
+	}})
+	require.Error(t, err)
+	_, err = json.Encode(&tengo.Error{Value: &tengo.String{Value: "e"}})
+	require.Error(t, err)
+}
+
 func testDecodeError(t *testing.T, input string) {
 	_, err := json.Decode([]byte(input))
 	require.Error(t, err)
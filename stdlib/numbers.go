@@ -0,0 +1,172 @@
+package stdlib
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+var numbersModule = map[string]tengo.Object{
+	"parse_int": &tengo.UserFunction{
+		Name:  "parse_int",
+		Value: numbersParseInt,
+	}, // parse_int(s, base) => int/error
+	"parse_float": &tengo.UserFunction{
+		Name:  "parse_float",
+		Value: numbersParseFloat,
+	}, // parse_float(s) => float/error
+	"format_int": &tengo.UserFunction{
+		Name:  "format_int",
+		Value: numbersFormatInt,
+	}, // format_int(n, base) => string/error
+	"format_float": &tengo.UserFunction{
+		Name:  "format_float",
+		Value: numbersFormatFloat,
+	}, // format_float(f, prec) => string
+	"clamp": &tengo.UserFunction{
+		Name:  "clamp",
+		Value: numbersClamp,
+	}, // clamp(n, lo, hi) => int/float/error
+}
+
+func numbersParseInt(args ...tengo.Object) (ret tengo.Object, err error) {
+	if len(args) != 2 {
+		err = tengo.ErrWrongNumArguments
+		return
+	}
+
+	s1, ok := args[0].(*tengo.String)
+	if !ok {
+		err = tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+		return
+	}
+
+	i2, ok := tengo.ToInt(args[1])
+	if !ok {
+		err = tengo.ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "int(compatible)",
+			Found:    args[1].TypeName(),
+		}
+		return
+	}
+
+	parsed, perr := strconv.ParseInt(s1.Value, i2, 64)
+	if perr != nil {
+		ret = wrapError(perr)
+		return
+	}
+
+	ret = &tengo.Int{Value: parsed}
+
+	return
+}
+
+func numbersParseFloat(args ...tengo.Object) (ret tengo.Object, err error) {
+	if len(args) != 1 {
+		err = tengo.ErrWrongNumArguments
+		return
+	}
+
+	s1, ok := args[0].(*tengo.String)
+	if !ok {
+		err = tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+		return
+	}
+
+	parsed, perr := strconv.ParseFloat(s1.Value, 64)
+	if perr != nil {
+		ret = wrapError(perr)
+		return
+	}
+
+	ret = &tengo.Float{Value: parsed}
+
+	return
+}
+
+func numbersFormatInt(args ...tengo.Object) (ret tengo.Object, err error) {
+	if len(args) != 2 {
+		err = tengo.ErrWrongNumArguments
+		return
+	}
+
+	i1, ok := tengo.ToInt64(args[0])
+	if !ok {
+		err = tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "int(compatible)",
+			Found:    args[0].TypeName(),
+		}
+		return
+	}
+
+	i2, ok := tengo.ToInt(args[1])
+	if !ok {
+		err = tengo.ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "int(compatible)",
+			Found:    args[1].TypeName(),
+		}
+		return
+	}
+
+	// strconv.FormatInt panics on an invalid base
+	if i2 < 2 || i2 > 36 {
+		ret = wrapError(fmt.Errorf("invalid base: %d", i2))
+		return
+	}
+
+	ret = &tengo.String{Value: strconv.FormatInt(i1, i2)}
+
+	return
+}
+
+func numbersFormatFloat(args ...tengo.Object) (ret tengo.Object, err error) {
+	if len(args) != 2 {
+		err = tengo.ErrWrongNumArguments
+		return
+	}
+
+	f1, ok := tengo.ToFloat64(args[0])
+	if !ok {
+		err = tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "float(compatible)",
+			Found:    args[0].TypeName(),
+		}
+		return
+	}
+
+	i2, ok := tengo.ToInt(args[1])
+	if !ok {
+		err = tengo.ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "int(compatible)",
+			Found:    args[1].TypeName(),
+		}
+		return
+	}
+
+	ret = &tengo.String{Value: strconv.FormatFloat(f1, 'f', i2, 64)}
+
+	return
+}
+
+func numbersClamp(args ...tengo.Object) (ret tengo.Object, err error) {
+	if len(args) != 3 {
+		err = tengo.ErrWrongNumArguments
+		return
+	}
+
+	return tengo.Clamp(args[0], args[1], args[2])
+}
@@ -0,0 +1,51 @@
+package stdlib_test
+
+import (
+	"testing"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+func TestNumbers(t *testing.T) {
+	module(t, "numbers").call("parse_int", "42", 10).expect(42)
+	module(t, "numbers").call("parse_int", "-ff", 16).expect(-255)
+	module(t, "numbers").call("parse_int", "0x1f", 0).expect(31)
+	module(t, "numbers").call("parse_int", "0o17", 0).expect(15)
+	module(t, "numbers").call("parse_int", "0b101", 0).expect(5)
+	module(t, "numbers").call("parse_int", "12", 0).expect(12)
+	module(t, "numbers").call("parse_int", "0x1f", 10).
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: `strconv.ParseInt: parsing "0x1f": invalid syntax`}})
+	module(t, "numbers").call("parse_int", 12, 10).expectError()
+	module(t, "numbers").call("parse_int", "12").expectError()
+
+	module(t, "numbers").call("parse_float", "3.25").expect(3.25)
+	module(t, "numbers").call("parse_float", "1e3").expect(1000.0)
+	module(t, "numbers").call("parse_float", "abc").
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: `strconv.ParseFloat: parsing "abc": invalid syntax`}})
+
+	module(t, "numbers").call("format_int", 255, 16).expect("ff")
+	module(t, "numbers").call("format_int", -5, 2).expect("-101")
+	module(t, "numbers").call("format_int", 255, 1).
+		expect(&tengo.Error{Value: &tengo.String{Value: "invalid base: 1"}})
+
+	module(t, "numbers").call("format_float", 3.14159, 2).expect("3.14")
+	module(t, "numbers").call("format_float", 2.5, 0).expect("2")
+	module(t, "numbers").call("format_float", 1.0, 3).expect("1.000")
+	module(t, "numbers").call("format_float", 0.1, -1).expect("0.1")
+	module(t, "numbers").call("format_float", 7, 1).expect("7.0")
+
+	module(t, "numbers").call("clamp", 5, 0, 10).expect(5)
+	module(t, "numbers").call("clamp", -1, 0, 10).expect(0)
+	module(t, "numbers").call("clamp", 11, 0, 10).expect(10)
+	module(t, "numbers").call("clamp", 0, 0, 10).expect(0)
+	module(t, "numbers").call("clamp", 10, 0, 10).expect(10)
+	module(t, "numbers").call("clamp", 1.5, 0, 1).expect(1.0)
+	module(t, "numbers").call("clamp", 5, 0.5, 2.5).expect(2.5)
+	module(t, "numbers").call("clamp", "5", 0, 10).expectError()
+	module(t, "numbers").call("clamp", 5, 10, 0).
+		expect(&tengo.Error{Value: &tengo.String{Value: "invalid range: 10 > 0"}})
+	module(t, "numbers").call("clamp", 1, 2.5, 0.5).
+		expect(&tengo.Error{Value: &tengo.String{Value: "invalid range: 2.5 > 0.5"}})
+}
@@ -0,0 +1,71 @@
+package stdlib
+
+import (
+	"path/filepath"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+var pathModule = map[string]tengo.Object{
+	"separator": &tengo.String{Value: string(filepath.Separator)},
+	"join": &tengo.UserFunction{
+		Name:  "join",
+		Value: pathJoin,
+	}, // join(parts...) => string
+	"base": &tengo.UserFunction{
+		Name:  "base",
+		Value: FuncASRS(filepath.Base),
+	}, // base(p) => string
+	"dir": &tengo.UserFunction{
+		Name:  "dir",
+		Value: FuncASRS(filepath.Dir),
+	}, // dir(p) => string
+	"ext": &tengo.UserFunction{
+		Name:  "ext",
+		Value: FuncASRS(filepath.Ext),
+	}, // ext(p) => string
+	"clean": &tengo.UserFunction{
+		Name:  "clean",
+		Value: FuncASRS(filepath.Clean),
+	}, // clean(p) => string
+	"split": &tengo.UserFunction{
+		Name:  "split",
+		Value: pathSplit,
+	}, // split(p) => [dir, file]
+}
+
+func pathJoin(args ...tengo.Object) (ret tengo.Object, err error) {
+	parts, err := stringArray(args, "parts")
+	if err != nil {
+		return
+	}
+
+	ret = &tengo.String{Value: filepath.Join(parts...)}
+
+	return
+}
+
+func pathSplit(args ...tengo.Object) (ret tengo.Object, err error) {
+	if len(args) != 1 {
+		err = tengo.ErrWrongNumArguments
+		return
+	}
+
+	s1, ok := args[0].(*tengo.String)
+	if !ok {
+		err = tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+		return
+	}
+
+	dir, file := filepath.Split(s1.Value)
+	ret = &tengo.Array{Value: []tengo.Object{
+		&tengo.String{Value: dir},
+		&tengo.String{Value: file},
+	}}
+
+	return
+}
@@ -0,0 +1,38 @@
+package stdlib_test
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	module(t, "path").call("join", "a", "b", "c").
+		expect(filepath.Join("a", "b", "c"))
+	module(t, "path").call("join", "a", "", "b").
+		expect(filepath.Join("a", "b"))
+	module(t, "path").call("join").expect("")
+	module(t, "path").call("join", "a", 1).expectError()
+	module(t, "path").call("join", "a/b", "../c").
+		expect(filepath.Join("a", "c"))
+
+	module(t, "path").call("base", "a/b/c.txt").expect("c.txt")
+	module(t, "path").call("base", "a/b/").expect("b")
+	module(t, "path").call("base", "").expect(".")
+	module(t, "path").call("dir", "a/b/c.txt").expect(filepath.Join("a", "b"))
+	module(t, "path").call("dir", "a/b/").expect(filepath.Join("a", "b"))
+	module(t, "path").call("dir", "c.txt").expect(".")
+	module(t, "path").call("ext", "a/b/c.tar.gz").expect(".gz")
+	module(t, "path").call("ext", "a/b/c").expect("")
+
+	module(t, "path").call("clean", "a/./b/../c/").
+		expect(filepath.Join("a", "c"))
+	module(t, "path").call("clean", "a//b").expect(filepath.Join("a", "b"))
+	module(t, "path").call("clean", "../../a").
+		expect(filepath.Join("..", "..", "a"))
+	module(t, "path").call("clean", "").expect(".")
+
+	module(t, "path").call("split", "a/b/c.txt").expect(ARR{"a/b/", "c.txt"})
+	module(t, "path").call("split", "a/b/").expect(ARR{"a/b/", ""})
+	module(t, "path").call("split", "c.txt").expect(ARR{"", "c.txt"})
+	module(t, "path").call("split", 1).expectError()
+}
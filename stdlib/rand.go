@@ -7,56 +7,30 @@ import (
 )
 
 var randModule = map[string]tengo.Object{
-	"int": &tengo.UserFunction{
-		Name:  "int",
-		Value: FuncARI64(rand.Int63),
-	},
-	"float": &tengo.UserFunction{
-		Name:  "float",
-		Value: FuncARF(rand.Float64),
-	},
-	"intn": &tengo.UserFunction{
-		Name:  "intn",
-		Value: FuncAI64RI64(rand.Int63n),
-	},
-	"exp_float": &tengo.UserFunction{
-		Name:  "exp_float",
-		Value: FuncARF(rand.ExpFloat64),
-	},
-	"norm_float": &tengo.UserFunction{
-		Name:  "norm_float",
-		Value: FuncARF(rand.NormFloat64),
-	},
-	"perm": &tengo.UserFunction{
-		Name:  "perm",
-		Value: FuncAIRIs(rand.Perm),
-	},
-	"seed": &tengo.UserFunction{
-		Name:  "seed",
-		Value: FuncAI64R(rand.Seed),
-	},
-	"read": &tengo.UserFunction{
-		Name: "read",
-		Value: func(args ...tengo.Object) (ret tengo.Object, err error) {
-			if len(args) != 1 {
-				return nil, tengo.ErrWrongNumArguments
-			}
-			y1, ok := args[0].(*tengo.Bytes)
-			if !ok {
-				return nil, tengo.ErrInvalidArgumentType{
-					Name:     "first",
-					Expected: "bytes",
-					Found:    args[0].TypeName(),
-				}
-			}
-			res, err := rand.Read(y1.Value)
-			if err != nil {
-				ret = wrapError(err)
-				return
-			}
-			return &tengo.Int{Value: int64(res)}, nil
-		},
-	},
+	"int": randFunc("int", func(r *rand.Rand) tengo.CallableFunc {
+		return FuncARI64(r.Int63)
+	}, FuncARI64(rand.Int63)),
+	"float": randFunc("float", func(r *rand.Rand) tengo.CallableFunc {
+		return FuncARF(r.Float64)
+	}, FuncARF(rand.Float64)),
+	"intn": randFunc("intn", func(r *rand.Rand) tengo.CallableFunc {
+		return FuncAI64RI64(r.Int63n)
+	}, FuncAI64RI64(rand.Int63n)),
+	"exp_float": randFunc("exp_float", func(r *rand.Rand) tengo.CallableFunc {
+		return FuncARF(r.ExpFloat64)
+	}, FuncARF(rand.ExpFloat64)),
+	"norm_float": randFunc("norm_float", func(r *rand.Rand) tengo.CallableFunc {
+		return FuncARF(r.NormFloat64)
+	}, FuncARF(rand.NormFloat64)),
+	"perm": randFunc("perm", func(r *rand.Rand) tengo.CallableFunc {
+		return FuncAIRIs(r.Perm)
+	}, FuncAIRIs(rand.Perm)),
+	"seed": randFunc("seed", func(r *rand.Rand) tengo.CallableFunc {
+		return FuncAI64R(r.Seed)
+	}, FuncAI64R(rand.Seed)),
+	"read": randFunc("read", func(r *rand.Rand) tengo.CallableFunc {
+		return randRead(r.Read)
+	}, randRead(rand.Read)),
 	"rand": &tengo.UserFunction{
 		Name: "rand",
 		Value: func(args ...tengo.Object) (tengo.Object, error) {
@@ -77,6 +51,52 @@ var randModule = map[string]tengo.Object{
 	},
 }
 
+// randFunc returns a function of the module that calls the function seeded
+// returns for the random number generator of the ExecutionContext the script
+// runs on behalf of, if it was created with WithSeed, or global otherwise.
+// global is called as a function of its own, which ExecutionContext
+// recordings capture.
+func randFunc(
+	name string,
+	seeded func(r *rand.Rand) tengo.CallableFunc,
+	global tengo.CallableFunc,
+) *tengo.UserFunction {
+	globalFn := &tengo.UserFunction{Name: name, Value: global}
+	return &tengo.UserFunction{
+		Name:  name,
+		Value: global,
+		VMValue: func(v *tengo.VM, args ...tengo.Object) (tengo.Object, error) {
+			if r := v.Rand(); r != nil {
+				return seeded(r)(args...)
+			}
+			return v.Call(globalFn, args...)
+		},
+	}
+}
+
+// randRead returns a function filling bytes with read.
+func randRead(read func([]byte) (int, error)) tengo.CallableFunc {
+	return func(args ...tengo.Object) (ret tengo.Object, err error) {
+		if len(args) != 1 {
+			return nil, tengo.ErrWrongNumArguments
+		}
+		y1, ok := args[0].(*tengo.Bytes)
+		if !ok {
+			return nil, tengo.ErrInvalidArgumentType{
+				Name:     "first",
+				Expected: "bytes",
+				Found:    args[0].TypeName(),
+			}
+		}
+		res, err := read(y1.Value)
+		if err != nil {
+			ret = wrapError(err)
+			return
+		}
+		return &tengo.Int{Value: int64(res)}, nil
+	}
+}
+
 func randRand(r *rand.Rand) *tengo.ImmutableMap {
 	return &tengo.ImmutableMap{
 		Value: map[string]tengo.Object{
@@ -109,29 +129,8 @@ func randRand(r *rand.Rand) *tengo.ImmutableMap {
 				Value: FuncAI64R(r.Seed),
 			},
 			"read": &tengo.UserFunction{
-				Name: "read",
-				Value: func(args ...tengo.Object) (
-					ret tengo.Object,
-					err error,
-				) {
-					if len(args) != 1 {
-						return nil, tengo.ErrWrongNumArguments
-					}
-					y1, ok := args[0].(*tengo.Bytes)
-					if !ok {
-						return nil, tengo.ErrInvalidArgumentType{
-							Name:     "first",
-							Expected: "bytes",
-							Found:    args[0].TypeName(),
-						}
-					}
-					res, err := r.Read(y1.Value)
-					if err != nil {
-						ret = wrapError(err)
-						return
-					}
-					return &tengo.Int{Value: int64(res)}, nil
-				},
+				Name:  "read",
+				Value: randRead(r.Read),
 			},
 		},
 	}
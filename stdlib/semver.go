@@ -0,0 +1,444 @@
+package stdlib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+var semverModule = map[string]tengo.Object{
+	"parse": &tengo.UserFunction{
+		Name:  "parse",
+		Value: semverParse,
+	}, // parse(s) => map/error
+	"compare": &tengo.UserFunction{
+		Name:  "compare",
+		Value: semverCompare,
+	}, // compare(a, b) => int/error
+	"satisfies": &tengo.UserFunction{
+		Name:  "satisfies",
+		Value: semverSatisfies,
+	}, // satisfies(version, range) => bool/error
+	"is_valid": &tengo.UserFunction{
+		Name:  "is_valid",
+		Value: semverIsValid,
+	}, // is_valid(s) => bool
+}
+
+// semver is a semantic version, as specified by https://semver.org.
+type semver struct {
+	major, minor, patch int64
+	pre                 []string // dot-separated pre-release identifiers
+	build               string
+}
+
+// parseSemver parses a semantic version, with an optional leading "v".
+func parseSemver(s string) (semver, error) {
+	v, parts, err := parsePartialSemver(s)
+	if err == nil && parts < 3 {
+		err = fmt.Errorf("invalid version: %s", s)
+	}
+	return v, err
+}
+
+// parsePartialSemver parses a semantic version, which may have less than 3
+// numbers in a range, or "x", "X" or "*" in place of the last ones. It
+// returns the number of numbers given.
+func parsePartialSemver(s string) (semver, int, error) {
+	var v semver
+	invalid := fmt.Errorf("invalid version: %s", s)
+	str := strings.TrimPrefix(s, "v")
+	if i := strings.IndexByte(str, '+'); i >= 0 {
+		v.build = str[i+1:]
+		if !validSemverIdents(v.build, false) {
+			return v, 0, invalid
+		}
+		str = str[:i]
+	}
+	if i := strings.IndexByte(str, '-'); i >= 0 {
+		pre := str[i+1:]
+		if !validSemverIdents(pre, true) {
+			return v, 0, invalid
+		}
+		v.pre = strings.Split(pre, ".")
+		str = str[:i]
+	}
+
+	nums := [3]*int64{&v.major, &v.minor, &v.patch}
+	fields := strings.Split(str, ".")
+	if len(fields) > 3 {
+		return v, 0, invalid
+	}
+	parts := 0
+	for _, f := range fields {
+		if f == "x" || f == "X" || f == "*" {
+			break
+		}
+		if !isSemverNumber(f) {
+			return v, 0, invalid
+		}
+		n, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return v, 0, invalid
+		}
+		*nums[parts] = n
+		parts++
+	}
+	// wildcards must be trailing, and only complete versions have
+	// pre-release identifiers or build metadata
+	for _, f := range fields[parts:] {
+		if f != "x" && f != "X" && f != "*" {
+			return v, 0, invalid
+		}
+	}
+	if parts < 3 && (v.pre != nil || v.build != "") {
+		return v, 0, invalid
+	}
+	return v, parts, nil
+}
+
+// isSemverNumber returns true if s is a number without leading zeros.
+func isSemverNumber(s string) bool {
+	if s == "" || (len(s) > 1 && s[0] == '0') {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validSemverIdents returns true if s is a list of dot-separated identifiers
+// of alphanumerics and hyphens. Numeric pre-release identifiers can't have
+// leading zeros.
+func validSemverIdents(s string, pre bool) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		numeric := true
+		for _, c := range id {
+			switch {
+			case c >= '0' && c <= '9':
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '-':
+				numeric = false
+			default:
+				return false
+			}
+		}
+		if pre && numeric && !isSemverNumber(id) {
+			return false
+		}
+	}
+	return true
+}
+
+// compare returns -1, 0 or 1 if v has a lower, the same or a higher
+// precedence than o. Build metadata is ignored.
+func (v semver) compare(o semver) int {
+	for _, d := range [3][2]int64{
+		{v.major, o.major}, {v.minor, o.minor}, {v.patch, o.patch},
+	} {
+		if d[0] != d[1] {
+			if d[0] < d[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// a pre-release has a lower precedence than the normal version
+	switch {
+	case v.pre == nil && o.pre == nil:
+		return 0
+	case v.pre == nil:
+		return 1
+	case o.pre == nil:
+		return -1
+	}
+	for i := 0; i < len(v.pre) && i < len(o.pre); i++ {
+		if c := compareSemverIdent(v.pre[i], o.pre[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.pre) < len(o.pre):
+		return -1
+	case len(v.pre) > len(o.pre):
+		return 1
+	}
+	return 0
+}
+
+// compareSemverIdent compares pre-release identifiers: numeric identifiers
+// numerically, and lower than alphanumeric ones, which are compared in ASCII
+// order.
+func compareSemverIdent(a, b string) int {
+	an, aErr := strconv.ParseUint(a, 10, 64)
+	bn, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		if an == bn {
+			return 0
+		}
+		if an < bn {
+			return -1
+		}
+		return 1
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// sameCore returns true if v and o have the same major, minor and patch
+// numbers.
+func (v semver) sameCore(o semver) bool {
+	return v.major == o.major && v.minor == o.minor && v.patch == o.patch
+}
+
+// bump returns the lowest version greater than the versions starting with
+// the first parts numbers of v, e.g. 1.3.0 for 1.2.x.
+func (v semver) bump(parts int) semver {
+	switch parts {
+	case 1:
+		return semver{major: v.major + 1}
+	case 2:
+		return semver{major: v.major, minor: v.minor + 1}
+	}
+	return semver{major: v.major, minor: v.minor, patch: v.patch + 1}
+}
+
+// semverComparator matches the versions that compare to v as op says.
+type semverComparator struct {
+	op string // "=", "<", "<=", ">" or ">="
+	v  semver
+}
+
+func (c semverComparator) matches(v semver) bool {
+	r := v.compare(c.v)
+	switch c.op {
+	case "<":
+		return r < 0
+	case "<=":
+		return r <= 0
+	case ">":
+		return r > 0
+	case ">=":
+		return r >= 0
+	}
+	return r == 0
+}
+
+// semverOps are the operators of a range, longest first.
+var semverOps = []string{">=", "<=", ">", "<", "=", "^", "~"}
+
+// parseSemverRange parses a range into sets of comparators: a version
+// satisfies the range if it matches all the comparators of one of the sets.
+// Sets are separated by "||", and their comparators by spaces.
+func parseSemverRange(s string) ([][]semverComparator, error) {
+	var sets [][]semverComparator
+	for _, alt := range strings.Split(s, "||") {
+		fields := strings.Fields(alt)
+		set := []semverComparator{}
+		for i := 0; i < len(fields); i++ {
+			field := fields[i]
+			var op string
+			for _, o := range semverOps {
+				if strings.HasPrefix(field, o) {
+					op = o
+					break
+				}
+			}
+			version := field[len(op):]
+			// an operator may be separated from its version
+			if version == "" && op != "" && i+1 < len(fields) {
+				i++
+				version = fields[i]
+			}
+			v, parts, err := parsePartialSemver(version)
+			if err != nil || version == "" {
+				return nil, fmt.Errorf("invalid version range: %s", s)
+			}
+			set = append(set, expandSemverComparator(op, v, parts)...)
+		}
+		sets = append(sets, set)
+	}
+	return sets, nil
+}
+
+// expandSemverComparator returns the comparators an operator applied to a
+// partial version of the given number of parts stands for.
+func expandSemverComparator(op string, v semver, parts int) []semverComparator {
+	if parts == 0 {
+		// any version
+		return nil
+	}
+	switch op {
+	case "", "=":
+		if parts == 3 {
+			return []semverComparator{{"=", v}}
+		}
+		return []semverComparator{{">=", v}, {"<", v.bump(parts)}}
+	case ">":
+		if parts == 3 {
+			return []semverComparator{{">", v}}
+		}
+		return []semverComparator{{">=", v.bump(parts)}}
+	case "<=":
+		if parts == 3 {
+			return []semverComparator{{"<=", v}}
+		}
+		return []semverComparator{{"<", v.bump(parts)}}
+	case "~":
+		// changes of patch, or of minor if it's not given
+		if parts == 3 {
+			parts = 2
+		}
+		return []semverComparator{{">=", v}, {"<", v.bump(parts)}}
+	case "^":
+		// changes that don't modify the first non-zero number given
+		switch {
+		case v.major > 0 || parts == 1:
+			parts = 1
+		case v.minor > 0 || parts == 2:
+			parts = 2
+		}
+		return []semverComparator{{">=", v}, {"<", v.bump(parts)}}
+	}
+	return []semverComparator{{op, v}}
+}
+
+// satisfies returns true if v satisfies one of the comparator sets. A
+// pre-release version only satisfies a set that has a comparator with a
+// pre-release of the same major, minor and patch numbers, so that e.g.
+// 2.0.0-rc.1 doesn't satisfy "<2.0.0".
+func (v semver) satisfies(sets [][]semverComparator) bool {
+	for _, set := range sets {
+		ok := true
+		for _, c := range set {
+			if !c.matches(v) {
+				ok = false
+				break
+			}
+		}
+		if !ok {
+			continue
+		}
+		if v.pre == nil {
+			return true
+		}
+		for _, c := range set {
+			if c.v.pre != nil && c.v.sameCore(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func semverParse(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	s, ok := tengo.ToString(args[0])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string(compatible)",
+			Found:    args[0].TypeName(),
+		}
+	}
+	v, err := parseSemver(s)
+	if err != nil {
+		return wrapError(err), nil
+	}
+	return &tengo.ImmutableMap{Value: map[string]tengo.Object{
+		"major":      &tengo.Int{Value: v.major},
+		"minor":      &tengo.Int{Value: v.minor},
+		"patch":      &tengo.Int{Value: v.patch},
+		"prerelease": &tengo.String{Value: strings.Join(v.pre, ".")},
+		"build":      &tengo.String{Value: v.build},
+	}}, nil
+}
+
+func semverCompare(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	var versions [2]semver
+	for i, name := range []string{"first", "second"} {
+		s, ok := tengo.ToString(args[i])
+		if !ok {
+			return nil, tengo.ErrInvalidArgumentType{
+				Name:     name,
+				Expected: "string(compatible)",
+				Found:    args[i].TypeName(),
+			}
+		}
+		v, err := parseSemver(s)
+		if err != nil {
+			return wrapError(err), nil
+		}
+		versions[i] = v
+	}
+	return &tengo.Int{Value: int64(versions[0].compare(versions[1]))}, nil
+}
+
+func semverSatisfies(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	s, ok := tengo.ToString(args[0])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string(compatible)",
+			Found:    args[0].TypeName(),
+		}
+	}
+	r, ok := tengo.ToString(args[1])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "string(compatible)",
+			Found:    args[1].TypeName(),
+		}
+	}
+	v, err := parseSemver(s)
+	if err != nil {
+		return wrapError(err), nil
+	}
+	sets, err := parseSemverRange(r)
+	if err != nil {
+		return wrapError(err), nil
+	}
+	if v.satisfies(sets) {
+		return tengo.TrueValue, nil
+	}
+	return tengo.FalseValue, nil
+}
+
+func semverIsValid(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	s, ok := tengo.ToString(args[0])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string(compatible)",
+			Found:    args[0].TypeName(),
+		}
+	}
+	if _, err := parseSemver(s); err != nil {
+		return tengo.FalseValue, nil
+	}
+	return tengo.TrueValue, nil
+}
@@ -0,0 +1,126 @@
+package stdlib_test
+
+import (
+	"testing"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+func TestSemverParse(t *testing.T) {
+	module(t, "semver").call("parse", "1.2.3").expect(IMAP{
+		"major": 1, "minor": 2, "patch": 3, "prerelease": "", "build": "",
+	})
+	module(t, "semver").call("parse", "v10.0.1-rc.1+build.5").expect(IMAP{
+		"major": 10, "minor": 0, "patch": 1, "prerelease": "rc.1",
+		"build": "build.5",
+	})
+	module(t, "semver").call("parse", "1.2").
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "invalid version: 1.2",
+		}})
+	module(t, "semver").call("parse").expectError()
+
+	for _, s := range []string{
+		"0.0.0", "1.2.3", "v1.2.3", "1.0.0-alpha", "1.0.0-alpha.1",
+		"1.0.0-0.3.7", "1.0.0-x-y.7.z.92", "1.0.0+20130313144700",
+		"1.0.0-beta+exp.sha.5114f85",
+	} {
+		module(t, "semver").call("is_valid", s).expect(true)
+	}
+	for _, s := range []string{
+		"", "1", "1.2", "1.2.3.4", "01.2.3", "1.02.3", "1.2.3-", "1.2.3-01",
+		"1.2.3-a..b", "1.2.3+", "1.2.3-a_b", "a.b.c", "1.2.x", "-1.2.3",
+		"1.2.3 ",
+	} {
+		module(t, "semver").call("is_valid", s).expect(false)
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	// in ascending order, as in the specification
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta",
+		"1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1",
+		"1.1.0", "1.10.0", "2.0.0",
+	}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			expected := 0
+			if i < j {
+				expected = -1
+			} else if i > j {
+				expected = 1
+			}
+			module(t, "semver").call("compare", a, b).expect(expected)
+		}
+	}
+	module(t, "semver").call("compare", "1.0.0+a", "v1.0.0+b").expect(0)
+	module(t, "semver").call("compare", "1.0.0", "x").
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "invalid version: x",
+		}})
+	module(t, "semver").call("compare", "1.0.0").expectError()
+}
+
+func TestSemverSatisfies(t *testing.T) {
+	for _, c := range []struct {
+		version, rng string
+		expected     bool
+	}{
+		{"1.2.3", "1.2.3", true},
+		{"1.2.4", "=1.2.3", false},
+		{"1.5.0", ">=1.0.0 <2.0.0", true},
+		{"2.0.0", ">=1.0.0 <2.0.0", false},
+		{"0.9.9", ">= 1.0.0 < 2.0.0", false},
+		{"1.2.0", "^1.2.0", true},
+		{"1.9.9", "^1.2.0", true},
+		{"1.1.9", "^1.2.0", false},
+		{"2.0.0", "^1.2.0", false},
+		{"0.2.5", "^0.2.3", true},
+		{"0.3.0", "^0.2.3", false},
+		{"0.0.3", "^0.0.3", true},
+		{"0.0.4", "^0.0.3", false},
+		{"0.9.0", "^0", true},
+		{"1.0.0", "^0", false},
+		{"1.2.9", "~1.2.3", true},
+		{"1.3.0", "~1.2.3", false},
+		{"1.9.0", "~1", true},
+		{"1.2.7", "1.2", true},
+		{"1.3.0", "1.2.x", false},
+		{"1.3.0", ">1.2", true},
+		{"1.2.9", ">1.2", false},
+		{"1.2.9", "<=1.2", true},
+		{"1.3.0", "<=1.2", false},
+		{"5.0.0", "*", true},
+		{"5.0.0", "", true},
+		{"3.1.0", "^1.0.0 || ^3.0.0", true},
+		{"2.1.0", "^1.0.0 || ^3.0.0", false},
+		{"v1.2.3", "^v1.0.0", true},
+
+		// pre-releases only match ranges with pre-releases of the same
+		// version
+		{"2.0.0-rc.1", "<2.0.0", false},
+		{"2.0.0-rc.1", "^1.0.0", false},
+		{"1.2.3-beta.2", "^1.2.3-beta.1", true},
+		{"1.2.3-alpha", "^1.2.3-beta.1", false},
+		{"1.2.4-beta.1", "^1.2.3-beta.1", false},
+		{"1.2.3", "^1.2.3-beta.1", true},
+	} {
+		module(t, "semver").call("satisfies", c.version, c.rng).
+			expect(c.expected)
+	}
+
+	module(t, "semver").call("satisfies", "1.0.0", ">=1.0 <2.x.1").
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "invalid version range: >=1.0 <2.x.1",
+		}})
+	module(t, "semver").call("satisfies", "1.0.0", ">=").
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "invalid version range: >=",
+		}})
+	module(t, "semver").call("satisfies", "1.0", "^1.0.0").
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "invalid version: 1.0",
+		}})
+	module(t, "semver").call("satisfies", "1.0.0").expectError()
+}
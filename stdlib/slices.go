@@ -0,0 +1,253 @@
+package stdlib
+
+import (
+	"github.com/tiagoj/tengo/v2"
+)
+
+var slicesModule = map[string]tengo.Object{
+	"map": &tengo.UserFunction{
+		Name:    "map",
+		VMValue: slicesMap,
+	}, // map(arr, fn) => array
+	"filter": &tengo.UserFunction{
+		Name:    "filter",
+		VMValue: slicesFilter,
+	}, // filter(arr, fn) => array
+	"reduce": &tengo.UserFunction{
+		Name:    "reduce",
+		VMValue: slicesReduce,
+	}, // reduce(arr, fn, init) => any
+	"find": &tengo.UserFunction{
+		Name:    "find",
+		VMValue: slicesFind,
+	}, // find(arr, fn) => any/undefined
+	"any": &tengo.UserFunction{
+		Name:    "any",
+		VMValue: slicesAny,
+	}, // any(arr, fn) => bool
+	"all": &tengo.UserFunction{
+		Name:    "all",
+		VMValue: slicesAll,
+	}, // all(arr, fn) => bool
+	"chunk": &tengo.UserFunction{
+		Name:  "chunk",
+		Value: slicesChunk,
+	}, // chunk(arr, size) => [array]/error
+}
+
+func slicesMap(vm *tengo.VM, args ...tengo.Object) (ret tengo.Object, err error) {
+	if len(args) != 2 {
+		err = tengo.ErrWrongNumArguments
+		return
+	}
+
+	items, fn, err := slicesArgs(args)
+	if err != nil {
+		return
+	}
+
+	res := make([]tengo.Object, 0, len(items))
+	for _, item := range items {
+		v, err := vm.Call(fn, item)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+
+	return &tengo.Array{Value: res}, nil
+}
+
+func slicesFilter(vm *tengo.VM, args ...tengo.Object) (ret tengo.Object, err error) {
+	if len(args) != 2 {
+		err = tengo.ErrWrongNumArguments
+		return
+	}
+
+	items, fn, err := slicesArgs(args)
+	if err != nil {
+		return
+	}
+
+	res := make([]tengo.Object, 0, len(items))
+	for _, item := range items {
+		v, err := vm.Call(fn, item)
+		if err != nil {
+			return nil, err
+		}
+		if !v.IsFalsy() {
+			res = append(res, item)
+		}
+	}
+
+	return &tengo.Array{Value: res}, nil
+}
+
+func slicesReduce(vm *tengo.VM, args ...tengo.Object) (ret tengo.Object, err error) {
+	if len(args) != 3 {
+		err = tengo.ErrWrongNumArguments
+		return
+	}
+
+	items, fn, err := slicesArgs(args)
+	if err != nil {
+		return
+	}
+
+	acc := args[2]
+	for _, item := range items {
+		acc, err = vm.Call(fn, acc, item)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return acc, nil
+}
+
+func slicesFind(vm *tengo.VM, args ...tengo.Object) (ret tengo.Object, err error) {
+	if len(args) != 2 {
+		err = tengo.ErrWrongNumArguments
+		return
+	}
+
+	items, fn, err := slicesArgs(args)
+	if err != nil {
+		return
+	}
+
+	for _, item := range items {
+		v, err := vm.Call(fn, item)
+		if err != nil {
+			return nil, err
+		}
+		if !v.IsFalsy() {
+			return item, nil
+		}
+	}
+
+	return tengo.UndefinedValue, nil
+}
+
+func slicesAny(vm *tengo.VM, args ...tengo.Object) (ret tengo.Object, err error) {
+	return slicesMatch(vm, args, true)
+}
+
+func slicesAll(vm *tengo.VM, args ...tengo.Object) (ret tengo.Object, err error) {
+	return slicesMatch(vm, args, false)
+}
+
+// slicesMatch returns whether fn is truthy for any (or all) of the items,
+// stopping at the first item that decides the result.
+func slicesMatch(
+	vm *tengo.VM,
+	args []tengo.Object,
+	wantAny bool,
+) (ret tengo.Object, err error) {
+	if len(args) != 2 {
+		err = tengo.ErrWrongNumArguments
+		return
+	}
+
+	items, fn, err := slicesArgs(args)
+	if err != nil {
+		return
+	}
+
+	for _, item := range items {
+		v, err := vm.Call(fn, item)
+		if err != nil {
+			return nil, err
+		}
+		if v.IsFalsy() != wantAny {
+			if wantAny {
+				return tengo.TrueValue, nil
+			}
+			return tengo.FalseValue, nil
+		}
+	}
+
+	if wantAny {
+		return tengo.FalseValue, nil
+	}
+	return tengo.TrueValue, nil
+}
+
+// slicesChunk splits an array into arrays of at most size elements. Each
+// chunk has its own copy of the elements, so appending to it never affects the
+// input array or the other chunks.
+func slicesChunk(args ...tengo.Object) (ret tengo.Object, err error) {
+	if len(args) != 2 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	var items []tengo.Object
+	switch arg := args[0].(type) {
+	case *tengo.Array:
+		items = arg.Value
+	case *tengo.ImmutableArray:
+		items = arg.Value
+	default:
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "array",
+			Found:    args[0].TypeName(),
+		}
+	}
+	size, ok := args[1].(*tengo.Int)
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "int",
+			Found:    args[1].TypeName(),
+		}
+	}
+	if size.Value <= 0 {
+		return &tengo.Error{Value: &tengo.String{
+			Value: "chunk size must be greater than 0",
+		}}, nil
+	}
+
+	n := int64(len(items))
+	numChunks := n / size.Value
+	if n%size.Value != 0 {
+		numChunks++
+	}
+	chunks := make([]tengo.Object, 0, numChunks)
+	for start := int64(0); start < n; start += size.Value {
+		end := start + size.Value
+		if end > n {
+			end = n
+		}
+		chunks = append(chunks, &tengo.Array{
+			Value: append([]tengo.Object{}, items[start:end]...),
+		})
+	}
+	return &tengo.Array{Value: chunks}, nil
+}
+
+// slicesArgs returns a snapshot of the array elements of the first argument
+// and the callable second argument. Working on a snapshot keeps the iteration
+// stable even if the callback modifies the input array.
+func slicesArgs(args []tengo.Object) ([]tengo.Object, tengo.Object, error) {
+	var items []tengo.Object
+	switch arg := args[0].(type) {
+	case *tengo.Array:
+		items = arg.Items()
+	case *tengo.ImmutableArray:
+		items = append([]tengo.Object{}, arg.Value...)
+	default:
+		return nil, nil, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "array",
+			Found:    args[0].TypeName(),
+		}
+	}
+	if !args[1].CanCall() {
+		return nil, nil, tengo.ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "callable",
+			Found:    args[1].TypeName(),
+		}
+	}
+	return items, args[1], nil
+}
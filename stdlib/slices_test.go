@@ -0,0 +1,161 @@
+package stdlib_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tiagoj/tengo/v2"
+	"github.com/tiagoj/tengo/v2/require"
+	"github.com/tiagoj/tengo/v2/stdlib"
+)
+
+func expectSlices(t *testing.T, input string, expected interface{}) {
+	s := tengo.NewScript([]byte(input))
+	s.SetImports(stdlib.GetModuleMap("slices"))
+	c, err := s.Run()
+	require.NoError(t, err)
+	require.Equal(t, object(expected), c.Get("out").Object())
+}
+
+func TestSlices(t *testing.T) {
+	expectSlices(t, `
+slices := import("slices")
+out := slices.map([1, 2, 3], func(x) { return x * 2 })
+`, ARR{2, 4, 6})
+
+	expectSlices(t, `
+slices := import("slices")
+out := slices.filter([1, 2, 3, 4, 5], func(x) { return x % 2 == 1 })
+`, ARR{1, 3, 5})
+
+	expectSlices(t, `
+slices := import("slices")
+out := slices.reduce([1, 2, 3, 4], func(acc, x) { return acc + x }, 10)
+`, 20)
+
+	expectSlices(t, `
+slices := import("slices")
+out := slices.reduce([], func(acc, x) { return acc + x }, 0)
+`, 0)
+
+	expectSlices(t, `
+slices := import("slices")
+out := [slices.find([1, 5, 10], func(x) { return x > 3 }),
+	slices.find([1, 2], func(x) { return x > 3 })]
+`, ARR{5, tengo.UndefinedValue})
+
+	expectSlices(t, `
+slices := import("slices")
+gt := func(n) { return func(x) { return x > n } }
+out := [slices.any([1, 2, 3], gt(2)), slices.any([1, 2, 3], gt(3)),
+	slices.all([1, 2, 3], gt(0)), slices.all([1, 2, 3], gt(1)),
+	slices.any([], gt(0)), slices.all([], gt(0))]
+`, ARR{true, false, true, false, false, true})
+
+	// callbacks see globals and builtins; the input is left untouched
+	expectSlices(t, `
+slices := import("slices")
+factor := 3
+calls := 0
+input := [1, 2, 3]
+res := slices.map(input, func(x) {
+	calls++
+	input = append(input, x)
+	return x * factor
+})
+out := [res, calls, len(input)]
+`, ARR{ARR{3, 6, 9}, 3, 6})
+
+	expectSlices(t, `
+slices := import("slices")
+out := slices.map(immutable([1, 2]), string)
+`, ARR{"1", "2"})
+}
+
+func TestSlicesErrors(t *testing.T) {
+	expectSlicesError := func(src, expected string) {
+		s := tengo.NewScript([]byte(src))
+		s.SetImports(stdlib.GetModuleMap("slices"))
+		_, err := s.Run()
+		require.Error(t, err)
+		require.True(t, strings.Contains(err.Error(), expected), err.Error())
+	}
+
+	expectSlicesError(`
+slices := import("slices")
+slices.map([1, 2, 0], func(x) { return 10 / x + undefined })
+`, "invalid operation: int + undefined")
+	expectSlicesError(`
+slices := import("slices")
+slices.reduce([1], func(x) { return x }, 0)
+`, "wrong number of arguments: want=1, got=2")
+	expectSlicesError(`
+slices := import("slices")
+slices.filter(1, func(x) { return x })
+`, "invalid type for argument 'first' in call to 'user-function:filter'")
+	expectSlicesError(`
+slices := import("slices")
+slices.all([1], 2)
+`, "invalid type for argument 'second' in call to 'user-function:all'")
+}
+
+func TestSlicesChunk(t *testing.T) {
+	module(t, "slices").call("chunk", ARR{1, 2, 3, 4, 5, 6}, 2).
+		expect(ARR{ARR{1, 2}, ARR{3, 4}, ARR{5, 6}})
+	module(t, "slices").call("chunk", ARR{1, 2, 3, 4, 5}, 2).
+		expect(ARR{ARR{1, 2}, ARR{3, 4}, ARR{5}})
+	module(t, "slices").call("chunk", ARR{1, 2, 3}, 3).
+		expect(ARR{ARR{1, 2, 3}})
+	module(t, "slices").call("chunk", ARR{1, 2, 3}, 10).
+		expect(ARR{ARR{1, 2, 3}})
+	module(t, "slices").call("chunk", ARR{1, 2}, 1).
+		expect(ARR{ARR{1}, ARR{2}})
+	module(t, "slices").call("chunk", ARR{}, 2).expect(ARR{})
+	module(t, "slices").call("chunk", ARR{1}, 9223372036854775807).
+		expect(ARR{ARR{1}})
+	module(t, "slices").call("chunk", ARR{1, 2}, 0).
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "chunk size must be greater than 0"}})
+	module(t, "slices").call("chunk", ARR{1, 2}, -1).
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "chunk size must be greater than 0"}})
+	module(t, "slices").call("chunk", ARR{1, 2}, "2").expectError()
+	module(t, "slices").call("chunk", "12", 2).expectError()
+	module(t, "slices").call("chunk", ARR{1, 2}).expectError()
+
+	// chunks don't share their elements with the input
+	expectSlices(t, `
+slices := import("slices")
+a := [1, 2, 3, 4, 5]
+chunks := slices.chunk(a, 2)
+chunks[0] = append(chunks[0], "x")
+chunks[0][0] = "y"
+out := [a, chunks]
+`, ARR{ARR{1, 2, 3, 4, 5}, ARR{ARR{"y", 2, "x"}, ARR{3, 4}, ARR{5}}})
+	expectSlices(t, `
+slices := import("slices")
+out := slices.chunk(immutable([1, 2, 3]), 2)
+`, ARR{ARR{1, 2}, ARR{3}})
+}
+
+func TestSlicesExecutionContext(t *testing.T) {
+	s := tengo.NewScript([]byte(`
+slices := import("slices")
+offset := 100
+total := func(arr) {
+	return slices.reduce(slices.map(arr, func(x) { return x + offset }),
+		func(acc, x) { return acc + x }, 0)
+}
+`))
+	s.SetImports(stdlib.GetModuleMap("slices"))
+	compiled, err := s.Run()
+	require.NoError(t, err)
+
+	fn := compiled.Get("total").Value().(*tengo.CompiledFunction)
+	res, err := tengo.NewExecutionContext(compiled).Call(fn,
+		&tengo.Array{Value: []tengo.Object{
+			&tengo.Int{Value: 1}, &tengo.Int{Value: 2},
+		}})
+	require.NoError(t, err)
+	require.Equal(t, int64(203), res.(*tengo.Int).Value)
+}
@@ -1,11 +1,26 @@
 package stdlib
 
 import (
+	"errors"
 	"time"
 
 	"github.com/tiagoj/tengo/v2"
 )
 
+// TimesSleepEnabled allows scripts to pause with the "sleep" function of the
+// "times" module. It's disabled by default as sleeping scripts can hold on to
+// the host's resources; sleep returns ErrSleepDisabled then. It's not
+// recommended to change this value while any VM is executing.
+var TimesSleepEnabled = false
+
+// ErrSleepDisabled is returned by the "sleep" function of the "times" module
+// unless TimesSleepEnabled is set.
+var ErrSleepDisabled = errors.New("times.sleep is disabled")
+
+// timesSleepInterval is how often a sleeping script checks whether it has
+// been aborted.
+const timesSleepInterval = 10 * time.Millisecond
+
 var timesModule = map[string]tengo.Object{
 	"format_ansic":        &tengo.String{Value: time.ANSIC},
 	"format_unix_date":    &tengo.String{Value: time.UnixDate},
@@ -41,8 +56,11 @@ var timesModule = map[string]tengo.Object{
 	"november":            &tengo.Int{Value: int64(time.November)},
 	"december":            &tengo.Int{Value: int64(time.December)},
 	"sleep": &tengo.UserFunction{
-		Name:  "sleep",
-		Value: timesSleep,
+		Name: "sleep",
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			return timesSleep(nil, args...)
+		},
+		VMValue: timesSleep,
 	}, // sleep(int)
 	"parse_duration": &tengo.UserFunction{
 		Name:  "parse_duration",
@@ -76,6 +94,10 @@ var timesModule = map[string]tengo.Object{
 		Name:  "duration_string",
 		Value: timesDurationString,
 	}, // duration_string(int) => string
+	"humanize_duration": &tengo.UserFunction{
+		Name:  "humanize_duration",
+		Value: timesDurationString,
+	}, // humanize_duration(int) => string
 	"month_string": &tengo.UserFunction{
 		Name:  "month_string",
 		Value: timesMonthString,
@@ -186,7 +208,8 @@ var timesModule = map[string]tengo.Object{
 	}, // in_location(time, location) => time
 }
 
-func timesSleep(args ...tengo.Object) (ret tengo.Object, err error) {
+// timesSleep pauses for the given duration, or until the VM is aborted.
+func timesSleep(v *tengo.VM, args ...tengo.Object) (ret tengo.Object, err error) {
 	if len(args) != 1 {
 		err = tengo.ErrWrongNumArguments
 		return
@@ -202,7 +225,26 @@ func timesSleep(args ...tengo.Object) (ret tengo.Object, err error) {
 		return
 	}
 
-	time.Sleep(time.Duration(i1))
+	if !TimesSleepEnabled {
+		err = ErrSleepDisabled
+		return
+	}
+
+	if v == nil {
+		time.Sleep(time.Duration(i1))
+	} else {
+		deadline := time.Now().Add(time.Duration(i1))
+		for !v.IsAborted() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				break
+			}
+			if d > timesSleepInterval {
+				d = timesSleepInterval
+			}
+			time.Sleep(d)
+		}
+	}
 	ret = tengo.UndefinedValue
 
 	return
@@ -227,9 +269,9 @@ func timesParseDuration(args ...tengo.Object) (
 		return
 	}
 
-	dur, err := time.ParseDuration(s1)
-	if err != nil {
-		ret = wrapError(err)
+	dur, parseErr := time.ParseDuration(s1)
+	if parseErr != nil {
+		ret = wrapError(parseErr)
 		return
 	}
 
@@ -1,11 +1,13 @@
 package stdlib_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/tiagoj/tengo/v2"
 	"github.com/tiagoj/tengo/v2/require"
+	"github.com/tiagoj/tengo/v2/stdlib"
 )
 
 func TestTimes(t *testing.T) {
@@ -14,7 +16,10 @@ func TestTimes(t *testing.T) {
 	location, _ := time.LoadLocation("Pacific/Auckland")
 	time3 := time.Date(1982, 9, 28, 19, 21, 44, 999, location)
 
+	module(t, "times").call("sleep", 1).expectError()
+	stdlib.TimesSleepEnabled = true
 	module(t, "times").call("sleep", 1).expect(tengo.UndefinedValue)
+	stdlib.TimesSleepEnabled = false
 
 	require.True(t, module(t, "times").
 		call("since", time.Now().Add(-time.Hour)).
@@ -31,6 +36,12 @@ func TestTimes(t *testing.T) {
 	module(t, "times").call("duration_nanoseconds", 100).expect(100)
 	module(t, "times").call("duration_seconds", 1000000).expect(0.001)
 	module(t, "times").call("duration_string", 1800000000000).expect("30m0s")
+	module(t, "times").call("humanize_duration", 5400000000000).
+		expect("1h30m0s")
+	module(t, "times").call("parse_duration", "1h30m").expect(5400000000000)
+	module(t, "times").call("parse_duration", "1x").
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: `time: unknown unit "x" in duration "1x"`}})
 
 	module(t, "times").call("month_string", 1).expect("January")
 	module(t, "times").call("month_string", 12).expect("December")
@@ -87,3 +98,31 @@ func TestTimes(t *testing.T) {
 	module(t, "times").call("time_string", time1).expect(time1.String())
 	module(t, "times").call("in_location", time1, location.String()).expect(time1.In(location))
 }
+
+func TestTimesDurationRoundTrip(t *testing.T) {
+	for _, d := range []string{"1h30m0s", "0s", "-2m3.5s", "1.5µs", "100ms"} {
+		expect(t, `
+times := import("times")
+out := times.humanize_duration(times.parse_duration("`+d+`"))
+`, d)
+	}
+}
+
+func TestTimesSleepAbort(t *testing.T) {
+	stdlib.TimesSleepEnabled = true
+	defer func() { stdlib.TimesSleepEnabled = false }()
+
+	s := tengo.NewScript([]byte(`
+times := import("times")
+times.sleep(10 * times.second)
+`))
+	s.SetImports(stdlib.GetModuleMap("times"))
+	ctx, cancel := context.WithTimeout(context.Background(),
+		50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := s.RunContext(ctx)
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.True(t, time.Since(start) < time.Second)
+}
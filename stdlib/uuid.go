@@ -0,0 +1,145 @@
+package stdlib
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+// UUIDRandom is the source of the random bits of the identifiers generated by
+// the "uuid" module. It can be replaced, e.g. with a seeded reader to get
+// reproducible identifiers in tests. It's not recommended to change this value
+// while any VM is executing.
+var UUIDRandom io.Reader = rand.Reader
+
+var uuidModule = map[string]tengo.Object{
+	"v4": &tengo.UserFunction{
+		Name:  "v4",
+		Value: FuncARSE(uuidV4),
+	}, // v4() => string
+	"ulid": &tengo.UserFunction{
+		Name:  "ulid",
+		Value: FuncARSE(uuidULID),
+	}, // ulid() => string
+	"ulid_at": &tengo.UserFunction{
+		Name:  "ulid_at",
+		Value: uuidULIDAt,
+	}, // ulid_at(unix_ms) => string/error
+}
+
+// crockford is the Crockford base32 alphabet used to encode ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidMaxTime is the greatest timestamp a ULID can hold, in milliseconds.
+const ulidMaxTime = 1<<48 - 1
+
+var (
+	// ulidLock protects the last ULID generated by ulid, which is used to
+	// keep the ULIDs generated within the same millisecond sorted.
+	ulidLock sync.Mutex
+	ulidLast [16]byte
+)
+
+func uuidV4() (string, error) {
+	var b [16]byte
+	if _, err := io.ReadFull(UUIDRandom, b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x",
+		b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+func uuidULID() (string, error) {
+	ms := time.Now().UnixMilli()
+
+	ulidLock.Lock()
+	defer ulidLock.Unlock()
+
+	var id [16]byte
+	putULIDTime(&id, ms)
+	if !ulidTimeBefore(ulidLast, id) {
+		// same millisecond (or the clock went back): increment the random
+		// part of the last ULID so that the new one sorts after it
+		id = ulidLast
+		i := 15
+		for ; i >= 6; i-- {
+			id[i]++
+			if id[i] != 0 {
+				break
+			}
+		}
+		if i < 6 {
+			return "", errors.New("ulid random part overflow")
+		}
+	} else if _, err := io.ReadFull(UUIDRandom, id[6:]); err != nil {
+		return "", err
+	}
+	ulidLast = id
+	return encodeULID(id), nil
+}
+
+func uuidULIDAt(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	ms, ok := tengo.ToInt64(args[0])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "int(compatible)",
+			Found:    args[0].TypeName(),
+		}
+	}
+	if ms < 0 || ms > ulidMaxTime {
+		return wrapError(errors.New("ulid timestamp out of range")), nil
+	}
+	var id [16]byte
+	putULIDTime(&id, ms)
+	if _, err := io.ReadFull(UUIDRandom, id[6:]); err != nil {
+		return wrapError(err), nil
+	}
+	return &tengo.String{Value: encodeULID(id)}, nil
+}
+
+// putULIDTime stores the 48-bit timestamp ms in the first 6 bytes of id.
+func putULIDTime(id *[16]byte, ms int64) {
+	for i := 5; i >= 0; i-- {
+		id[i] = byte(ms)
+		ms >>= 8
+	}
+}
+
+// ulidTimeBefore returns true if the timestamp of a is before that of b.
+func ulidTimeBefore(a, b [16]byte) bool {
+	for i := 0; i < 6; i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+// encodeULID encodes the 128 bits of id as 26 Crockford base32 characters,
+// 5 bits each, the first character holding the 3 most significant bits.
+func encodeULID(id [16]byte) string {
+	var out [26]byte
+	for i := range out {
+		bit := i*5 - 2 // offset of the first bit in id, with 2 padding bits
+		var v int
+		for j := 0; j < 5; j++ {
+			v <<= 1
+			if b := bit + j; b >= 0 && id[b/8]&(0x80>>(b%8)) != 0 {
+				v |= 1
+			}
+		}
+		out[i] = crockford[v]
+	}
+	return string(out[:])
+}
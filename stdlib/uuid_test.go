@@ -0,0 +1,101 @@
+package stdlib_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/tiagoj/tengo/v2"
+	"github.com/tiagoj/tengo/v2/require"
+	"github.com/tiagoj/tengo/v2/stdlib"
+)
+
+var ulidPattern = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+
+func TestUUIDv4(t *testing.T) {
+	pattern := regexp.MustCompile(
+		`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		res := module(t, "uuid").call("v4")
+		require.NoError(t, res.e)
+		id := res.o.(*tengo.String).Value
+		require.True(t, pattern.MatchString(id), id)
+		require.False(t, seen[id])
+		seen[id] = true
+	}
+	module(t, "uuid").call("v4", 1).expectError()
+}
+
+func TestUUIDULID(t *testing.T) {
+	ulid := func() string {
+		res := module(t, "uuid").call("ulid")
+		require.NoError(t, res.e)
+		return res.o.(*tengo.String).Value
+	}
+
+	// format and timestamp
+	before := time.Now().UnixMilli()
+	id := ulid()
+	require.True(t, ulidPattern.MatchString(id), id)
+	prefix := module(t, "uuid").call("ulid_at", before).o.(*tengo.String).Value
+	require.True(t, prefix[:10] <= id[:10], prefix, id)
+
+	// ULIDs generated later sort after the earlier ones, even within the
+	// same millisecond
+	prev := id
+	for i := 0; i < 1000; i++ {
+		id := ulid()
+		require.True(t, prev < id, prev, id)
+		prev = id
+	}
+	time.Sleep(2 * time.Millisecond)
+	id = ulid()
+	require.True(t, prev[:10] < id[:10], prev, id)
+	module(t, "uuid").call("ulid", 1).expectError()
+}
+
+func TestUUIDULIDAt(t *testing.T) {
+	defer func(r io.Reader) { stdlib.UUIDRandom = r }(stdlib.UUIDRandom)
+
+	// the reference ULID of the specification
+	stdlib.UUIDRandom = bytes.NewReader(make([]byte, 10))
+	module(t, "uuid").call("ulid_at", 1469918176385).
+		expect("01ARYZ6S410000000000000000")
+	stdlib.UUIDRandom = bytes.NewReader(bytes.Repeat([]byte{0xff}, 10))
+	module(t, "uuid").call("ulid_at", 1<<48-1).
+		expect("7ZZZZZZZZZZZZZZZZZZZZZZZZZ")
+	stdlib.UUIDRandom = bytes.NewReader(make([]byte, 10))
+	module(t, "uuid").call("ulid_at", 0).expect("00000000000000000000000000")
+
+	// deterministic for a given timestamp and seed
+	gen := func(seed int64, ms int64) string {
+		stdlib.UUIDRandom = rand.New(rand.NewSource(seed))
+		res := module(t, "uuid").call("ulid_at", ms)
+		require.NoError(t, res.e)
+		return res.o.(*tengo.String).Value
+	}
+	a := gen(42, 1700000000000)
+	require.True(t, ulidPattern.MatchString(a), a)
+	require.Equal(t, a, gen(42, 1700000000000))
+	require.True(t, a != gen(43, 1700000000000))
+	require.Equal(t, a[:10], gen(43, 1700000000000)[:10])
+	require.True(t, a < gen(42, 1700000000001))
+
+	module(t, "uuid").call("ulid_at", -1).
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "ulid timestamp out of range"}})
+	module(t, "uuid").call("ulid_at", int64(1)<<48).
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "ulid timestamp out of range"}})
+	module(t, "uuid").call("ulid_at", "x").expectError()
+	module(t, "uuid").call("ulid_at").expectError()
+
+	// a failing source of randomness results in an error object
+	stdlib.UUIDRandom = bytes.NewReader(nil)
+	module(t, "uuid").call("ulid_at", 0).
+		expect(&tengo.Error{Value: &tengo.String{Value: "EOF"}})
+}
@@ -0,0 +1,188 @@
+package stdlib
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/tiagoj/tengo/v2"
+)
+
+var validateModule = map[string]tengo.Object{
+	"email": &tengo.UserFunction{
+		Name:  "email",
+		Value: validateBool(FuncASRS(validateEmail)),
+	}, // email(s) => bool
+	"url": &tengo.UserFunction{
+		Name:  "url",
+		Value: validateBool(FuncASRS(validateURL)),
+	}, // url(s) => bool
+	"ipv4": &tengo.UserFunction{
+		Name:  "ipv4",
+		Value: validateBool(FuncASRS(validateIPv4)),
+	}, // ipv4(s) => bool
+	"in_range": &tengo.UserFunction{
+		Name:  "in_range",
+		Value: validateBool(validateInRange),
+	}, // in_range(n, lo, hi) => bool
+	"matches": &tengo.UserFunction{
+		Name:  "matches",
+		Value: validateBool(validateMatches),
+	}, // matches(s, pattern) => bool/error
+	"reason": &tengo.ImmutableMap{
+		Value: map[string]tengo.Object{
+			"email": &tengo.UserFunction{
+				Name:  "email",
+				Value: FuncASRS(validateEmail),
+			}, // reason.email(s) => string
+			"url": &tengo.UserFunction{
+				Name:  "url",
+				Value: FuncASRS(validateURL),
+			}, // reason.url(s) => string
+			"ipv4": &tengo.UserFunction{
+				Name:  "ipv4",
+				Value: FuncASRS(validateIPv4),
+			}, // reason.ipv4(s) => string
+			"in_range": &tengo.UserFunction{
+				Name:  "in_range",
+				Value: validateInRange,
+			}, // reason.in_range(n, lo, hi) => string
+			"matches": &tengo.UserFunction{
+				Name:  "matches",
+				Value: validateMatches,
+			}, // reason.matches(s, pattern) => string/error
+		},
+	},
+}
+
+// validateBool turns a function returning the reason a value is invalid into
+// one returning whether the value is valid. Results other than strings, such
+// as error objects, are returned unchanged.
+func validateBool(fn tengo.CallableFunc) tengo.CallableFunc {
+	return func(args ...tengo.Object) (tengo.Object, error) {
+		ret, err := fn(args...)
+		if err != nil {
+			return nil, err
+		}
+		reason, ok := ret.(*tengo.String)
+		if !ok {
+			return ret, nil
+		}
+		if reason.Value == "" {
+			return tengo.TrueValue, nil
+		}
+		return tengo.FalseValue, nil
+	}
+}
+
+// validateEmail returns why s is not a plain email address, or an empty
+// string if it is one. Addresses with a display name are rejected.
+func validateEmail(s string) string {
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return "invalid email address: " +
+			strings.TrimPrefix(err.Error(), "mail: ")
+	}
+	if addr.Address != s {
+		return "invalid email address: unexpected display name"
+	}
+	return ""
+}
+
+// validateURL returns why s is not an absolute URL with a host, or an empty
+// string if it is one.
+func validateURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "invalid url: " + err.(*url.Error).Err.Error()
+	}
+	if u.Scheme == "" {
+		return "invalid url: missing scheme"
+	}
+	if u.Host == "" {
+		return "invalid url: missing host"
+	}
+	return ""
+}
+
+// validateIPv4 returns why s is not an IPv4 address in dotted decimal
+// notation, or an empty string if it is one.
+func validateIPv4(s string) string {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return "invalid IP address"
+	}
+	if ip.To4() == nil || strings.Contains(s, ":") {
+		return "not an IPv4 address"
+	}
+	return ""
+}
+
+// validateInRange returns why n is not within [lo, hi], or an empty string if
+// it is.
+func validateInRange(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 3 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	var values [3]float64
+	for i, name := range []string{"first", "second", "third"} {
+		switch arg := args[i].(type) {
+		case *tengo.Int:
+			values[i] = float64(arg.Value)
+		case *tengo.Float:
+			values[i] = arg.Value
+		default:
+			return nil, tengo.ErrInvalidArgumentType{
+				Name:     name,
+				Expected: "int/float",
+				Found:    args[i].TypeName(),
+			}
+		}
+	}
+	var reason string
+	switch n, lo, hi := values[0], values[1], values[2]; {
+	case n < lo:
+		reason = fmt.Sprintf("%s is less than %s", args[0], args[1])
+	case n > hi:
+		reason = fmt.Sprintf("%s is greater than %s", args[0], args[2])
+	}
+	return &tengo.String{Value: reason}, nil
+}
+
+// validateMatches returns why s does not match the regular expression
+// pattern, or an empty string if it does. It returns an error object if the
+// pattern is invalid.
+func validateMatches(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	s, ok := tengo.ToString(args[0])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string(compatible)",
+			Found:    args[0].TypeName(),
+		}
+	}
+	pattern, ok := tengo.ToString(args[1])
+	if !ok {
+		return nil, tengo.ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "string(compatible)",
+			Found:    args[1].TypeName(),
+		}
+	}
+	matched, err := regexp.MatchString(pattern, s)
+	if err != nil {
+		return wrapError(err), nil
+	}
+	if !matched {
+		return &tengo.String{
+			Value: fmt.Sprintf("does not match pattern %q", pattern),
+		}, nil
+	}
+	return &tengo.String{}, nil
+}
@@ -0,0 +1,67 @@
+package stdlib_test
+
+import (
+	"testing"
+
+	"github.com/tiagoj/tengo/v2"
+	"github.com/tiagoj/tengo/v2/stdlib"
+)
+
+func TestValidate(t *testing.T) {
+	module(t, "validate").call("email", "user@example.com").expect(true)
+	module(t, "validate").call("email", "first.last+tag@sub.example.org").expect(true)
+	module(t, "validate").call("email", "user@").expect(false)
+	module(t, "validate").call("email", "example.com").expect(false)
+	module(t, "validate").call("email", "Bob <bob@example.com>").expect(false)
+	module(t, "validate").call("email", "").expect(false)
+	module(t, "validate").call("email").expectError()
+
+	module(t, "validate").call("url", "https://example.com/a?b=c").expect(true)
+	module(t, "validate").call("url", "ftp://127.0.0.1:21").expect(true)
+	module(t, "validate").call("url", "example.com").expect(false)
+	module(t, "validate").call("url", "https://").expect(false)
+	module(t, "validate").call("url", "http://a b.com").expect(false)
+
+	module(t, "validate").call("ipv4", "192.168.0.1").expect(true)
+	module(t, "validate").call("ipv4", "0.0.0.0").expect(true)
+	module(t, "validate").call("ipv4", "256.1.1.1").expect(false)
+	module(t, "validate").call("ipv4", "1.2.3").expect(false)
+	module(t, "validate").call("ipv4", "::1").expect(false)
+	module(t, "validate").call("ipv4", "::ffff:1.2.3.4").expect(false)
+
+	module(t, "validate").call("in_range", 5, 1, 10).expect(true)
+	module(t, "validate").call("in_range", 1, 1, 10).expect(true)
+	module(t, "validate").call("in_range", 10.0, 1, 10).expect(true)
+	module(t, "validate").call("in_range", 0.5, 1, 10).expect(false)
+	module(t, "validate").call("in_range", 11, 1, 10).expect(false)
+	module(t, "validate").call("in_range", "5", 1, 10).expectError()
+	module(t, "validate").call("in_range", 5, 1).expectError()
+
+	module(t, "validate").call("matches", "abc123", `^[a-z]+\d+$`).expect(true)
+	module(t, "validate").call("matches", "abc", `^\d+$`).expect(false)
+	module(t, "validate").call("matches", "abc", `(`).
+		expect(&tengo.Error{Value: &tengo.String{
+			Value: "error parsing regexp: missing closing ): `(`"}})
+
+	reason := callres{t: t, o: stdlib.BuiltinModules["validate"]["reason"]}
+	reason.call("email", "user@example.com").expect("")
+	reason.call("email", "Bob <bob@example.com>").
+		expect("invalid email address: unexpected display name")
+	reason.call("url", "https://example.com").expect("")
+	reason.call("url", "example.com").expect("invalid url: missing scheme")
+	reason.call("url", "https://").expect("invalid url: missing host")
+	reason.call("ipv4", "1.2.3.4").expect("")
+	reason.call("ipv4", "1.2.3").expect("invalid IP address")
+	reason.call("ipv4", "::1").expect("not an IPv4 address")
+	reason.call("in_range", 5, 1, 10).expect("")
+	reason.call("in_range", 0, 1, 10).expect("0 is less than 1")
+	reason.call("in_range", 11.5, 1, 10).expect("11.5 is greater than 10")
+	reason.call("matches", "abc", "^a").expect("")
+	reason.call("matches", "abc", "^b").expect(`does not match pattern "^b"`)
+
+	expect(t, `
+validate := import("validate")
+out := validate.email("a@b.co") && !validate.ipv4("x") &&
+	validate.reason.email("user@") != ""
+`, true)
+}
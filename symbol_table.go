@@ -17,6 +17,11 @@ type Symbol struct {
 	Scope         SymbolScope
 	Index         int
 	LocalAssigned bool // if the local symbol is assigned at least once
+	Constant      bool // if the symbol is declared with const
+
+	// value is the value of a constant known at compile time, which the
+	// references to the constant use instead of the variable.
+	value Object
 }
 
 // SymbolTable represents a symbol table.
@@ -105,10 +110,12 @@ func (t *SymbolTable) Resolve(
 	depth++
 
 	// if symbol is defined in parent table and if it's not global/builtin
-	// then it's free variable.
+	// then it's free variable, unless it's a constant known at compile time,
+	// which is never read from its variable.
 	if !t.block && depth > 0 &&
 		symbol.Scope != ScopeGlobal &&
-		symbol.Scope != ScopeBuiltin {
+		symbol.Scope != ScopeBuiltin &&
+		symbol.value == nil {
 		return t.defineFree(symbol), depth, true
 	}
 	return symbol, depth, true
@@ -158,6 +165,34 @@ func (t *SymbolTable) Names() []string {
 	return names
 }
 
+// lookup returns the symbol with the given name in t or its parents, or nil.
+// Unlike Resolve, it doesn't define free symbols.
+func (t *SymbolTable) lookup(name string) *Symbol {
+	for ; t != nil; t = t.parent {
+		if symbol, ok := t.store[name]; ok {
+			return symbol
+		}
+	}
+	return nil
+}
+
+// origin returns the symbol a free symbol resolved in t refers to, in the
+// scope that defines it, or the symbol itself if it's not free.
+func (t *SymbolTable) origin(symbol *Symbol) *Symbol {
+	for symbol.Scope == ScopeFree {
+		// the free symbol is stored in the table of its function
+		for t != nil && t.store[symbol.Name] != symbol {
+			t = t.parent
+		}
+		if t == nil {
+			break
+		}
+		symbol = t.freeSymbols[symbol.Index]
+		t = t.parent
+	}
+	return symbol
+}
+
 func (t *SymbolTable) nextIndex() int {
 	if t.block {
 		return t.parent.nextIndex() + t.numDefinition
@@ -178,9 +213,10 @@ func (t *SymbolTable) defineFree(original *Symbol) *Symbol {
 	// TODO: should we check duplicates?
 	t.freeSymbols = append(t.freeSymbols, original)
 	symbol := &Symbol{
-		Name:  original.Name,
-		Index: len(t.freeSymbols) - 1,
-		Scope: ScopeFree,
+		Name:     original.Name,
+		Index:    len(t.freeSymbols) - 1,
+		Scope:    ScopeFree,
+		Constant: original.Constant,
 	}
 	t.store[original.Name] = symbol
 	return symbol
@@ -34,6 +34,10 @@ const (
 // CallableFunc is a function signature for the callable functions.
 type CallableFunc = func(args ...Object) (ret Object, err error)
 
+// VMCallableFunc is a function signature for the callable functions that
+// receive the VM invoking them.
+type VMCallableFunc = func(vm *VM, args ...Object) (ret Object, err error)
+
 // CountObjects returns the number of objects that a given object o contains.
 // For scalar value types, it will always be 1. For compound value types,
 // this will include its elements and all of their elements recursively.
@@ -230,6 +234,10 @@ func ToInterface(o Object) (res interface{}) {
 		for key, v := range o.Value {
 			res.(map[string]interface{})[key] = ToInterface(v)
 		}
+	case *GoMap:
+		res = o.Value
+	case *GoSlice:
+		res = o.Value
 	case *Time:
 		res = o.Value
 	case *Error:
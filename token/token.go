@@ -84,6 +84,9 @@ const (
 	In
 	Undefined
 	Import
+	Yield
+	Defer
+	Const
 	_keywordEnd
 )
 
@@ -158,6 +161,9 @@ var tokens = [...]string{
 	In:           "in",
 	Undefined:    "undefined",
 	Import:       "import",
+	Yield:        "yield",
+	Defer:        "defer",
+	Const:        "const",
 }
 
 func (tok Token) String() string {
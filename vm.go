@@ -1,13 +1,28 @@
 package tengo
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
 	"sync/atomic"
 
 	"github.com/tiagoj/tengo/v2/parser"
 	"github.com/tiagoj/tengo/v2/token"
 )
 
+// errCallAborted is the error of a callback stopped because the VM that called
+// it back is being aborted.
+var errCallAborted = errors.New("execution aborted")
+
+// stackReserve is the number of stack slots left for the operands of a
+// function when checking whether a call overflows the stack.
+const stackReserve = 64
+
 // frame represents a function call frame.
 type frame struct {
 	fn          *CompiledFunction
@@ -16,6 +31,14 @@ type frame struct {
 	basePointer int
 }
 
+// deferredCall is a call scheduled by a defer statement, run when the
+// function of the frame returns.
+type deferredCall struct {
+	frame int // index of the frame that scheduled the call
+	fn    Object
+	args  []Object
+}
+
 // VM is a virtual machine that executes the bytecode compiled by Compiler.
 type VM struct {
 	constants   []Object
@@ -29,9 +52,50 @@ type VM struct {
 	curInsts    []byte
 	ip          int
 	aborting    int64
+	sharedAbort *int64 // aborting flag of the VM that called v back, if any
 	maxAllocs   int64
 	allocs      int64
 	err         error
+	ctx         *ExecutionContext   // set when running on behalf of an ExecutionContext
+	caller      *VM                 // set when running a callback through VM.Call
+	stackTrace  bool                // capture stack traces for errors
+	overflow    bool                // report int overflows as runtime errors
+	readOnly    bool                // fail on assignments to globals
+	sortedMaps  bool                // iterate maps in the order of their keys
+	profile     *callProfile        // counts the calls of compiled functions, if set
+	deferred    []deferredCall      // pending deferred calls of the active frames
+	lazy        map[int]*lazyGlobal // globals computed on first read, by index
+	alloc       AllocatorFunc       // creates the objects below, if set
+	metrics     *callMetrics        // aggregates the work of the calls, if set
+	recorder    *callRecorder       // records or replays host function calls, if set
+	tracer      *callTracer         // writes the call trace, if set
+	traceDepth  int                 // trace depth of the root frame
+	hostCalls   int                 // host function calls in progress, for the trace depth
+	frameBase   int                 // frames of the VMs that invoked v through VM.Call
+	depth       *int64              // frame depth published to ctx at host function calls
+	observer    ReturnObserverFunc  // receives the values returned by functions, if set
+	output      *outputLimit        // limits the output of the call, if set
+	rand        *rand.Rand          // draws from the random source of ctx, if any
+	executed    int64               // instructions executed, including by callbacks
+	panicking   *panicState         // the error unwound by the deferred calls, if any
+	coroutine   bool                // running the body of a Coroutine
+	yielded     bool                // suspended by yield; the value is on top of the stack
+	resumable   bool                // host functions may suspend the call with Suspend
+	suspended   *suspendSignal      // the suspension of the call by a host function, if any
+}
+
+// Frame is an entry of a script stack trace.
+type Frame struct {
+	Name string // function name, empty for anonymous functions and main code
+	Pos  parser.SourceFilePos
+}
+
+func (f Frame) String() string {
+	name := f.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	return fmt.Sprintf("%s (%s)", name, f.Pos)
 }
 
 // NewVM creates a VM.
@@ -59,9 +123,72 @@ func NewVM(
 	return v
 }
 
+// vmFree holds the VMs of finished function calls, so that the calls made
+// through ExecutionContext and VM.Call reuse their stack and frames instead of
+// allocating them each time.
+var vmFree = sync.Pool{
+	New: func() interface{} { return new(VM) },
+}
+
+// newCallVM grabs a cleared VM from vmFree.
+func newCallVM() *VM {
+	return vmFree.Get().(*VM)
+}
+
+// freeCallVM clears v, so that the pool neither retains the objects of the
+// call nor leaks them to the next one, and saves it in vmFree. The results
+// must be read from v beforehand, and nothing may refer to v afterwards.
+func freeCallVM(v *VM) {
+	*v = VM{}
+	vmFree.Put(v)
+}
+
 // Abort aborts the execution.
 func (v *VM) Abort() {
-	atomic.StoreInt64(&v.aborting, 1)
+	atomic.StoreInt64(v.abortFlag(), 1)
+}
+
+// abortFlag returns the flag aborting v: the one of the VM that called v back
+// through Call, if any, so that aborting that VM also aborts v.
+func (v *VM) abortFlag() *int64 {
+	if v.sharedAbort != nil {
+		return v.sharedAbort
+	}
+	return &v.aborting
+}
+
+// IsAborted returns true if the execution of the VM, or of the VM that called
+// it back through Call, is being aborted. Functions that block, such as
+// sleep, use it to return early when the script is cancelled.
+func (v *VM) IsAborted() bool {
+	return v != nil && atomic.LoadInt64(v.abortFlag()) != 0
+}
+
+// Output returns the writer functions printing text should write to: the
+// output of the ExecutionContext the VM runs on behalf of, or os.Stdout. If
+// the context limits the output of its calls, writes past the limit fail with
+// ErrOutputLimit. It's safe to call on a nil VM.
+func (v *VM) Output() io.Writer {
+	if v != nil && v.output != nil {
+		return v.output
+	}
+	if v != nil && v.ctx != nil && v.ctx.output != nil {
+		return v.ctx.output
+	}
+	return os.Stdout
+}
+
+// Rand returns a random number generator drawing from the source of the
+// ExecutionContext the VM runs on behalf of, if it was created with
+// ExecutionContext.WithSeed, or nil otherwise. It's safe to call on a nil VM.
+func (v *VM) Rand() *rand.Rand {
+	if v == nil || v.ctx == nil || v.ctx.random == nil {
+		return nil
+	}
+	if v.rand == nil {
+		v.rand = rand.New(v.ctx.random)
+	}
+	return v.rand
 }
 
 // Run starts the execution.
@@ -75,30 +202,251 @@ func (v *VM) Run() (err error) {
 	v.framesIndex = 1
 	v.ip = -1
 	v.allocs = v.maxAllocs + 1
+	v.deferred = nil
 
 	v.run()
+	return v.finish()
+}
+
+// resume continues the call of v suspended by a host function, with value as
+// the result of the function.
+func (v *VM) resume(value Object) error {
+	v.suspended = nil
+	if value == nil {
+		value = UndefinedValue
+	}
+	v.allocs--
+	if v.allocs == 0 {
+		v.err = ErrObjectAllocLimit
+	} else {
+		v.stack[v.sp] = value
+		v.sp++
+		v.run()
+	}
+	return v.finish()
+}
+
+// finish unwinds the deferred calls left by the run of v and returns its
+// runtime error, if any.
+func (v *VM) finish() error {
+	v.unwindDeferred()
 	atomic.StoreInt64(&v.aborting, 0)
-	err = v.err
+	err := v.err
 	if err != nil {
-		filePos := v.fileSet.Position(
-			v.curFrame.fn.SourcePos(v.ip - 1))
-		err = fmt.Errorf("Runtime Error: %w\n\tat %s",
-			err, filePos)
-		for v.framesIndex > 1 {
-			v.framesIndex--
-			v.curFrame = &v.frames[v.framesIndex-1]
-			filePos = v.fileSet.Position(
-				v.curFrame.fn.SourcePos(v.curFrame.ip - 1))
-			err = fmt.Errorf("%w\n\tat %s", err, filePos)
+		var trace []Frame
+		if v.stackTrace {
+			var inner ErrRuntime
+			if errors.As(err, &inner) {
+				// raised in a callback, which captured the deeper frames
+				trace = inner.Trace
+			} else {
+				trace = v.captureStackTrace()
+			}
+		}
+		err = fmt.Errorf("Runtime Error: %w", v.traceError(err))
+		if trace != nil {
+			err = ErrRuntime{Err: err, Trace: trace}
 		}
 		return err
 	}
 	return nil
 }
 
+// captureStackTrace returns the active call frames, innermost first,
+// including the frames of the VMs that invoked v through VM.Call.
+func (v *VM) captureStackTrace() []Frame {
+	var trace []Frame
+	for vm := v; vm != nil; vm = vm.caller {
+		ip := vm.ip
+		for i := vm.framesIndex - 1; i >= 0; i-- {
+			f := &vm.frames[i]
+			if i < vm.framesIndex-1 {
+				ip = f.ip
+			}
+			trace = append(trace, Frame{
+				Name: f.fn.Name,
+				Pos:  vm.sourcePosition(f.fn.SourcePos(ip)),
+			})
+		}
+	}
+	return trace
+}
+
+// traceError appends the source positions of the active call frames to err,
+// unwinding the frames.
+func (v *VM) traceError(err error) error {
+	err = fmt.Errorf("%w\n\tat %s", err, v.sourcePosition(
+		v.curFrame.fn.SourcePos(v.ip-1)))
+	for v.framesIndex > 1 {
+		v.framesIndex--
+		v.curFrame = &v.frames[v.framesIndex-1]
+		err = fmt.Errorf("%w\n\tat %s", err, v.sourcePosition(
+			v.curFrame.fn.SourcePos(v.curFrame.ip-1)))
+	}
+	return err
+}
+
+// readOnlyError returns the error of an assignment to the given global in a
+// read-only call.
+func (v *VM) readOnlyError(globalIndex int) error {
+	name := fmt.Sprintf("#%d", globalIndex)
+	if v.ctx != nil && v.ctx.source != nil {
+		name = v.ctx.globalName(globalIndex)
+	}
+	return fmt.Errorf("%w: %s", ErrReadOnlyGlobal, name)
+}
+
+func (v *VM) sourcePosition(p parser.Pos) parser.SourceFilePos {
+	if v.fileSet == nil {
+		return parser.SourceFilePos{}
+	}
+	return v.fileSet.Position(p)
+}
+
+// Call calls fn with the given arguments on behalf of a builtin or user
+// function that is currently being invoked by v, e.g. to run a callback
+// passed in by the script. Compiled functions run in a child VM that shares
+// the constants, globals, allocation budget and execution context of v. On a
+// nil VM, Call falls back to fn.Call.
+func (v *VM) Call(fn Object, args ...Object) (Object, error) {
+	if v == nil {
+		return fn.Call(args...)
+	}
+	callee, ok := fn.(*CompiledFunction)
+	if !ok {
+		if !fn.CanCall() {
+			return nil, fmt.Errorf("not callable: %s", fn.TypeName())
+		}
+		ret, err := v.callObject(fn, args)
+		if err != nil {
+			return nil, wrapCallError(fn, err)
+		}
+		if ret == nil {
+			ret = UndefinedValue
+		}
+		return ret, nil
+	}
+	if err := callee.checkArity(len(args)); err != nil {
+		return nil, err
+	}
+	if len(callee.Instructions) == 0 {
+		return UndefinedValue, nil
+	}
+
+	child := newCallVM()
+	child.constants = v.constants
+	child.globals = v.globals
+	child.fileSet = v.fileSet
+	child.maxAllocs = v.maxAllocs
+	child.allocs = v.allocs
+	child.ctx = v.ctx
+	child.sharedAbort = v.abortFlag()
+	child.caller = v
+	child.stackTrace = v.stackTrace
+	child.overflow = v.overflow
+	child.readOnly = v.readOnly
+	child.sortedMaps = v.sortedMaps
+	child.profile = v.profile
+	child.lazy = v.lazy
+	child.alloc = v.alloc
+	child.metrics = v.metrics
+	child.recorder = v.recorder
+	child.tracer = v.tracer
+	child.traceDepth = v.callDepth()
+	child.frameBase = v.frameBase + v.framesIndex
+	child.depth = v.depth
+	child.observer = v.observer
+	child.output = v.output
+	callee.setupCall(child, args)
+	if v.profile != nil {
+		v.profile.count(callee)
+	}
+	if v.tracer != nil {
+		v.tracer.enter(child.traceDepth, callee, args)
+	}
+	child.run()
+	child.unwindDeferred()
+	v.allocs = child.allocs
+	v.executed += child.executed
+	if child.err == nil && atomic.LoadInt64(child.sharedAbort) != 0 {
+		child.err = errCallAborted
+	}
+	traceDepth := child.traceDepth
+	if child.err != nil {
+		err := child.callError()
+		freeCallVM(child)
+		if v.tracer != nil {
+			v.tracer.exit(traceDepth, callee, nil, err)
+		}
+		return nil, err
+	}
+	ret := child.stack[child.sp-1]
+	freeCallVM(child)
+	if v.tracer != nil {
+		v.tracer.exit(traceDepth, callee, ret, nil)
+	}
+	return ret, nil
+}
+
+// callError returns the error of a VM that ran a call on behalf of another
+// VM, annotated with its source positions.
+func (v *VM) callError() error {
+	if v.stackTrace {
+		trace := v.captureStackTrace()
+		return ErrRuntime{Err: v.traceError(v.err), Trace: trace}
+	}
+	return v.traceError(v.err)
+}
+
+// callObject calls a non-compiled callable, passing v to functions that
+// need access to the VM.
+func (v *VM) callObject(value Object, args []Object) (Object, error) {
+	if v.depth != nil {
+		atomic.StoreInt64(v.depth, int64(v.frameBase+v.framesIndex))
+	}
+	if v.tracer == nil {
+		return v.callHost(value, args)
+	}
+	depth := v.callDepth()
+	v.tracer.enter(depth, value, args)
+	v.hostCalls++
+	ret, err := v.callHost(value, args)
+	v.hostCalls--
+	v.tracer.exit(depth, value, ret, err)
+	return ret, err
+}
+
+// callDepth returns the trace depth of the calls made by the current frame.
+func (v *VM) callDepth() int {
+	return v.traceDepth + v.framesIndex + v.hostCalls
+}
+
+// callHost implements callObject.
+func (v *VM) callHost(value Object, args []Object) (Object, error) {
+	switch fn := value.(type) {
+	case *BuiltinFunction:
+		if fn.vmValue != nil {
+			return fn.vmValue(v, args...)
+		}
+	case *UserFunction:
+		if fn.VMValue != nil {
+			return fn.VMValue(v, args...)
+		}
+		if v.recorder != nil {
+			return v.recorder.call(fn, args)
+		}
+	}
+	return value.Call(args...)
+}
+
 func (v *VM) run() {
-	for atomic.LoadInt64(&v.aborting) == 0 {
+	aborting := v.abortFlag()
+	counting := v.metrics != nil
+	for atomic.LoadInt64(aborting) == 0 {
 		v.ip++
+		if counting {
+			v.executed++
+		}
 
 		switch v.curInsts[v.ip] {
 		case parser.OpConstant:
@@ -115,7 +463,21 @@ func (v *VM) run() {
 			right := v.stack[v.sp-1]
 			left := v.stack[v.sp-2]
 			tok := token.Token(v.curInsts[v.ip])
-			res, e := left.BinaryOp(tok, right)
+			if v.overflow {
+				if e := checkIntOverflow(tok, left, right); e != nil {
+					v.sp -= 2
+					v.err = e
+					return
+				}
+			}
+			var res Object
+			var e error
+			if v.alloc != nil {
+				res = v.intBinaryOp(tok, left, right)
+			}
+			if res == nil {
+				res, e = left.BinaryOp(tok, right)
+			}
 			if e != nil {
 				v.sp -= 2
 				if e == ErrInvalidOperator {
@@ -178,7 +540,7 @@ func (v *VM) run() {
 
 			switch x := operand.(type) {
 			case *Int:
-				var res Object = &Int{Value: ^x.Value}
+				res := v.newInt(^x.Value)
 				v.allocs--
 				if v.allocs == 0 {
 					v.err = ErrObjectAllocLimit
@@ -197,7 +559,11 @@ func (v *VM) run() {
 
 			switch x := operand.(type) {
 			case *Int:
-				var res Object = &Int{Value: -x.Value}
+				if v.overflow && x.Value == math.MinInt64 {
+					v.err = fmt.Errorf("%w: negation of %d", ErrIntOverflow, x.Value)
+					return
+				}
+				res := v.newInt(-x.Value)
 				v.allocs--
 				if v.allocs == 0 {
 					v.err = ErrObjectAllocLimit
@@ -249,11 +615,24 @@ func (v *VM) run() {
 			v.ip += 2
 			v.sp--
 			globalIndex := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8
+			if v.readOnly {
+				v.err = v.readOnlyError(globalIndex)
+				return
+			}
 			v.globals[globalIndex] = v.stack[v.sp]
+			if v.lazy != nil {
+				if g, ok := v.lazy[globalIndex]; ok {
+					g.assigned.Store(true)
+				}
+			}
 		case parser.OpSetSelGlobal:
 			v.ip += 3
 			globalIndex := int(v.curInsts[v.ip-1]) | int(v.curInsts[v.ip-2])<<8
 			numSelectors := int(v.curInsts[v.ip])
+			if v.readOnly {
+				v.err = v.readOnlyError(globalIndex)
+				return
+			}
 
 			// selectors and RHS value
 			selectors := make([]Object, numSelectors)
@@ -271,6 +650,12 @@ func (v *VM) run() {
 			v.ip += 2
 			globalIndex := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8
 			val := v.globals[globalIndex]
+			if v.lazy != nil && (val == nil || val == UndefinedValue) {
+				if g, ok := v.lazy[globalIndex]; ok && !g.assigned.Load() {
+					val = g.get()
+					v.globals[globalIndex] = val
+				}
+			}
 			v.stack[v.sp] = val
 			v.sp++
 		case parser.OpArray:
@@ -283,7 +668,7 @@ func (v *VM) run() {
 			}
 			v.sp -= numElements
 
-			var arr Object = &Array{Value: elements}
+			arr := v.newArray(elements)
 			v.allocs--
 			if v.allocs == 0 {
 				v.err = ErrObjectAllocLimit
@@ -303,7 +688,7 @@ func (v *VM) run() {
 			}
 			v.sp -= numElements
 
-			var m Object = &Map{Value: kv}
+			m := v.newMap(kv)
 			v.allocs--
 			if v.allocs == 0 {
 				v.err = ErrObjectAllocLimit
@@ -313,9 +698,12 @@ func (v *VM) run() {
 			v.sp++
 		case parser.OpError:
 			value := v.stack[v.sp-1]
-			var e Object = &Error{
+			e := &Error{
 				Value: value,
 			}
+			if v.stackTrace {
+				e.trace = v.captureStackTrace()
+			}
 			v.allocs--
 			if v.allocs == 0 {
 				v.err = ErrObjectAllocLimit
@@ -415,9 +803,7 @@ func (v *VM) run() {
 				} else if highIdx > numElements {
 					highIdx = numElements
 				}
-				var val Object = &Array{
-					Value: left.Value[lowIdx:highIdx],
-				}
+				val := v.newArray(left.Value[lowIdx:highIdx])
 				v.allocs--
 				if v.allocs == 0 {
 					v.err = ErrObjectAllocLimit
@@ -452,9 +838,7 @@ func (v *VM) run() {
 				} else if highIdx > numElements {
 					highIdx = numElements
 				}
-				var val Object = &Array{
-					Value: left.Value[lowIdx:highIdx],
-				}
+				val := v.newArray(left.Value[lowIdx:highIdx])
 				v.allocs--
 				if v.allocs == 0 {
 					v.err = ErrObjectAllocLimit
@@ -489,9 +873,7 @@ func (v *VM) run() {
 				} else if highIdx > numElements {
 					highIdx = numElements
 				}
-				var val Object = &String{
-					Value: left.Value[lowIdx:highIdx],
-				}
+				var val Object = internString(left.Value[lowIdx:highIdx])
 				v.allocs--
 				if v.allocs == 0 {
 					v.err = ErrObjectAllocLimit
@@ -572,6 +954,29 @@ func (v *VM) run() {
 				}
 			}
 
+			if value == builtinApplyFunc {
+				// apply(fn, args): replace the call with fn(args...) so
+				// compiled functions get a regular frame
+				fn, items, e := applyArgs(v.stack[v.sp-numArgs : v.sp])
+				if e != nil {
+					v.err = wrapCallError(value, e)
+					return
+				}
+				if v.sp+len(items) >= StackSize {
+					v.err = ErrStackOverflow
+					return
+				}
+				v.sp -= numArgs + 1
+				v.stack[v.sp] = fn
+				v.sp++
+				for _, item := range items {
+					v.stack[v.sp] = item
+					v.sp++
+				}
+				numArgs = len(items)
+				value = fn
+			}
+
 			if callee, ok := value.(*CompiledFunction); ok {
 				if callee.VarArgs {
 					// if the closure is variadic,
@@ -585,7 +990,7 @@ func (v *VM) run() {
 						for i := spStart; i < v.sp; i++ {
 							args[i-spStart] = v.stack[i]
 						}
-						v.stack[spStart] = &Array{Value: args}
+						v.stack[spStart] = v.newArray(args)
 						v.sp = spStart + 1
 					}
 				}
@@ -601,27 +1006,48 @@ func (v *VM) run() {
 					}
 					return
 				}
+				if v.profile != nil {
+					v.profile.count(callee)
+				}
 
-				// test if it's tail-call
-				if callee == v.curFrame.fn { // recursion
-					nextOp := v.curInsts[v.ip+1]
-					if nextOp == parser.OpReturn ||
-						(nextOp == parser.OpPop &&
-							parser.OpReturn == v.curInsts[v.ip+2]) {
-						for p := 0; p < numArgs; p++ {
-							v.stack[v.curFrame.basePointer+p] =
-								v.stack[v.sp-numArgs+p]
-						}
-						v.sp -= numArgs + 1
-						v.ip = -1 // reset IP to beginning of the frame
-						continue
+				// test if it's tail-call: the current frame is not needed
+				// anymore, so the callee can reuse it. calls to other
+				// functions keep their frame if stack traces are captured.
+				recursive := callee == v.curFrame.fn
+				if (recursive || !v.stackTrace && v.tracer == nil) &&
+					!v.frameHasDeferred() && v.isTailCall(recursive) {
+					if v.tracer != nil {
+						depth := v.callDepth() - 1
+						v.tracer.tailCall(depth, callee)
+						v.tracer.enter(depth, callee,
+							v.stack[v.sp-numArgs:v.sp])
 					}
+					base := v.curFrame.basePointer
+					for p := 0; p < numArgs; p++ {
+						v.stack[base+p] = v.stack[v.sp-numArgs+p]
+					}
+					if callee != v.curFrame.fn {
+						v.curFrame.fn = callee
+						v.curInsts = callee.Instructions
+					}
+					v.curFrame.freeVars = callee.Free
+					v.sp = base + callee.NumLocals
+					v.ip = -1 // reset IP to beginning of the frame
+					continue
 				}
-				if v.framesIndex >= MaxFrames {
+				// keep some room on the stack for the operands of the
+				// callee, so that deep recursion fails gracefully
+				if v.framesIndex >= MaxFrames ||
+					v.sp-numArgs+callee.NumLocals+stackReserve >= StackSize {
 					v.err = ErrStackOverflow
 					return
 				}
 
+				if v.tracer != nil {
+					v.tracer.enter(v.callDepth(), callee,
+						v.stack[v.sp-numArgs:v.sp])
+				}
+
 				// update call frame
 				v.curFrame.ip = v.ip // store current ip before call
 				v.curFrame = &(v.frames[v.framesIndex])
@@ -635,25 +1061,16 @@ func (v *VM) run() {
 			} else {
 				var args []Object
 				args = append(args, v.stack[v.sp-numArgs:v.sp]...)
-				ret, e := value.Call(args...)
+				ret, e := v.callObject(value, args)
 				v.sp -= numArgs + 1
 
 				// runtime error
 				if e != nil {
-					if e == ErrWrongNumArguments {
-						v.err = fmt.Errorf(
-							"wrong number of arguments in call to '%s'",
-							value.TypeName())
-						return
-					}
-					if e, ok := e.(ErrInvalidArgumentType); ok {
-						v.err = fmt.Errorf(
-							"invalid type for argument '%s' in call to '%s': "+
-								"expected %s, found %s",
-							e.Name, value.TypeName(), e.Expected, e.Found)
+					if s, ok := e.(*suspendSignal); ok && v.resumable {
+						v.suspended = s
 						return
 					}
-					v.err = e
+					v.err = wrapCallError(value, e)
 					return
 				}
 
@@ -671,18 +1088,33 @@ func (v *VM) run() {
 			}
 		case parser.OpReturn:
 			v.ip++
+			if v.frameHasDeferred() {
+				if err := v.runDeferred(v.framesIndex - 1); err != nil {
+					v.err = err
+					return
+				}
+			}
 			var retVal Object
 			if int(v.curInsts[v.ip]) == 1 {
 				retVal = v.stack[v.sp-1]
 			} else {
 				retVal = UndefinedValue
 			}
+			if v.tracer != nil && v.framesIndex > 1 {
+				v.tracer.exit(v.callDepth()-1, v.curFrame.fn, retVal, nil)
+			}
+			if v.observer != nil {
+				v.observer(v.frameBase+v.framesIndex, retVal)
+			}
 			//v.sp--
 			v.framesIndex--
 
 			// Check if we're returning from the root frame
 			if v.framesIndex == 0 {
 				// We're returning from the root frame, so terminate execution
+				if v.sp == 0 {
+					v.sp++ // function without arguments and locals
+				}
 				v.stack[v.sp-1] = retVal
 				return
 			}
@@ -776,12 +1208,14 @@ func (v *VM) run() {
 			}
 			v.sp -= numFree
 			cl := &CompiledFunction{
+				Name:          fn.Name,
 				Instructions:  fn.Instructions,
 				NumLocals:     fn.NumLocals,
 				NumParameters: fn.NumParameters,
 				VarArgs:       fn.VarArgs,
 				SourceMap:     fn.SourceMap,
 				Free:          free,
+				origin:        fn.origin,
 			}
 			v.allocs--
 			if v.allocs == 0 {
@@ -848,6 +1282,9 @@ func (v *VM) run() {
 				return
 			}
 			iterator = dst.Iterate()
+			if it, ok := iterator.(*MapIterator); ok && v.sortedMaps {
+				sort.Strings(it.k)
+			}
 			v.allocs--
 			if v.allocs == 0 {
 				v.err = ErrObjectAllocLimit
@@ -858,7 +1295,16 @@ func (v *VM) run() {
 		case parser.OpIteratorNext:
 			iterator := v.stack[v.sp-1]
 			v.sp--
-			hasMore := iterator.(Iterator).Next()
+			var hasMore bool
+			if it, ok := iterator.(*CoroutineIterator); ok {
+				hasMore = it.next(v)
+				if it.err != nil {
+					v.err = it.err
+					return
+				}
+			} else {
+				hasMore = iterator.(Iterator).Next()
+			}
 			if hasMore {
 				v.stack[v.sp] = TrueValue
 			} else {
@@ -877,6 +1323,129 @@ func (v *VM) run() {
 			val := iterator.(Iterator).Value()
 			v.stack[v.sp] = val
 			v.sp++
+		case parser.OpDestructure:
+			v.ip += 2
+			numElements := int(v.curInsts[v.ip-1])
+			fromMap := v.curInsts[v.ip] == 1
+
+			// the source (followed by the keys when destructuring a map) is
+			// replaced by the elements in reverse order, so the first
+			// element ends up on top of the stack
+			var elements []Object
+			base := v.sp - 1
+			if fromMap {
+				base = v.sp - numElements - 1
+				var kv map[string]Object
+				switch src := v.stack[base].(type) {
+				case *Map:
+					kv = src.Value
+				case *ImmutableMap:
+					kv = src.Value
+				case *GoMap:
+					kv = src.entries()
+				default:
+					v.err = fmt.Errorf(
+						"cannot destructure %s: expected map",
+						src.TypeName())
+					return
+				}
+				for _, key := range v.stack[base+1 : v.sp] {
+					elem, ok := kv[key.(*String).Value]
+					if !ok {
+						elem = UndefinedValue
+					}
+					elements = append(elements, elem)
+				}
+			} else {
+				switch src := v.stack[base].(type) {
+				case *Array:
+					elements = src.Value
+				case *ImmutableArray:
+					elements = src.Value
+				case *GoSlice:
+					elements = src.elements()
+				default:
+					v.err = fmt.Errorf(
+						"cannot destructure %s: expected array",
+						src.TypeName())
+					return
+				}
+				if len(elements) != numElements {
+					v.err = fmt.Errorf(
+						"destructuring mismatch: want=%d, got=%d",
+						numElements, len(elements))
+					return
+				}
+				if base+numElements > StackSize {
+					v.err = ErrStackOverflow
+					return
+				}
+			}
+			for i, elem := range elements {
+				v.stack[base+numElements-1-i] = elem
+			}
+			v.sp = base + numElements
+		case parser.OpYield:
+			if !v.coroutine {
+				v.err = fmt.Errorf("yield outside coroutine")
+				return
+			}
+			v.yielded = true
+			return
+		case parser.OpDefer:
+			numArgs := int(v.curInsts[v.ip+1])
+			spread := int(v.curInsts[v.ip+2])
+			v.ip += 2
+
+			value := v.stack[v.sp-1-numArgs]
+			if !value.CanCall() {
+				v.err = fmt.Errorf("not callable: %s", value.TypeName())
+				return
+			}
+			args := append([]Object{}, v.stack[v.sp-numArgs:v.sp]...)
+			if spread == 1 {
+				last := args[len(args)-1]
+				elements, ok := arrayElements(last)
+				if !ok {
+					v.err = fmt.Errorf("not an array: %s", last.TypeName())
+					return
+				}
+				args = append(args[:len(args)-1], elements...)
+			}
+			v.sp -= numArgs + 1
+			v.deferred = append(v.deferred, deferredCall{
+				frame: v.framesIndex - 1,
+				fn:    value,
+				args:  args,
+			})
+		case parser.OpSpread:
+			src := v.stack[v.sp-1]
+			v.sp--
+			switch dst := v.stack[v.sp-1].(type) {
+			case *Array:
+				elements, ok := arrayElements(src)
+				if !ok {
+					v.err = fmt.Errorf("cannot spread %s into array",
+						src.TypeName())
+					return
+				}
+				dst.Value = append(dst.Value, elements...)
+			case *Map:
+				var entries map[string]Object
+				switch src := src.(type) {
+				case *Map:
+					entries = src.Value
+				case *ImmutableMap:
+					entries = src.Value
+				default:
+					v.err = fmt.Errorf("cannot spread %s into map",
+						src.TypeName())
+					return
+				}
+				for key, value := range entries {
+					dst.Value[key] = value
+				}
+			}
 		case parser.OpSuspend:
 			return
 		default:
@@ -886,11 +1455,227 @@ func (v *VM) run() {
 	}
 }
 
+// newInt returns an Int holding x, created by the allocator if any, or
+// interned.
+func (v *VM) newInt(x int64) Object {
+	if v.alloc != nil {
+		if o, ok := v.alloc(ObjectKindInt).(*Int); ok && o != nil {
+			o.Value = x
+			return o
+		}
+	}
+	return internInt(x)
+}
+
+// newArray returns an Array holding elements, created by the allocator if
+// any.
+func (v *VM) newArray(elements []Object) Object {
+	if v.alloc != nil {
+		if o, ok := v.alloc(ObjectKindArray).(*Array); ok && o != nil {
+			o.Value = elements
+			return o
+		}
+	}
+	return &Array{Value: elements}
+}
+
+// newMap returns a Map holding kv, created by the allocator if any.
+func (v *VM) newMap(kv map[string]Object) Object {
+	if v.alloc != nil {
+		if o, ok := v.alloc(ObjectKindMap).(*Map); ok && o != nil {
+			o.Value = kv
+			return o
+		}
+	}
+	return &Map{Value: kv}
+}
+
+// intBinaryOp computes the arithmetic and bitwise operations on two ints
+// with an Int from the allocator. It returns nil for other operands and
+// operators, and for divisions by zero, which are left to BinaryOp.
+func (v *VM) intBinaryOp(op token.Token, left, right Object) Object {
+	x, ok := left.(*Int)
+	if !ok {
+		return nil
+	}
+	y, ok := right.(*Int)
+	if !ok {
+		return nil
+	}
+	var r int64
+	switch op {
+	case token.Add:
+		r = x.Value + y.Value
+	case token.Sub:
+		r = x.Value - y.Value
+	case token.Mul:
+		r = x.Value * y.Value
+	case token.Quo:
+		if y.Value == 0 {
+			return nil
+		}
+		r = x.Value / y.Value
+	case token.Rem:
+		if y.Value == 0 {
+			return nil
+		}
+		r = x.Value % y.Value
+	case token.And:
+		r = x.Value & y.Value
+	case token.Or:
+		r = x.Value | y.Value
+	case token.Xor:
+		r = x.Value ^ y.Value
+	case token.AndNot:
+		r = x.Value &^ y.Value
+	case token.Shl:
+		r = x.Value << uint64(y.Value)
+	case token.Shr:
+		r = x.Value >> uint64(y.Value)
+	default:
+		return nil
+	}
+	if r == x.Value {
+		// like Int.BinaryOp, reuse the operand
+		return x
+	}
+	return v.newInt(r)
+}
+
 // IsStackEmpty tests if the stack is empty or not.
 func (v *VM) IsStackEmpty() bool {
 	return v.sp == 0
 }
 
+// frameHasDeferred returns true if the current frame scheduled deferred
+// calls that have not run yet.
+func (v *VM) frameHasDeferred() bool {
+	n := len(v.deferred)
+	return n > 0 && v.deferred[n-1].frame == v.framesIndex-1
+}
+
+// runDeferred runs the pending deferred calls of the frames from the given
+// index up, most recent first, and returns the error of the first call that
+// fails, leaving the calls scheduled before it pending.
+func (v *VM) runDeferred(frame int) error {
+	for n := len(v.deferred); n > 0 && v.deferred[n-1].frame >= frame; n-- {
+		d := v.deferred[n-1]
+		v.deferred[n-1] = deferredCall{}
+		v.deferred = v.deferred[:n-1]
+		if _, err := v.Call(d.fn, d.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unwindDeferred runs the deferred calls still pending after a runtime error,
+// most recent first. If a deferred call recovers the error with the builtin
+// recover, the function that scheduled it returns undefined and the execution
+// resumes in its caller. The errors of the deferred calls are ignored so that
+// the original error is reported.
+func (v *VM) unwindDeferred() {
+	for v.err != nil && len(v.deferred) > 0 {
+		if !isRecoverable(v.err) || v.IsAborted() {
+			for len(v.deferred) > 0 {
+				_ = v.runDeferred(0)
+			}
+			break
+		}
+		frame := v.deferred[len(v.deferred)-1].frame
+		p := &panicState{err: v.err}
+		for n := len(v.deferred); n > 0 && v.deferred[n-1].frame == frame; n-- {
+			d := v.deferred[n-1]
+			v.deferred[n-1] = deferredCall{}
+			v.deferred = v.deferred[:n-1]
+			p.fn = d.fn
+			v.panicking = p
+			_, _ = v.Call(d.fn, d.args...)
+			v.panicking = nil
+		}
+		if p.recovered {
+			v.err = nil
+			if v.tracer != nil {
+				v.traceUnwind(frame+1, p.err)
+				if frame > 0 {
+					v.tracer.exit(v.traceDepth+frame, v.frames[frame].fn,
+						UndefinedValue, nil)
+				}
+			}
+			if v.observer != nil {
+				v.observer(v.frameBase+frame+1, UndefinedValue)
+			}
+			if v.returnFrom(frame) {
+				v.run()
+			}
+		}
+	}
+	if v.err != nil && v.tracer != nil {
+		v.traceUnwind(1, v.err)
+	}
+}
+
+// traceUnwind traces the exits of the frames discarded by a runtime error,
+// from the innermost one down to the given frame. The exit of the root frame
+// is left to the caller of the VM, which traced its entry.
+func (v *VM) traceUnwind(frame int, err error) {
+	for i := v.framesIndex - 1; i >= frame && i > 0; i-- {
+		v.tracer.exit(v.traceDepth+i, v.frames[i].fn, nil, err)
+	}
+}
+
+// panicState is the runtime error a VM unwinds while running the deferred
+// calls of a frame.
+type panicState struct {
+	err       error
+	fn        Object // the deferred function being run
+	recovered bool
+}
+
+// isRecoverable returns true if err can be recovered: the object allocation
+// limit and stack overflows can't, so that scripts cannot ignore them.
+func isRecoverable(err error) bool {
+	return !errors.Is(err, ErrObjectAllocLimit) &&
+		!errors.Is(err, ErrStackOverflow)
+}
+
+// returnFrom returns undefined from the function of the given frame to its
+// caller, discarding the frames it called. It returns false if there is no
+// caller, the frame being the root one.
+func (v *VM) returnFrom(frame int) bool {
+	v.framesIndex = frame
+	if frame == 0 {
+		v.sp = v.frames[0].basePointer
+		if v.sp == 0 {
+			v.sp++
+		}
+		v.stack[v.sp-1] = UndefinedValue
+		return false
+	}
+	v.curFrame = &v.frames[frame-1]
+	v.curInsts = v.curFrame.fn.Instructions
+	v.ip = v.curFrame.ip
+	v.sp = v.frames[frame].basePointer
+	v.stack[v.sp-1] = UndefinedValue
+	return true
+}
+
+// isTailCall returns true if the call instruction at the current IP is in a
+// tail position, i.e. its result is returned right away, possibly after a
+// jump. Recursive calls whose result is discarded right before the function
+// returns are in a tail position too, as they'd leave the same result.
+func (v *VM) isTailCall(recursive bool) bool {
+	ip := v.ip + 1
+	if recursive && v.curInsts[ip] == parser.OpPop {
+		return v.curInsts[ip+1] == parser.OpReturn
+	}
+	for v.curInsts[ip] == parser.OpJump {
+		ip = int(v.curInsts[ip+4]) | int(v.curInsts[ip+3])<<8 |
+			int(v.curInsts[ip+2])<<16 | int(v.curInsts[ip+1])<<24
+	}
+	return v.curInsts[ip] == parser.OpReturn
+}
+
 func indexAssign(dst, src Object, selectors []Object) error {
 	numSel := len(selectors)
 	for sidx := numSel - 1; sidx > 0; sidx-- {
@@ -919,3 +1704,20 @@ func indexAssign(dst, src Object, selectors []Object) error {
 	}
 	return nil
 }
+
+// wrapCallError adds the callee's type name to argument errors returned by a
+// non-compiled callable.
+func wrapCallError(value Object, e error) error {
+	if e == ErrWrongNumArguments {
+		return fmt.Errorf(
+			"wrong number of arguments in call to '%s'",
+			value.TypeName())
+	}
+	if e, ok := e.(ErrInvalidArgumentType); ok {
+		return fmt.Errorf(
+			"invalid type for argument '%s' in call to '%s': "+
+				"expected %s, found %s",
+			e.Name, value.TypeName(), e.Expected, e.Found)
+	}
+	return e
+}
@@ -9,6 +9,7 @@ import (
 	_runtime "runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/tiagoj/tengo/v2"
 	"github.com/tiagoj/tengo/v2/parser"
@@ -1000,6 +1001,13 @@ out = [f(0), f(1), f(2)]
 out = 1 > 2 ?
 	1 + 2 + 3 :
 	10 - 5`, nil, 5)
+
+	// in map literal values, only the taken branch is evaluated
+	expectRun(t, `
+calls := []
+f := func(v) { calls = append(calls, v); return v }
+m := {a: 1 < 2 ? f("x") : f("y"), b: false ? f(1) : true ? f(2) : f(3)}
+out = [m.a, m.b, calls]`, nil, ARR{"x", 2, ARR{"x", 2}})
 }
 
 func TestEquality(t *testing.T) {
@@ -2839,20 +2847,22 @@ func TestBangOperator(t *testing.T) {
 
 func TestObjectsLimit(t *testing.T) {
 	testAllocsLimit(t, `5`, 0)
-	testAllocsLimit(t, `5 + 5`, 1)
+	testAllocsLimit(t, `a := 5; a + 5`, 1)
 	testAllocsLimit(t, `a := [1, 2, 3]`, 1)
 	testAllocsLimit(t, `a := 1; b := 2; c := 3; d := [a, b, c]`, 1)
 	testAllocsLimit(t, `a := {foo: 1, bar: 2}`, 1)
 	testAllocsLimit(t, `a := 1; b := 2; c := {foo: a, bar: b}`, 1)
 	testAllocsLimit(t, `
 f := func() {
-	return 5 + 5
+	b := 5
+	return b + 5
 }
 a := f() + 5
 `, 2)
 	testAllocsLimit(t, `
 f := func() {
-	return 5 + 5
+	b := 5
+	return b + 5
 }
 a := f()
 `, 1)
@@ -2917,6 +2927,14 @@ if a := 3; a {
 out = c
 `, nil, 5)
 
+	// shadowed builtin functions
+	expectRun(t, `len := 5; out = len`, nil, 5)
+	expectRun(t, `copy, append := [1, 2]; out = [copy, append]`, nil, ARR{1, 2})
+	expectRun(t, `
+format := func(x) { return x * 2 }
+out = [format(3), func() { return string(1) }()]
+`, nil, ARR{6, "1"})
+
 	// shadowed local variable
 	expectRun(t, `
 func() {
@@ -3559,6 +3577,65 @@ iter := func(n, max) {
 iter(0, 9999)
 out = c 
 `, nil, 9999)
+
+	// deep tail-recursive accumulator
+	expectRun(t, `
+sum := func(n, acc) {
+	if n == 0 {
+		return acc
+	}
+	return sum(n-1, acc+n)
+}
+out = sum(100000, 0)
+`, nil, 5000050000)
+	expectRun(t, `
+sum := func(n, acc) {
+	return n == 0 ? acc : sum(n-1, acc+n)
+}
+out = sum(100000, 0)
+`, nil, 5000050000)
+
+	// mutual recursion
+	expectRun(t, `
+even := undefined
+odd := func(n) { return n == 0 ? false : even(n-1) }
+even = func(n) { return n == 0 ? true : odd(n-1) }
+out = even(100001)
+`, nil, false)
+
+	// the frame of the caller is replaced by the callee
+	expectRun(t, `
+a := 3
+h := func(x) { return x + a }
+f := func(n) { b := 10; return h(n + b) }
+out = f(1)
+`, nil, 14)
+
+	// discarded result of a call to another function
+	expectRun(t, `
+g := func() { return 7 }
+f := func() { g() }
+out = f()
+`, nil, tengo.UndefinedValue)
+
+	// not in tail position
+	expectError(t, `
+f := func(n) {
+	if n == 0 {
+		return 0
+	}
+	return 1 + f(n-1)
+}
+f(100000)`, nil, "stack overflow")
+	expectError(t, `
+f := func(n) {
+	if n == 0 {
+		return 0
+	}
+	x := f(n-1)
+	return x
+}
+f(100000)`, nil, "stack overflow")
 }
 
 // tail call with free vars
@@ -3634,6 +3711,700 @@ func TestSpread(t *testing.T) {
 		"Runtime Error: wrong number of arguments: want=3, got=2")
 }
 
+func TestApply(t *testing.T) {
+	expectRun(t, `
+	f := func(a, b, c) { return a * 100 + b * 10 + c }
+	out = apply(f, [1, 2, 3])
+	`, nil, 123)
+
+	expectRun(t, `
+	f := func(a, b) { return a + b }
+	out = apply(f, immutable([1, 2]))
+	`, nil, 3)
+
+	expectRun(t, `out = apply(func() { return 5 }, [])`, nil, 5)
+
+	// variadic targets
+	expectRun(t, `
+	f := func(...a) { return a }
+	out = apply(f, [1, 2, 3])
+	`, nil, ARR{1, 2, 3})
+
+	expectRun(t, `
+	f := func(a, ...b) { return [a, b] }
+	out = [apply(f, [1]), apply(f, [1, 2, 3])]
+	`, nil, ARR{ARR{1, ARR{}}, ARR{1, ARR{2, 3}}})
+
+	// closures and recursion
+	expectRun(t, `
+	x := 10
+	fact := func(n) {
+		if n <= 1 { return 1 }
+		return n * apply(fact, [n - 1])
+	}
+	out = apply(func(a) { return fact(a) + x }, [5])
+	`, nil, 130)
+
+	// builtin and user function targets
+	expectRun(t, `out = apply(len, [[1, 2, 3]])`, nil, 3)
+	expectRun(t, `out = apply(append, [[1], 2, 3])`, nil, ARR{1, 2, 3})
+
+	// apply called outside of a direct call
+	expectRun(t, `
+	f := func(a, b) { return a - b }
+	g := copy(apply)
+	out = g(f, [5, 3])
+	`, nil, 2)
+
+	// spread arguments to apply itself
+	expectRun(t, `
+	f := func(a, b) { return a - b }
+	out = apply([f, [5, 3]]...)
+	`, nil, 2)
+
+	expectError(t, `apply(func(a) {}, [1, 2])`, nil,
+		"Runtime Error: wrong number of arguments: want=1, got=2")
+	expectError(t, `apply(func(a, ...b) {}, [])`, nil,
+		"Runtime Error: wrong number of arguments: want>=1, got=0")
+	expectError(t, `apply(func() {})`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:apply'")
+	expectError(t, `apply(1, [])`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:apply': expected callable, found int")
+	expectError(t, `apply(func() {}, 1)`, nil,
+		"Runtime Error: invalid type for argument 'second' in call to "+
+			"'builtin-function:apply': expected array, found int")
+}
+
+func TestAssert(t *testing.T) {
+	expectRun(t, `assert(true); out = 1`, nil, 1)
+	expectRun(t, `out = assert(1 < 2, "ordered")`, nil, tengo.UndefinedValue)
+	expectRun(t, `
+	f := func(x) {
+		assert(x > 0, "x must be positive")
+		return x * 2
+	}
+	out = f(3)
+	`, nil, 6)
+
+	expectError(t, `assert(false, "broken invariant")`, nil,
+		"Runtime Error: assertion failed: broken invariant\n\tat test:1:1")
+	expectError(t, `assert([])`, nil,
+		"Runtime Error: assertion failed\n\tat test:1:1")
+	expectError(t, `assert(false, 1)`, nil,
+		"Runtime Error: assertion failed: 1")
+	expectError(t, `assert()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:assert'")
+	expectErrorAs(t, `x := 0; assert(x != 0, "x is zero")`, nil,
+		&tengo.ErrAssertionFailed{})
+}
+
+func TestZipEnumerate(t *testing.T) {
+	expectRun(t, `out = zip([1, 2, 3], ["a", "b", "c"])`, nil,
+		ARR{ARR{1, "a"}, ARR{2, "b"}, ARR{3, "c"}})
+	expectRun(t, `out = zip([1, 2, 3], immutable(["a"]))`, nil,
+		ARR{ARR{1, "a"}})
+	expectRun(t, `out = zip([1], [true, false])`, nil, ARR{ARR{1, true}})
+	expectRun(t, `out = zip([], [1, 2])`, nil, ARR{})
+	expectRun(t, `out = zip([], [])`, nil, ARR{})
+	expectRun(t, `
+	out = 0
+	for p in zip([1, 2, 3], [10, 20, 30]) { out += p[0] * p[1] }
+	`, nil, 140)
+
+	expectRun(t, `out = enumerate(["a", "b"])`, nil,
+		ARR{ARR{0, "a"}, ARR{1, "b"}})
+	expectRun(t, `out = enumerate(immutable([5]))`, nil, ARR{ARR{0, 5}})
+	expectRun(t, `out = enumerate([])`, nil, ARR{})
+
+	expectError(t, `zip([1])`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:zip'")
+	expectError(t, `zip([1], "ab")`, nil,
+		"Runtime Error: invalid type for argument 'second' in call to "+
+			"'builtin-function:zip': expected array, found string")
+	expectError(t, `enumerate({})`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:enumerate': expected array, found map")
+}
+
+func TestDestructuring(t *testing.T) {
+	expectRun(t, `a, b := [1, 2]; out = a * 10 + b`, nil, 12)
+	expectRun(t, `a, b, c := immutable(["x", 2, true]); out = [c, b, a]`,
+		nil, ARR{true, 2, "x"})
+	expectRun(t, `
+	pair := func(x) { return [x, x * 2] }
+	a, b := pair(5)
+	out = [a, b]
+	`, nil, ARR{5, 10})
+	expectRun(t, `
+	a := 1; b := 2
+	a, b = [b, a]
+	out = [a, b]
+	`, nil, ARR{2, 1})
+	expectRun(t, `
+	out = [0, {}]
+	out[0], out[1].k = [3, 4]
+	`, nil, ARR{3, MAP{"k": 4}})
+	expectRun(t, `
+	f := func(p) {
+		x, y := p
+		g := func() { y, x = [x, y]; return x - y }
+		return g()
+	}
+	out = f([1, 5])
+	`, nil, 4)
+	expectRun(t, `
+	out = 0
+	for i, j := [0, 3]; i < j; i++ { out += i }
+	`, nil, 3)
+
+	// map destructuring, missing keys are undefined
+	expectRun(t, `{x, y} := {x: 1, y: 2, z: 3}; out = [x, y]`, nil, ARR{1, 2})
+	expectRun(t, `{x, w} := immutable({x: 1}); out = [x, w]`, nil,
+		ARR{1, tengo.UndefinedValue})
+	expectRun(t, `
+	f := func(opts) {
+		{
+			name,
+			size
+		} := opts
+		return format("%s:%d", name, size)
+	}
+	out = f({name: "a", size: 3})
+	`, nil, "a:3")
+	expectRun(t, `x := 0; {x} = {x: 7}; out = x`, nil, 7)
+
+	expectError(t, `a, b := [1, 2, 3]`, nil,
+		"Runtime Error: destructuring mismatch: want=2, got=3\n\tat test:1:1")
+	expectError(t, `a, b := [1]`, nil,
+		"Runtime Error: destructuring mismatch: want=2, got=1")
+	expectError(t, `a, b := {}`, nil,
+		"Runtime Error: cannot destructure map: expected array")
+	expectError(t, `{a, b} := [1, 2]`, nil,
+		"Runtime Error: cannot destructure array: expected map")
+}
+
+func TestCoroutine(t *testing.T) {
+	// iterate a generator to exhaustion
+	expectRun(t, `
+	gen := func(n) {
+		for i := 0; i < n; i++ { yield i * i }
+	}
+	out = []
+	for v in coroutine(gen, 4) { out = append(out, v) }
+	`, nil, ARR{0, 1, 4, 9})
+	expectRun(t, `
+	out = {}
+	for i, v in coroutine(func() { yield "a"; yield "b" }) { out[v] = i }
+	`, nil, MAP{"a": 0, "b": 1})
+
+	// resume returns the yielded values, then the returned value, then
+	// undefined once the coroutine has completed
+	expectRun(t, `
+	co := coroutine(func() { yield 1; yield; return 3 })
+	out = [co.resume(), co.resume(), co.done(), co.resume(), co.done(),
+		co.resume(), co.resume()]
+	`, nil, ARR{1, tengo.UndefinedValue, false, 3, true,
+		tengo.UndefinedValue, tengo.UndefinedValue})
+	expectRun(t, `
+	co := coroutine(func() {})
+	out = [co.done(), co.resume(), !co]
+	`, nil, ARR{false, tengo.UndefinedValue, true})
+
+	// yield suspends nested calls and preserves locals and free variables
+	expectRun(t, `
+	f := func(base) {
+		step := func(x) { yield base + x; yield base + x * 10 }
+		step(1)
+		step(2)
+	}
+	out = []
+	for v in coroutine(f, 100) { out = append(out, v) }
+	`, nil, ARR{101, 110, 102, 120})
+	expectRun(t, `
+	counter := 0
+	ticker := coroutine(func() { for { counter++; yield counter } })
+	ticker.resume(); ticker.resume()
+	out = [ticker.resume(), counter]
+	`, nil, ARR{3, 3})
+
+	// infinite generator consumed lazily
+	expectRun(t, `
+	fib := coroutine(func() {
+		a := 0; b := 1
+		for { yield a; a, b = [b, a + b] }
+	})
+	out = []
+	for v in fib {
+		if v > 20 { break }
+		out = append(out, v)
+	}
+	`, nil, ARR{0, 1, 1, 2, 3, 5, 8, 13})
+
+	// copies resume independently
+	expectRun(t, `
+	co := coroutine(func() { yield 1; yield 2; yield 3 })
+	co.resume()
+	cp := copy(co)
+	out = [co.resume(), co.resume(), cp.resume()]
+	`, nil, ARR{2, 3, 2})
+
+	expectError(t, `f := func() { yield 1 }; f()`, nil,
+		"Runtime Error: yield outside coroutine")
+	expectError(t, `coroutine(func(a) {})`, nil,
+		"Runtime Error: wrong number of arguments: want=1, got=0")
+	expectError(t, `coroutine(len)`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:coroutine': expected compiled-function, "+
+			"found builtin-function")
+	expectError(t, `
+	co := coroutine(func() { yield 1; return 1 + {} })
+	for v in co {}
+	`, nil, "Runtime Error: invalid operation: int + map\n\tat test:2:43\n\tat test:3:2")
+	expectError(t, `
+	co := undefined
+	co = coroutine(func() { co.resume() })
+	co.resume()
+	`, nil, "coroutine is already running")
+	expectError(t, `coroutine(func() {}).next()`, nil,
+		"Runtime Error: invalid index type")
+}
+
+func TestMemoize(t *testing.T) {
+	// recursive calls go through the cache
+	expectRun(t, `
+	calls := 0
+	fib := func(n) {
+		calls++
+		if n < 2 { return n }
+		return fib(n - 1) + fib(n - 2)
+	}
+	a := fib(20)
+	plain := calls
+	calls = 0
+	fib = memoize(fib)
+	out = [a, fib(20), plain, calls, fib(20), calls]
+	`, nil, ARR{6765, 6765, 21891, 21, 6765, 21})
+
+	// arguments are keyed by type and value
+	expectRun(t, `
+	calls := 0
+	f := memoize(func(a, b) { calls++; return [a, b] })
+	f(1, "x"); f(1, "x"); f(1.0, "x"); f("1", "x"); f(1, 'x'); f(1, "x")
+	out = calls
+	`, nil, 4)
+
+	// unhashable arguments bypass the cache
+	expectRun(t, `
+	calls := 0
+	f := memoize(func(a) { calls++; return len(a) })
+	out = [f([1, 2]), f([1, 2]), calls]
+	`, nil, ARR{2, 2, 2})
+
+	expectRun(t, `out = memoize(len)([1, 2, 3])`, nil, 3)
+	expectError(t, `memoize(1)`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:memoize': expected callable, found int")
+	expectError(t, `memoize(func(a) { return a })()`, nil,
+		"Runtime Error: wrong number of arguments: want=1, got=0")
+}
+
+func TestRangeArray(t *testing.T) {
+	expectRun(t, `out = range_array(0, 5)`, nil, ARR{0, 1, 2, 3, 4})
+	expectRun(t, `out = range_array(1, 10, 3)`, nil, ARR{1, 4, 7})
+	expectRun(t, `out = range_array(3, -3, 2)`, nil, ARR{3, 1, -1})
+	expectRun(t, `out = range_array(5, 5)`, nil, ARR{})
+	expectRun(t, `out = len(range_array(0, 100000))`, nil, 100000)
+	expectRun(t, `out = range_array(10, 0, -2)`, nil, ARR{10, 8, 6, 4, 2})
+	expectRun(t, `out = range_array(3, 3, -1)`, nil, ARR{})
+	expectRun(t, `
+out = []
+for x in range(10, 0, -3) { out = append(out, x) }`, nil, ARR{10, 7, 4, 1})
+	expectError(t, `range_array(0, 5, 0)`, nil,
+		"Runtime Error: range step must not be 0")
+	expectError(t, `range(5, 0, 0)`, nil,
+		"Runtime Error: range step must not be 0")
+	expectError(t, `range_array(0, 5, -1)`, nil,
+		"Runtime Error: negative range step with start less than stop")
+	expectError(t, `range(0, 5, -1)`, nil,
+		"Runtime Error: negative range step with start less than stop")
+	expectError(t, `range_array(0, "5")`, nil,
+		"Runtime Error: invalid type for argument 'stop' in call to "+
+			"'builtin-function:range_array': expected int, found string")
+
+	// the array and its elements count against the allocation limit
+	testAllocsLimit(t, `range_array(0, 5)`, 6)
+	testAllocsLimit(t, `range_array(10, 0, 4)`, 4)
+	testAllocsLimit(t, `range_array(10, 0, -4)`, 5) // including -4
+	expectError(t, `range_array(0, 1 << 62)`,
+		Opts().MaxAllocs(1000).Skip2ndPass(), "allocation limit exceeded")
+}
+
+func TestSpreadLiteral(t *testing.T) {
+	expectRun(t, `x := [1, 2]; y := [3]; out = [...x, ...y]`, nil,
+		ARR{1, 2, 3})
+	expectRun(t, `x := [2, 3]; out = [1, ...x, 4, ...x, 5]`, nil,
+		ARR{1, 2, 3, 4, 2, 3, 5})
+	expectRun(t, `out = [...[], ...immutable([1]), ...[]]`, nil, ARR{1})
+	expectRun(t, `x := [1]; y := [...x]; y[0] = 2; out = [x[0], y[0]]`, nil,
+		ARR{1, 2})
+	expectRun(t, `out = len([...range_array(0, 300)])`, nil, 300)
+
+	// later keys win
+	expectRun(t, `
+	a := {x: 1, y: 2}
+	b := {y: 3, z: 4}
+	out = {...a, ...b}
+	`, nil, MAP{"x": 1, "y": 3, "z": 4})
+	expectRun(t, `
+	a := {x: 1, y: 2}
+	out = {x: 0, ...a, y: 5, ...immutable({z: 6})}
+	`, nil, MAP{"x": 1, "y": 5, "z": 6})
+	expectRun(t, `a := {x: 1}; b := {...a}; b.x = 2; out = [a.x, b.x]`, nil,
+		ARR{1, 2})
+
+	expectError(t, `[...1]`, nil,
+		"Runtime Error: cannot spread int into array\n\tat test:1:5")
+	expectError(t, `{...[1]}`, nil, "cannot spread array into map")
+	expectError(t, `[...{}]`, nil, "cannot spread map into array")
+}
+
+func TestKeysValuesSorted(t *testing.T) {
+	expectRun(t, `out = keys_sorted({b: 2, c: 3, a: 1})`, nil,
+		ARR{"a", "b", "c"})
+	expectRun(t, `out = values_sorted({b: 2, c: 3, a: 1})`, nil,
+		ARR{1, 2, 3})
+	expectRun(t, `out = keys_sorted(immutable({y: 1, x: 2}))`, nil,
+		ARR{"x", "y"})
+	expectRun(t, `out = values_sorted(immutable({y: 1, x: 2}))`, nil,
+		ARR{2, 1})
+	expectRun(t, `out = [keys_sorted({}), values_sorted({})]`, nil,
+		ARR{ARR{}, ARR{}})
+
+	// the result doesn't depend on how the map was built
+	expectRun(t, `
+	build := func(order) {
+		m := {}
+		for k in order { m[k] = k + "!" }
+		return m
+	}
+	out = true
+	expected := ["a", "b", "c", "d", "e"]
+	for i := 0; i < 20; i++ {
+		for order in [["e", "d", "c", "b", "a"], ["c", "a", "e", "b", "d"], expected] {
+			m := build(order)
+			if keys_sorted(m) != expected { out = false }
+			if values_sorted(m) != ["a!", "b!", "c!", "d!", "e!"] { out = false }
+		}
+	}
+	`, nil, true)
+
+	expectError(t, `keys_sorted([1])`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:keys_sorted': expected map, found array")
+	expectError(t, `values_sorted()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:values_sorted'")
+}
+
+func TestGroupBy(t *testing.T) {
+	expectRun(t, `
+people := [
+	{name: "a", team: "x"},
+	{name: "b", team: "y"},
+	{name: "c", team: "x"},
+	{name: "d", team: "z"}
+]
+groups := group_by(people, func(p) { return p.team })
+out = {}
+for k, v in groups {
+	names := []
+	for p in v { names = append(names, p.name) }
+	out[k] = names
+}`, nil, MAP{"x": ARR{"a", "c"}, "y": ARR{"b"}, "z": ARR{"d"}})
+
+	// int keys, immutable arrays and non-compiled functions
+	expectRun(t, `out = group_by(immutable([1, 2, 3, 4, 5]), func(n) { return n % 2 })`,
+		nil, MAP{"0": ARR{2, 4}, "1": ARR{1, 3, 5}})
+	expectRun(t, `out = group_by(["a", "bb", "cc"], len)`,
+		nil, MAP{"1": ARR{"a"}, "2": ARR{"bb", "cc"}})
+	expectRun(t, `out = group_by([], func(x) { return x })`, nil, MAP{})
+
+	// the elements are the same objects
+	expectRun(t, `
+a := [{n: 1}]
+g := group_by(a, func(e) { return "k" })
+g.k[0].n = 2
+out = a[0].n`, nil, 2)
+
+	expectRun(t, `out = group_by([1, 2], func(x) { return [x] })`, nil,
+		errorObject("invalid group key: array"))
+	expectRun(t, `out = group_by([1.5], func(x) { return x })`, nil,
+		errorObject("invalid group key: float"))
+	expectError(t, `group_by([1], func(x) { return x + {} })`, nil,
+		"Runtime Error: invalid operation: int + map")
+	expectError(t, `group_by({}, len)`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:group_by': expected array, found map")
+	expectError(t, `group_by([1], 1)`, nil,
+		"Runtime Error: invalid type for argument 'second' in call to "+
+			"'builtin-function:group_by': expected callable, found int")
+	expectError(t, `group_by([1])`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:group_by'")
+}
+
+func TestPartial(t *testing.T) {
+	// one and two leading arguments of fixed-arity functions
+	expectRun(t, `
+add := func(a, b) { return a + b }
+add5 := partial(add, 5)
+out = [add5(3), add5(-5), partial(add, 1, 2)()]`, nil, ARR{8, 0, 3})
+	expectRun(t, `
+f := func(a, b, c) { return [a, b, c] }
+out = [partial(f, 1)(2, 3), partial(f, 1, 2)(3), partial(f)(1, 2, 3)]`,
+		nil, ARR{ARR{1, 2, 3}, ARR{1, 2, 3}, ARR{1, 2, 3}})
+
+	// variadic functions
+	expectRun(t, `
+f := func(a, ...rest) { return [a, rest] }
+out = [partial(f, 1)(), partial(f, 1)(2, 3), partial(f, 1, 2)(3)]`,
+		nil, ARR{ARR{1, ARR{}}, ARR{1, ARR{2, 3}}, ARR{1, ARR{2, 3}}})
+	expectRun(t, `
+f := func(a, b, ...rest) { return [a, b, rest] }
+out = partial(f, 1)(2)`, nil, ARR{1, 2, ARR{}})
+
+	// closures, builtins and composition with other functions
+	expectRun(t, `
+mul := func(k) { return func(x) { return k * x } }
+scale := func(k, x) { return mul(k)(x) }
+out = group_by([1, 2, 3, 4], partial(scale, 0))`, nil, MAP{"0": ARR{1, 2, 3, 4}})
+	expectRun(t, `out = partial(format, "%d-%d", 1)(2)`, nil, "1-2")
+	expectRun(t, `out = partial(partial(func(a, b, c) { return a + b + c }, 1), 2)(3)`,
+		nil, 6)
+
+	// the bound arguments are the same objects for every call
+	expectRun(t, `
+push := func(arr, x) { arr = append(arr, x); return len(arr) }
+acc := [1]
+p := partial(push, acc)
+out = [p(2), p(3), len(acc)]`, nil, ARR{2, 2, 1})
+
+	// arity errors account for the bound arguments
+	expectError(t, `partial(func(a, b) {}, 1)(2, 3)`, nil,
+		"Runtime Error: wrong number of arguments: want=1, got=2")
+	expectError(t, `partial(func(a, b) {}, 1)()`, nil,
+		"Runtime Error: wrong number of arguments: want=1, got=0")
+	expectError(t, `partial(func(a, b, c, ...d) {}, 1)(2)`, nil,
+		"Runtime Error: wrong number of arguments: want>=2, got=1")
+	expectError(t, `partial(func(a) {}, 1, 2)`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:partial'")
+	expectError(t, `partial()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:partial'")
+	expectError(t, `partial(1, 2)`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:partial': expected callable, found int")
+}
+
+func TestCurry(t *testing.T) {
+	// the arguments are collected one at a time
+	expectRun(t, `
+add := func(a, b) { return a + b }
+cadd := curry(add)
+out = [cadd(1)(2), cadd(1)(2) == add(1, 2), cadd(-4)(4)]`, nil, ARR{3, true, 0})
+	expectRun(t, `
+f := func(a, b, c) { return [a, b, c] }
+out = curry(f)(1)(2)(3)`, nil, ARR{1, 2, 3})
+
+	// intermediate functions can be reused with different arguments
+	expectRun(t, `
+f := func(a, b, c) { return a + b + c }
+f1 := curry(f)("a")
+f12 := f1("b")
+out = [f12("c"), f12("d"), f1("x")("y"), f1("b")("c")]`,
+		nil, ARR{"abc", "abd", "axy", "abc"})
+
+	// functions with one parameter are called right away, and functions
+	// without parameters are returned as is
+	expectRun(t, `out = curry(func(x) { return x * 2 })(21)`, nil, 42)
+	expectRun(t, `out = curry(func() { return 1 })()`, nil, 1)
+
+	// closures, and composition with other functions
+	expectRun(t, `
+k := 10
+scale := curry(func(factor, x) { return factor * x + k })
+out = map_values({a: 1, b: 2}, scale(3))`, nil, MAP{"a": 13, "b": 16})
+	expectRun(t, `out = curry(func(a, b, c) { return a - b - c })(10)(partial(func(x) { return x }, 3)())(2)`,
+		nil, 5)
+
+	// errors of the curried function are reported by the last call
+	expectError(t, `curry(func(a, b) { return a / b })(1)(0)`, nil,
+		"Runtime Error: division by zero")
+
+	expectRun(t, `out = curry(func(a, ...rest) { return a })`,
+		nil, errorObject("cannot curry a function with a variadic parameter"))
+	expectError(t, `curry(func(a, b) {})(1, 2)`, nil,
+		"Runtime Error: wrong number of arguments: want=1, got=2")
+	expectError(t, `curry(func(a, b) {})(1)()`, nil,
+		"Runtime Error: wrong number of arguments: want=1, got=0")
+	expectError(t, `curry()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:curry'")
+	expectError(t, `curry(len)`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:curry': expected compiled-function, "+
+			"found builtin-function")
+}
+
+func TestTry(t *testing.T) {
+	expectRun(t, `out = try(func(a, b) { return a / b }, 6, 3)`, nil,
+		ARR{2, tengo.UndefinedValue})
+	expectRun(t, `r, e := try(func() {}); out = [r, e]`, nil,
+		ARR{tengo.UndefinedValue, tengo.UndefinedValue})
+	expectRun(t, `out = try(len, [1, 2])`, nil, ARR{2, tengo.UndefinedValue})
+
+	// runtime errors are trapped
+	expectRun(t, `
+div := func(a, b) { return a / b }
+r, e := try(div, 1, 0)
+out = [r, e]`, nil,
+		ARR{tengo.UndefinedValue, errorObject("division by zero")})
+	expectRun(t, `
+r, e := try(func() { return 1 + {} })
+out = is_error(e) ? string(e.value) : "no error"`, nil,
+		"invalid operation: int + map")
+	expectRun(t, `out = try(func(a) { return a }, 1, 2)[1].value`, nil,
+		"wrong number of arguments: want=1, got=2")
+	expectRun(t, `out = try(len)[1].value`, nil,
+		"wrong number of arguments in call to 'builtin-function:len'")
+
+	// so are errors raised in nested calls, and execution resumes after try
+	expectRun(t, `
+inner := func() { assert(false, "boom") }
+outer := func() { inner(); return "unreachable" }
+r, e := try(outer)
+out = [r, e.value, "after"]`, nil,
+		ARR{tengo.UndefinedValue, "assertion failed: boom", "after"})
+
+	// returned error values
+	expectRun(t, `
+r, e := try(func(x) { return error(x) }, "bad")
+out = [r, e.value]`, nil, ARR{tengo.UndefinedValue, "bad"})
+
+	// the allocation limit is not trapped
+	expectError(t, `
+f := func() { a := []; for i := 0; i < 100; i++ { a = append(a, i) } }
+try(f)`, Opts().MaxAllocs(50).Skip2ndPass(), "allocation limit exceeded")
+
+	expectError(t, `a := 0; b := 1 / a`, nil, "Runtime Error: division by zero")
+	expectError(t, `a := 0; b := 1 % a`, nil, "Runtime Error: division by zero")
+	expectError(t, `try()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:try'")
+	expectError(t, `try(1)`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:try': expected callable, found int")
+}
+
+func TestTimeit(t *testing.T) {
+	// the result comes with the duration of the call in nanoseconds
+	expectRun(t, `
+slow := func(n) {
+	total := 0
+	for i := 0; i < n; i++ { total += i }
+	return total
+}
+r, d := timeit(slow, 10000)
+out = [r, is_int(d), d > 0]`, nil, ARR{49995000, true, true})
+
+	nap := &tengo.UserFunction{
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			time.Sleep(2 * time.Millisecond)
+			return &tengo.String{Value: "rested"}, nil
+		},
+	}
+	expectRun(t, `r, d := timeit(nap); out = [r, d >= 2000000]`,
+		Opts().Symbol("nap", nap).Skip2ndPass(), ARR{"rested", true})
+
+	// closures, builtins, and nested timings
+	expectRun(t, `
+k := 3
+r, d := timeit(func(a, b) { return [a, b, k] }, 1, 2)
+out = r`, nil, ARR{1, 2, 3})
+	expectRun(t, `out = timeit(len, [1, 2, 3])[0]`, nil, 3)
+	expectRun(t, `
+outer := timeit(func() { return timeit(func() { return "in" }) })
+out = [outer[0][0], outer[1] >= outer[0][1]]`, nil, ARR{"in", true})
+
+	// errors of the call are not trapped
+	expectError(t, `timeit(func(a, b) { return a / b }, 1, 0)`, nil,
+		"Runtime Error: division by zero")
+	expectRun(t, `out = timeit(func() { return error("bad") })[0]`,
+		nil, errorObject("bad"))
+	expectError(t, `timeit(func(a) {})`, nil,
+		"Runtime Error: wrong number of arguments: want=1, got=0")
+	expectError(t, `timeit()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:timeit'")
+	expectError(t, `timeit(1)`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:timeit': expected callable, found int")
+}
+
+func TestDefault(t *testing.T) {
+	expectRun(t, `out = default(undefined, 5)`, nil, 5)
+	expectRun(t, `out = default(3, 5)`, nil, 3)
+	expectRun(t, `m := {a: 1}; out = [default(m.a, 0), default(m.b, 0)]`,
+		nil, ARR{1, 0})
+	expectRun(t, `out = default(undefined, undefined)`,
+		nil, tengo.UndefinedValue)
+
+	// zero values are defined, so they're not replaced
+	expectRun(t, `out = [default(0, 1), default("", "x"), default(false, true),
+		default(0.0, 1.5)]`, nil, ARR{0, "", false, 0.0})
+	expectRun(t, `out = [default([], [1]), default({}, {a: 1})]`,
+		nil, ARR{ARR{}, MAP{}})
+	expectRun(t, `out = default(error("e"), 1)`, nil, errorObject("e"))
+
+	// the value itself is returned, not a copy
+	expectRun(t, `a := [1]; b := default(a, []); b[0] = 2; out = a`,
+		nil, ARR{2})
+
+	expectError(t, `default(1)`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:default'")
+	expectError(t, `default(1, 2, 3)`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:default'")
+}
+
+func TestCoalesce(t *testing.T) {
+	expectRun(t, `out = coalesce(undefined, undefined, 3, 4)`, nil, 3)
+	expectRun(t, `out = coalesce(1)`, nil, 1)
+	expectRun(t, `out = coalesce(undefined)`, nil, tengo.UndefinedValue)
+	expectRun(t, `out = coalesce(undefined, undefined)`,
+		nil, tengo.UndefinedValue)
+	expectRun(t, `
+cfg := {port: 0}
+env := {}
+out = [coalesce(env.port, cfg.port, 8080), coalesce(env.host, cfg.host, "localhost")]`,
+		nil, ARR{0, "localhost"})
+
+	// zero values are the first defined argument
+	expectRun(t, `out = [coalesce(undefined, 0, 1), coalesce(undefined, "", "x"),
+		coalesce(undefined, [], [1]), coalesce(false, true)]`,
+		nil, ARR{0, "", ARR{}, false})
+
+	expectError(t, `coalesce()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:coalesce'")
+}
+
 func TestSliceIndex(t *testing.T) {
 	expectError(t, `undefined[:1]`, nil, "Runtime Error: not indexable")
 	expectError(t, `123[-1:2]`, nil, "Runtime Error: not indexable")
@@ -3996,3 +4767,1135 @@ func objectZeroCopy(o tengo.Object) tengo.Object {
 		panic(fmt.Errorf("unknown object type: %s", o.TypeName()))
 	}
 }
+
+func TestNumericReducers(t *testing.T) {
+	// all ints stay ints
+	expectRun(t, `out = [sum([1, 2, 3]), min([3, 1, 2]), max([3, 1, 2])]`,
+		nil, ARR{6, 1, 3})
+	expectRun(t, `out = avg([1, 2, 3, 4])`, nil, 2.5)
+	expectRun(t, `out = sum([9007199254740993, 1])`, nil, int64(9007199254740994))
+	expectRun(t, `out = max([9007199254740993, 9007199254740992])`, nil,
+		int64(9007199254740993))
+	expectRun(t, `out = [sum(immutable([1, 2])), min(immutable([2, 1]))]`,
+		nil, ARR{3, 1})
+
+	// mixed arrays are promoted to float
+	expectRun(t, `out = [sum([1, 2.5]), min([3, 1.5, 2]), max([3, 1.5, 2])]`,
+		nil, ARR{3.5, 1.5, 3.0})
+	expectRun(t, `out = avg([1, 2.0])`, nil, 1.5)
+	expectRun(t, `out = [sum([1.5]), min([2.5]), max([-1.0, -2.0])]`,
+		nil, ARR{1.5, 2.5, -1.0})
+
+	// empty arrays
+	expectRun(t, `out = sum([])`, nil, 0)
+	expectRun(t, `out = min([])`, nil, errorObject("empty array"))
+	expectRun(t, `out = max([])`, nil, errorObject("empty array"))
+	expectRun(t, `out = avg([])`, nil, errorObject("empty array"))
+
+	// non-numeric elements
+	expectRun(t, `out = sum([1, "2"])`, nil,
+		errorObject("non-numeric element: string"))
+	expectRun(t, `out = min([1, undefined])`, nil,
+		errorObject("non-numeric element: undefined"))
+	expectRun(t, `out = max([[1]])`, nil,
+		errorObject("non-numeric element: array"))
+	expectRun(t, `out = avg([1.0, true])`, nil,
+		errorObject("non-numeric element: bool"))
+
+	// the names can still be used for variables and functions of scripts
+	expectRun(t, `sum := 0; for x in [1, 2] { sum += x }; out = sum`, nil, 3)
+	expectRun(t, `
+min := func(a, b) { return a < b ? a : b }
+max, avg := [1, 2]
+out = [min(2, 1), max, avg]`, nil, ARR{1, 1, 2})
+	expectRun(t, `out = [sum([1]), func() { sum := 2; return sum }()]`,
+		nil, ARR{1, 2})
+
+	// int sums never wrap around
+	expectRun(t, `out = sum([9223372036854775806, 1])`, nil,
+		int64(math.MaxInt64))
+	expectError(t, `sum([9223372036854775807, 1])`, nil,
+		"Runtime Error: integer overflow: 9223372036854775807 + 1")
+	expectError(t, `sum([-9223372036854775807, -1, -1])`, nil,
+		"Runtime Error: integer overflow: -9223372036854775808 + -1")
+
+	expectError(t, `sum(1)`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:sum': expected array, found int")
+	expectError(t, `avg()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:avg'")
+}
+
+func TestFormatMap(t *testing.T) {
+	// named substitutions
+	expectRun(t, `out = format_map("Hello, {name}! You have {count} new {what}.",
+		{name: "Ana", count: 3, what: "messages"})`,
+		nil, "Hello, Ana! You have 3 new messages.")
+	expectRun(t, `out = format_map("{a}{b}{a}", {a: "x", b: 1.5})`, nil, "x1.5x")
+	expectRun(t, `out = format_map("{v}", immutable({v: [1, "s"]}))`, nil,
+		`[1, "s"]`)
+	expectRun(t, `out = format_map("{first name} é {k}", {"first name": "Zé", k: true})`,
+		nil, "Zé é true")
+	expectRun(t, `out = format_map("", {})`, nil, "")
+
+	// escaped braces
+	expectRun(t, `out = format_map("{{name}} is {name}, {{}} and }}{{", {name: "x"})`,
+		nil, "{name} is x, {} and }{")
+	expectRun(t, `out = format_map("{{{name}}}", {name: "x"})`, nil, "{x}")
+
+	// missing keys render as empty strings unless strict
+	expectRun(t, `out = format_map("[{missing}] [{u}]", {u: undefined})`, nil,
+		"[] []")
+	expectRun(t, `out = format_map("[{missing}]", {}, false)`, nil, "[]")
+	expectRun(t, `out = format_map("{a}{missing}", {a: 1}, true)`, nil,
+		errorObject("missing key: missing"))
+	expectRun(t, `out = format_map("{a}", {a: 1}, true)`, nil, "1")
+
+	// malformed templates and arguments
+	expectError(t, `format_map("a {b", {})`, nil,
+		"Runtime Error: unclosed '{' at offset 2 in template")
+	expectError(t, `format_map("a } b", {})`, nil,
+		"Runtime Error: unmatched '}' at offset 2 in template")
+	expectError(t, `format_map("{a}", [1])`, nil,
+		"Runtime Error: invalid type for argument 'second' in call to "+
+			"'builtin-function:format_map': expected map, found array")
+	expectError(t, `format_map(1, {})`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:format_map': expected string, found int")
+	expectError(t, `format_map("")`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:format_map'")
+}
+
+func TestDefer(t *testing.T) {
+	// deferred calls run in LIFO order after the body, and the returned
+	// value is evaluated before them
+	expectRun(t, `
+	log := []
+	push := func(x) { log = append(log, x) }
+	f := func() {
+		defer push("first")
+		defer push("second")
+		push("body")
+		return len(log)
+	}
+	out = [f(), log]`, nil, ARR{1, ARR{"body", "second", "first"}})
+
+	// the function and the arguments are evaluated by the defer statement
+	expectRun(t, `
+	log := []
+	f := func() {
+		p := func(x) { log = append(log, "a" + x) }
+		for i := 0; i < 3; i++ { defer p(string(i)) }
+		p = func(x) { log = append(log, "b" + x) }
+		defer p(["!"]...)
+	}
+	f()
+	out = log`, nil, ARR{"b!", "a2", "a1", "a0"})
+
+	// each function runs its own deferred calls, also when it's called
+	// recursively or ends with a tail call
+	expectRun(t, `
+	log := []
+	rec := func(n) {
+		if n == 0 { return 0 }
+		defer func() { log = append(log, n) }()
+		return rec(n - 1)
+	}
+	g := func() { log = append(log, "g") }
+	h := func() {
+		defer func() { log = append(log, "h") }()
+		return g()
+	}
+	rec(3)
+	h()
+	out = log`, nil, ARR{1, 2, 3, "g", "h"})
+
+	// error values and runtime errors
+	expectRun(t, `
+	log := []
+	f := func() {
+		defer func() { log = append(log, "cleanup") }()
+		return error("failed")
+	}
+	out = [f(), log]`, nil, ARR{errorObject("failed"), ARR{"cleanup"}})
+	expectRun(t, `
+	log := []
+	inner := func() {
+		defer func() { log = append(log, "inner") }()
+		return 1 / 0
+	}
+	outer := func() {
+		defer func() { log = append(log, "outer 1") }()
+		defer func() { log = append(log, "outer 2") }()
+		inner()
+		log = append(log, "unreachable")
+	}
+	r, e := try(outer)
+	out = [e, log]`, nil, ARR{errorObject("division by zero"),
+		ARR{"inner", "outer 2", "outer 1"}})
+
+	// deferred calls can't hide the error, and a failing deferred call fails
+	// the function
+	expectRun(t, `
+	log := []
+	f := func() {
+		defer func() { log = append(log, "still runs") }()
+		defer func() { return 1 + "a" }()
+		defer func() { log = append(log, "runs") }()
+		return "ok"
+	}
+	r, e := try(f)
+	out = [r, is_error(e), log]`, nil,
+		ARR{tengo.UndefinedValue, true, ARR{"runs", "still runs"}})
+	expectError(t, `func() { defer func() { return 1 + "a" }() }()`, nil,
+		"Runtime Error: invalid operation: int + string")
+
+	// builtins, callbacks and coroutines
+	expectRun(t, `
+	log := []
+	f := func(arr) {
+		defer group_by(arr, func(x) { log = append(log, x); return x })
+		log = append(log, "body")
+	}
+	f([1, 2])
+	out = log`, nil, ARR{"body", 1, 2})
+	expectRun(t, `
+	log := []
+	gen := func() {
+		defer func() { log = append(log, "done") }()
+		yield 1
+		yield 2
+	}
+	co := coroutine(gen)
+	co.resume()
+	out = [copy(log)]
+	for v in co {}
+	out = append(out, log)`, nil, ARR{ARR{}, ARR{"done"}})
+
+	expectError(t, `func() { defer 1() }()`, nil,
+		"Runtime Error: not callable: int")
+	expectError(t, `func() { x := 1; defer len(x...) }()`, nil,
+		"Runtime Error: not an array: int")
+}
+
+func TestDeepEqual(t *testing.T) {
+	// nested structures
+	expectRun(t, `
+	a := {name: "x", tags: ["a", "b"], meta: {n: 1, list: [{k: true}]}}
+	b := {meta: {list: [{k: true}], n: 1}, tags: ["a", "b"], name: "x"}
+	out = [deep_equal(a, b), deep_equal(a, copy(a)), deep_equal(a, immutable(b))]`,
+		nil, ARR{true, true, true})
+	expectRun(t, `out = [deep_equal([1, [2, 3]], [1, [2, 3]]), deep_equal([1, 2], [2, 1])]`,
+		nil, ARR{true, false})
+	expectRun(t, `out = [deep_equal([], []), deep_equal({}, {}), deep_equal([], {})]`,
+		nil, ARR{true, true, false})
+
+	// differing key sets, values and types
+	expectRun(t, `out = [
+		deep_equal({a: 1, b: 2}, {a: 1}),
+		deep_equal({a: 1}, {a: 1, b: 2}),
+		deep_equal({a: 1}, {b: 1}),
+		deep_equal({a: undefined}, {b: undefined}),
+		deep_equal({a: [1]}, {a: [1, 2]}),
+		deep_equal({a: [1]}, {a: {x: 1}}),
+		deep_equal([1], 1)
+	]`, nil, ARR{false, false, false, false, false, false, false})
+
+	// scalars compare like ==, so ints and floats differ
+	expectRun(t, `out = [deep_equal(1, 1), deep_equal("a", "a"), deep_equal(1, 1.0),
+		deep_equal([1], [1.0]), deep_equal(undefined, undefined)]`,
+		nil, ARR{true, true, false, false, true})
+
+	// cyclic values (kept in locals, as globals are printed by the tests)
+	expectRun(t, `
+	out = func() {
+		a := {n: 1}; a.self = a
+		b := {n: 1}; b.self = b
+		c := {n: 2}; c.self = c
+		x := [1, 0]; x[1] = x
+		y := [1, 0]; y[1] = y
+		return [deep_equal(a, b), deep_equal(a, c), deep_equal(x, y),
+			deep_equal(a, a)]
+	}()`, nil, ARR{true, false, true, true})
+	expectRun(t, `
+	out = func() {
+		a := {}; b := {}
+		a.next = b; b.next = a
+		c := {}; c.next = c
+		return [deep_equal(a, c), deep_equal([a, b], [b, a])]
+	}()`, nil, ARR{true, true})
+
+	expectError(t, `deep_equal(1)`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:deep_equal'")
+}
+
+func TestPipe(t *testing.T) {
+	// pipe applies the functions from left to right, compose from right to
+	// left
+	expectRun(t, `
+double := func(x) { return x * 2 }
+inc := func(x) { return x + 1 }
+square := func(x) { return x * x }
+out = [pipe(double, inc)(5), inc(double(5)), compose(double, inc)(5),
+	pipe(double, inc, square)(3), compose(double, inc, square)(3)]`,
+		nil, ARR{11, 11, 12, 49, 20})
+
+	// empty pipes are the identity, and a single function is called as is
+	expectRun(t, `out = [pipe()(5), compose()("x"), pipe(len)([1, 2])]`,
+		nil, ARR{5, "x", 2})
+
+	// builtins, closures and the results of other pipes can be stages
+	expectRun(t, `
+add := func(a) { return func(b) { return a + b } }
+f := pipe(add(1), pipe(add(10), string), len)
+out = [f(5), compose(string, add(1))(2)]`,
+		nil, ARR{2, "3"})
+
+	// error values are passed along, runtime errors stop the pipe
+	expectRun(t, `
+calls := 0
+out = pipe(func(x) { return error(x) }, func(e) { calls++; return e })(1)
+out = [is_error(out), calls]`, nil, ARR{true, 1})
+	expectError(t, `pipe(func(x) { return x / 0 }, func(x) { return x })(1)`,
+		nil, "Runtime Error: division by zero")
+
+	expectError(t, `pipe(func(x) { return x })(1, 2)`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'user-function:pipe'")
+	expectError(t, `compose(len, 1)`, nil,
+		"Runtime Error: invalid type for argument 'second' in call to "+
+			"'builtin-function:compose': expected callable, found int")
+	expectError(t, `pipe(len, len, len, len, len, len, len, len, len, len, len, 1)`,
+		nil, "Runtime Error: invalid type for argument '12th' in call to "+
+			"'builtin-function:pipe': expected callable, found int")
+}
+
+func TestRetry(t *testing.T) {
+	// succeeds on the 2nd attempt, after an error value or a runtime error
+	expectRun(t, `
+calls := 0
+f := func(x) {
+	calls++
+	if calls < 2 { return error("flaky") }
+	return x * 10
+}
+out = [retry(f, 3, 4), calls]`, nil, ARR{40, 2})
+	expectRun(t, `
+calls := 0
+f := func(a, b) {
+	calls++
+	if calls < 2 { return a / 0 }
+	return a + b
+}
+out = [retry(f, 3, 1, 2), calls]`, nil, ARR{3, 2})
+	expectRun(t, `out = retry(func() { return "ok" }, 1)`, nil, "ok")
+
+	// always fails: the error of the last attempt is returned
+	expectRun(t, `
+calls := 0
+out = retry(func() { calls++; return error("attempt " + calls) }, 3)
+out = [out.value, calls]`, nil, ARR{"attempt 3", 3})
+	expectRun(t, `
+calls := 0
+out = retry(func() { calls++; return 1 / 0 }, 2)
+out = [out, calls]`, nil, ARR{errorObject("division by zero"), 2})
+	expectRun(t, `out = retry(len, 2, 1).value`, nil,
+		"invalid type for argument 'first' in call to "+
+			"'builtin-function:len': expected array/string/bytes/map, found int")
+
+	// non-positive attempts
+	expectRun(t, `out = retry(func() { return 1 }, 0)`, nil,
+		errorObject("invalid number of attempts: 0"))
+	expectRun(t, `out = retry(func() { return 1 }, -2)`, nil,
+		errorObject("invalid number of attempts: -2"))
+
+	// the allocation limit is not trapped
+	expectError(t, `
+f := func() { a := []; for i := 0; i < 100; i++ { a = append(a, i) } }
+retry(f, 3)`, Opts().MaxAllocs(50).Skip2ndPass(), "allocation limit exceeded")
+
+	expectError(t, `retry(func() {})`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:retry'")
+	expectError(t, `retry(1, 2)`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:retry': expected callable, found int")
+	expectError(t, `retry(func() {}, "2")`, nil,
+		"Runtime Error: invalid type for argument 'second' in call to "+
+			"'builtin-function:retry': expected int, found string")
+}
+
+func TestConst(t *testing.T) {
+	expectRun(t, `const PI = 3.5; out = PI * 2`, nil, 7.0)
+	expectRun(t, `
+const N = 10
+const HALF = N / 2
+const NAME = "n"
+const OK = true
+out = [N, HALF, -HALF, NAME + N, OK, 'c']`, nil,
+		ARR{10, 5, -5, "n10", true, 'c'})
+
+	// in functions, closures and blocks
+	expectRun(t, `
+f := func(x) {
+	const k = 3
+	g := func() { return x * k }
+	if x > 0 { const k = 100; return g() + k }
+	return g()
+}
+out = [f(1), f(-1)]`, nil, ARR{103, -3})
+
+	// values computed at runtime and recursive functions
+	expectRun(t, `
+const base = len([1, 2, 3])
+const fact = func(n) { return n < 2 ? 1 : n * fact(n - 1) }
+out = fact(base)`, nil, 6)
+	expectRun(t, `
+const m = {a: 1}
+m.a = 2
+m.b = 3
+out = m`, nil, MAP{"a": 2, "b": 3})
+
+	// modules
+	expectRun(t, `out = import("mod").x`,
+		Opts().Module("mod", `const X = 40; export {x: X + 2}`), 42)
+}
+
+func TestMapValuesKeys(t *testing.T) {
+	expectRun(t, `out = map_values({a: 1, b: 2, c: 3}, func(v) { return v * 2 })`,
+		nil, MAP{"a": 2, "b": 4, "c": 6})
+	expectRun(t, `out = map_values(immutable({a: 1}), string)`,
+		nil, MAP{"a": "1"})
+	expectRun(t, `out = map_values({}, func(v) { return v })`, nil, MAP{})
+	expectRun(t, `
+text := import("text")
+out = map_keys({a: 1, b: 2}, text.to_upper)`,
+		Opts().Stdlib(),
+		MAP{"A": 1, "B": 2})
+	expectRun(t, `out = map_keys({"1": "x"}, func(k) { return int(k) + 1 })`,
+		nil, MAP{"2": "x"})
+
+	// the functions are called in the order of the keys, and the maps are
+	// copies
+	expectRun(t, `
+seen := []
+m := {b: 2, a: 1}
+n := map_values(m, func(v) { seen = append(seen, v); return v })
+n.a = 10
+out = [seen, m.a]`, nil, ARR{ARR{1, 2}, 1})
+
+	// duplicate keys are an error
+	expectRun(t, `out = map_keys({a: 1, A: 2}, func(k) { return "x" })`,
+		nil, errorObject("duplicate map key: x"))
+	expectRun(t, `out = map_keys({a: 1}, func(k) { return [k] })`,
+		nil, errorObject("invalid map key: array"))
+
+	expectError(t, `map_values({a: 1}, func(v) { return v / 0 })`, nil,
+		"Runtime Error: division by zero")
+	expectError(t, `map_keys({a: 1})`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:map_keys'")
+	expectError(t, `map_values([1], string)`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:map_values': expected map, found array")
+	expectError(t, `map_keys({}, 1)`, nil,
+		"Runtime Error: invalid type for argument 'second' in call to "+
+			"'builtin-function:map_keys': expected callable, found int")
+}
+
+func TestPanicRecover(t *testing.T) {
+	// recovered within the same function, which returns undefined
+	expectRun(t, `
+log := []
+f := func() {
+	defer func() { log = append(log, recover()) }()
+	panic("boom")
+	log = append(log, "unreachable")
+}
+r := f()
+out = [is_undefined(r), log]`, nil, ARR{true, ARR{"boom"}})
+
+	// the execution resumes in the caller of the recovering function,
+	// after the deferred calls of that function and the frames in between
+	expectRun(t, `
+log := []
+inner := func() { defer func() { log = append(log, "inner") }(); panic({code: 7}) }
+middle := func() { inner(); log = append(log, "unreachable") }
+outer := func() {
+	defer func() { log = append(log, "last") }()
+	defer func() { log = append(log, recover().code) }()
+	defer func() { log = append(log, "first") }()
+	middle()
+}
+outer()
+out = append(log, "done")`, nil, ARR{"inner", "first", 7, "last", "done"})
+
+	// runtime errors are recovered as error values
+	expectRun(t, `
+f := func(a, b) {
+	defer func() { out = recover() }()
+	return a / b
+}
+f(1, 0)`, nil, errorObject("division by zero"))
+
+	// recover returns undefined without panic, when called twice, and when
+	// not called directly by the deferred function
+	expectRun(t, `out = recover()`, nil, tengo.UndefinedValue)
+	expectRun(t, `
+f := func() {
+	defer func() { out = [recover(), recover()] }()
+	panic(1)
+}
+f()`, nil, ARR{1, tengo.UndefinedValue})
+	expectError(t, `
+helper := func() { return recover() }
+f := func() { defer func() { helper() }(); panic("boom") }
+f()`, nil, "Runtime Error: panic: boom")
+	expectError(t, `
+f := func() { defer recover(); panic("boom") }
+f()`, nil, "Runtime Error: panic: boom")
+
+	// panics cross the calls made by builtins, in both directions
+	expectRun(t, `
+f := func() {
+	defer func() { out = recover() }()
+	map_values({a: 1}, func(v) { panic("in callback") })
+}
+f()`, nil, "in callback")
+	expectRun(t, `
+out = map_values({a: 1}, func(v) {
+	defer func() { recover() }()
+	panic("in callback")
+})
+out = is_undefined(out.a)`, nil, true)
+
+	// a panic in a deferred call on return can be recovered by the next one
+	expectRun(t, `
+f := func() {
+	defer func() { out = recover() }()
+	defer func() { panic("deferred") }()
+	return 1
+}
+f()`, nil, "deferred")
+
+	// the allocation limit is not recoverable
+	expectError(t, `
+f := func() {
+	defer func() { recover() }()
+	a := []
+	for i := 0; i < 100; i++ { a = append(a, i) }
+}
+f()`, Opts().MaxAllocs(50).Skip2ndPass(), "allocation limit exceeded")
+
+	expectError(t, `panic()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:panic'")
+	expectError(t, `f := func() { panic([1, 2]) }; f()`, nil,
+		"Runtime Error: panic: [1, 2]")
+
+	// unrecovered panics reach Go with their value
+	script := tengo.NewScript([]byte(`
+fail := func(code) { panic({code: code}) }
+fail(3)`))
+	_, err := script.Run()
+	var perr tengo.ErrPanic
+	require.True(t, errors.As(err, &perr))
+	require.Equal(t, int64(3), perr.Value.(*tengo.Map).Value["code"].(*tengo.Int).Value)
+
+	script = tengo.NewScript([]byte(`fail := func(v) { panic(v) }`))
+	compiled, err := script.Run()
+	require.NoError(t, err)
+	fn := compiled.Get("fail").Value().(*tengo.CompiledFunction)
+	_, err = tengo.NewExecutionContext(compiled).Call(fn, &tengo.String{Value: "x"})
+	require.True(t, errors.As(err, &perr))
+	require.Equal(t, "x", perr.Value.(*tengo.String).Value)
+	_, err = tengo.NewExecutionContext(compiled).Call(fn, &tengo.Int{Value: 1})
+	require.True(t, errors.As(err, &perr))
+	require.Equal(t, "panic: 1", perr.Error())
+
+	// a function called from Go and recovering returns undefined
+	script = tengo.NewScript([]byte(`
+safe := func(v) { defer func() { recover() }(); panic(v) }`))
+	compiled, err = script.Run()
+	require.NoError(t, err)
+	fn = compiled.Get("safe").Value().(*tengo.CompiledFunction)
+	res, err := tengo.NewExecutionContext(compiled).Call(fn, &tengo.Int{Value: 1})
+	require.NoError(t, err)
+	require.Equal(t, tengo.UndefinedValue, res)
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	// round trips of nested structures
+	expectRun(t, `
+v := {name: "tengo", tags: ["a", "b"], meta: {n: 3, ratio: 0.5, ok: true, none: undefined}}
+out = from_json(to_json(v))`, nil, MAP{
+		"name": "tengo",
+		"tags": ARR{"a", "b"},
+		"meta": MAP{"n": 3, "ratio": 0.5, "ok": true,
+			"none": tengo.UndefinedValue},
+	})
+	expectRun(t, `out = from_json(to_json([[1, [2, [3]]], {}, []]))`, nil,
+		ARR{ARR{1, ARR{2, ARR{3}}}, MAP{}, ARR{}})
+	expectRun(t, `out = to_json({a: [1, "x\n", immutable([false])]})`,
+		nil, `{"a":[1,"x\n",[false]]}`)
+	expectRun(t, `out = from_json(bytes("[1.5, null]"))`, nil,
+		ARR{1.5, tengo.UndefinedValue})
+	expectRun(t, `out = from_json(" \"s\" ")`, nil, "s")
+
+	// values that can't be encoded
+	expectRun(t, `out = to_json(func() {})`, nil,
+		errorObject("unsupported type: compiled-function"))
+	expectRun(t, `out = to_json({a: [1, len]})`, nil,
+		errorObject("unsupported type: builtin-function:len"))
+	expectRun(t, `out = to_json([1.0 / 0])`, nil,
+		errorObject("unsupported float value"))
+
+	// malformed JSON
+	expectRun(t, `out = from_json("{")`, nil,
+		errorObject("unexpected end of JSON input"))
+	expectRun(t, `out = from_json("[1,]")`, nil,
+		errorObject("invalid character ']' looking for beginning of value"))
+	expectRun(t, `out = from_json("")`, nil,
+		errorObject("unexpected end of JSON input"))
+
+	expectError(t, `to_json()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:to_json'")
+	expectError(t, `from_json(1)`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:from_json': expected string/bytes, found int")
+}
+
+func TestUnique(t *testing.T) {
+	expectRun(t, `out = unique([3, 1, 3, 2, 1, 2])`, nil, ARR{3, 1, 2})
+	expectRun(t, `out = unique(["b", "a", "b", "c", "a"])`,
+		nil, ARR{"b", "a", "c"})
+	expectRun(t, `out = unique(immutable([1, "1", 1.0, 1, '1', "1"]))`,
+		nil, ARR{1, "1", 1.0, '1'})
+	expectRun(t, `out = unique([])`, nil, ARR{})
+	expectRun(t, `out = unique([undefined, true, undefined, false, true])`,
+		nil, ARR{tengo.UndefinedValue, true, false})
+
+	// unhashable elements are compared by value
+	expectRun(t, `out = unique([{a: 1}, [1], {a: 1}, {a: 2}, [1], 1])`,
+		nil, ARR{MAP{"a": 1}, ARR{1}, MAP{"a": 2}, 1})
+
+	// the result is a copy
+	expectRun(t, `
+a := [1, 1, 2]
+b := unique(a)
+b[0] = 5
+out = [a, b]`, nil, ARR{ARR{1, 1, 2}, ARR{5, 2}})
+
+	expectRun(t, `
+users := [{id: 1, name: "a"}, {id: 2, name: "b"}, {id: 1, name: "c"}, {id: 3, name: "b"}]
+out = [unique_by(users, func(u) { return u.id }),
+	unique_by(users, func(u) { return u.name })]`,
+		nil, ARR{
+			ARR{
+				MAP{"id": 1, "name": "a"},
+				MAP{"id": 2, "name": "b"},
+				MAP{"id": 3, "name": "b"},
+			},
+			ARR{
+				MAP{"id": 1, "name": "a"},
+				MAP{"id": 2, "name": "b"},
+				MAP{"id": 1, "name": "c"},
+			},
+		})
+	expectRun(t, `out = unique_by([1, 2, 3, 4, 5], func(x) { return [x % 2] })`,
+		nil, ARR{1, 2})
+
+	expectError(t, `unique_by([1], func(x) { return x / 0 })`, nil,
+		"Runtime Error: division by zero")
+	expectError(t, `unique()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:unique'")
+	expectError(t, `unique({a: 1})`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:unique': expected array, found map")
+	expectError(t, `unique_by([1], 1)`, nil,
+		"Runtime Error: invalid type for argument 'second' in call to "+
+			"'builtin-function:unique_by': expected callable, found int")
+}
+
+func TestNumericHelpers(t *testing.T) {
+	// clamp keeps ints unless a float is involved
+	expectRun(t, `out = clamp(5, 0, 10)`, nil, 5)
+	expectRun(t, `out = clamp(-3, 0, 10)`, nil, 0)
+	expectRun(t, `out = clamp(12, 0, 10)`, nil, 10)
+	expectRun(t, `out = clamp(7, 7, 7)`, nil, 7)
+	expectRun(t, `out = clamp(5, 0, 2.5)`, nil, 2.5)
+	expectRun(t, `out = clamp(1, 0, 10.0)`, nil, 1.0)
+	expectRun(t, `out = clamp(-0.5, 0, 1)`, nil, 0.0)
+	expectRun(t, `out = clamp(5, 10, 0)`, nil,
+		errorObject("invalid range: 10 > 0"))
+	expectRun(t, `out = clamp(5, 1.5, 1.25)`, nil,
+		errorObject("invalid range: 1.5 > 1.25"))
+
+	expectRun(t, `out = [sign(-7), sign(0), sign(3)]`, nil, ARR{-1, 0, 1})
+	expectRun(t, `out = [sign(-0.1), sign(0.0), sign(2.5)]`, nil, ARR{-1, 0, 1})
+
+	expectRun(t, `out = abs(-5)`, nil, 5)
+	expectRun(t, `out = abs(5)`, nil, 5)
+	expectRun(t, `out = abs(-2.5)`, nil, 2.5)
+	expectRun(t, `out = abs(0.0)`, nil, 0.0)
+
+	// round keeps the type, and rounds halfway values to even
+	expectRun(t, `out = round(2.5)`, nil, 2.0)
+	expectRun(t, `out = round(3.5)`, nil, 4.0)
+	expectRun(t, `out = round(-2.5)`, nil, -2.0)
+	expectRun(t, `out = round(2.51)`, nil, 3.0)
+	expectRun(t, `out = round(3.14159, 2)`, nil, 3.14)
+	expectRun(t, `out = round(0.125, 2)`, nil, 0.12)
+	expectRun(t, `out = round(0.375, 2)`, nil, 0.38)
+	// 2.675 is slightly less than its decimal representation
+	expectRun(t, `out = round(2.675, 2)`, nil, 2.67)
+	expectRun(t, `out = round(1250.0, -2)`, nil, 1200.0)
+	expectRun(t, `out = round(1350.0, -2)`, nil, 1400.0)
+	expectRun(t, `out = round(7, 2)`, nil, 7)
+	expectRun(t, `out = round(1250, -2)`, nil, 1200)
+	expectRun(t, `out = round(1350, -2)`, nil, 1400)
+	expectRun(t, `out = round(-1251, -2)`, nil, -1300)
+	expectRun(t, `out = round(49, -2)`, nil, 0)
+	expectRun(t, `out = round(123, -25)`, nil, 0)
+
+	expectError(t, `round(9223372036854775807, -1)`, nil,
+		"Runtime Error: integer overflow")
+	expectError(t, `clamp(1, 2)`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:clamp'")
+	expectError(t, `clamp("1", 0, 2)`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:clamp': expected int/float, found string")
+	expectError(t, `abs(-9223372036854775807 - 1)`, nil,
+		"Runtime Error: integer overflow: abs(-9223372036854775808)")
+	expectError(t, `abs("1")`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:abs': expected int/float, found string")
+	expectError(t, `round(1.5, 1.0)`, nil,
+		"Runtime Error: invalid type for argument 'second' in call to "+
+			"'builtin-function:round': expected int, found float")
+}
+
+func TestFrequencies(t *testing.T) {
+	expectRun(t, `out = frequencies([1, 2, 1, 3, 1, 2])`,
+		nil, MAP{"1": 3, "2": 2, "3": 1})
+	expectRun(t, `out = frequencies(["b", "a", "b", "c", "b"])`,
+		nil, MAP{"a": 1, "b": 3, "c": 1})
+	expectRun(t, `out = frequencies(immutable([true, 1.5, 'x', false, 1.5]))`,
+		nil, MAP{"true": 1, "false": 1, "1.5": 2, "x": 1})
+	expectRun(t, `out = frequencies([])`, nil, MAP{})
+
+	// keys are the string forms of the elements
+	expectRun(t, `out = frequencies([1, "1", 'a', "a"])`,
+		nil, MAP{"1": 2, "a": 2})
+	expectRun(t, `
+words := ["x", "y", "x"]
+f := frequencies(words)
+out = f[words[0]]`, nil, 2)
+
+	expectRun(t, `out = frequencies([1, [1]])`,
+		nil, errorObject("unhashable element: array"))
+	expectRun(t, `out = frequencies([{a: 1}])`,
+		nil, errorObject("unhashable element: map"))
+	expectRun(t, `out = frequencies([undefined])`,
+		nil, errorObject("unhashable element: undefined"))
+	expectError(t, `frequencies()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:frequencies'")
+	expectError(t, `frequencies("abc")`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:frequencies': expected array, found string")
+}
+
+func TestByteConversions(t *testing.T) {
+	// ints round-trip in both byte orders
+	for _, c := range []struct {
+		n      int64
+		size   int
+		big    []byte
+		little []byte
+	}{
+		{-2, 1, []byte{0xfe}, []byte{0xfe}},
+		{-12345, 2, []byte{0xcf, 0xc7}, []byte{0xc7, 0xcf}},
+		{305419896, 4, []byte{0x12, 0x34, 0x56, 0x78},
+			[]byte{0x78, 0x56, 0x34, 0x12}},
+		{-2, 8, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe},
+			[]byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	} {
+		expectRun(t, fmt.Sprintf(`out = to_bytes(%d, %d, true)`, c.n, c.size),
+			nil, c.big)
+		expectRun(t, fmt.Sprintf(`out = to_bytes(%d, %d, false)`, c.n, c.size),
+			nil, c.little)
+		expectRun(t, fmt.Sprintf(
+			`out = from_bytes(to_bytes(%d, %d, true), true, true)`, c.n, c.size),
+			nil, c.n)
+		expectRun(t, fmt.Sprintf(
+			`out = from_bytes(to_bytes(%d, %d, false), true, false)`, c.n, c.size),
+			nil, c.n)
+	}
+	expectRun(t, `out = from_bytes(to_bytes(65535, 2, true), false, true)`,
+		nil, 65535)
+	expectRun(t, `out = from_bytes(to_bytes(65535, 2, true), true, true)`,
+		nil, -1)
+	expectRun(t, `out = from_bytes(to_bytes(9223372036854775807, 8, false), false, false)`,
+		nil, int64(math.MaxInt64))
+	expectRun(t, `out = from_bytes(to_bytes(-1, 8, false), false, false)`,
+		nil, errorObject("18446744073709551615 overflows int"))
+
+	// floats round-trip in both byte orders
+	expectRun(t, `out = float_to_bytes(1.5, 4, true)`,
+		nil, []byte{0x3f, 0xc0, 0x00, 0x00})
+	expectRun(t, `out = float_to_bytes(1.5, 8, false)`,
+		nil, []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xf8, 0x3f})
+	expectRun(t, `out = bytes_to_float(float_to_bytes(0.1, 8, true), true)`,
+		nil, 0.1)
+	expectRun(t, `out = bytes_to_float(float_to_bytes(-2, 4, false), false)`,
+		nil, -2.0)
+
+	// unsupported sizes and values that don't fit
+	expectRun(t, `out = to_bytes(1, 3, true)`,
+		nil, errorObject("unsupported size: 3 (want 1, 2, 4 or 8)"))
+	expectRun(t, `out = from_bytes(bytes(3), true, true)`,
+		nil, errorObject("unsupported size: 3 (want 1, 2, 4 or 8)"))
+	expectRun(t, `out = to_bytes(256, 1, true)`,
+		nil, errorObject("256 does not fit in 1 bytes"))
+	expectRun(t, `out = to_bytes(-32769, 2, true)`,
+		nil, errorObject("-32769 does not fit in 2 bytes"))
+	expectRun(t, `out = float_to_bytes(1.5, 2, true)`,
+		nil, errorObject("unsupported float size: 2 (want 4 or 8)"))
+	expectRun(t, `out = float_to_bytes(1.5, -1, true)`,
+		nil, errorObject("unsupported float size: -1 (want 4 or 8)"))
+	expectRun(t, `out = float_to_bytes(1.5, 9223372036854775807, true)`,
+		nil, errorObject(
+			"unsupported float size: 9223372036854775807 (want 4 or 8)"))
+	expectRun(t, `out = to_bytes(1, -1, true)`,
+		nil, errorObject("unsupported size: -1 (want 1, 2, 4 or 8)"))
+	expectRun(t, `out = bytes_to_float(bytes(2), true)`,
+		nil, errorObject("unsupported float size: 2 (want 4 or 8)"))
+
+	expectError(t, `to_bytes(1, 4)`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:to_bytes'")
+	expectError(t, `to_bytes(1, 4, "big")`, nil,
+		"Runtime Error: invalid type for argument 'third' in call to "+
+			"'builtin-function:to_bytes': expected bool, found string")
+	expectError(t, `from_bytes("ab", true, true)`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:from_bytes': expected bytes, found string")
+}
+
+func TestMerge(t *testing.T) {
+	// nested maps merge recursively, and override wins on conflicts
+	expectRun(t, `
+base := {name: "app", db: {host: "localhost", port: 5432, opts: {ssl: false}}}
+override := {db: {port: 6543, opts: {ssl: true, timeout: 5}}, debug: true}
+out = merge(base, override)`, nil, MAP{
+		"name":  "app",
+		"debug": true,
+		"db": MAP{
+			"host": "localhost",
+			"port": 6543,
+			"opts": MAP{"ssl": true, "timeout": 5},
+		},
+	})
+	expectRun(t, `out = merge({a: {x: 1}, b: 1}, {a: 2, b: {y: 2}})`,
+		nil, MAP{"a": 2, "b": MAP{"y": 2}})
+	expectRun(t, `out = merge(immutable({a: {x: 1}}), {a: immutable({y: 2})})`,
+		nil, MAP{"a": MAP{"x": 1, "y": 2}})
+
+	// the inputs are not modified
+	expectRun(t, `
+base := {a: {x: 1}}
+merge(base, {a: {y: 2}})
+out = base`, nil, MAP{"a": MAP{"x": 1}})
+
+	// arrays are replaced, or concatenated in concat mode
+	expectRun(t, `out = merge({tags: [1, 2], n: 1}, {tags: [3]})`,
+		nil, MAP{"tags": ARR{3}, "n": 1})
+	expectRun(t, `out = merge({tags: [1, 2]}, {tags: [3]}, "replace")`,
+		nil, MAP{"tags": ARR{3}})
+	expectRun(t, `out = merge({a: {tags: [1, 2]}}, {a: {tags: [3]}}, "concat")`,
+		nil, MAP{"a": MAP{"tags": ARR{1, 2, 3}}})
+	expectRun(t, `out = merge({tags: [1]}, {tags: "x"}, "concat")`,
+		nil, MAP{"tags": "x"})
+
+	// cyclic maps are merged without infinite recursion (kept in locals, as
+	// globals are printed by the tests)
+	expectRun(t, `
+out = func() {
+	a := {n: 1}; a.self = a
+	b := {m: 2}; b.self = b
+	c := merge(a, b)
+	c.self.z = 3
+	d := merge(a, {self: {k: 4}})
+	return [c.n, c.m, c.z, c.self.self.m, d.self.k, d.self.n, a.z]
+}()`, nil, ARR{1, 2, 3, 2, 4, 1, tengo.UndefinedValue})
+
+	expectRun(t, `out = merge({}, {}, "append")`, nil,
+		errorObject(`invalid array mode: "append" (want "replace" or "concat")`))
+	expectError(t, `merge({})`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:merge'")
+	expectError(t, `merge({}, [])`, nil,
+		"Runtime Error: invalid type for argument 'second' in call to "+
+			"'builtin-function:merge': expected map, found array")
+}
+
+func TestSprintf(t *testing.T) {
+	// verbs
+	expectRun(t, `out = sprintf("%d|%s|%f|%t|%x", 42, "go", 1.5, true, 255)`,
+		nil, "42|go|1.500000|true|ff")
+	expectRun(t, `out = sprintf("%x|%X|%x", "hi", -255, to_bytes(427, 2, true))`,
+		nil, "6869|-FF|01ab")
+	expectRun(t, `out = sprintf("%v|%v|%v|%v", 1, "a", [1, "b"], {k: 2.5})`,
+		nil, `1|"a"|[1, "b"]|{k: 2.5}`)
+	expectRun(t, `out = sprintf("%v %s", undefined, error("x"))`,
+		nil, `<undefined> error: "x"`)
+	expectRun(t, `out = sprintf("100%%")`, nil, "100%")
+	expectRun(t, `out = sprintf("%[2]d %[1]d", 1, 2)`, nil, "2 1")
+
+	// width and precision
+	expectRun(t, `out = sprintf("[%5d|%-5d|%05d]", 42, 42, 42)`,
+		nil, "[   42|42   |00042]")
+	expectRun(t, `out = sprintf("[%.2f|%8.3f|%-8.1f|%.0f]", 3.14159, 2.5, 1.25, 2.5)`,
+		nil, "[3.14|   2.500|1.2     |2]")
+	expectRun(t, `out = sprintf("[%6s|%-6s|%.2s|%*d]", "ab", "ab", "abc", 4, 7)`,
+		nil, "[    ab|ab    |ab|   7]")
+
+	// mismatches return an error
+	expectRun(t, `out = sprintf("%d", "abc")`,
+		nil, errorObject("invalid verb %d for string"))
+	expectRun(t, `out = sprintf("%s", 1)`,
+		nil, errorObject("invalid verb %s for int"))
+	expectRun(t, `out = sprintf("%t", 1.5)`,
+		nil, errorObject("invalid verb %t for float"))
+	expectRun(t, `out = sprintf("%f", [1])`,
+		nil, errorObject("invalid verb %f for array"))
+	expectRun(t, `out = sprintf("%d %d", 1)`,
+		nil, errorObject("missing argument for %d"))
+	expectRun(t, `out = sprintf("%d", 1, 2, 3)`,
+		nil, errorObject("too many arguments: 2 unused"))
+	expectRun(t, `out = sprintf("%[3]d", 1)`,
+		nil, errorObject("invalid argument index for %d"))
+	expectRun(t, `out = sprintf("%*d", "x", 1)`,
+		nil, errorObject("width is not an int"))
+	expectRun(t, `out = sprintf("%d%", 1)`,
+		nil, errorObject("missing verb at end of format"))
+
+	// format is lenient about the same mismatches
+	expectRun(t, `out = format("%d", "abc")`, nil, `%!d("abc"="abc")`)
+
+	expectError(t, `sprintf()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:sprintf'")
+	expectError(t, `sprintf(1)`, nil,
+		"Runtime Error: invalid type for argument 'format' in call to "+
+			"'builtin-function:sprintf': expected string, found int")
+}
+
+func TestSortByKey(t *testing.T) {
+	records := `records := [
+	{name: "c", age: 30},
+	{name: "a", age: 25},
+	{name: "d", age: 30.5},
+	{name: "b", age: 25}
+]
+names := func(arr) {
+	res := []
+	for r in arr { res = append(res, r.name) }
+	return res
+}`
+
+	// ints and floats compare numerically, and the sort is stable
+	expectRun(t, records+`
+out = names(sort_by_key(records, "age"))`, nil, ARR{"a", "b", "c", "d"})
+	expectRun(t, records+`
+out = names(sort_by_key(records, "age", true))`, nil, ARR{"d", "c", "a", "b"})
+	expectRun(t, records+`
+out = names(sort_by_key(records, "name", false))`, nil, ARR{"a", "b", "c", "d"})
+	expectRun(t, records+`
+out = names(sort_by_key(immutable(records), "name", true))`,
+		nil, ARR{"d", "c", "b", "a"})
+
+	// the array is not modified
+	expectRun(t, records+`
+sort_by_key(records, "name")
+out = names(records)`, nil, ARR{"c", "a", "d", "b"})
+
+	// missing keys sort first, or last in descending order
+	expectRun(t, `
+out = sort_by_key([{n: 2}, {}, {n: 1}, {n: undefined, k: 1}], "n")`,
+		nil, ARR{MAP{}, MAP{"n": tengo.UndefinedValue, "k": 1}, MAP{"n": 1}, MAP{"n": 2}})
+	expectRun(t, `
+out = sort_by_key([{n: 2}, {}, {n: 1}], "n", true)`,
+		nil, ARR{MAP{"n": 2}, MAP{"n": 1}, MAP{}})
+	expectRun(t, `out = sort_by_key([], "n")`, nil, ARR{})
+
+	expectRun(t, `out = sort_by_key([{n: 1}, {n: "a"}], "n")`,
+		nil, errorObject("cannot compare numbers and strings"))
+	expectRun(t, `out = sort_by_key([{n: 1}, {n: true}], "n")`,
+		nil, errorObject("unsupported key type in element 1: bool"))
+	expectRun(t, `out = sort_by_key([{n: 1}, 2], "n")`,
+		nil, errorObject("element 1 is not a map: int"))
+	expectError(t, `sort_by_key([])`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:sort_by_key'")
+	expectError(t, `sort_by_key([], 1)`, nil,
+		"Runtime Error: invalid type for argument 'second' in call to "+
+			"'builtin-function:sort_by_key': expected string, found int")
+}
+
+func TestFormatTable(t *testing.T) {
+	// columns are as wide as their widest cell, and separated by two spaces
+	expectRun(t, `out = format_table([["apple", "3"], ["kiwi", "12"]])`,
+		nil, "apple  3\nkiwi   12")
+
+	// the header is followed by a separator line
+	expectRun(t, `out = format_table([["alice", 30], ["bob", 4.5]], ["name", "age"])`,
+		nil, "name   age\n-----  ---\nalice  30\nbob    4.5")
+	expectRun(t, `out = format_table([], ["id", "name"])`,
+		nil, "id  name\n--  ----")
+
+	// short rows are padded with empty cells
+	expectRun(t, `out = format_table([["a"], ["b", "c", "d"], [], ["éé", undefined, "f"]])`,
+		nil, "a\nb   c  d\n\néé     f")
+	expectRun(t, `out = format_table([])`, nil, "")
+
+	// the size limit applies to the table without trailing spaces
+	tengo.MaxStringLen = 8
+	expectRun(t, `out = format_table([["ab", ""], ["c", "d"]])`,
+		nil, "ab\nc   d")
+	expectError(t, `format_table([["apple", "3"], ["kiwi", "12"]])`,
+		nil, "exceeding string size limit")
+	expectError(t, `format_table([], ["id", "name"])`,
+		nil, "exceeding string size limit")
+	tengo.MaxStringLen = 2147483647
+
+	expectRun(t, `out = format_table([["a"], "b"])`,
+		nil, errorObject("row 1 is not an array: string"))
+	expectError(t, `format_table()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:format_table'")
+	expectError(t, `format_table([], "h")`, nil,
+		"Runtime Error: invalid type for argument 'second' in call to "+
+			"'builtin-function:format_table': expected array, found string")
+}
+
+func TestSplitLines(t *testing.T) {
+	expectRun(t, `out = split_lines("a\nb\nc")`, nil, ARR{"a", "b", "c"})
+
+	// CRLF and LF line endings can be mixed
+	expectRun(t, `out = split_lines("a\r\nb\nc\r\nd")`,
+		nil, ARR{"a", "b", "c", "d"})
+
+	// a trailing newline doesn't add an empty line, but blank lines are kept
+	expectRun(t, `out = split_lines("a\nb\n")`, nil, ARR{"a", "b"})
+	expectRun(t, `out = split_lines("a\r\n\r\nb\r\n")`,
+		nil, ARR{"a", "", "b"})
+	expectRun(t, `out = split_lines("\n")`, nil, ARR{""})
+	expectRun(t, `out = split_lines("\n\n")`, nil, ARR{"", ""})
+
+	// a carriage return not followed by a newline is part of the line
+	expectRun(t, `out = split_lines("a\rb\nc\r")`, nil, ARR{"a\rb", "c\r"})
+
+	expectRun(t, `out = split_lines("")`, nil, ARR{})
+	expectRun(t, `out = split_lines("abc")`, nil, ARR{"abc"})
+
+	expectError(t, `split_lines()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:split_lines'")
+	expectError(t, `split_lines(1)`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:split_lines': expected string, found int")
+}
+
+func TestJoinLines(t *testing.T) {
+	expectRun(t, `out = join_lines(["a", "b", "c"])`, nil, "a\nb\nc")
+	expectRun(t, `out = join_lines(["a", "b"], "\r\n")`, nil, "a\r\nb")
+	expectRun(t, `out = join_lines(["x", 1, 2.5, true])`,
+		nil, "x\n1\n2.5\ntrue")
+	expectRun(t, `out = join_lines(["a"])`, nil, "a")
+	expectRun(t, `out = join_lines([])`, nil, "")
+
+	// split_lines reverses join_lines, and normalizes line endings
+	expectRun(t, `out = join_lines(split_lines("a\r\nb\nc\n"))`,
+		nil, "a\nb\nc")
+
+	expectError(t, `join_lines()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:join_lines'")
+	expectError(t, `join_lines("a")`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:join_lines': expected array, found string")
+	expectError(t, `join_lines(["a"], 1)`, nil,
+		"Runtime Error: invalid type for argument 'second' in call to "+
+			"'builtin-function:join_lines': expected string, found int")
+	expectError(t, `join_lines(["a", undefined])`, nil,
+		"Runtime Error: invalid type for argument 'first[1]' in call to "+
+			"'builtin-function:join_lines': expected string(compatible), "+
+			"found undefined")
+}
+
+func TestParseQuery(t *testing.T) {
+	expectRun(t, `out = parse_query("a=1&b=two")`,
+		nil, MAP{"a": ARR{"1"}, "b": ARR{"two"}})
+
+	// repeated keys keep all their values in order
+	expectRun(t, `out = parse_query("tag=x&id=7&tag=y&tag=z")`,
+		nil, MAP{"tag": ARR{"x", "y", "z"}, "id": ARR{"7"}})
+
+	// empty values, and keys without a value
+	expectRun(t, `out = parse_query("a=&b&c=3")`,
+		nil, MAP{"a": ARR{""}, "b": ARR{""}, "c": ARR{"3"}})
+	expectRun(t, `out = parse_query("")`, nil, MAP{})
+
+	// escapes are decoded, and a leading question mark is ignored
+	expectRun(t, `out = parse_query("?q=a+b%26c%3Dd&%C3%A9=%E2%9C%93")`,
+		nil, MAP{"q": ARR{"a b&c=d"}, "é": ARR{"✓"}})
+
+	expectRun(t, `out = parse_query("a=%zz")`,
+		nil, errorObject(`invalid URL escape "%zz"`))
+	expectRun(t, `out = parse_query("a=1;b=2")`,
+		nil, errorObject("invalid semicolon separator in query"))
+	expectError(t, `parse_query()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:parse_query'")
+	expectError(t, `parse_query(1)`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:parse_query': expected string, found int")
+}
+
+func TestBuildQuery(t *testing.T) {
+	// keys are sorted, and arrays give repeated keys
+	expectRun(t, `out = build_query({b: "two", a: 1, tag: ["x", "y"]})`,
+		nil, "a=1&b=two&tag=x&tag=y")
+	expectRun(t, `out = build_query({a: "", b: []})`, nil, "a=")
+	expectRun(t, `out = build_query({})`, nil, "")
+	expectRun(t, `out = build_query(immutable({ok: true, n: 1.5}))`,
+		nil, "n=1.5&ok=true")
+
+	// special characters are escaped
+	expectRun(t, `out = build_query({q: "a b&c=d/e?f#g%", "k y": "é✓"})`,
+		nil, "k+y=%C3%A9%E2%9C%93&q=a+b%26c%3Dd%2Fe%3Ff%23g%25")
+
+	// and round-trip through parse_query
+	expectRun(t, `
+		q := {q: ["a b&c=d", "+%;#"], "é=?": [""], "": ["x"]}
+		out = parse_query(build_query(q)) == q`, nil, true)
+
+	expectError(t, `build_query()`, nil,
+		"Runtime Error: wrong number of arguments in call to "+
+			"'builtin-function:build_query'")
+	expectError(t, `build_query("a=1")`, nil,
+		"Runtime Error: invalid type for argument 'first' in call to "+
+			"'builtin-function:build_query': expected map, found string")
+	expectError(t, `build_query({a: [1, undefined]})`, nil,
+		"Runtime Error: invalid type for argument 'first[\"a\"]' in call to "+
+			"'builtin-function:build_query': expected string(compatible) "+
+			"or array, found undefined")
+}